@@ -1,6 +1,8 @@
 package main
 
 import (
+	"os"
+
 	"github.com/vladyslavpavlenko/genesis-api-project/internal/app"
 	"github.com/vladyslavpavlenko/genesis-api-project/internal/app/config"
 	"github.com/vladyslavpavlenko/genesis-api-project/pkg/logger"
@@ -8,6 +10,14 @@ import (
 )
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		l := logger.New(false)
+		if err := app.Migrate(os.Args[2:], os.Stdout, l); err != nil {
+			l.Fatal("failed to migrate database", zap.Error(err))
+		}
+		return
+	}
+
 	a := config.New()
 	l := logger.New(true)
 
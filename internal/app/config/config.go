@@ -1,7 +1,15 @@
 package config
 
+import "time"
+
 // Config holds the application config.
-type Config struct{}
+type Config struct {
+	// AdminToken is the bearer token required by the admin API. The admin API is
+	// disabled when the token is empty.
+	AdminToken string
+	// StreamHeartbeat is the interval of the heartbeats of the rate streams.
+	StreamHeartbeat time.Duration
+}
 
 // New creates a new Config.
 func New() *Config {
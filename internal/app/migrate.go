@@ -0,0 +1,186 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"github.com/vladyslavpavlenko/genesis-api-project/internal/email"
+	"github.com/vladyslavpavlenko/genesis-api-project/internal/storage/gormstorage"
+	"github.com/vladyslavpavlenko/genesis-api-project/pkg/logger"
+	"go.uber.org/zap"
+)
+
+const migrateTimeout = 10 * time.Minute
+
+var errMigrateUsage = errors.New("usage: migrate up | down [steps] | status")
+
+// Migrate runs the `migrate` command with the given arguments:
+//
+//	up            applies all the pending migrations
+//	down [steps]  reverts the last applied migrations, one by default
+//	status        lists the migrations along with whether they are applied
+//
+// The output is written to w.
+func Migrate(args []string, w io.Writer, l *logger.Logger) error {
+	if len(args) == 0 {
+		return errMigrateUsage
+	}
+
+	envs, err := readEnv()
+	if err != nil {
+		return fmt.Errorf("error reading the .env file: %w", err)
+	}
+
+	dbConn, err := connectDB(&envs, l)
+	if err != nil {
+		return fmt.Errorf("error conntecting to the database: %w", err)
+	}
+	defer dbConn.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), migrateTimeout)
+	defer cancel()
+
+	switch args[0] {
+	case "up":
+		normalizer, err := email.NewNormalizer(envs.EmailPlusTags)
+		if err != nil {
+			return fmt.Errorf("error creating email normalizer: %w", err)
+		}
+		return migrateUp(ctx, dbConn, normalizer, w, l)
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			steps, err = strconv.Atoi(args[1])
+			if err != nil || steps < 1 {
+				return errMigrateUsage
+			}
+		}
+		return migrateDown(ctx, dbConn, steps, w)
+	case "status":
+		return migrateStatus(ctx, dbConn, w)
+	default:
+		return errMigrateUsage
+	}
+}
+
+// migrateUp applies the pending migrations, normalizes the subscriptions, and
+// reseals the stored email addresses with the current keys, which cannot be done in
+// SQL. The subscriptions are normalized and resealed under the migration lock, so that
+// concurrent replicas do not rewrite the same rows.
+func migrateUp(ctx context.Context, conn *gormstorage.Connection, normalizer *email.Normalizer, w io.Writer,
+	l *logger.Logger,
+) error {
+	m, err := conn.Migrator()
+	if err != nil {
+		return err
+	}
+
+	normalize := func(emailAddr string) (string, error) {
+		addr, err := normalizer.Normalize(emailAddr)
+		return addr.Normalized, err
+	}
+
+	applied, err := m.UpAndRun(ctx, func(context.Context) error {
+		merged, err := conn.NormalizeSubscriptions(normalize)
+		if err != nil {
+			return fmt.Errorf("error normalizing subscriptions: %w", err)
+		}
+		if merged > 0 {
+			l.Info("merged duplicate subscriptions", zap.Int("count", merged))
+		}
+
+		// Encrypt the addresses stored so far, or rewrap them after the keys have changed
+		resealed, err := conn.Reseal(normalize)
+		if err != nil {
+			return fmt.Errorf("error resealing email addresses: %w", err)
+		}
+		if resealed > 0 {
+			l.Info("resealed email addresses", zap.Int("count", resealed))
+		}
+
+		return nil
+	})
+	for _, mig := range applied {
+		fmt.Fprintf(w, "applied %s\n", mig)
+	}
+	if err != nil {
+		return err
+	}
+	if len(applied) == 0 {
+		fmt.Fprintln(w, "no pending migrations")
+	}
+
+	return nil
+}
+
+func migrateDown(ctx context.Context, conn *gormstorage.Connection, steps int, w io.Writer) error {
+	m, err := conn.Migrator()
+	if err != nil {
+		return err
+	}
+
+	reverted, err := m.Down(ctx, steps)
+	for _, mig := range reverted {
+		fmt.Fprintf(w, "reverted %s\n", mig)
+	}
+	if err != nil {
+		return err
+	}
+	if len(reverted) == 0 {
+		fmt.Fprintln(w, "no applied migrations")
+	}
+
+	return nil
+}
+
+func migrateStatus(ctx context.Context, conn *gormstorage.Connection, w io.Writer) error {
+	m, err := conn.Migrator()
+	if err != nil {
+		return err
+	}
+
+	statuses, err := m.Status(ctx)
+	if err != nil {
+		return err
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "MIGRATION\tAPPLIED AT")
+	for _, s := range statuses {
+		appliedAt := "pending"
+		if s.Applied {
+			appliedAt = s.AppliedAt.UTC().Format(time.RFC3339)
+		}
+		fmt.Fprintf(tw, "%s\t%s\n", s.Migration, appliedAt)
+	}
+
+	return tw.Flush()
+}
+
+// checkMigrations makes sure that the database schema is up to date, so that the
+// application never runs against a schema it does not expect.
+func checkMigrations(conn *gormstorage.Connection) error {
+	m, err := conn.Migrator()
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), gormstorage.RequestTimeout)
+	defer cancel()
+
+	pending, err := m.Pending(ctx)
+	if err != nil {
+		return fmt.Errorf("error checking database migrations: %w", err)
+	}
+	if len(pending) > 0 {
+		return fmt.Errorf("database schema is out of date, %d migrations are pending (run `migrate up`)",
+			len(pending))
+	}
+
+	return nil
+}
@@ -11,6 +11,7 @@ import (
 	"time"
 
 	"github.com/vladyslavpavlenko/genesis-api-project/internal/app/config"
+	"github.com/vladyslavpavlenko/genesis-api-project/internal/bounce"
 
 	"github.com/vladyslavpavlenko/genesis-api-project/pkg/logger"
 	"go.uber.org/zap"
@@ -18,6 +19,7 @@ import (
 	"github.com/vladyslavpavlenko/genesis-api-project/internal/notifier"
 	schedulerpkg "github.com/vladyslavpavlenko/genesis-api-project/pkg/scheduler"
 
+	"github.com/vladyslavpavlenko/genesis-api-project/internal/outbox"
 	producerpkg "github.com/vladyslavpavlenko/genesis-api-project/internal/outbox/producer"
 
 	consumerpkg "github.com/vladyslavpavlenko/genesis-api-project/internal/email/consumer"
@@ -30,8 +32,15 @@ const (
 	apiPort         = 8080
 	metricsPort     = 8081
 	mailingSchedule = "0 10 * * *" // every day at 10 AM
+
+	bouncePollInterval   = time.Minute
+	sagaRecoveryInterval = time.Minute
 )
 
+// retryDelays are the delays of the email retry tiers. Emails that still fail after
+// the last tier are dead-lettered.
+var retryDelays = []time.Duration{time.Minute, 10 * time.Minute, time.Hour}
+
 // scheduler is an interface for task scheduling.
 type scheduler interface {
 	Schedule(schedule string, task func()) (cron.EntryID, error)
@@ -58,6 +67,9 @@ func Run(app *config.Config, l *logger.Logger) error {
 		return err
 	}
 	defer svcs.DBConn.Close()
+	if svcs.SMTPPool != nil {
+		defer svcs.SMTPPool.Close()
+	}
 
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
@@ -69,8 +81,9 @@ func Run(app *config.Config, l *logger.Logger) error {
 	s.Start()
 	defer s.Stop()
 
-	kafkaURL := os.Getenv("KAFKA_URL")
+	kafkaURL := svcs.Env.KafkaURL
 	kafkaTopic := "emails-topic"
+	retryPolicy := consumerpkg.NewRetryPolicy(kafkaTopic, retryDelays...)
 
 	kafkaProducer, err := producerpkg.NewKafkaProducer(kafkaURL, svcs.Outbox, svcs.DBConn, l)
 	if err != nil {
@@ -78,28 +91,67 @@ func Run(app *config.Config, l *logger.Logger) error {
 	}
 	defer kafkaProducer.Writer.Close()
 
-	err = kafkaProducer.NewTopic(kafkaTopic, 1, 1)
-	if err != nil {
-		return fmt.Errorf("failed to create topic: %w", err)
+	for _, topic := range append([]string{kafkaTopic}, retryPolicy.Topics()...) {
+		err = kafkaProducer.NewTopic(topic, svcs.Env.KafkaPartitions, svcs.Env.KafkaReplicationFactor)
+		if err != nil {
+			return fmt.Errorf("failed to create topic %s: %w", topic, err)
+		}
 	}
 	kafkaProducer.SetTopic(kafkaTopic)
 	go eventProducer(ctx, kafkaProducer, kafkaTopic, 1, l)
 
+	// The subscription and rate events are published to the downstream services
+	for stream, topic := range map[string]string{
+		outbox.StreamSubscriptions: "subscriptions-topic",
+		outbox.StreamRates:         "rates-topic",
+	} {
+		streamProducer, err := newStreamProducer(svcs, topic, stream, l)
+		if err != nil {
+			return err
+		}
+		defer streamProducer.Writer.Close()
+
+		go eventProducer(ctx, streamProducer, topic, 1, l)
+	}
+
+	// The sampler closes the rate streams once the context is canceled on shutdown
+	go svcs.RateSampler.Run(ctx)
+
 	kafkaGroupID := "emails-group"
 
 	kafkaConsumer, err := consumerpkg.NewKafkaConsumer(
-		kafkaURL,
-		kafkaTopic,
-		0,
-		kafkaGroupID,
+		consumerpkg.Config{
+			KafkaURL: kafkaURL,
+			Topic:    kafkaTopic,
+			GroupID:  kafkaGroupID,
+			Workers:  svcs.Env.ConsumerWorkers,
+			Retry:    retryPolicy,
+			Keys:     svcs.DBConn.Keyring(),
+		},
 		svcs.Sender,
+		svcs.Templates,
+		svcs.Charts,
+		svcs.Bounces,
 		svcs.DBConn,
 		l)
 	if err != nil {
 		return fmt.Errorf("failed to create kafka consumer: %w", err)
 	}
-	defer kafkaConsumer.Reader.Close()
-	go eventConsumer(ctx, kafkaConsumer, l)
+	defer kafkaConsumer.Close()
+	defer svcs.DeadLetters.Writer.Close()
+
+	go svcs.Sagas.Recover(ctx, sagaRecoveryInterval)
+
+	if dir := svcs.Env.BounceMaildir; dir != "" {
+		poller := bounce.NewMaildirPoller(dir, svcs.Bounces, l)
+		go poller.Poll(ctx, bouncePollInterval)
+	}
+
+	consumerDone := make(chan struct{})
+	go func() {
+		defer close(consumerDone)
+		eventConsumer(ctx, kafkaConsumer, l)
+	}()
 
 	apiServer := &http.Server{
 		Addr:              fmt.Sprintf(":%d", apiPort),
@@ -115,6 +167,9 @@ func Run(app *config.Config, l *logger.Logger) error {
 
 	shutdown(apiServer, metricsServer, cancel, l)
 
+	// Wait for the in-flight emails to be processed
+	<-consumerDone
+
 	return nil
 }
 
@@ -173,6 +228,25 @@ func scheduleEmails(s scheduler, n *notifier.Notifier, l *logger.Logger) error {
 	return nil
 }
 
+// newStreamProducer creates a producer of the outbox stream to the topic. The events
+// are published decrypted, as the downstream services do not hold the keys.
+func newStreamProducer(svcs *services, topic, stream string, l *logger.Logger) (*producerpkg.KafkaProducer, error) {
+	p, err := producerpkg.NewKafkaProducer(svcs.Env.KafkaURL, svcs.Outbox, svcs.DBConn, l)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create kafka producer: %w", err)
+	}
+
+	if err = p.NewTopic(topic, svcs.Env.KafkaPartitions, svcs.Env.KafkaReplicationFactor); err != nil {
+		p.Writer.Close()
+		return nil, fmt.Errorf("failed to create topic %s: %w", topic, err)
+	}
+	p.SetTopic(topic)
+	p.SetStream(stream)
+	p.Decrypt(svcs.DBConn.Keyring())
+
+	return p, nil
+}
+
 // eventProducer runs an event dispatcher.
 func eventProducer(ctx context.Context, producer producer, topic string, partition int, l *logger.Logger) {
 	producer.Produce(ctx, 10*time.Second, topic, partition)
@@ -182,11 +256,9 @@ func eventProducer(ctx context.Context, producer producer, topic string, partiti
 	l.Info("shutting down event producer...")
 }
 
-// eventConsumer runs an event dispatcher.
+// eventConsumer runs an event consumer until the context is canceled and all the
+// in-flight events are processed.
 func eventConsumer(ctx context.Context, c consumer, l *logger.Logger) {
-	go c.Consume(ctx)
-
-	// Wait for context cancellation to handle graceful shutdown
-	<-ctx.Done()
-	l.Info("shutting down event consumer...")
+	c.Consume(ctx)
+	l.Info("event consumer has been shut down")
 }
@@ -1,12 +1,22 @@
 package app
 
 import (
+	"encoding/base64"
+	"errors"
 	"fmt"
 	"net/http"
+	"strings"
+	"time"
 
 	"github.com/vladyslavpavlenko/genesis-api-project/internal/app/config"
+	"github.com/vladyslavpavlenko/genesis-api-project/internal/bounce"
+	"github.com/vladyslavpavlenko/genesis-api-project/internal/privacy"
+	"github.com/vladyslavpavlenko/genesis-api-project/internal/sagaadmin"
 
+	"github.com/vladyslavpavlenko/genesis-api-project/pkg/dkim"
+	"github.com/vladyslavpavlenko/genesis-api-project/pkg/envelope"
 	"github.com/vladyslavpavlenko/genesis-api-project/pkg/logger"
+	"github.com/vladyslavpavlenko/genesis-api-project/pkg/saga"
 
 	"github.com/vladyslavpavlenko/genesis-api-project/internal/subscriber/gormsubscriber"
 
@@ -16,20 +26,26 @@ import (
 	"github.com/vladyslavpavlenko/genesis-api-project/internal/outbox/gormoutbox"
 	producerpkg "github.com/vladyslavpavlenko/genesis-api-project/internal/outbox/producer"
 
-	outboxpkg "github.com/vladyslavpavlenko/genesis-api-project/internal/outbox"
+	consumerpkg "github.com/vladyslavpavlenko/genesis-api-project/internal/email/consumer"
 
-	"github.com/vladyslavpavlenko/genesis-api-project/internal/models"
 	"github.com/vladyslavpavlenko/genesis-api-project/internal/rateapi"
 	"github.com/vladyslavpavlenko/genesis-api-project/internal/rateapi/chain"
-	"gopkg.in/gomail.v2"
+	"github.com/vladyslavpavlenko/genesis-api-project/internal/ratechart"
+	"github.com/vladyslavpavlenko/genesis-api-project/internal/ratefeed"
 
 	"github.com/kelseyhightower/envconfig"
 	"github.com/vladyslavpavlenko/genesis-api-project/internal/email"
+	senderchain "github.com/vladyslavpavlenko/genesis-api-project/internal/email/chain"
+	"github.com/vladyslavpavlenko/genesis-api-project/internal/email/preview"
+	"github.com/vladyslavpavlenko/genesis-api-project/internal/email/templates"
+	"github.com/vladyslavpavlenko/genesis-api-project/internal/email/transport"
 	handlerspkg "github.com/vladyslavpavlenko/genesis-api-project/internal/handlers"
 )
 
 // envVariables holds environment variables used in the application.
 type envVariables struct {
+	DBDriver  string `envconfig:"DB_DRIVER" default:"postgres"`
+	DBPath    string `envconfig:"DB_PATH" default:"genesis.db"`
 	DBURL     string `envconfig:"DB_URL"`
 	DBPort    string `envconfig:"DB_PORT"`
 	DBUser    string `envconfig:"DB_USER"`
@@ -37,16 +53,64 @@ type envVariables struct {
 	DBName    string `envconfig:"DB_NAME"`
 	EmailAddr string `envconfig:"EMAIL_ADDR"`
 	EmailPass string `envconfig:"EMAIL_PASS"`
+	KafkaURL  string `envconfig:"KAFKA_URL"`
+	AdminKey  string `envconfig:"ADMIN_TOKEN"`
+
+	EncryptionKeys string `envconfig:"ENCRYPTION_KEYS"`
+	BlindIndexKey  string `envconfig:"BLIND_INDEX_KEY"`
+
+	KafkaPartitions        int `envconfig:"KAFKA_PARTITIONS" default:"3"`
+	KafkaReplicationFactor int `envconfig:"KAFKA_REPLICATION_FACTOR" default:"1"`
+	ConsumerWorkers        int `envconfig:"CONSUMER_WORKERS" default:"4"`
+
+	RateEpsilon         float64       `envconfig:"RATE_EPSILON" default:"0.01"`
+	RateSampleInterval  time.Duration `envconfig:"RATE_SAMPLE_INTERVAL" default:"10s"`
+	RateStreamHeartbeat time.Duration `envconfig:"RATE_STREAM_HEARTBEAT" default:"15s"`
+	RateStreamPairs     string        `envconfig:"RATE_STREAM_PAIRS" default:"USD/UAH,EUR/UAH,PLN/UAH,USD/EUR"`
+
+	BounceThreshold int    `envconfig:"BOUNCE_THRESHOLD" default:"3"`
+	BounceMaildir   string `envconfig:"BOUNCE_MAILDIR"`
+
+	EmailTemplatesDir string `envconfig:"EMAIL_TEMPLATES_DIR"`
+	EmailPlusTags     string `envconfig:"EMAIL_PLUS_TAGS" default:"keep"`
+
+	EmailSenders  []string `envconfig:"EMAIL_SENDERS" default:"smtp"`
+	EmailAPIURL   string   `envconfig:"EMAIL_API_URL"`
+	EmailAPIKey   string   `envconfig:"EMAIL_API_KEY"`
+	SendmailPath  string   `envconfig:"SENDMAIL_PATH" default:"/usr/sbin/sendmail"`
+	EmailMboxPath string   `envconfig:"EMAIL_MBOX_PATH" default:"emails.mbox"`
+
+	DKIMDomain   string   `envconfig:"DKIM_DOMAIN"`
+	DKIMSelector string   `envconfig:"DKIM_SELECTOR"`
+	DKIMKeyFile  string   `envconfig:"DKIM_KEY_FILE"`
+	DKIMHeaders  []string `envconfig:"DKIM_HEADERS"`
+
+	SMTPHost               string `envconfig:"SMTP_HOST" default:"smtp.gmail.com"`
+	SMTPPort               int    `envconfig:"SMTP_PORT" default:"587"`
+	SMTPUsername           string `envconfig:"SMTP_USERNAME"`
+	SMTPPassword           string `envconfig:"SMTP_PASSWORD"`
+	SMTPAuth               string `envconfig:"SMTP_AUTH" default:"plain"`
+	SMTPTLS                string `envconfig:"SMTP_TLS" default:"starttls"`
+	SMTPPoolSize           int    `envconfig:"SMTP_POOL_SIZE" default:"4"`
+	SMTPMaxMessagesPerConn int    `envconfig:"SMTP_MAX_MESSAGES_PER_CONN" default:"100"`
 }
 
 type services struct {
-	DBConn     *gormstorage.Connection
-	Sender     *email.GomailSender
-	Fetcher    *chain.Node
-	Notifier   *notifierpkg.Notifier
-	Subscriber *gormsubscriber.Subscriber
-	Outbox     producerpkg.Outbox
-	Handlers   *handlerspkg.Handlers
+	Env         envVariables
+	DBConn      *gormstorage.Connection
+	Sender      email.Sender
+	SMTPPool    *transport.Pool
+	Templates   *templates.Renderer
+	Charts      *ratechart.Renderer
+	Fetcher     *chain.Node
+	Notifier    *notifierpkg.Notifier
+	RateSampler *ratefeed.Sampler
+	Subscriber  *gormsubscriber.Subscriber
+	Sagas       *saga.Orchestrator
+	Outbox      producerpkg.Outbox
+	DeadLetters *consumerpkg.DeadLetterQueue
+	Bounces     *bounce.Processor
+	Handlers    *handlerspkg.Handlers
 }
 
 func setup(app *config.Config, l *logger.Logger) (*services, error) {
@@ -55,58 +119,101 @@ func setup(app *config.Config, l *logger.Logger) (*services, error) {
 		return nil, fmt.Errorf("error reading the .env file: %w", err)
 	}
 
-	dsn := fmt.Sprintf("host=%s port=%s user=%s password=%s dbname=%s sslmode=disable timezone=UTC connect_timeout=5",
-		envs.DBURL,
-		envs.DBPort,
-		envs.DBUser,
-		envs.DBPass,
-		envs.DBName)
-
-	dbConn, err := connectDB(dsn, l)
+	dbConn, err := connectDB(&envs, l)
 	if err != nil {
 		return nil, fmt.Errorf("error conntecting to the database: %w", err)
 	}
 
-	err = migrateDB(dbConn, l)
+	err = checkMigrations(dbConn)
+	if err != nil {
+		return nil, err
+	}
+
+	normalizer, err := email.NewNormalizer(envs.EmailPlusTags)
 	if err != nil {
-		return nil, fmt.Errorf("error runnning database migrations: %w", err)
+		return nil, fmt.Errorf("error creating email normalizer: %w", err)
 	}
 
 	fetcher := setupFetchersChain(&http.Client{}, l)
 
-	sender, err := setupSender(&envs)
+	sender, smtpPool, err := setupSenders(&envs, &http.Client{})
 	if err != nil {
 		return nil, fmt.Errorf("failed set up sender: %w", err)
 	}
 
-	outbox, err := gormoutbox.New(dbConn)
+	outbox, err := gormoutbox.New(dbConn, dbConn.Keyring())
 	if err != nil {
 		return nil, fmt.Errorf("failed to create outbox: %w", err)
 	}
 
-	subscriber, err := gormsubscriber.NewSubscriber(dbConn.DB(), l)
+	sagas := saga.NewOrchestrator(dbConn, l)
+
+	subscriber, err := gormsubscriber.NewSubscriber(dbConn.DB(), normalizer, dbConn.Keyring(), fetcher, sagas, l)
 	if err != nil {
 		return nil, fmt.Errorf("failed to setup subscriber service: %w", err)
 	}
 
-	notifier := notifierpkg.NewNotifier(subscriber, fetcher, outbox)
+	notifier := notifierpkg.NewNotifier(subscriber, fetcher, outbox, dbConn, dbConn)
+
+	rateSampler := ratefeed.NewSampler(fetcher, envs.RateSampleInterval, l)
+	ratePublisher := ratefeed.NewPublisher(outbox, envs.RateEpsilon, l)
+	rateSampler.Observe(ratefeed.DefaultPair, ratePublisher.Publish)
+	if err = allowStreamPairs(rateSampler, envs.RateStreamPairs); err != nil {
+		return nil, fmt.Errorf("failed to set up rate stream: %w", err)
+	}
+
+	charts := ratechart.NewRenderer(dbConn)
+
+	tmpl := templates.New(envs.EmailTemplatesDir)
+
+	previews := preview.NewService(tmpl, fetcher, dbConn, charts, sender)
+
+	bounces := bounce.NewProcessor(dbConn, envs.BounceThreshold, l)
+
+	deadLetters := consumerpkg.NewDeadLetterQueue(envs.KafkaURL, dbConn)
+
+	subjects := privacy.NewService(dbConn, normalizer, dbConn.Keyring(), l)
+
+	sagaAdmin := sagaadmin.NewService(dbConn, sagas, normalizer)
+
+	app.AdminToken = envs.AdminKey
+	app.StreamHeartbeat = envs.RateStreamHeartbeat
 
 	handlers := handlerspkg.NewHandlers(
 		app,
 		&handlerspkg.Services{
-			Fetcher:    fetcher,
-			Notifier:   notifier,
-			Subscriber: subscriber,
+			Fetcher:     fetcher,
+			Charts:      charts,
+			Notifier:    notifier,
+			Subscriber:  subscriber,
+			DeadLetters: deadLetters,
+			Deliveries:  dbConn,
+			Bounces:     bounces,
+			Suppression: dbConn,
+			Previews:    previews,
+			Privacy:     subjects,
+			Sagas:       sagaAdmin,
+			RateStream:  rateSampler,
 		},
 		l,
 	)
 
 	return &services{
-		DBConn:   dbConn,
-		Sender:   sender,
-		Fetcher:  fetcher,
-		Outbox:   outbox,
-		Handlers: handlers,
+		Env:         envs,
+		DBConn:      dbConn,
+		Sender:      sender,
+		SMTPPool:    smtpPool,
+		Templates:   tmpl,
+		Charts:      charts,
+		Fetcher:     fetcher,
+		Notifier:    notifier,
+		RateSampler: rateSampler,
+		Subscriber:  subscriber,
+		Sagas:       sagas,
+		Outbox:      outbox,
+		DeadLetters: deadLetters,
+		Bounces:     bounces,
+		Handlers:    handlers,
 	}, nil
 }
 
@@ -120,43 +227,167 @@ func readEnv() (envVariables, error) {
 	return envs, nil
 }
 
-// connectDB sets up a GORM database connection and returns an interface.
-func connectDB(dsn string, l *logger.Logger) (*gormstorage.Connection, error) {
+// connectDB sets up a GORM database connection of the DB_DRIVER. The SQLite
+// database is stored at DB_PATH.
+func connectDB(envs *envVariables, l *logger.Logger) (*gormstorage.Connection, error) {
 	var conn gormstorage.Connection
 
-	err := conn.Setup(dsn, l)
+	dsn := envs.DBPath
+	if envs.DBDriver == gormstorage.DriverPostgres {
+		dsn = fmt.Sprintf("host=%s port=%s user=%s password=%s dbname=%s sslmode=disable timezone=UTC connect_timeout=5",
+			envs.DBURL,
+			envs.DBPort,
+			envs.DBUser,
+			envs.DBPass,
+			envs.DBName)
+	}
+
+	keys, err := setupKeyring(envs)
+	if err != nil {
+		return nil, err
+	}
+
+	err = conn.Setup(envs.DBDriver, dsn, l)
 	if err != nil {
 		return nil, err
 	}
+	conn.UseKeyring(keys)
 
 	return &conn, nil
 }
 
-// migrateDB runs database migrations.
-func migrateDB(conn *gormstorage.Connection, l *logger.Logger) error {
-	l.Debug("running migrations...")
-
-	err := conn.Migrate(&models.Subscription{}, &outboxpkg.Event{})
+// setupKeyring sets up the envelope.Keyring the stored email addresses are encrypted
+// with. Without ENCRYPTION_KEYS, the addresses are stored in plain text.
+func setupKeyring(envs *envVariables) (*envelope.Keyring, error) {
+	keys, err := envelope.ParseKeys(envs.EncryptionKeys)
 	if err != nil {
-		return fmt.Errorf("error running migrations: %w", err)
+		return nil, fmt.Errorf("error parsing ENCRYPTION_KEYS: %w", err)
 	}
 
-	l.Debug("database migrated!")
+	var indexKey []byte
+	if envs.BlindIndexKey != "" {
+		indexKey, err = base64.StdEncoding.DecodeString(envs.BlindIndexKey)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing BLIND_INDEX_KEY: %w", err)
+		}
+	}
 
-	return nil
+	keyring, err := envelope.New(keys, indexKey)
+	if err != nil {
+		return nil, fmt.Errorf("error creating keyring: %w", err)
+	}
+	return keyring, nil
 }
 
-// setupSender sets up a Sender service.
-func setupSender(envs *envVariables) (sender *email.GomailSender, err error) {
+// setupSenders sets up a chain of responsibility for the senders listed in the
+// EMAIL_SENDERS variable. The SMTP pool is only created if the SMTP sender is used.
+func setupSenders(envs *envVariables, c *http.Client) (*senderchain.Node, *transport.Pool, error) {
 	emailConfig, err := email.NewEmailConfig(envs.EmailAddr, envs.EmailPass)
 	if err != nil {
-		return nil, fmt.Errorf("error creating email config: %w", err)
+		return nil, nil, fmt.Errorf("error creating email config: %w", err)
 	}
 
-	return &email.GomailSender{
-		Dialer: gomail.NewDialer("smtp.gmail.com", 587, envs.EmailAddr, envs.EmailPass),
-		Config: emailConfig,
-	}, nil
+	signer, err := setupSigner(envs)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var (
+		nodes    []*senderchain.Node
+		smtpPool *transport.Pool
+	)
+	for _, name := range envs.EmailSenders {
+		var sender email.Sender
+
+		switch name {
+		case "smtp":
+			if smtpPool == nil {
+				smtpPool, err = setupSMTPPool(envs, signer)
+				if err != nil {
+					return nil, nil, err
+				}
+			}
+			sender = &email.GomailSender{Dialer: smtpPool, Config: emailConfig}
+		case "http":
+			if envs.EmailAPIURL == "" {
+				return nil, nil, errors.New("EMAIL_API_URL is required by the http sender")
+			}
+			sender = email.NewHTTPSender(c, envs.EmailAPIURL, envs.EmailAPIKey, emailConfig)
+		case "sendmail":
+			sendmail := email.NewSendmailSender(envs.SendmailPath, emailConfig)
+			sendmail.Signer = signer
+			sender = sendmail
+		case "file":
+			file := email.NewFileSender(envs.EmailMboxPath, emailConfig)
+			file.Signer = signer
+			sender = file
+		default:
+			return nil, nil, fmt.Errorf("unknown email sender %q", name)
+		}
+
+		nodes = append(nodes, senderchain.NewNode(name, sender))
+	}
+
+	if len(nodes) == 0 {
+		return nil, nil, errors.New("no email senders configured")
+	}
+
+	return senderchain.New(nodes...), smtpPool, nil
+}
+
+// setupSigner sets up a DKIM signer if DKIM_KEY_FILE is set. The signing domain
+// defaults to the domain of the sender.
+func setupSigner(envs *envVariables) (email.Signer, error) {
+	if envs.DKIMKeyFile == "" {
+		return nil, nil
+	}
+
+	key, err := dkim.LoadKey(envs.DKIMKeyFile)
+	if err != nil {
+		return nil, err
+	}
+
+	domain := envs.DKIMDomain
+	if domain == "" {
+		_, domain, _ = strings.Cut(envs.EmailAddr, "@")
+	}
+
+	signer, err := dkim.NewSigner(dkim.Config{
+		Domain:   domain,
+		Selector: envs.DKIMSelector,
+		Headers:  envs.DKIMHeaders,
+	}, key)
+	if err != nil {
+		return nil, fmt.Errorf("error creating dkim signer: %w", err)
+	}
+
+	return signer, nil
+}
+
+// setupSMTPPool sets up a pool of SMTP connections. The SMTP credentials default to
+// the sender's ones.
+func setupSMTPPool(envs *envVariables, signer email.Signer) (*transport.Pool, error) {
+	username, password := envs.SMTPUsername, envs.SMTPPassword
+	if username == "" {
+		username, password = envs.EmailAddr, envs.EmailPass
+	}
+
+	pool, err := transport.NewPool(transport.Config{
+		Host:               envs.SMTPHost,
+		Port:               envs.SMTPPort,
+		Username:           username,
+		Password:           password,
+		Auth:               envs.SMTPAuth,
+		TLS:                envs.SMTPTLS,
+		PoolSize:           envs.SMTPPoolSize,
+		MaxMessagesPerConn: envs.SMTPMaxMessagesPerConn,
+		Signer:             signer,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error creating smtp pool: %w", err)
+	}
+
+	return pool, nil
 }
 
 // setupFetchersChain sets up a chain of responsibility for fetchers.
@@ -179,3 +410,17 @@ func setupFetchersChain(c *http.Client, l *logger.Logger) *chain.Node {
 
 	return coinbaseNode
 }
+
+// allowStreamPairs allows the comma-separated pairs to be streamed by the sampler.
+func allowStreamPairs(sampler *ratefeed.Sampler, list string) error {
+	var pairs []ratefeed.Pair
+	for _, name := range strings.Split(list, ",") {
+		p, err := ratefeed.ParsePair(name)
+		if err != nil {
+			return fmt.Errorf("invalid pair %q: %w", name, err)
+		}
+		pairs = append(pairs, p)
+	}
+
+	return sampler.Allow(pairs)
+}
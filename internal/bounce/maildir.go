@@ -0,0 +1,82 @@
+package bounce
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/vladyslavpavlenko/genesis-api-project/pkg/logger"
+	"go.uber.org/zap"
+)
+
+// MaildirPoller periodically processes the bounce and complaint messages delivered
+// to a local Maildir mailbox. Processed messages are moved from `new` to `cur`.
+type MaildirPoller struct {
+	dir       string
+	processor *Processor
+	l         *logger.Logger
+}
+
+// NewMaildirPoller creates a new MaildirPoller for the Maildir at dir.
+func NewMaildirPoller(dir string, p *Processor, l *logger.Logger) *MaildirPoller {
+	return &MaildirPoller{dir: dir, processor: p, l: l}
+}
+
+// Poll processes the mailbox every interval until the context is canceled.
+func (m *MaildirPoller) Poll(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		m.processNew()
+
+		select {
+		case <-ctx.Done():
+			m.l.Info("shutting down maildir poller...")
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// processNew processes all the new messages of the mailbox.
+func (m *MaildirPoller) processNew() {
+	entries, err := os.ReadDir(filepath.Join(m.dir, "new"))
+	if err != nil {
+		m.l.Error("failed to read maildir", zap.String("dir", m.dir), zap.Error(err))
+		return
+	}
+
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+
+		if err = m.processFile(entry.Name()); err != nil {
+			m.l.Error("failed to process bounce message", zap.String("file", entry.Name()), zap.Error(err))
+		}
+	}
+}
+
+// processFile processes a single message and moves it to `cur`. Messages that are not
+// reports are moved as well, so they are not processed over and over again.
+func (m *MaildirPoller) processFile(name string) error {
+	path := filepath.Join(m.dir, "new", name)
+
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+
+	events, err := m.processor.ProcessMessage(f)
+	f.Close()
+	if err != nil {
+		m.l.Warn("skipping message", zap.String("file", name), zap.Error(err))
+	} else {
+		m.l.Debug("bounce message processed", zap.String("file", name), zap.Int("events", len(events)))
+	}
+
+	// The `2,S` info marks the message as seen
+	return os.Rename(path, filepath.Join(m.dir, "cur", name+":2,S"))
+}
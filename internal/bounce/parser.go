@@ -0,0 +1,232 @@
+package bounce
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/mail"
+	"net/textproto"
+	"strings"
+)
+
+const (
+	TypeHardBounce = "hard_bounce"
+	TypeSoftBounce = "soft_bounce"
+	TypeComplaint  = "complaint"
+)
+
+var ErrUnsupportedReport = errors.New("message is neither a delivery status nor a feedback report")
+
+// Event is a bounce or a complaint concerning a single recipient.
+type Event struct {
+	Email      string `json:"email"`
+	Type       string `json:"type"` // TypeHardBounce, TypeSoftBounce, TypeComplaint
+	Status     string `json:"status,omitempty"`
+	Diagnostic string `json:"diagnostic,omitempty"`
+}
+
+// Parse parses a raw RFC 822 message that is either a delivery status notification
+// (RFC 3464) or an abuse feedback report (RFC 5965) and returns the events it reports.
+// Successful delivery notifications yield no events.
+func Parse(r io.Reader) ([]Event, error) {
+	msg, err := mail.ReadMessage(r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read message: %w", err)
+	}
+
+	mediaType, params, err := mime.ParseMediaType(msg.Header.Get("Content-Type"))
+	if err != nil || mediaType != "multipart/report" {
+		return nil, ErrUnsupportedReport
+	}
+
+	mr := multipart.NewReader(msg.Body, params["boundary"])
+
+	switch strings.ToLower(params["report-type"]) {
+	case "delivery-status":
+		return parseDeliveryStatus(mr)
+	case "feedback-report":
+		return parseFeedbackReport(mr)
+	default:
+		return nil, ErrUnsupportedReport
+	}
+}
+
+// parseDeliveryStatus parses the parts of a delivery status notification.
+func parseDeliveryStatus(mr *multipart.Reader) ([]Event, error) {
+	var events []Event
+
+	err := eachPart(mr, func(mediaType string, part io.Reader) error {
+		if mediaType != "message/delivery-status" && mediaType != "message/global-delivery-status" {
+			return nil
+		}
+
+		groups, err := readFieldGroups(part)
+		if err != nil {
+			return err
+		}
+
+		// Per-message fields have no recipient, so they are skipped
+		for _, fields := range groups {
+			if e, ok := deliveryStatusEvent(fields); ok {
+				events = append(events, e)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return events, nil
+}
+
+// deliveryStatusEvent converts the per-recipient fields of a delivery status
+// notification to an Event. It returns false if the delivery has not failed.
+func deliveryStatusEvent(fields textproto.MIMEHeader) (Event, bool) {
+	recipient := fields.Get("Final-Recipient")
+	if recipient == "" {
+		recipient = fields.Get("Original-Recipient")
+	}
+
+	e := Event{
+		Email:      parseAddress(recipient),
+		Status:     fields.Get("Status"),
+		Diagnostic: fields.Get("Diagnostic-Code"),
+	}
+	if e.Email == "" {
+		return Event{}, false
+	}
+
+	switch action := strings.ToLower(fields.Get("Action")); {
+	case action == "failed" && strings.HasPrefix(e.Status, "5"):
+		e.Type = TypeHardBounce
+	case action == "failed" || action == "delayed":
+		e.Type = TypeSoftBounce
+	default:
+		return Event{}, false
+	}
+
+	return e, true
+}
+
+// parseFeedbackReport parses the parts of an abuse feedback report. The recipients
+// are taken from the Original-Rcpt-To fields, falling back to the To header of the
+// original message.
+func parseFeedbackReport(mr *multipart.Reader) ([]Event, error) {
+	var (
+		feedbackType string
+		recipients   []string
+		originalTo   string
+	)
+
+	err := eachPart(mr, func(mediaType string, part io.Reader) error {
+		switch mediaType {
+		case "message/feedback-report":
+			groups, err := readFieldGroups(part)
+			if err != nil {
+				return err
+			}
+			feedbackType = groups[0].Get("Feedback-Type")
+			recipients = append(recipients, groups[0].Values("Original-Rcpt-To")...)
+		case "message/rfc822", "text/rfc822-headers":
+			original, err := textproto.NewReader(bufio.NewReader(part)).ReadMIMEHeader()
+			if err != nil && !errors.Is(err, io.EOF) {
+				return nil // the original message is optional
+			}
+			originalTo = original.Get("To")
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if len(recipients) == 0 && originalTo != "" {
+		recipients = append(recipients, originalTo)
+	}
+
+	events := make([]Event, 0, len(recipients))
+	for _, r := range recipients {
+		addr := parseAddress(r)
+		if addr == "" {
+			continue
+		}
+		events = append(events, Event{
+			Email:      addr,
+			Type:       TypeComplaint,
+			Diagnostic: "feedback-type: " + feedbackType,
+		})
+	}
+
+	return events, nil
+}
+
+// eachPart calls fn for every part of the multipart message.
+func eachPart(mr *multipart.Reader, fn func(mediaType string, part io.Reader) error) error {
+	for {
+		part, err := mr.NextPart()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read report part: %w", err)
+		}
+
+		mediaType, _, err := mime.ParseMediaType(part.Header.Get("Content-Type"))
+		if err != nil {
+			mediaType = "text/plain"
+		}
+
+		if err = fn(strings.ToLower(mediaType), part); err != nil {
+			return err
+		}
+	}
+}
+
+// readFieldGroups reads the blank line separated groups of header fields used by
+// delivery status notifications and feedback reports.
+func readFieldGroups(r io.Reader) ([]textproto.MIMEHeader, error) {
+	tr := textproto.NewReader(bufio.NewReader(r))
+
+	var groups []textproto.MIMEHeader
+	for {
+		fields, err := tr.ReadMIMEHeader()
+		if len(fields) > 0 {
+			groups = append(groups, fields)
+		}
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read report fields: %w", err)
+		}
+	}
+
+	if len(groups) == 0 {
+		return nil, errors.New("report has no fields")
+	}
+
+	return groups, nil
+}
+
+// parseAddress extracts the email address from a field value such as
+// `rfc822; user@example.com` or `<user@example.com>`.
+func parseAddress(v string) string {
+	if i := strings.Index(v, ";"); i >= 0 {
+		v = v[i+1:]
+	}
+	v = strings.TrimSpace(v)
+
+	if addr, err := mail.ParseAddress(v); err == nil {
+		return strings.ToLower(addr.Address)
+	}
+
+	v = strings.Trim(v, "<>")
+	if !strings.Contains(v, "@") {
+		return ""
+	}
+	return strings.ToLower(v)
+}
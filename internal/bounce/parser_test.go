@@ -0,0 +1,104 @@
+package bounce_test
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/vladyslavpavlenko/genesis-api-project/internal/bounce"
+)
+
+const dsn = "From: MAILER-DAEMON@mx.example.com\r\n" +
+	"To: rates@example.com\r\n" +
+	"Subject: Undelivered Mail Returned to Sender\r\n" +
+	"MIME-Version: 1.0\r\n" +
+	"Content-Type: multipart/report; report-type=delivery-status; boundary=\"b1\"\r\n" +
+	"\r\n" +
+	"--b1\r\n" +
+	"Content-Type: text/plain\r\n" +
+	"\r\n" +
+	"Your message could not be delivered.\r\n" +
+	"--b1\r\n" +
+	"Content-Type: message/delivery-status\r\n" +
+	"\r\n" +
+	"Reporting-MTA: dns; mx.example.com\r\n" +
+	"\r\n" +
+	"Final-Recipient: rfc822; Gone@Example.com\r\n" +
+	"Action: failed\r\n" +
+	"Status: 5.1.1\r\n" +
+	"Diagnostic-Code: smtp; 550 5.1.1 user unknown\r\n" +
+	"\r\n" +
+	"Final-Recipient: rfc822; busy@example.com\r\n" +
+	"Action: delayed\r\n" +
+	"Status: 4.2.2\r\n" +
+	"\r\n" +
+	"Final-Recipient: rfc822; ok@example.com\r\n" +
+	"Action: delivered\r\n" +
+	"Status: 2.0.0\r\n" +
+	"--b1--\r\n"
+
+const arf = "From: abuse@isp.example\r\n" +
+	"To: rates@example.com\r\n" +
+	"MIME-Version: 1.0\r\n" +
+	"Content-Type: multipart/report; report-type=feedback-report; boundary=\"b2\"\r\n" +
+	"\r\n" +
+	"--b2\r\n" +
+	"Content-Type: text/plain\r\n" +
+	"\r\n" +
+	"This is an abuse report.\r\n" +
+	"--b2\r\n" +
+	"Content-Type: message/feedback-report\r\n" +
+	"\r\n" +
+	"Feedback-Type: abuse\r\n" +
+	"User-Agent: SomeGenerator/1.0\r\n" +
+	"Version: 1\r\n" +
+	"\r\n" +
+	"--b2\r\n" +
+	"Content-Type: text/rfc822-headers\r\n" +
+	"\r\n" +
+	"From: rates@example.com\r\n" +
+	"To: Angry User <angry@example.com>\r\n" +
+	"Subject: USD to UAH Exchange Rate\r\n" +
+	"\r\n" +
+	"--b2--\r\n"
+
+func TestParse_DeliveryStatus(t *testing.T) {
+	events, err := bounce.Parse(strings.NewReader(dsn))
+	require.NoError(t, err)
+
+	assert.Equal(t, []bounce.Event{
+		{
+			Email:      "gone@example.com",
+			Type:       bounce.TypeHardBounce,
+			Status:     "5.1.1",
+			Diagnostic: "smtp; 550 5.1.1 user unknown",
+		},
+		{
+			Email:  "busy@example.com",
+			Type:   bounce.TypeSoftBounce,
+			Status: "4.2.2",
+		},
+	}, events)
+}
+
+func TestParse_FeedbackReport(t *testing.T) {
+	events, err := bounce.Parse(strings.NewReader(arf))
+	require.NoError(t, err)
+
+	assert.Equal(t, []bounce.Event{
+		{
+			Email:      "angry@example.com",
+			Type:       bounce.TypeComplaint,
+			Diagnostic: "feedback-type: abuse",
+		},
+	}, events)
+}
+
+func TestParse_Unsupported(t *testing.T) {
+	msg := "From: someone@example.com\r\nContent-Type: text/plain\r\n\r\nHello!\r\n"
+
+	_, err := bounce.Parse(strings.NewReader(msg))
+	assert.True(t, errors.Is(err, bounce.ErrUnsupportedReport))
+}
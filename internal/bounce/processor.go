@@ -0,0 +1,112 @@
+package bounce
+
+import (
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/VictoriaMetrics/metrics"
+	"github.com/vladyslavpavlenko/genesis-api-project/internal/models"
+	"github.com/vladyslavpavlenko/genesis-api-project/pkg/logger"
+	"go.uber.org/zap"
+)
+
+var suppressedCounter = metrics.NewCounter("suppressed_emails_count")
+
+// store defines an interface for the bounce and suppression storage.
+type store interface {
+	AddBounce(b *models.Bounce) error
+	CountBounces(email, bounceType string) (int64, error)
+	AddSuppression(s *models.Suppression) error
+}
+
+// Processor records bounces and complaints and suppresses the email addresses that
+// either complained or bounced permanently too many times.
+type Processor struct {
+	db        store
+	threshold int
+	l         *logger.Logger
+}
+
+// NewProcessor creates a new Processor. An email address is suppressed after the
+// threshold number of hard bounces.
+func NewProcessor(db store, threshold int, l *logger.Logger) *Processor {
+	if threshold < 1 {
+		threshold = 1
+	}
+	return &Processor{db: db, threshold: threshold, l: l}
+}
+
+// ProcessMessage parses a raw delivery status notification or feedback report and
+// processes the events it reports.
+func (p *Processor) ProcessMessage(r io.Reader) ([]Event, error) {
+	events, err := Parse(r)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, e := range events {
+		if err = p.Process(e); err != nil {
+			return nil, err
+		}
+	}
+
+	return events, nil
+}
+
+// RecordSendFailure processes a permanent SMTP failure to send an email as a hard bounce.
+func (p *Processor) RecordSendFailure(email string, cause error) error {
+	return p.Process(Event{
+		Email:      email,
+		Type:       TypeHardBounce,
+		Diagnostic: cause.Error(),
+	})
+}
+
+// Process records the event and suppresses its email address if needed.
+func (p *Processor) Process(e Event) error {
+	err := p.db.AddBounce(&models.Bounce{
+		Email:      e.Email,
+		Type:       e.Type,
+		Status:     e.Status,
+		Diagnostic: e.Diagnostic,
+		CreatedAt:  time.Now(),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to add bounce: %w", err)
+	}
+
+	p.l.Info("bounce received", zap.String("type", e.Type), zap.String("status", e.Status))
+
+	switch e.Type {
+	case TypeComplaint:
+		return p.suppress(e.Email, models.SuppressionReasonComplaint)
+	case TypeHardBounce:
+		count, err := p.db.CountBounces(e.Email, TypeHardBounce)
+		if err != nil {
+			return fmt.Errorf("failed to count bounces: %w", err)
+		}
+		if count >= int64(p.threshold) {
+			return p.suppress(e.Email, models.SuppressionReasonHardBounces)
+		}
+	}
+
+	return nil
+}
+
+// suppress adds the email address to the suppression list.
+func (p *Processor) suppress(email, reason string) error {
+	err := p.db.AddSuppression(&models.Suppression{
+		Email:     email,
+		Reason:    reason,
+		CreatedAt: time.Now(),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to add suppression: %w", err)
+	}
+
+	suppressedCounter.Inc()
+	p.l.Info("email address suppressed", zap.String("reason", reason))
+
+	return nil
+}
@@ -0,0 +1,95 @@
+package chain
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/VictoriaMetrics/metrics"
+	"github.com/vladyslavpavlenko/genesis-api-project/internal/email"
+)
+
+// Chain interface defines a chain of responsibility for sending emails.
+type Chain interface {
+	email.Sender
+	Name() string
+	SetNext(Chain)
+}
+
+// Node is a concrete implementation of the Chain interface. If its sender fails to
+// send an email, the email is sent by the next node.
+type Node struct {
+	name   string
+	sender email.Sender
+	next   Chain
+}
+
+// NewNode creates a new Node with the given email.Sender.
+func NewNode(name string, sender email.Sender) *Node {
+	return &Node{
+		name:   name,
+		sender: sender,
+	}
+}
+
+// Name returns the name of the node's sender.
+func (n *Node) Name() string {
+	return n.name
+}
+
+// SetNext sets the next chain in the responsibility chain.
+func (n *Node) SetNext(next Chain) {
+	n.next = next
+}
+
+// Send sends the email and fails over to the next chain if necessary. It returns the
+// reply of the sender that has sent the email. If every sender fails, the error of the
+// last one is returned.
+func (n *Node) Send(params email.Params) (string, error) {
+	reply, err := n.sender.Send(params)
+	if err == nil {
+		sentCounter(n.name).Inc()
+		return reply, nil
+	}
+	failedCounter(n.name).Inc()
+
+	next := n.next
+	if next == nil {
+		return "", fmt.Errorf("%s: %w", n.name, err)
+	}
+
+	failoverCounter(n.name, next.Name()).Inc()
+	return next.Send(params)
+}
+
+// New links the nodes in the given order, exports the order in the
+// `email_sender_chain_info` metric and returns the first node.
+func New(nodes ...*Node) *Node {
+	if len(nodes) == 0 {
+		return nil
+	}
+
+	names := make([]string, 0, len(nodes))
+	for i, n := range nodes {
+		names = append(names, n.name)
+		if i > 0 {
+			nodes[i-1].SetNext(n)
+		}
+	}
+
+	metrics.GetOrCreateGauge(fmt.Sprintf(`email_sender_chain_info{chain=%q}`, strings.Join(names, ",")),
+		func() float64 { return 1 })
+
+	return nodes[0]
+}
+
+func sentCounter(sender string) *metrics.Counter {
+	return metrics.GetOrCreateCounter(fmt.Sprintf(`emails_sent_via_sender_count{sender=%q}`, sender))
+}
+
+func failedCounter(sender string) *metrics.Counter {
+	return metrics.GetOrCreateCounter(fmt.Sprintf(`emails_failed_via_sender_count{sender=%q}`, sender))
+}
+
+func failoverCounter(from, to string) *metrics.Counter {
+	return metrics.GetOrCreateCounter(fmt.Sprintf(`email_sender_failovers_count{from=%q,to=%q}`, from, to))
+}
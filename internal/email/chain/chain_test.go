@@ -0,0 +1,80 @@
+package chain_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/vladyslavpavlenko/genesis-api-project/internal/email"
+	"github.com/vladyslavpavlenko/genesis-api-project/internal/email/chain"
+)
+
+type MockSender struct {
+	Reply string
+	Err   error
+	Calls int
+}
+
+func (m *MockSender) Send(_ email.Params) (string, error) {
+	m.Calls++
+	if m.Err != nil {
+		return "", m.Err
+	}
+	return m.Reply, nil
+}
+
+func TestNode_Send(t *testing.T) {
+	tests := []struct {
+		name          string
+		senders       []*MockSender
+		expectedCalls []int
+		expectedReply string
+		expectedError string
+	}{
+		{
+			name:          "primary succeeds",
+			senders:       []*MockSender{{Reply: "250 queued as A1"}, {Reply: "250 queued as B1"}},
+			expectedCalls: []int{1, 0},
+			expectedReply: "250 queued as A1",
+		},
+		{
+			name:          "fail over to the next sender",
+			senders:       []*MockSender{{Err: errors.New("554 relay denied")}, {Reply: "250 queued as B1"}},
+			expectedCalls: []int{1, 1},
+			expectedReply: "250 queued as B1",
+		},
+		{
+			name: "every sender fails",
+			senders: []*MockSender{
+				{Err: errors.New("554 relay denied")},
+				{Err: errors.New("connection refused")},
+			},
+			expectedCalls: []int{1, 1},
+			expectedError: "second: connection refused",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			first := chain.NewNode("first", tt.senders[0])
+			second := chain.NewNode("second", tt.senders[1])
+			c := chain.New(first, second)
+
+			reply, err := c.Send(email.Params{To: "recipient@example.com"})
+			if tt.expectedError == "" {
+				assert.NoError(t, err)
+				assert.Equal(t, tt.expectedReply, reply)
+			} else {
+				assert.EqualError(t, err, tt.expectedError)
+			}
+
+			for i, s := range tt.senders {
+				assert.Equal(t, tt.expectedCalls[i], s.Calls)
+			}
+		})
+	}
+}
+
+func TestNew_Empty(t *testing.T) {
+	assert.Nil(t, chain.New())
+}
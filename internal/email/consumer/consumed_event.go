@@ -1,16 +1,37 @@
 package consumer
 
 import (
+	"errors"
 	"time"
 
 	"github.com/vladyslavpavlenko/genesis-api-project/internal/outbox"
 )
 
-// ConsumedEvent represents an event consumed by the consumer.
+const (
+	ConsumedEventStatusPending = "pending"
+	ConsumedEventStatusDone    = "done"
+)
+
+var (
+	// ErrEventAlreadyConsumed is returned when an event with the same ID or idempotency
+	// key has already been consumed.
+	ErrEventAlreadyConsumed = errors.New("event already consumed")
+
+	// ErrEventInProgress is returned when an event with the same ID or idempotency key
+	// is being consumed by another worker, e.g. while the partitions are rebalanced.
+	ErrEventInProgress = errors.New("event is being consumed")
+)
+
+// ConsumedEvent represents an event consumed by the consumer. An event is claimed
+// as pending until its email is sent, so the claim of a consumer that has crashed
+// expires after ClaimedUntil.
 type ConsumedEvent struct {
-	ID         uint         `gorm:"not null;index"`
-	Event      outbox.Event `gorm:"foreignKey:ID" json:"-"`
-	Data       string
-	ConsumedAt time.Time
-	UpdatedAt  time.Time
+	ID             uint         `gorm:"primaryKey;autoIncrement:false"`
+	Event          outbox.Event `gorm:"foreignKey:ID" json:"-"`
+	IdempotencyKey *string      `gorm:"uniqueIndex"`
+	Data           string
+	Status         string `gorm:"default:done"` // ConsumedEventStatusPending, ConsumedEventStatusDone
+	ClaimedUntil   *time.Time
+	ConsumedAt     time.Time
+	UpdatedAt      time.Time
 }
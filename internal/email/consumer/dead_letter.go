@@ -0,0 +1,81 @@
+package consumer
+
+import (
+	"context"
+	"strconv"
+
+	"github.com/pkg/errors"
+	"github.com/segmentio/kafka-go"
+	"github.com/vladyslavpavlenko/genesis-api-project/internal/models"
+	"github.com/vladyslavpavlenko/genesis-api-project/internal/outbox"
+)
+
+// ErrDeadLetterNotFound is returned by the deadLetterStore when there is no dead
+// letter with the given ID.
+var ErrDeadLetterNotFound = errors.New("dead letter not found")
+
+// deadLetterStore defines an interface for the dead-letter storage.
+type deadLetterStore interface {
+	GetDeadLetters(limit, offset int) ([]models.DeadLetter, error)
+	GetDeadLetter(id uint) (models.DeadLetter, error)
+	DeleteDeadLetter(id uint) error
+}
+
+// DeadLetterQueue provides the means to inspect, replay, and discard dead-lettered
+// messages.
+type DeadLetterQueue struct {
+	db     deadLetterStore
+	Writer messageWriter
+}
+
+// NewDeadLetterQueue creates a new DeadLetterQueue.
+func NewDeadLetterQueue(kafkaURL string, db deadLetterStore) *DeadLetterQueue {
+	return &DeadLetterQueue{
+		db: db,
+		Writer: &kafka.Writer{
+			Addr:     kafka.TCP(kafkaURL),
+			Balancer: &kafka.Hash{},
+		},
+	}
+}
+
+// GetDeadLetters returns a paginated list of dead letters.
+func (q *DeadLetterQueue) GetDeadLetters(limit, offset int) ([]models.DeadLetter, error) {
+	return q.db.GetDeadLetters(limit, offset)
+}
+
+// GetDeadLetter returns a dead letter by its ID.
+func (q *DeadLetterQueue) GetDeadLetter(id uint) (models.DeadLetter, error) {
+	return q.db.GetDeadLetter(id)
+}
+
+// ReplayDeadLetter republishes the dead letter to its original topic with a fresh
+// retry budget and removes it from the queue.
+func (q *DeadLetterQueue) ReplayDeadLetter(ctx context.Context, id uint) error {
+	dl, err := q.GetDeadLetter(id)
+	if err != nil {
+		return err
+	}
+
+	err = q.Writer.WriteMessages(ctx, kafka.Message{
+		Topic: dl.Topic,
+		Key:   []byte(dl.Key),
+		Value: []byte(dl.Value),
+		Headers: []kafka.Header{
+			{Key: outbox.HeaderEventID, Value: []byte(strconv.FormatUint(uint64(dl.EventID), 10))},
+		},
+	})
+	if err != nil {
+		return errors.Wrap(err, "failed to republish dead letter")
+	}
+
+	return q.db.DeleteDeadLetter(id)
+}
+
+// DiscardDeadLetter removes the dead letter from the queue without replaying it.
+func (q *DeadLetterQueue) DiscardDeadLetter(id uint) error {
+	if _, err := q.GetDeadLetter(id); err != nil {
+		return err
+	}
+	return q.db.DeleteDeadLetter(id)
+}
@@ -0,0 +1,89 @@
+package consumer_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/vladyslavpavlenko/genesis-api-project/internal/email/consumer"
+	"github.com/vladyslavpavlenko/genesis-api-project/internal/models"
+	"github.com/vladyslavpavlenko/genesis-api-project/internal/outbox"
+)
+
+type mockDeadLetterStore struct {
+	deadLetters map[uint]models.DeadLetter
+}
+
+func (m *mockDeadLetterStore) GetDeadLetters(_, _ int) ([]models.DeadLetter, error) {
+	dls := make([]models.DeadLetter, 0, len(m.deadLetters))
+	for _, dl := range m.deadLetters {
+		dls = append(dls, dl)
+	}
+	return dls, nil
+}
+
+func (m *mockDeadLetterStore) GetDeadLetter(id uint) (models.DeadLetter, error) {
+	dl, ok := m.deadLetters[id]
+	if !ok {
+		return models.DeadLetter{}, consumer.ErrDeadLetterNotFound
+	}
+	return dl, nil
+}
+
+func (m *mockDeadLetterStore) DeleteDeadLetter(id uint) error {
+	delete(m.deadLetters, id)
+	return nil
+}
+
+func newDeadLetterQueue() (*consumer.DeadLetterQueue, *mockDeadLetterStore, *mockWriter) {
+	store := &mockDeadLetterStore{deadLetters: map[uint]models.DeadLetter{
+		7: {ID: 7, EventID: 42, Topic: "emails-topic", Key: "key", Value: "value", Attempts: 3},
+	}}
+	writer := &mockWriter{}
+
+	q := consumer.NewDeadLetterQueue("localhost:9092", store)
+	q.Writer = writer
+	return q, store, writer
+}
+
+func TestDeadLetterQueue_ReplayDeadLetter(t *testing.T) {
+	q, store, writer := newDeadLetterQueue()
+
+	require.NoError(t, q.ReplayDeadLetter(context.Background(), 7))
+
+	// The message is republished with a fresh retry budget
+	require.Len(t, writer.messages, 1)
+	m := writer.messages[0]
+	assert.Equal(t, "emails-topic", m.Topic)
+	assert.Equal(t, "key", string(m.Key))
+	assert.Equal(t, "value", string(m.Value))
+	assert.Equal(t, "42", headerOf(m, outbox.HeaderEventID))
+	assert.Empty(t, headerOf(m, consumer.HeaderAttempt))
+
+	assert.Empty(t, store.deadLetters)
+
+	err := q.ReplayDeadLetter(context.Background(), 7)
+	assert.ErrorIs(t, err, consumer.ErrDeadLetterNotFound)
+}
+
+func TestDeadLetterQueue_ReplayDeadLetter_WriteFailed(t *testing.T) {
+	q, store, writer := newDeadLetterQueue()
+	writer.err = errors.New("broker unavailable")
+
+	// The dead letter is kept unless it is republished
+	err := q.ReplayDeadLetter(context.Background(), 7)
+	assert.ErrorContains(t, err, "broker unavailable")
+	assert.Contains(t, store.deadLetters, uint(7))
+}
+
+func TestDeadLetterQueue_DiscardDeadLetter(t *testing.T) {
+	q, store, writer := newDeadLetterQueue()
+
+	require.NoError(t, q.DiscardDeadLetter(7))
+	assert.Empty(t, store.deadLetters)
+	assert.Empty(t, writer.messages)
+
+	assert.ErrorIs(t, q.DiscardDeadLetter(7), consumer.ErrDeadLetterNotFound)
+}
@@ -0,0 +1,55 @@
+package consumer
+
+import (
+	"context"
+
+	"github.com/segmentio/kafka-go"
+	"github.com/vladyslavpavlenko/genesis-api-project/pkg/logger"
+)
+
+// OffsetTracker exposes offsetTracker for testing.
+type OffsetTracker = offsetTracker
+
+var NewOffsetTracker = newOffsetTracker
+
+func (t *offsetTracker) Track(partition int, offset int64) {
+	t.track(partition, offset)
+}
+
+func (t *offsetTracker) Complete(partition int, offset int64) (int64, bool) {
+	return t.complete(partition, offset)
+}
+
+func (t *offsetTracker) Refetched(partition int, offset int64) bool {
+	return t.refetched(partition, offset)
+}
+
+func (t *offsetTracker) Reset() {
+	t.reset()
+}
+
+// NewTestConsumer creates a KafkaConsumer without the readers, so the processing of
+// the messages can be tested without a broker.
+func NewTestConsumer(cfg Config, sender sender, tmpl renderer, bounces bounceRecorder, db dbConnection,
+	w messageWriter,
+) *KafkaConsumer {
+	return &KafkaConsumer{
+		Writer:  w,
+		Sender:  sender,
+		tmpl:    tmpl,
+		bounces: bounces,
+		policy:  cfg.Retry,
+		keys:    cfg.Keys,
+		workers: 1,
+		db:      db,
+		l:       logger.New(false),
+	}
+}
+
+func (c *KafkaConsumer) Process(ctx context.Context, m kafka.Message) error {
+	return c.process(ctx, m)
+}
+
+func (c *KafkaConsumer) ProcessUntilHandedOver(ctx context.Context, m kafka.Message) bool {
+	return c.processUntilHandedOver(ctx, context.WithoutCancel(ctx), m)
+}
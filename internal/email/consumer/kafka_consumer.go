@@ -3,10 +3,16 @@ package consumer
 import (
 	"context"
 	"fmt"
+	"hash/fnv"
+	"strconv"
+	"sync"
 	"time"
 
 	"github.com/VictoriaMetrics/metrics"
 
+	"github.com/vladyslavpavlenko/genesis-api-project/internal/models"
+	"github.com/vladyslavpavlenko/genesis-api-project/pkg/chart"
+	"github.com/vladyslavpavlenko/genesis-api-project/pkg/envelope"
 	"github.com/vladyslavpavlenko/genesis-api-project/pkg/logger"
 	"go.uber.org/zap"
 
@@ -15,6 +21,7 @@ import (
 	"github.com/vladyslavpavlenko/genesis-api-project/internal/outbox"
 
 	"github.com/vladyslavpavlenko/genesis-api-project/internal/email"
+	"github.com/vladyslavpavlenko/genesis-api-project/internal/email/templates"
 
 	"github.com/segmentio/kafka-go"
 )
@@ -22,51 +29,244 @@ import (
 var (
 	sentEmailsCounter    = metrics.NewCounter("sent_emails_count")
 	notSentEmailsCounter = metrics.NewCounter("not_sent_emails_count")
+	retriedEmailsCounter = metrics.NewCounter("retried_emails_count")
+	skippedEmailsCounter = metrics.NewCounter("skipped_duplicate_emails_count")
+	deadLettersCounter   = metrics.NewCounter("dead_letters_count")
+	processErrorsCounter = metrics.NewCounter("message_processing_errors_count")
 	emailSendingDuration = metrics.NewHistogram("email_sending_duration_seconds")
 	_                    = metrics.NewGauge("email_sending_success_rate", calculateEmailSuccessRate)
 )
 
+const (
+	// commitTimeout bounds a single offset commit.
+	commitTimeout = 10 * time.Second
+
+	// minProcessBackoff and maxProcessBackoff bound the delay before a message that
+	// could not be handed over, e.g. while the database is down, is processed again.
+	minProcessBackoff = time.Second
+	maxProcessBackoff = time.Minute
+
+	digestTemplate  = "digest"
+	welcomeTemplate = "welcome"
+
+	// chartCID is the content ID of the chart embedded into the digest.
+	chartCID = "chart.png"
+)
+
 type (
 	sender interface {
-		Send(params email.Params) error
+		Send(params email.Params) (string, error)
+	}
+
+	// messageWriter publishes messages to Kafka.
+	messageWriter interface {
+		WriteMessages(ctx context.Context, msgs ...kafka.Message) error
+		Close() error
+	}
+
+	// renderer renders email templates.
+	renderer interface {
+		Render(name, locale string, data any) (templates.Email, error)
+	}
+
+	// chartRenderer renders the PNG chart of the recent rates of a currency pair.
+	chartRenderer interface {
+		Chart(base, target string) ([]byte, error)
+	}
+
+	// bounceRecorder records permanent failures to deliver an email.
+	bounceRecorder interface {
+		RecordSendFailure(email string, cause error) error
 	}
 
 	dbConnection interface {
-		Migrate(models ...any) error
-		AddConsumedEvent(event ConsumedEvent) error
+		ConsumeOnce(event *ConsumedEvent, process func() error) error
+		AddDeadLetter(dl *models.DeadLetter) error
+		AddDelivery(d *models.Delivery) error
 	}
 )
 
 type KafkaConsumer struct {
-	db     dbConnection
-	Reader *kafka.Reader
-	Sender sender
-	l      *logger.Logger
+	db      dbConnection
+	Reader  *kafka.Reader
+	Retries []*kafka.Reader
+	Writer  messageWriter
+	Sender  sender
+	tmpl    renderer
+	charts  chartRenderer
+	bounces bounceRecorder
+	policy  RetryPolicy
+	keys    *envelope.Keyring
+	workers int
+	l       *logger.Logger
+}
+
+// Config holds the KafkaConsumer configuration.
+type Config struct {
+	KafkaURL string
+	Topic    string
+
+	// GroupID is the consumer group shared by all the replicas. The partitions of the
+	// topics are balanced between the members of the group.
+	GroupID string
+
+	// Workers is the number of messages of a single topic processed concurrently.
+	Workers int
+
+	// Retry is the policy applied to the messages that fail to be sent.
+	Retry RetryPolicy
+
+	// Keys decrypts the messages, which are encrypted by the outbox.
+	Keys *envelope.Keyring
 }
 
-// NewKafkaConsumer initializes a new KafkaConsumer.
-func NewKafkaConsumer(kafkaURL, topic string, partition int, groupID string,
-	sender sender, db dbConnection, l *logger.Logger,
+// NewKafkaConsumer initializes a new KafkaConsumer. Messages that fail to be sent
+// are republished to the retry tiers of the configured RetryPolicy and dead-lettered
+// once the retries are exhausted. Permanent failures are dead-lettered right away and
+// recorded as bounces.
+func NewKafkaConsumer(cfg Config, sender sender, tmpl renderer, charts chartRenderer, bounces bounceRecorder,
+	db dbConnection, l *logger.Logger,
 ) (*KafkaConsumer, error) {
-	reader := kafka.NewReader(kafka.ReaderConfig{
+	reader := newReader(cfg.KafkaURL, cfg.Topic, cfg.GroupID, l)
+
+	retries := make([]*kafka.Reader, 0, len(cfg.Retry.Tiers))
+	for _, tier := range cfg.Retry.Tiers {
+		retries = append(retries, newReader(cfg.KafkaURL, tier.Topic, cfg.GroupID, l))
+	}
+
+	writer := &kafka.Writer{
+		Addr:     kafka.TCP(cfg.KafkaURL),
+		Balancer: &kafka.Hash{},
+	}
+
+	workers := cfg.Workers
+	if workers < 1 {
+		workers = 1
+	}
+
+	return &KafkaConsumer{
+		Reader:  reader,
+		Retries: retries,
+		Writer:  writer,
+		Sender:  sender,
+		tmpl:    tmpl,
+		charts:  charts,
+		bounces: bounces,
+		policy:  cfg.Retry,
+		keys:    cfg.Keys,
+		workers: workers,
+		db:      db,
+		l:       l,
+	}, nil
+}
+
+// newReader creates a consumer group kafka.Reader for the given topic. The group
+// rebalancing events, including the partitions assigned to the reader, are logged.
+func newReader(kafkaURL, topic, groupID string, l *logger.Logger) *kafka.Reader {
+	return kafka.NewReader(kafka.ReaderConfig{
 		Brokers:        []string{kafkaURL},
 		Topic:          topic,
-		Partition:      partition,
 		GroupID:        groupID,
 		CommitInterval: 0, // disable auto-commit
+		Logger: kafka.LoggerFunc(func(msg string, args ...any) {
+			l.Debug(fmt.Sprintf(msg, args...), zap.String("topic", topic), zap.String("group_id", groupID))
+		}),
+		ErrorLogger: kafka.LoggerFunc(func(msg string, args ...any) {
+			l.Error(fmt.Sprintf(msg, args...), zap.String("topic", topic), zap.String("group_id", groupID))
+		}),
 	})
+}
 
-	err := db.Migrate(&ConsumedEvent{})
-	if err != nil {
-		return nil, errors.Wrap(err, "failed to migrate offset")
+// Close closes all the readers and the writer of the KafkaConsumer.
+func (c *KafkaConsumer) Close() error {
+	var errs []error
+	for _, r := range append([]*kafka.Reader{c.Reader}, c.Retries...) {
+		if err := r.Close(); err != nil {
+			errs = append(errs, err)
+		}
 	}
-
-	return &KafkaConsumer{Reader: reader, Sender: sender, db: db, l: l}, nil
+	if err := c.Writer.Close(); err != nil {
+		errs = append(errs, err)
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("failed to close consumer: %v", errs)
+	}
+	return nil
 }
 
 // Consume is a worker that consumes messages from Kafka and processes them
-// to send an email using the Sender interface.
+// to send an email using the Sender interface. The main topic and every retry
+// tier are consumed concurrently. Consume returns once all the in-flight messages
+// are processed after the context is canceled.
 func (c *KafkaConsumer) Consume(ctx context.Context) {
+	var wg sync.WaitGroup
+	for _, r := range c.Retries {
+		wg.Add(1)
+		go func(r *kafka.Reader) {
+			defer wg.Done()
+			c.consume(ctx, r)
+		}(r)
+	}
+
+	c.consume(ctx, c.Reader)
+	wg.Wait()
+}
+
+// consume reads messages from a single reader until the context is canceled and
+// dispatches them to a pool of workers. Messages with the same recipient are always
+// dispatched to the same worker, so they keep their order.
+//
+// An offset is committed only once its message and all the earlier messages of its
+// partition are either sent, republished to a retry tier, or dead-lettered. A message
+// that could not be handed over is retried in place, holding the commits of its
+// partition back, until it is handed over or the consumer shuts down, in which case
+// it is redelivered after a restart.
+func (c *KafkaConsumer) consume(ctx context.Context, r *kafka.Reader) {
+	// In-flight messages are drained after the context is canceled
+	workCtx := context.WithoutCancel(ctx)
+
+	tracker := newOffsetTracker()
+	results := make(chan kafka.Message, c.workers)
+
+	committerDone := make(chan struct{})
+	go func() {
+		defer close(committerDone)
+		c.commit(workCtx, r, tracker, results)
+	}()
+
+	queues := make([]chan kafka.Message, c.workers)
+	var wg sync.WaitGroup
+	for i := range queues {
+		queues[i] = make(chan kafka.Message, 1)
+		wg.Add(1)
+		go func(queue <-chan kafka.Message) {
+			defer wg.Done()
+			for m := range queue {
+				if c.processUntilHandedOver(ctx, workCtx, m) {
+					results <- m
+				}
+			}
+		}(queues[i])
+	}
+
+	c.fetch(ctx, r, tracker, queues)
+
+	for _, q := range queues {
+		close(q)
+	}
+	wg.Wait()
+	close(results)
+	<-committerDone
+
+	c.l.Info("consumer drained", zap.String("topic", r.Config().Topic))
+}
+
+// fetch reads messages from the reader and dispatches them to the worker queues
+// until the context is canceled.
+func (c *KafkaConsumer) fetch(ctx context.Context, r *kafka.Reader, tracker *offsetTracker, queues []chan kafka.Message) {
+	partitions := newPartitionObserver(r, c.l)
+	go partitions.collect(ctx)
+
 	for {
 		select {
 		case <-ctx.Done():
@@ -75,7 +275,7 @@ func (c *KafkaConsumer) Consume(ctx context.Context) {
 		default:
 		}
 
-		m, err := c.Reader.FetchMessage(ctx)
+		m, err := r.FetchMessage(ctx)
 		if err != nil {
 			if errors.Is(err, context.Canceled) {
 				c.l.Info("shutting down consumer...", zap.String("cause", "context canceled"))
@@ -85,45 +285,355 @@ func (c *KafkaConsumer) Consume(ctx context.Context) {
 			continue
 		}
 
-		start := time.Now()
+		// Messages from retry tiers are delayed until their due time
+		if err = waitNotBefore(ctx, m); err != nil {
+			c.l.Info("shutting down consumer...", zap.String("cause", "context canceled"))
+			return
+		}
 
-		data, err := outbox.DeserializeData(m.Value)
-		if err != nil {
-			c.l.Error("failed to deserialize data", zap.Int64("offset", m.Offset), zap.Error(err))
+		// The stats of the reader report a rebalance late, while a partition fetched
+		// again from its committed offset reports it as soon as it is reassigned
+		if partitions.observe(m) || tracker.refetched(m.Partition, m.Offset) {
+			// The offsets fetched before the rebalance may belong to another member now
+			tracker.reset()
+		}
+
+		tracker.track(m.Partition, m.Offset)
+		queues[workerOf(m, len(queues))] <- m
+	}
+}
+
+// commit commits the offsets of the processed messages in order.
+func (c *KafkaConsumer) commit(ctx context.Context, r *kafka.Reader, tracker *offsetTracker, results <-chan kafka.Message) {
+	for m := range results {
+		offset, ok := tracker.complete(m.Partition, m.Offset)
+		if !ok {
 			continue
 		}
 
-		err = c.sendMessage(data)
+		commitCtx, cancel := context.WithTimeout(ctx, commitTimeout)
+		err := r.CommitMessages(commitCtx, kafka.Message{Topic: m.Topic, Partition: m.Partition, Offset: offset})
+		cancel()
 		if err != nil {
-			notSentEmailsCounter.Inc()
-			c.l.Error("failed to send email", zap.Int64("offset", m.Offset), zap.Error(err))
-		} else {
-			sentEmailsCounter.Inc()
+			c.l.Error("failed to commit message",
+				zap.String("topic", m.Topic), zap.Int("partition", m.Partition), zap.Int64("offset", offset), zap.Error(err))
+			continue
+		}
+
+		c.l.Debug("offset committed",
+			zap.String("topic", m.Topic), zap.Int("partition", m.Partition), zap.Int64("offset", offset))
+	}
+}
+
+// processUntilHandedOver processes the message until it is handed over, backing off
+// between the attempts. It returns false if the consumer is shut down first, in which
+// case the message is not committed.
+func (c *KafkaConsumer) processUntilHandedOver(ctx, workCtx context.Context, m kafka.Message) bool {
+	backoff := minProcessBackoff
+	for {
+		err := c.process(workCtx, m)
+		if err == nil {
+			return true
 		}
 
-		// Record the duration it took to process the email
+		processErrorsCounter.Inc()
+		c.l.Error("failed to process message",
+			zap.String("topic", m.Topic), zap.Int64("offset", m.Offset), zap.Duration("backoff", backoff), zap.Error(err))
+
+		timer := time.NewTimer(backoff)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			c.l.Warn("message left uncommitted on shutdown", zap.String("topic", m.Topic),
+				zap.Int("partition", m.Partition), zap.Int64("offset", m.Offset))
+			return false
+		case <-timer.C:
+		}
+		backoff = min(2*backoff, maxProcessBackoff)
+	}
+}
+
+// workerOf returns the index of the worker the message is dispatched to. Messages
+// are routed by their key, which is the blind index of the recipient.
+func workerOf(m kafka.Message, workers int) int {
+	h := fnv.New32a()
+	_, _ = h.Write(m.Key)
+	return int(h.Sum32() % uint32(workers))
+}
+
+// process sends an email for the message. Each event is sent once: the event ID and
+// idempotency key are claimed before the sending and recorded as done after it, and
+// already recorded events are skipped. Failed messages are passed on to the next
+// retry tier or to the dead-letter queue. An error is returned only if the message
+// could not be handed over, so it must not be committed.
+func (c *KafkaConsumer) process(ctx context.Context, m kafka.Message) error {
+	eventID, err := eventIDOf(m)
+	if err != nil {
+		return c.deadLetter(m, attemptOf(m)+1, err)
+	}
+
+	value, err := c.keys.Open(string(m.Value))
+	if err != nil {
+		return c.deadLetter(m, attemptOf(m)+1, errors.Wrap(err, "failed to decrypt data"))
+	}
+
+	data, err := outbox.DeserializeData([]byte(value))
+	if err != nil {
+		// Malformed messages will never succeed, so there is no point in retrying them
+		return c.deadLetter(m, attemptOf(m)+1, errors.Wrap(err, "failed to deserialize data"))
+	}
+
+	// The data is stored as received, that is encrypted
+	event := &ConsumedEvent{
+		ID:         eventID,
+		Data:       string(m.Value),
+		ConsumedAt: time.Now(),
+	}
+	if key := data.IdempotencyKey(); key != "" {
+		key = c.keys.BlindIndex(key)
+		event.IdempotencyKey = &key
+	}
+
+	start := time.Now()
+
+	var (
+		sent    bool
+		reply   string
+		sendErr error
+	)
+	err = c.db.ConsumeOnce(event, func() error {
+		reply, sendErr = c.sendMessage(data)
+		sent = sendErr == nil
+		return sendErr
+	})
+
+	switch {
+	case errors.Is(err, ErrEventAlreadyConsumed):
+		skippedEmailsCounter.Inc()
+		c.l.Info("skipping already consumed event", zap.Uint("event_id", eventID), zap.Int64("offset", m.Offset))
+		return nil
+	case sendErr != nil:
 		emailSendingDuration.UpdateDuration(start)
+		notSentEmailsCounter.Inc()
+		c.l.Error("failed to send email", zap.String("topic", m.Topic), zap.Int64("offset", m.Offset), zap.Error(sendErr))
 
-		if err = c.Reader.CommitMessages(ctx, m); err != nil {
-			c.l.Error("failed to commit message", zap.Int64("offset", m.Offset), zap.Error(err))
-			continue
+		deadLettered, err := c.handleFailure(ctx, m, data, sendErr)
+		if err != nil {
+			return err
+		}
+
+		status := models.DeliveryStatusRetrying
+		if deadLettered {
+			status = models.DeliveryStatusFailed
 		}
+		c.recordDelivery(m, eventID, data, status, sendErr.Error(), start)
+
+		return nil
+	case err != nil && !sent:
+		return errors.Wrap(err, "failed to claim event")
+	case err != nil:
+		// The email is sent, so it is not sent again even though the event is still
+		// claimed; the claim expires unless the event is redelivered
+		c.l.Error("failed to record consumed event", zap.Uint("event_id", eventID), zap.Error(err))
+	}
+
+	// Record the duration it took to process the email
+	emailSendingDuration.UpdateDuration(start)
+	sentEmailsCounter.Inc()
+
+	c.recordDelivery(m, eventID, data, models.DeliveryStatusSent, reply, start)
+
+	return nil
+}
+
+// recordDelivery records the attempt to deliver the email in the delivery log along
+// with the response, which is the reply of the server if the email is sent, or the
+// error otherwise. The delivery log is informational, so failing to record the
+// attempt is only logged.
+func (c *KafkaConsumer) recordDelivery(m kafka.Message, eventID uint, data outbox.Data, status, response string, start time.Time) {
+	finish := time.Now()
+
+	err := c.db.AddDelivery(&models.Delivery{
+		EventID:    eventID,
+		RunID:      data.RunID,
+		Recipient:  data.Email,
+		Attempt:    attemptOf(m) + 1,
+		Status:     status,
+		Response:   response,
+		StartedAt:  start,
+		FinishedAt: finish,
+		DurationMs: finish.Sub(start).Milliseconds(),
+	})
+	if err != nil {
+		c.l.Error("failed to record delivery", zap.Uint("event_id", eventID), zap.Error(err))
+	}
+}
+
+// eventIDOf returns the ID of the outbox event the message was produced from.
+func eventIDOf(m kafka.Message) (uint, error) {
+	v, ok := header(m, outbox.HeaderEventID)
+	if !ok {
+		return 0, errors.New("message has no event id")
+	}
+
+	id, err := strconv.ParseUint(v, 10, 64)
+	if err != nil {
+		return 0, errors.Wrap(err, "failed to parse event id")
+	}
+	return uint(id), nil
+}
+
+// handleFailure hands a message that failed to be sent over to the next retry tier.
+// Permanent failures will never succeed, so they are dead-lettered right away and
+// recorded as bounces. It returns true if the message was dead-lettered.
+func (c *KafkaConsumer) handleFailure(ctx context.Context, m kafka.Message, data outbox.Data, cause error) (bool, error) {
+	if !email.IsPermanent(cause) {
+		return c.retry(ctx, m, cause)
+	}
+
+	if err := c.bounces.RecordSendFailure(data.Email, cause); err != nil {
+		c.l.Error("failed to record bounce", zap.Error(err))
+	}
 
-		c.l.Debug("offset committed", zap.Int64("offset", m.Offset))
+	return true, c.deadLetter(m, attemptOf(m)+1, cause)
+}
+
+// retry republishes the message to the next retry tier, or dead-letters it if the
+// retries are exhausted, in which case it returns true.
+func (c *KafkaConsumer) retry(ctx context.Context, m kafka.Message, cause error) (bool, error) {
+	attempt := attemptOf(m) + 1
+
+	tier, ok := c.policy.Next(attempt)
+	if !ok {
+		return true, c.deadLetter(m, attempt, cause)
+	}
+
+	headers := make([]kafka.Header, len(m.Headers))
+	copy(headers, m.Headers)
+	headers = setHeader(headers, HeaderAttempt, strconv.Itoa(attempt))
+	headers = setHeader(headers, HeaderNotBefore, strconv.FormatInt(time.Now().Add(tier.Delay).UnixMilli(), 10))
+	headers = setHeader(headers, HeaderError, cause.Error())
+	headers = setHeader(headers, HeaderOriginalTopic, originalTopicOf(m))
+
+	err := c.Writer.WriteMessages(ctx, kafka.Message{
+		Topic:   tier.Topic,
+		Key:     m.Key,
+		Value:   m.Value,
+		Headers: headers,
+	})
+	if err != nil {
+		return false, errors.Wrap(err, "failed to publish message to retry topic")
+	}
+
+	retriedEmailsCounter.Inc()
+	c.l.Info("message scheduled for retry",
+		zap.String("topic", tier.Topic),
+		zap.Int("attempt", attempt),
+		zap.Duration("delay", tier.Delay))
+
+	return false, nil
+}
+
+// deadLetter stores the message in the dead-letter queue along with the failure reason.
+func (c *KafkaConsumer) deadLetter(m kafka.Message, attempts int, cause error) error {
+	eventID, _ := eventIDOf(m)
+
+	dl := &models.DeadLetter{
+		EventID:   eventID,
+		Topic:     originalTopicOf(m),
+		Key:       string(m.Key),
+		Value:     string(m.Value),
+		Attempts:  attempts,
+		Reason:    cause.Error(),
+		CreatedAt: time.Now(),
+	}
+
+	if err := c.db.AddDeadLetter(dl); err != nil {
+		return errors.Wrap(err, "failed to add dead letter")
 	}
+
+	deadLettersCounter.Inc()
+	c.l.Warn("message dead-lettered",
+		zap.Uint("dead_letter_id", dl.ID),
+		zap.Int("attempts", attempts),
+		zap.Error(cause))
+
+	return nil
 }
 
-func (c *KafkaConsumer) sendMessage(data outbox.Data) error {
+// sendMessage renders the email of the event in the locale of the subscriber and
+// sends it, returning the reply of the server. The chart of the recent rates is
+// embedded into the digest if there is enough history to draw it.
+func (c *KafkaConsumer) sendMessage(data outbox.Data) (string, error) {
+	rc := rateContext(data)
+
+	var (
+		name    string
+		content any
+		inline  []email.Inline
+	)
+	switch data.EventType() {
+	case outbox.TypeSubscriptionCreated:
+		name, content = welcomeTemplate, templates.WelcomeContext{Email: data.Email, RateContext: rc}
+	default:
+		if png := c.chart(rc.Base, rc.Target); png != nil {
+			rc.Chart = chartCID
+			inline = append(inline, email.Inline{Name: chartCID, ContentType: "image/png", Data: png})
+		}
+		name, content = digestTemplate, rc
+	}
+
+	e, err := c.tmpl.Render(name, data.Locale, content)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to render email")
+	}
+
 	params := email.Params{
 		To:      data.Email,
-		Subject: "USD to UAH Exchange Rate",
-		Body:    fmt.Sprintf("The current exchange rate for USD to UAH is %.2f.", data.Rate),
+		Subject: e.Subject,
+		Body:    e.Text,
+		HTML:    e.HTML,
+		Inline:  inline,
+	}
+
+	return c.Sender.Send(params)
+}
+
+// chart returns the chart of the currency pair, or nil if it cannot be rendered. The
+// digest is sent without the chart rather than failing.
+func (c *KafkaConsumer) chart(base, target string) []byte {
+	if c.charts == nil {
+		return nil
 	}
 
-	err := c.Sender.Send(params)
+	png, err := c.charts.Chart(base, target)
 	if err != nil {
-		return err
+		if !errors.Is(err, chart.ErrNotEnoughData) {
+			c.l.Error("failed to render chart", zap.Error(err))
+		}
+		return nil
 	}
 
-	return nil
+	return png
+}
+
+// rateContext returns the template data of the rate email. Events produced before the
+// currency pair was part of the event are assumed to be USD to UAH.
+func rateContext(data outbox.Data) templates.RateContext {
+	rc := templates.RateContext{
+		Base:         data.Base,
+		Target:       data.Target,
+		Rate:         data.Rate,
+		PreviousRate: data.PreviousRate,
+		Date:         data.RatedAt,
+	}
+
+	if rc.Base == "" || rc.Target == "" {
+		rc.Base, rc.Target = "USD", "UAH"
+	}
+	if rc.Date.IsZero() {
+		rc.Date = time.Now()
+	}
+
+	return rc
 }
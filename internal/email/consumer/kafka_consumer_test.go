@@ -0,0 +1,330 @@
+package consumer_test
+
+import (
+	"context"
+	"errors"
+	"net/textproto"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/vladyslavpavlenko/genesis-api-project/internal/email"
+	"github.com/vladyslavpavlenko/genesis-api-project/internal/email/consumer"
+	"github.com/vladyslavpavlenko/genesis-api-project/internal/email/templates"
+	"github.com/vladyslavpavlenko/genesis-api-project/internal/models"
+	"github.com/vladyslavpavlenko/genesis-api-project/internal/outbox"
+)
+
+type mockSender struct {
+	err  error
+	sent []email.Params
+}
+
+func (m *mockSender) Send(params email.Params) (string, error) {
+	if m.err != nil {
+		return "", m.err
+	}
+	m.sent = append(m.sent, params)
+	return "250 2.0.0 Ok: queued as 4F3A1", nil
+}
+
+type mockRenderer struct{}
+
+func (m *mockRenderer) Render(name, _ string, _ any) (templates.Email, error) {
+	return templates.Email{Subject: name, Text: name}, nil
+}
+
+type mockBounces struct {
+	recorded []string
+}
+
+func (m *mockBounces) RecordSendFailure(addr string, _ error) error {
+	m.recorded = append(m.recorded, addr)
+	return nil
+}
+
+type mockDB struct {
+	consumed    map[string]string
+	deadLetters []models.DeadLetter
+	deliveries  []models.Delivery
+}
+
+// ConsumeOnce records the event by its ID and idempotency key, the same way as the
+// storage does.
+func (m *mockDB) ConsumeOnce(event *consumer.ConsumedEvent, process func() error) error {
+	if m.consumed == nil {
+		m.consumed = make(map[string]string)
+	}
+
+	keys := []string{strconv.FormatUint(uint64(event.ID), 10)}
+	if event.IdempotencyKey != nil {
+		keys = append(keys, *event.IdempotencyKey)
+	}
+	for _, k := range keys {
+		switch m.consumed[k] {
+		case consumer.ConsumedEventStatusPending:
+			return consumer.ErrEventInProgress
+		case consumer.ConsumedEventStatusDone:
+			return consumer.ErrEventAlreadyConsumed
+		}
+	}
+
+	if err := process(); err != nil {
+		return err
+	}
+	for _, k := range keys {
+		m.consumed[k] = consumer.ConsumedEventStatusDone
+	}
+	return nil
+}
+
+func (m *mockDB) AddDeadLetter(dl *models.DeadLetter) error {
+	dl.ID = uint(len(m.deadLetters) + 1)
+	m.deadLetters = append(m.deadLetters, *dl)
+	return nil
+}
+
+func (m *mockDB) AddDelivery(d *models.Delivery) error {
+	m.deliveries = append(m.deliveries, *d)
+	return nil
+}
+
+type mockWriter struct {
+	err      error
+	failures int // the number of writes failing with err, all of them if zero
+	messages []kafka.Message
+}
+
+func (m *mockWriter) WriteMessages(_ context.Context, msgs ...kafka.Message) error {
+	if m.err != nil {
+		err := m.err
+		if m.failures > 0 {
+			if m.failures--; m.failures == 0 {
+				m.err = nil
+			}
+		}
+		return err
+	}
+	m.messages = append(m.messages, msgs...)
+	return nil
+}
+
+func (m *mockWriter) Close() error {
+	return nil
+}
+
+type consumerTest struct {
+	c       *consumer.KafkaConsumer
+	sender  *mockSender
+	bounces *mockBounces
+	db      *mockDB
+	writer  *mockWriter
+}
+
+func newConsumerTest(sendErr error) *consumerTest {
+	ct := &consumerTest{
+		sender:  &mockSender{err: sendErr},
+		bounces: &mockBounces{},
+		db:      &mockDB{},
+		writer:  &mockWriter{},
+	}
+	cfg := consumer.Config{Retry: consumer.NewRetryPolicy("emails-topic", time.Minute, time.Hour)}
+	ct.c = consumer.NewTestConsumer(cfg, ct.sender, &mockRenderer{}, ct.bounces, ct.db, ct.writer)
+	return ct
+}
+
+// message returns a message of the digest event with the given ID that has failed
+// the given number of times.
+func message(t *testing.T, eventID uint, attempt int) kafka.Message {
+	t.Helper()
+	return runMessage(t, eventID, attempt, "")
+}
+
+// runMessage returns a message of the digest event of the mailing run.
+func runMessage(t *testing.T, eventID uint, attempt int, runID string) kafka.Message {
+	t.Helper()
+
+	value, err := outbox.Data{Email: "bob@example.com", Rate: 41.5, RunID: runID}.Serialize()
+	require.NoError(t, err)
+
+	m := kafka.Message{
+		Topic: "emails-topic",
+		Key:   []byte("bob@example.com"),
+		Value: []byte(value),
+		Headers: []kafka.Header{
+			{Key: outbox.HeaderEventID, Value: []byte(strconv.FormatUint(uint64(eventID), 10))},
+		},
+	}
+	if attempt > 0 {
+		m.Topic = "emails-topic.retry-" + strconv.Itoa(attempt)
+		m.Headers = append(m.Headers,
+			kafka.Header{Key: consumer.HeaderAttempt, Value: []byte(strconv.Itoa(attempt))},
+			kafka.Header{Key: consumer.HeaderOriginalTopic, Value: []byte("emails-topic")})
+	}
+	return m
+}
+
+func headerOf(m kafka.Message, key string) string {
+	for _, h := range m.Headers {
+		if h.Key == key {
+			return string(h.Value)
+		}
+	}
+	return ""
+}
+
+func TestKafkaConsumer_Process(t *testing.T) {
+	ct := newConsumerTest(nil)
+
+	require.NoError(t, ct.c.Process(context.Background(), message(t, 1, 0)))
+	require.Len(t, ct.sender.sent, 1)
+	assert.Equal(t, "bob@example.com", ct.sender.sent[0].To)
+	assert.Empty(t, ct.writer.messages)
+	assert.Empty(t, ct.db.deadLetters)
+	require.Len(t, ct.db.deliveries, 1)
+	assert.Equal(t, models.DeliveryStatusSent, ct.db.deliveries[0].Status)
+	assert.Equal(t, "250 2.0.0 Ok: queued as 4F3A1", ct.db.deliveries[0].Response)
+
+	// A redelivered event is skipped
+	require.NoError(t, ct.c.Process(context.Background(), message(t, 1, 0)))
+	assert.Len(t, ct.sender.sent, 1)
+	assert.Len(t, ct.db.deliveries, 1)
+}
+
+func TestKafkaConsumer_Process_Duplicate(t *testing.T) {
+	ct := newConsumerTest(nil)
+
+	// The digest of the same run is sent once, even if it is added as another event
+	require.NoError(t, ct.c.Process(context.Background(), runMessage(t, 1, 0, "run-1")))
+	require.NoError(t, ct.c.Process(context.Background(), runMessage(t, 2, 0, "run-1")))
+	assert.Len(t, ct.sender.sent, 1)
+
+	require.NoError(t, ct.c.Process(context.Background(), runMessage(t, 3, 0, "run-2")))
+	assert.Len(t, ct.sender.sent, 2)
+	assert.Len(t, ct.db.deliveries, 2)
+	assert.Empty(t, ct.writer.messages)
+}
+
+func TestKafkaConsumer_Process_InProgress(t *testing.T) {
+	ct := newConsumerTest(nil)
+	ct.db.consumed = map[string]string{"1": consumer.ConsumedEventStatusPending}
+
+	// The event being sent by another worker is neither sent nor committed
+	err := ct.c.Process(context.Background(), message(t, 1, 0))
+	assert.ErrorIs(t, err, consumer.ErrEventInProgress)
+	assert.Empty(t, ct.sender.sent)
+	assert.Empty(t, ct.db.deliveries)
+}
+
+func TestKafkaConsumer_Process_Retry(t *testing.T) {
+	ct := newConsumerTest(&textproto.Error{Code: 421, Msg: "try again later"})
+
+	require.NoError(t, ct.c.Process(context.Background(), message(t, 1, 0)))
+	assert.Empty(t, ct.db.deadLetters)
+	assert.Empty(t, ct.bounces.recorded)
+
+	require.Len(t, ct.writer.messages, 1)
+	m := ct.writer.messages[0]
+	assert.Equal(t, "emails-topic.retry-1", m.Topic)
+	assert.Equal(t, "1", headerOf(m, consumer.HeaderAttempt))
+	assert.Equal(t, "emails-topic", headerOf(m, consumer.HeaderOriginalTopic))
+	assert.Equal(t, "1", headerOf(m, outbox.HeaderEventID))
+	assert.Contains(t, headerOf(m, consumer.HeaderError), "421")
+
+	notBefore, err := strconv.ParseInt(headerOf(m, consumer.HeaderNotBefore), 10, 64)
+	require.NoError(t, err)
+	assert.WithinDuration(t, time.Now().Add(time.Minute), time.UnixMilli(notBefore), 5*time.Second)
+
+	// The next failure goes to the next tier
+	require.NoError(t, ct.c.Process(context.Background(), message(t, 1, 1)))
+	require.Len(t, ct.writer.messages, 2)
+	assert.Equal(t, "emails-topic.retry-2", ct.writer.messages[1].Topic)
+	assert.Equal(t, "2", headerOf(ct.writer.messages[1], consumer.HeaderAttempt))
+
+	require.Len(t, ct.db.deliveries, 2)
+	assert.Equal(t, models.DeliveryStatusRetrying, ct.db.deliveries[1].Status)
+	assert.Equal(t, 2, ct.db.deliveries[1].Attempt)
+}
+
+func TestKafkaConsumer_Process_RetriesExhausted(t *testing.T) {
+	ct := newConsumerTest(&textproto.Error{Code: 451, Msg: "local error"})
+
+	require.NoError(t, ct.c.Process(context.Background(), message(t, 1, 2)))
+	assert.Empty(t, ct.writer.messages)
+	assert.Empty(t, ct.bounces.recorded)
+
+	require.Len(t, ct.db.deadLetters, 1)
+	dl := ct.db.deadLetters[0]
+	assert.Equal(t, uint(1), dl.EventID)
+	assert.Equal(t, "emails-topic", dl.Topic)
+	assert.Equal(t, 3, dl.Attempts)
+	assert.Contains(t, dl.Reason, "451")
+
+	require.Len(t, ct.db.deliveries, 1)
+	assert.Equal(t, models.DeliveryStatusFailed, ct.db.deliveries[0].Status)
+	assert.Contains(t, ct.db.deliveries[0].Response, "local error")
+}
+
+func TestKafkaConsumer_Process_PermanentFailure(t *testing.T) {
+	ct := newConsumerTest(&textproto.Error{Code: 550, Msg: "no such user"})
+
+	require.NoError(t, ct.c.Process(context.Background(), message(t, 1, 0)))
+	assert.Empty(t, ct.writer.messages)
+	assert.Equal(t, []string{"bob@example.com"}, ct.bounces.recorded)
+
+	require.Len(t, ct.db.deadLetters, 1)
+	assert.Equal(t, 1, ct.db.deadLetters[0].Attempts)
+}
+
+func TestKafkaConsumer_Process_Malformed(t *testing.T) {
+	ct := newConsumerTest(nil)
+
+	m := message(t, 1, 0)
+	m.Value = []byte("{")
+	require.NoError(t, ct.c.Process(context.Background(), m))
+
+	m = message(t, 2, 0)
+	m.Headers = nil
+	require.NoError(t, ct.c.Process(context.Background(), m))
+
+	assert.Empty(t, ct.sender.sent)
+	assert.Empty(t, ct.writer.messages)
+	require.Len(t, ct.db.deadLetters, 2)
+	assert.Contains(t, ct.db.deadLetters[0].Reason, "failed to deserialize data")
+	assert.Contains(t, ct.db.deadLetters[1].Reason, "no event id")
+}
+
+func TestKafkaConsumer_Process_HandOverFailed(t *testing.T) {
+	ct := newConsumerTest(&textproto.Error{Code: 421, Msg: "try again later"})
+	ct.writer.err = errors.New("broker unavailable")
+
+	// The message is not committed unless it is handed over
+	err := ct.c.Process(context.Background(), message(t, 1, 0))
+	assert.ErrorContains(t, err, "broker unavailable")
+	assert.Empty(t, ct.db.deadLetters)
+}
+
+func TestKafkaConsumer_ProcessUntilHandedOver(t *testing.T) {
+	ct := newConsumerTest(&textproto.Error{Code: 421, Msg: "try again later"})
+	ct.writer.err, ct.writer.failures = errors.New("broker unavailable"), 1
+
+	// The message is retried in place until it is handed over
+	assert.True(t, ct.c.ProcessUntilHandedOver(context.Background(), message(t, 1, 0)))
+	require.Len(t, ct.writer.messages, 1)
+	assert.Equal(t, "emails-topic.retry-1", ct.writer.messages[0].Topic)
+}
+
+func TestKafkaConsumer_ProcessUntilHandedOver_Shutdown(t *testing.T) {
+	ct := newConsumerTest(&textproto.Error{Code: 421, Msg: "try again later"})
+	ct.writer.err = errors.New("broker unavailable")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	// The message is left uncommitted once the consumer shuts down
+	assert.False(t, ct.c.ProcessUntilHandedOver(ctx, message(t, 1, 0)))
+	assert.Empty(t, ct.writer.messages)
+}
@@ -1,5 +1,17 @@
 package consumer
 
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/VictoriaMetrics/metrics"
+	"github.com/segmentio/kafka-go"
+	"github.com/vladyslavpavlenko/genesis-api-project/pkg/logger"
+	"go.uber.org/zap"
+)
+
 // calculateEmailSuccessRate computes the success rate of email sending operations.
 func calculateEmailSuccessRate() float64 {
 	totalAttempts := sentEmailsCounter.Get() + notSentEmailsCounter.Get()
@@ -8,3 +20,98 @@ func calculateEmailSuccessRate() float64 {
 	}
 	return float64(sentEmailsCounter.Get()) / float64(totalAttempts)
 }
+
+// statsInterval is how often the stats of a reader are collected.
+const statsInterval = 10 * time.Second
+
+// partitionObserver exports the partitions a reader consumes from. Consumer group
+// readers do not expose their assignment, so it is derived from the fetched messages
+// and reset whenever the group rebalances.
+type partitionObserver struct {
+	r          *kafka.Reader
+	l          *logger.Logger
+	topic      string
+	rebalanced chan struct{}
+	assigned   map[int]bool
+}
+
+// newPartitionObserver creates a new partitionObserver for the reader.
+func newPartitionObserver(r *kafka.Reader, l *logger.Logger) *partitionObserver {
+	return &partitionObserver{
+		r:          r,
+		l:          l,
+		topic:      r.Config().Topic,
+		rebalanced: make(chan struct{}, 1),
+		assigned:   make(map[int]bool),
+	}
+}
+
+// collect exports the stats of the reader every statsInterval until the context is
+// canceled. Reader.Stats resets the counters of the reader, so it is not called
+// anywhere else.
+func (o *partitionObserver) collect(ctx context.Context) {
+	ticker := time.NewTicker(statsInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		stats := o.r.Stats()
+		metrics.GetOrCreateGauge(fmt.Sprintf(`consumer_lag{topic=%q}`, o.topic), nil).Set(float64(stats.Lag))
+
+		if stats.Rebalances > 0 {
+			rebalancesCounter(o.topic).Add(int(stats.Rebalances))
+			o.l.Info("consumer group rebalanced", zap.String("topic", o.topic), zap.Int64("rebalances", stats.Rebalances))
+
+			select {
+			case o.rebalanced <- struct{}{}:
+			default:
+			}
+		}
+	}
+}
+
+// observe records the message in the metrics of its partition and logs the
+// partitions that are consumed for the first time since the last rebalance. It
+// returns true if the group has rebalanced since the previous message.
+func (o *partitionObserver) observe(m kafka.Message) bool {
+	rebalanced := false
+	select {
+	case <-o.rebalanced:
+		rebalanced = true
+		clear(o.assigned)
+	default:
+	}
+
+	if !o.assigned[m.Partition] {
+		o.assigned[m.Partition] = true
+		o.l.Info("consuming partition",
+			zap.String("topic", m.Topic),
+			zap.Int("partition", m.Partition),
+			zap.Int64("offset", m.Offset),
+			zap.Ints("assigned_partitions", o.partitions()))
+	}
+
+	metrics.GetOrCreateCounter(fmt.Sprintf(`consumed_messages_count{topic=%q,partition="%d"}`, m.Topic, m.Partition)).Inc()
+
+	return rebalanced
+}
+
+// partitions returns the sorted list of the observed partitions.
+func (o *partitionObserver) partitions() []int {
+	ps := make([]int, 0, len(o.assigned))
+	for p := range o.assigned {
+		ps = append(ps, p)
+	}
+	sort.Ints(ps)
+	return ps
+}
+
+// rebalancesCounter returns the counter of consumer group rebalances for the topic.
+func rebalancesCounter(topic string) *metrics.Counter {
+	return metrics.GetOrCreateCounter(fmt.Sprintf(`consumer_rebalances_count{topic=%q}`, topic))
+}
@@ -0,0 +1,97 @@
+package consumer
+
+import "sync"
+
+// offsetTracker keeps track of the in-flight offsets of each partition, so that an
+// offset is committed only once all the earlier offsets of its partition are done.
+type offsetTracker struct {
+	mu         sync.Mutex
+	partitions map[int]*partitionOffsets
+}
+
+// partitionOffsets holds the in-flight offsets of a single partition.
+type partitionOffsets struct {
+	pending []int64        // in the order they were fetched
+	done    map[int64]bool // by the pending offsets
+	stale   int            // the number of the first pending offsets fetched before a reset
+}
+
+// newOffsetTracker creates a new offsetTracker.
+func newOffsetTracker() *offsetTracker {
+	return &offsetTracker{partitions: make(map[int]*partitionOffsets)}
+}
+
+// refetched reports whether the offset is not after the last in-flight offset of the
+// partition, i.e. the partition is fetched again from its committed offset, which
+// happens once the group rebalances.
+func (t *offsetTracker) refetched(partition int, offset int64) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	p, ok := t.partitions[partition]
+	return ok && len(p.pending) > 0 && offset <= p.pending[len(p.pending)-1]
+}
+
+// track registers a fetched offset as in-flight. A partition fetched again from an
+// earlier offset, which happens once it is reassigned by a rebalance, is tracked
+// anew.
+func (t *offsetTracker) track(partition int, offset int64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	p, ok := t.partitions[partition]
+	if !ok || (len(p.pending) > 0 && offset <= p.pending[len(p.pending)-1]) {
+		p = &partitionOffsets{done: make(map[int64]bool)}
+		t.partitions[partition] = p
+	}
+	p.pending = append(p.pending, offset)
+	p.done[offset] = false
+}
+
+// complete marks the offset as done. It returns the highest offset of the partition
+// that can be committed, i.e. the one all earlier offsets of which are done, and false
+// if there is no such offset. Offsets that are not tracked, e.g. those fetched before
+// a rebalance, are ignored, and so are those fetched before a reset.
+func (t *offsetTracker) complete(partition int, offset int64) (int64, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	p, ok := t.partitions[partition]
+	if !ok {
+		return 0, false
+	}
+	if _, ok = p.done[offset]; !ok {
+		return 0, false
+	}
+	p.done[offset] = true
+
+	var (
+		committable int64
+		found       bool
+	)
+	for len(p.pending) > 0 && p.done[p.pending[0]] {
+		if p.stale > 0 {
+			p.stale--
+		} else {
+			committable, found = p.pending[0], true
+		}
+		delete(p.done, p.pending[0])
+		p.pending = p.pending[1:]
+	}
+
+	return committable, found
+}
+
+// reset marks all the in-flight offsets as stale, so the offsets fetched before the
+// partitions were reassigned are not committed, as the partitions may belong to
+// another member now. Stale offsets still hold back the commits of the later offsets
+// of their partition until they are done, in case the partition is still assigned to
+// this member and is not fetched again.
+func (t *offsetTracker) reset() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for _, p := range t.partitions {
+		p.stale = len(p.pending)
+	}
+}
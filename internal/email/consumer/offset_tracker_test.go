@@ -0,0 +1,99 @@
+package consumer_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/vladyslavpavlenko/genesis-api-project/internal/email/consumer"
+)
+
+func TestOffsetTracker_Complete(t *testing.T) {
+	tr := consumer.NewOffsetTracker()
+	for _, o := range []int64{10, 11, 12, 13} {
+		tr.Track(0, o)
+	}
+	tr.Track(1, 5)
+
+	// Out-of-order completion holds the commit back
+	_, ok := tr.Complete(0, 12)
+	assert.False(t, ok)
+
+	_, ok = tr.Complete(0, 11)
+	assert.False(t, ok)
+
+	// Once the earliest offset is done, everything up to the first gap is committable
+	offset, ok := tr.Complete(0, 10)
+	assert.True(t, ok)
+	assert.Equal(t, int64(12), offset)
+
+	offset, ok = tr.Complete(0, 13)
+	assert.True(t, ok)
+	assert.Equal(t, int64(13), offset)
+
+	// Partitions are tracked independently
+	offset, ok = tr.Complete(1, 5)
+	assert.True(t, ok)
+	assert.Equal(t, int64(5), offset)
+
+	_, ok = tr.Complete(2, 1)
+	assert.False(t, ok)
+}
+
+func TestOffsetTracker_Rebalance(t *testing.T) {
+	tr := consumer.NewOffsetTracker()
+	for _, o := range []int64{10, 11, 12} {
+		tr.Track(0, o)
+	}
+	tr.Track(1, 5)
+
+	// The partition is fetched again from the last committed offset
+	tr.Track(0, 11)
+	_, ok := tr.Complete(0, 10)
+	assert.False(t, ok)
+
+	offset, ok := tr.Complete(0, 11)
+	assert.True(t, ok)
+	assert.Equal(t, int64(11), offset)
+
+	// The offsets fetched before the reset are not committed
+	tr.Reset()
+	_, ok = tr.Complete(1, 5)
+	assert.False(t, ok)
+
+	tr.Track(1, 5)
+	offset, ok = tr.Complete(1, 5)
+	assert.True(t, ok)
+	assert.Equal(t, int64(5), offset)
+
+	// An offset completed twice is committed once
+	_, ok = tr.Complete(1, 5)
+	assert.False(t, ok)
+}
+
+func TestOffsetTracker_ResetKeepsLowWaterMark(t *testing.T) {
+	tr := consumer.NewOffsetTracker()
+	tr.Track(0, 10)
+	tr.Track(0, 11)
+	tr.Reset()
+
+	// The partition is still assigned, so it is not fetched again
+	assert.False(t, tr.Refetched(0, 12))
+	tr.Track(0, 12)
+
+	// The offset fetched after the reset is held back by the stale in-flight ones
+	_, ok := tr.Complete(0, 12)
+	assert.False(t, ok)
+
+	_, ok = tr.Complete(0, 10)
+	assert.False(t, ok)
+
+	// Stale offsets are not committed themselves
+	offset, ok := tr.Complete(0, 11)
+	assert.True(t, ok)
+	assert.Equal(t, int64(12), offset)
+
+	// A partition fetched again from an earlier offset has been reassigned
+	tr.Track(0, 13)
+	assert.True(t, tr.Refetched(0, 13))
+	assert.False(t, tr.Refetched(1, 0))
+}
@@ -0,0 +1,133 @@
+package consumer
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// Message headers used to carry the retry state between topics.
+const (
+	HeaderAttempt       = "x-attempt"
+	HeaderNotBefore     = "x-not-before"
+	HeaderError         = "x-error"
+	HeaderOriginalTopic = "x-original-topic"
+)
+
+// RetryTier is a retry topic along with the delay its messages wait before being
+// reprocessed.
+type RetryTier struct {
+	Topic string
+	Delay time.Duration
+}
+
+// RetryPolicy defines the tiers a failed message goes through before it is
+// dead-lettered.
+type RetryPolicy struct {
+	Tiers []RetryTier
+}
+
+// NewRetryPolicy creates a RetryPolicy with a retry tier for each of the given delays.
+// Tier topics are named after the main topic, e.g. `emails-topic.retry-1`.
+func NewRetryPolicy(topic string, delays ...time.Duration) RetryPolicy {
+	tiers := make([]RetryTier, 0, len(delays))
+	for i, d := range delays {
+		tiers = append(tiers, RetryTier{
+			Topic: fmt.Sprintf("%s.retry-%d", topic, i+1),
+			Delay: d,
+		})
+	}
+	return RetryPolicy{Tiers: tiers}
+}
+
+// Next returns the tier a message should be sent to after its n-th failed attempt.
+// It returns false if the retries are exhausted.
+func (p RetryPolicy) Next(attempt int) (RetryTier, bool) {
+	if attempt < 1 || attempt > len(p.Tiers) {
+		return RetryTier{}, false
+	}
+	return p.Tiers[attempt-1], true
+}
+
+// Topics returns the topics of all the retry tiers.
+func (p RetryPolicy) Topics() []string {
+	topics := make([]string, 0, len(p.Tiers))
+	for _, t := range p.Tiers {
+		topics = append(topics, t.Topic)
+	}
+	return topics
+}
+
+// header returns the value of the header with the given key.
+func header(m kafka.Message, key string) (string, bool) {
+	for _, h := range m.Headers {
+		if h.Key == key {
+			return string(h.Value), true
+		}
+	}
+	return "", false
+}
+
+// setHeader sets the header with the given key, replacing the existing one.
+func setHeader(headers []kafka.Header, key, value string) []kafka.Header {
+	for i := range headers {
+		if headers[i].Key == key {
+			headers[i].Value = []byte(value)
+			return headers
+		}
+	}
+	return append(headers, kafka.Header{Key: key, Value: []byte(value)})
+}
+
+// attemptOf returns the number of failed attempts to process the message.
+func attemptOf(m kafka.Message) int {
+	v, ok := header(m, HeaderAttempt)
+	if !ok {
+		return 0
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil {
+		return 0
+	}
+	return n
+}
+
+// originalTopicOf returns the topic the message was originally published to.
+func originalTopicOf(m kafka.Message) string {
+	if v, ok := header(m, HeaderOriginalTopic); ok {
+		return v
+	}
+	return m.Topic
+}
+
+// waitNotBefore blocks until the moment specified in the HeaderNotBefore header
+// or until the context is canceled.
+func waitNotBefore(ctx context.Context, m kafka.Message) error {
+	v, ok := header(m, HeaderNotBefore)
+	if !ok {
+		return nil
+	}
+
+	ms, err := strconv.ParseInt(v, 10, 64)
+	if err != nil {
+		return nil
+	}
+
+	d := time.Until(time.UnixMilli(ms))
+	if d <= 0 {
+		return nil
+	}
+
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
@@ -0,0 +1,37 @@
+package consumer_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/vladyslavpavlenko/genesis-api-project/internal/email/consumer"
+)
+
+func TestNewRetryPolicy(t *testing.T) {
+	p := consumer.NewRetryPolicy("emails-topic", time.Minute, time.Hour)
+
+	assert.Equal(t, []string{"emails-topic.retry-1", "emails-topic.retry-2"}, p.Topics())
+	assert.Equal(t, time.Hour, p.Tiers[1].Delay)
+}
+
+func TestRetryPolicy_Next(t *testing.T) {
+	p := consumer.NewRetryPolicy("emails-topic", time.Minute, time.Hour)
+
+	cases := []struct {
+		attempt int
+		topic   string
+		ok      bool
+	}{
+		{attempt: 0, ok: false},
+		{attempt: 1, topic: "emails-topic.retry-1", ok: true},
+		{attempt: 2, topic: "emails-topic.retry-2", ok: true},
+		{attempt: 3, ok: false},
+	}
+
+	for _, tc := range cases {
+		tier, ok := p.Next(tc.attempt)
+		assert.Equal(t, tc.ok, ok, "attempt %d", tc.attempt)
+		assert.Equal(t, tc.topic, tier.Topic, "attempt %d", tc.attempt)
+	}
+}
@@ -0,0 +1,82 @@
+package email
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/textproto"
+)
+
+// Failure is a class of a failure to send an email.
+type Failure int
+
+const (
+	// FailureUnknown is a failure that cannot be attributed to the email, e.g. a
+	// network error. It is retried the same way as a transient one.
+	FailureUnknown Failure = iota
+	// FailureTransient is a 4xx SMTP failure, which may succeed if retried.
+	FailureTransient
+	// FailurePermanent is a 5xx SMTP failure, which will not succeed if retried.
+	FailurePermanent
+)
+
+// HTTPError is returned by HTTPSender if the email API responds with an error status.
+type HTTPError struct {
+	StatusCode int
+	Status     string
+	Body       string
+}
+
+func (e *HTTPError) Error() string {
+	return fmt.Sprintf("email api responded with status %s: %s", e.Status, e.Body)
+}
+
+// Classify classifies the error returned by a Sender by its SMTP reply code or its
+// HTTP status. Only the typed errors are classified, as the text of an error may
+// contain anything that looks like a reply code, e.g. the body of an HTTP response.
+func Classify(err error) Failure {
+	var (
+		tpErr   *textproto.Error
+		httpErr *HTTPError
+	)
+	switch {
+	case errors.As(err, &tpErr):
+		return classifyReplyCode(tpErr.Code)
+	case errors.As(err, &httpErr):
+		return classifyStatus(httpErr.StatusCode)
+	default:
+		return FailureUnknown
+	}
+}
+
+// classifyReplyCode classifies an SMTP reply code.
+func classifyReplyCode(code int) Failure {
+	switch {
+	case code >= 500 && code < 600:
+		return FailurePermanent
+	case code >= 400 && code < 500:
+		return FailureTransient
+	default:
+		return FailureUnknown
+	}
+}
+
+// classifyStatus classifies an HTTP status of an email API. The APIs reject the
+// emails they will never send, e.g. to an invalid recipient, with 422 Unprocessable
+// Entity. The other client errors, e.g. of an invalid API key, are not the fault of
+// the email, so the recipient is not suppressed for them.
+func classifyStatus(code int) Failure {
+	switch {
+	case code == http.StatusUnprocessableEntity:
+		return FailurePermanent
+	case code == http.StatusRequestTimeout, code == http.StatusTooManyRequests, code >= 500 && code < 600:
+		return FailureTransient
+	default:
+		return FailureUnknown
+	}
+}
+
+// IsPermanent reports whether the error is a permanent failure.
+func IsPermanent(err error) bool {
+	return Classify(err) == FailurePermanent
+}
@@ -0,0 +1,38 @@
+package email_test
+
+import (
+	"errors"
+	"fmt"
+	"net/textproto"
+	"testing"
+
+	"github.com/vladyslavpavlenko/genesis-api-project/internal/email"
+)
+
+func TestClassify(t *testing.T) {
+	cases := []struct {
+		name    string
+		err     error
+		failure email.Failure
+	}{
+		{"nil", nil, email.FailureUnknown},
+		{"network error", errors.New("dial tcp: connection refused"), email.FailureUnknown},
+		{"textproto permanent", &textproto.Error{Code: 550, Msg: "5.1.1 user unknown"}, email.FailurePermanent},
+		{"wrapped textproto transient", fmt.Errorf("send: %w", &textproto.Error{Code: 451, Msg: "try later"}),
+			email.FailureTransient},
+		{"untyped reply code", errors.New("gomail: could not send email 1: 550 5.1.1 user unknown"),
+			email.FailureUnknown},
+		{"wrapped untyped reply code", fmt.Errorf("http: %w", errors.New("upstream: 421 try again later")),
+			email.FailureUnknown},
+		{"http rejected", &email.HTTPError{StatusCode: 422, Body: "550 invalid recipient"}, email.FailurePermanent},
+		{"wrapped http throttled", fmt.Errorf("api: %w", &email.HTTPError{StatusCode: 429}), email.FailureTransient},
+		{"http unavailable", &email.HTTPError{StatusCode: 503, Body: "550 maintenance"}, email.FailureTransient},
+		{"http unauthorized", &email.HTTPError{StatusCode: 401}, email.FailureUnknown},
+	}
+
+	for _, tc := range cases {
+		if got := email.Classify(tc.err); got != tc.failure {
+			t.Errorf("%s: expected %v, got %v", tc.name, tc.failure, got)
+		}
+	}
+}
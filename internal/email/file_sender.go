@@ -0,0 +1,67 @@
+package email
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// FileSender implements the Sender interface by appending the messages to an mbox
+// file. It is meant for development.
+type FileSender struct {
+	Path   string
+	Config Config
+	// Signer, if set, signs every message before it is sent.
+	Signer Signer
+
+	mu sync.Mutex
+}
+
+// NewFileSender creates a new FileSender.
+func NewFileSender(path string, cfg Config) *FileSender {
+	return &FileSender{
+		Path:   path,
+		Config: cfg,
+	}
+}
+
+func (fs *FileSender) Send(params Params) (string, error) {
+	msg, err := writeMessage(fs.Config.Email, params, fs.Signer)
+	if err != nil {
+		return "", err
+	}
+
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	f, err := os.OpenFile(fs.Path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o644)
+	if err != nil {
+		return "", fmt.Errorf("error opening mbox: %w", err)
+	}
+	defer f.Close()
+
+	w := bufio.NewWriter(f)
+	fmt.Fprintf(w, "From %s %s\n", fs.Config.Email, time.Now().UTC().Format(time.ANSIC))
+
+	content := bytes.TrimRight(bytes.ReplaceAll(msg, []byte("\r\n"), []byte("\n")), "\n")
+
+	// Quote the lines looking like a message separator (mboxrd)
+	for _, line := range bytes.Split(content, []byte("\n")) {
+		if bytes.HasPrefix(bytes.TrimLeft(line, ">"), []byte("From ")) {
+			w.WriteByte('>')
+		}
+		w.Write(line)
+		w.WriteByte('\n')
+	}
+	// Messages are separated by an empty line
+	w.WriteByte('\n')
+
+	if err = w.Flush(); err != nil {
+		return "", fmt.Errorf("error writing mbox: %w", err)
+	}
+
+	return "", nil
+}
@@ -1,6 +1,10 @@
 package email
 
 import (
+	"bytes"
+	"fmt"
+	"io"
+
 	"gopkg.in/gomail.v2"
 )
 
@@ -18,15 +22,64 @@ func (d *GomailDialer) DialAndSend(m ...*gomail.Message) error {
 	return d.Dialer.DialAndSend(m...)
 }
 
-func (gs *GomailSender) Send(params Params) error {
+// replyDialer is a Dialer that returns the reply of the server to the message, e.g.
+// transport.Pool.
+type replyDialer interface {
+	Send(m *gomail.Message) (string, error)
+}
+
+func (gs *GomailSender) Send(params Params) (string, error) {
+	m := newMessage(gs.Config.Email, params)
+
+	if d, ok := gs.Dialer.(replyDialer); ok {
+		return d.Send(m)
+	}
+
+	if err := gs.Dialer.DialAndSend(m); err != nil {
+		return "", err
+	}
+	return "", nil
+}
+
+// newMessage builds the message sent from the given address.
+func newMessage(from string, params Params) *gomail.Message {
 	m := gomail.NewMessage()
-	m.SetHeader("From", gs.Config.Email)
+	m.SetHeader("From", from)
 	m.SetHeader("To", params.To)
 	m.SetHeader("Subject", params.Subject)
 	m.SetBody("text/plain", params.Body)
+	if params.HTML != "" {
+		m.AddAlternative("text/html", params.HTML)
+	}
+	for _, in := range params.Inline {
+		data := in.Data
+		m.Embed(in.Name,
+			gomail.SetCopyFunc(func(w io.Writer) error {
+				_, err := w.Write(data)
+				return err
+			}),
+			gomail.SetHeader(map[string][]string{"Content-Type": {in.ContentType}}),
+		)
+	}
+	return m
+}
 
-	if err := gs.Dialer.DialAndSend(m); err != nil {
-		return err
+// writeMessage writes the message sent from the given address, signing it if the
+// signer is set.
+func writeMessage(from string, params Params, signer Signer) ([]byte, error) {
+	var buf bytes.Buffer
+	if _, err := newMessage(from, params).WriteTo(&buf); err != nil {
+		return nil, fmt.Errorf("error writing message: %w", err)
 	}
-	return nil
+
+	if signer == nil {
+		return buf.Bytes(), nil
+	}
+
+	signed, err := signer.Sign(buf.Bytes())
+	if err != nil {
+		return nil, fmt.Errorf("error signing message: %w", err)
+	}
+
+	return signed, nil
 }
@@ -1,6 +1,7 @@
 package email_test
 
 import (
+	"bytes"
 	"errors"
 	"testing"
 
@@ -21,7 +22,7 @@ func TestSend(t *testing.T) {
 
 	mockDialer.EXPECT().DialAndSend(gomock.Any()).Return(nil)
 
-	err := gomailSender.Send(params)
+	_, err := gomailSender.Send(params)
 	if err != nil {
 		t.Errorf("Send failed: %v", err)
 	}
@@ -39,7 +40,7 @@ func TestGomailSenderSendFailure(t *testing.T) {
 	testError := errors.New("smtp error")
 	mockDialer.EXPECT().DialAndSend(gomock.Any()).Return(testError)
 
-	err := sender.Send(params)
+	_, err := sender.Send(params)
 
 	assert.Equal(t, testError, err, "Expected a specific error, but got a different one")
 }
@@ -66,3 +67,52 @@ func TestGomailDialerDialAndSend(t *testing.T) {
 		t.Errorf("DialAndSend failed: %v", err)
 	}
 }
+
+func TestGomailSenderSendAlternative(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockDialer := mocks.NewMockDialer(ctrl)
+	sender := email.GomailSender{Dialer: mockDialer}
+
+	params := email.Params{To: "recipient@example.com", Subject: "Test", Body: "Hello", HTML: "<p>Hello</p>"}
+
+	var raw bytes.Buffer
+	mockDialer.EXPECT().DialAndSend(gomock.Any()).DoAndReturn(func(m ...*gomail.Message) error {
+		_, err := m[0].WriteTo(&raw)
+		return err
+	})
+
+	_, err := sender.Send(params)
+	assert.NoError(t, err)
+	assert.Contains(t, raw.String(), "multipart/alternative")
+	assert.Contains(t, raw.String(), "<p>Hello</p>")
+}
+
+func TestGomailSenderSendInline(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockDialer := mocks.NewMockDialer(ctrl)
+	sender := email.GomailSender{Dialer: mockDialer}
+
+	params := email.Params{
+		To:      "recipient@example.com",
+		Subject: "Test",
+		Body:    "Hello",
+		HTML:    `<img src="cid:chart.png">`,
+		Inline:  []email.Inline{{Name: "chart.png", ContentType: "image/png", Data: []byte("png")}},
+	}
+
+	var raw bytes.Buffer
+	mockDialer.EXPECT().DialAndSend(gomock.Any()).DoAndReturn(func(m ...*gomail.Message) error {
+		_, err := m[0].WriteTo(&raw)
+		return err
+	})
+
+	_, err := sender.Send(params)
+	assert.NoError(t, err)
+	assert.Contains(t, raw.String(), "multipart/related")
+	assert.Contains(t, raw.String(), "Content-ID: <chart.png>")
+	assert.Contains(t, raw.String(), "Content-Type: image/png")
+}
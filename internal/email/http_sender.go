@@ -0,0 +1,104 @@
+package email
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+const httpSendTimeout = 10 * time.Second
+
+// HTTPSender implements the Sender interface for the HTTP APIs of transactional email
+// providers. It posts the message as JSON to the URL, authenticating with the API key
+// as a bearer token.
+type HTTPSender struct {
+	Client *http.Client
+	URL    string
+	APIKey string
+	Config Config
+}
+
+// httpMessage is the JSON body of the request sent by HTTPSender.
+type httpMessage struct {
+	From    string       `json:"from"`
+	To      string       `json:"to"`
+	Subject string       `json:"subject"`
+	Text    string       `json:"text"`
+	HTML    string       `json:"html,omitempty"`
+	Inline  []httpInline `json:"inline,omitempty"`
+}
+
+// httpInline is an inline file of the request sent by HTTPSender. The content is
+// base64-encoded.
+type httpInline struct {
+	ContentID   string `json:"content_id"`
+	ContentType string `json:"content_type"`
+	Content     []byte `json:"content"`
+}
+
+// NewHTTPSender creates a new HTTPSender.
+func NewHTTPSender(c *http.Client, url, apiKey string, cfg Config) *HTTPSender {
+	return &HTTPSender{
+		Client: c,
+		URL:    url,
+		APIKey: apiKey,
+		Config: cfg,
+	}
+}
+
+// Send posts the message and returns the status and the body of the response.
+func (hs *HTTPSender) Send(params Params) (string, error) {
+	msg := httpMessage{
+		From:    hs.Config.Email,
+		To:      params.To,
+		Subject: params.Subject,
+		Text:    params.Body,
+		HTML:    params.HTML,
+	}
+	for _, in := range params.Inline {
+		msg.Inline = append(msg.Inline, httpInline{
+			ContentID:   in.Name,
+			ContentType: in.ContentType,
+			Content:     in.Data,
+		})
+	}
+
+	body, err := json.Marshal(msg)
+	if err != nil {
+		return "", fmt.Errorf("error marshaling message: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), httpSendTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, hs.URL, bytes.NewReader(body))
+	if err != nil {
+		return "", fmt.Errorf("error creating request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if hs.APIKey != "" {
+		req.Header.Set("Authorization", "Bearer "+hs.APIKey)
+	}
+
+	resp, err := hs.Client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("error sending request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	reply, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+	reply = bytes.TrimSpace(reply)
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return "", &HTTPError{StatusCode: resp.StatusCode, Status: resp.Status, Body: string(reply)}
+	}
+
+	if len(reply) == 0 {
+		return resp.Status, nil
+	}
+	return resp.Status + ": " + string(reply), nil
+}
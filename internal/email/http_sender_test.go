@@ -0,0 +1,64 @@
+package email_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/vladyslavpavlenko/genesis-api-project/internal/email"
+)
+
+func TestHTTPSenderSend(t *testing.T) {
+	var got map[string]string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "Bearer key", r.Header.Get("Authorization"))
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&got))
+		w.WriteHeader(http.StatusAccepted)
+		_, _ = w.Write([]byte(`{"id":"msg-1"}` + "\n"))
+	}))
+	defer srv.Close()
+
+	s := email.NewHTTPSender(srv.Client(), srv.URL, "key", email.Config{Email: "sender@example.com"})
+	reply, err := s.Send(email.Params{To: "recipient@example.com", Subject: "Test", Body: "Hello", HTML: "<p>Hello</p>"})
+	require.NoError(t, err)
+	assert.Equal(t, `202 Accepted: {"id":"msg-1"}`, reply)
+
+	assert.Equal(t, map[string]string{
+		"from":    "sender@example.com",
+		"to":      "recipient@example.com",
+		"subject": "Test",
+		"text":    "Hello",
+		"html":    "<p>Hello</p>",
+	}, got)
+}
+
+func TestHTTPSenderSendError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+
+	s := email.NewHTTPSender(srv.Client(), srv.URL, "", email.Config{Email: "sender@example.com"})
+	_, err := s.Send(email.Params{To: "recipient@example.com"})
+
+	var httpErr *email.HTTPError
+	require.ErrorAs(t, err, &httpErr)
+	assert.Equal(t, http.StatusServiceUnavailable, httpErr.StatusCode)
+	assert.Equal(t, "unavailable", httpErr.Body)
+	assert.Equal(t, email.FailureTransient, email.Classify(err))
+}
+
+func TestHTTPSenderSendRejected(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		http.Error(w, "550 invalid recipient", http.StatusUnprocessableEntity)
+	}))
+	defer srv.Close()
+
+	s := email.NewHTTPSender(srv.Client(), srv.URL, "", email.Config{Email: "sender@example.com"})
+	_, err := s.Send(email.Params{To: "recipient@example.com"})
+
+	assert.True(t, email.IsPermanent(err))
+}
@@ -0,0 +1,83 @@
+package email
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/net/idna"
+)
+
+// Plus-tag policies.
+const (
+	// PlusTagKeep treats the tagged addresses, e.g. `alice+news@example.com`, as
+	// distinct addresses.
+	PlusTagKeep = "keep"
+	// PlusTagStrip treats the tagged addresses as the untagged one, so that
+	// `alice+news@example.com` is a duplicate of `alice@example.com`.
+	PlusTagStrip = "strip"
+	// PlusTagReject rejects the tagged addresses.
+	PlusTagReject = "reject"
+)
+
+var (
+	ErrInvalidAddress = errors.New("invalid email address")
+	ErrPlusTag        = errors.New("email addresses with a plus tag are not allowed")
+)
+
+// Address is a canonicalized email address.
+type Address struct {
+	// Email is the address the emails are sent to. Its domain is lower-cased and
+	// converted to punycode.
+	Email string
+	// Normalized is the lower-cased address with the plus tag handled according to
+	// the policy. Two addresses with the same Normalized value are the same.
+	Normalized string
+}
+
+// Normalizer canonicalizes email addresses.
+type Normalizer struct {
+	plusTags string
+}
+
+// NewNormalizer creates a new Normalizer with the given plus-tag policy.
+func NewNormalizer(plusTags string) (*Normalizer, error) {
+	switch plusTags {
+	case PlusTagKeep, PlusTagStrip, PlusTagReject:
+	default:
+		return nil, fmt.Errorf("plus-tag policy %q is unsupported", plusTags)
+	}
+
+	return &Normalizer{plusTags: plusTags}, nil
+}
+
+// Normalize validates and canonicalizes the email address.
+func (n *Normalizer) Normalize(addr string) (Address, error) {
+	addr = strings.TrimSpace(addr)
+	if !Email(addr).Validate() {
+		return Address{}, ErrInvalidAddress
+	}
+
+	i := strings.LastIndex(addr, "@")
+	local, domain := addr[:i], addr[i+1:]
+
+	domain, err := idna.Lookup.ToASCII(strings.TrimSuffix(strings.ToLower(domain), "."))
+	if err != nil {
+		return Address{}, fmt.Errorf("%w: %w", ErrInvalidAddress, err)
+	}
+
+	key := strings.ToLower(local)
+	if tag := strings.Index(key, "+"); tag >= 0 {
+		switch n.plusTags {
+		case PlusTagReject:
+			return Address{}, ErrPlusTag
+		case PlusTagStrip:
+			key = key[:tag]
+		}
+	}
+
+	return Address{
+		Email:      local + "@" + domain,
+		Normalized: key + "@" + domain,
+	}, nil
+}
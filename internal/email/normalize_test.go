@@ -0,0 +1,83 @@
+package email_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/vladyslavpavlenko/genesis-api-project/internal/email"
+)
+
+func TestNormalizer_Normalize(t *testing.T) {
+	tests := []struct {
+		name       string
+		policy     string
+		addr       string
+		expected   email.Address
+		expectedEr error
+	}{
+		{
+			name:     "lower-cases the domain and the key",
+			policy:   email.PlusTagKeep,
+			addr:     " Alice@Example.COM ",
+			expected: email.Address{Email: "Alice@example.com", Normalized: "alice@example.com"},
+		},
+		{
+			name:     "converts the domain to punycode",
+			policy:   email.PlusTagKeep,
+			addr:     "user@Bücher.example",
+			expected: email.Address{Email: "user@xn--bcher-kva.example", Normalized: "user@xn--bcher-kva.example"},
+		},
+		{
+			name:     "keeps plus tags",
+			policy:   email.PlusTagKeep,
+			addr:     "alice+news@example.com",
+			expected: email.Address{Email: "alice+news@example.com", Normalized: "alice+news@example.com"},
+		},
+		{
+			name:     "strips plus tags from the key",
+			policy:   email.PlusTagStrip,
+			addr:     "Alice+News@example.com",
+			expected: email.Address{Email: "Alice+News@example.com", Normalized: "alice@example.com"},
+		},
+		{
+			name:       "rejects plus tags",
+			policy:     email.PlusTagReject,
+			addr:       "alice+news@example.com",
+			expectedEr: email.ErrPlusTag,
+		},
+		{
+			name:       "rejects display names",
+			policy:     email.PlusTagKeep,
+			addr:       `"Bob" <bob@example.com>`,
+			expectedEr: email.ErrInvalidAddress,
+		},
+		{
+			name:       "rejects invalid domains",
+			policy:     email.PlusTagKeep,
+			addr:       "bob@exa_mple.com",
+			expectedEr: email.ErrInvalidAddress,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			n, err := email.NewNormalizer(tt.policy)
+			require.NoError(t, err)
+
+			addr, err := n.Normalize(tt.addr)
+			if tt.expectedEr != nil {
+				assert.ErrorIs(t, err, tt.expectedEr)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, addr)
+		})
+	}
+}
+
+func TestNewNormalizer_InvalidPolicy(t *testing.T) {
+	_, err := email.NewNormalizer("drop")
+	assert.Error(t, err)
+}
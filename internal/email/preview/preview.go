@@ -0,0 +1,234 @@
+package preview
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/vladyslavpavlenko/genesis-api-project/internal/email"
+	"github.com/vladyslavpavlenko/genesis-api-project/internal/email/templates"
+	"github.com/vladyslavpavlenko/genesis-api-project/internal/models"
+	"github.com/vladyslavpavlenko/genesis-api-project/pkg/chart"
+)
+
+const (
+	base   = "USD"
+	target = "UAH"
+
+	// chartCID is the content ID of the chart embedded into the rate emails.
+	chartCID = "chart.png"
+
+	// sampleEmail is the recipient shown in the emails rendered for no one in
+	// particular.
+	sampleEmail = "subscriber@example.com"
+
+	// testSubjectPrefix marks the test emails.
+	testSubjectPrefix = "[Test] "
+)
+
+var (
+	ErrUnknownTemplate = errors.New("unknown template")
+	ErrLiveData        = errors.New("failed to get live data")
+)
+
+type (
+	renderer interface {
+		Render(name, locale string, data any) (templates.Email, error)
+	}
+
+	fetcher interface {
+		Fetch(ctx context.Context, base, target string) (string, error)
+	}
+
+	rateHistory interface {
+		GetLastRateBefore(base, target string, before time.Time) (models.Rate, error)
+	}
+
+	chartRenderer interface {
+		Chart(base, target string) ([]byte, error)
+	}
+
+	sender interface {
+		Send(params email.Params) (string, error)
+	}
+)
+
+// Message is a rendered email along with its inline files.
+type Message struct {
+	templates.Email
+	Inline []email.Inline `json:"-"`
+}
+
+// HTMLWithDataURIs returns the HTML part with the references to the inline files
+// replaced by data URIs, so that it can be viewed in a browser.
+func (m Message) HTMLWithDataURIs() string {
+	html := m.HTML
+	for _, in := range m.Inline {
+		uri := "data:" + in.ContentType + ";base64," + base64.StdEncoding.EncodeToString(in.Data)
+		html = strings.ReplaceAll(html, "cid:"+in.Name, uri)
+	}
+	return html
+}
+
+// Service renders the email templates with sample or live data, and sends them to
+// arbitrary addresses for testing.
+type Service struct {
+	tmpl    renderer
+	fetcher fetcher
+	rates   rateHistory
+	charts  chartRenderer
+	sender  sender
+	now     func() time.Time
+}
+
+// NewService creates a new Service.
+func NewService(tmpl renderer, fetcher fetcher, rates rateHistory, charts chartRenderer, sender sender) *Service {
+	return &Service{
+		tmpl:    tmpl,
+		fetcher: fetcher,
+		rates:   rates,
+		charts:  charts,
+		sender:  sender,
+		now:     time.Now,
+	}
+}
+
+// Render renders the named template in the given locale. With live set, the rate
+// emails are rendered with the current rate and the stored history instead of
+// sample data. The recipient is shown in the emails addressed to someone; if it is
+// empty, a sample address is used.
+func (s *Service) Render(ctx context.Context, name, locale, recipient string, live bool) (Message, error) {
+	if recipient == "" {
+		recipient = sampleEmail
+	}
+
+	var (
+		data   any
+		inline []email.Inline
+	)
+	switch name {
+	case templates.Digest, templates.Alert:
+		rc, png, err := s.rateContext(ctx, live)
+		if err != nil {
+			return Message{}, err
+		}
+		if png != nil {
+			rc.Chart = chartCID
+			inline = append(inline, email.Inline{Name: chartCID, ContentType: "image/png", Data: png})
+		}
+		data = rc
+	case templates.Confirmation:
+		data = templates.ConfirmationContext{
+			Email:      recipient,
+			Base:       base,
+			Target:     target,
+			ConfirmURL: "https://example.com/api/v1/confirm?token=sample",
+		}
+	case templates.Welcome:
+		rc, _, err := s.rateContext(ctx, live)
+		if err != nil {
+			return Message{}, err
+		}
+		// The welcome email compares with nothing and has no chart
+		rc.PreviousRate = 0
+		data = templates.WelcomeContext{Email: recipient, RateContext: rc}
+	default:
+		return Message{}, fmt.Errorf("%w: %s", ErrUnknownTemplate, name)
+	}
+
+	e, err := s.tmpl.Render(name, locale, data)
+	if err != nil {
+		return Message{}, err
+	}
+
+	return Message{Email: e, Inline: inline}, nil
+}
+
+// Send renders the named template and sends it to the recipient through the
+// configured sender. The subscriptions and suppressions are not consulted.
+func (s *Service) Send(ctx context.Context, name, locale, recipient string, live bool) error {
+	m, err := s.Render(ctx, name, locale, recipient, live)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.sender.Send(email.Params{
+		To:      recipient,
+		Subject: testSubjectPrefix + m.Subject,
+		Body:    m.Text,
+		HTML:    m.HTML,
+		Inline:  m.Inline,
+	})
+	return err
+}
+
+// rateContext returns the data of the rate emails along with the chart, which is
+// nil if there is not enough history to draw it.
+func (s *Service) rateContext(ctx context.Context, live bool) (templates.RateContext, []byte, error) {
+	now := s.now()
+	if !live {
+		return sampleRateContext(now)
+	}
+
+	price, err := s.fetcher.Fetch(ctx, base, target)
+	if err != nil {
+		return templates.RateContext{}, nil, fmt.Errorf("%w: %w", ErrLiveData, err)
+	}
+
+	rate, err := strconv.ParseFloat(price, 64)
+	if err != nil {
+		return templates.RateContext{}, nil, fmt.Errorf("%w: invalid rate %q", ErrLiveData, price)
+	}
+
+	rc := templates.RateContext{Base: base, Target: target, Rate: rate, Date: now}
+
+	// Like the digest, compare with the last rate recorded before today
+	today := now.UTC().Truncate(24 * time.Hour)
+	if previous, err := s.rates.GetLastRateBefore(base, target, today); err == nil {
+		rc.PreviousRate = previous.Value
+	}
+
+	png, err := s.charts.Chart(base, target)
+	if errors.Is(err, chart.ErrNotEnoughData) {
+		return rc, nil, nil
+	}
+	if err != nil {
+		return templates.RateContext{}, nil, fmt.Errorf("%w: %w", ErrLiveData, err)
+	}
+
+	return rc, png, nil
+}
+
+// sampleRateContext returns the sample data of the rate emails along with a chart
+// of a made-up history.
+func sampleRateContext(now time.Time) (templates.RateContext, []byte, error) {
+	points := make([]chart.Point, 30)
+	for i := range points {
+		day := float64(i)
+		points[i] = chart.Point{
+			Time:  now.AddDate(0, 0, i-len(points)+1),
+			Value: 41 + 0.35*math.Sin(day/4) + 0.01*day,
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := chart.LinePNG(&buf, points, chart.DefaultOptions()); err != nil {
+		return templates.RateContext{}, nil, err
+	}
+
+	rc := templates.RateContext{
+		Base:         base,
+		Target:       target,
+		Rate:         points[len(points)-1].Value,
+		PreviousRate: points[len(points)-2].Value,
+		Date:         now,
+	}
+
+	return rc, buf.Bytes(), nil
+}
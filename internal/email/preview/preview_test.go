@@ -0,0 +1,121 @@
+package preview_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/vladyslavpavlenko/genesis-api-project/internal/email"
+	"github.com/vladyslavpavlenko/genesis-api-project/internal/email/preview"
+	"github.com/vladyslavpavlenko/genesis-api-project/internal/email/templates"
+	"github.com/vladyslavpavlenko/genesis-api-project/internal/models"
+	"github.com/vladyslavpavlenko/genesis-api-project/pkg/chart"
+)
+
+type mockFetcher struct {
+	rate string
+	err  error
+}
+
+func (m *mockFetcher) Fetch(_ context.Context, _, _ string) (string, error) {
+	return m.rate, m.err
+}
+
+type mockHistory struct{}
+
+func (m *mockHistory) GetLastRateBefore(_, _ string, _ time.Time) (models.Rate, error) {
+	return models.Rate{Value: 40}, nil
+}
+
+type mockCharts struct {
+	err error
+}
+
+func (m *mockCharts) Chart(_, _ string) ([]byte, error) {
+	return []byte("png"), m.err
+}
+
+type mockSender struct {
+	sent []email.Params
+}
+
+func (m *mockSender) Send(params email.Params) (string, error) {
+	m.sent = append(m.sent, params)
+	return "", nil
+}
+
+func newService(f *mockFetcher, c *mockCharts, s *mockSender) *preview.Service {
+	return preview.NewService(templates.New(""), f, &mockHistory{}, c, s)
+}
+
+func TestService_RenderSample(t *testing.T) {
+	for _, name := range templates.Names {
+		for _, locale := range templates.Locales {
+			t.Run(name+"."+locale, func(t *testing.T) {
+				s := newService(&mockFetcher{err: errors.New("not used")}, &mockCharts{}, &mockSender{})
+
+				m, err := s.Render(context.Background(), name, locale, "", false)
+				require.NoError(t, err)
+				assert.NotEmpty(t, m.Subject)
+				assert.NotEmpty(t, m.Text)
+				assert.NotEmpty(t, m.HTML)
+			})
+		}
+	}
+}
+
+func TestService_RenderLive(t *testing.T) {
+	s := newService(&mockFetcher{rate: "41"}, &mockCharts{}, &mockSender{})
+
+	m, err := s.Render(context.Background(), templates.Digest, "en", "", true)
+	require.NoError(t, err)
+
+	assert.Contains(t, m.Text, "is 41.00.")
+	assert.Contains(t, m.Text, "changed by +1.00 (+2.50%)")
+	require.Len(t, m.Inline, 1)
+	assert.Equal(t, []byte("png"), m.Inline[0].Data)
+
+	html := m.HTMLWithDataURIs()
+	assert.Contains(t, html, `src="data:image/png;base64,cG5n"`)
+	assert.NotContains(t, html, "cid:")
+}
+
+func TestService_RenderLiveWithoutHistory(t *testing.T) {
+	s := newService(&mockFetcher{rate: "41"}, &mockCharts{err: chart.ErrNotEnoughData}, &mockSender{})
+
+	m, err := s.Render(context.Background(), templates.Alert, "en", "", true)
+	require.NoError(t, err)
+	assert.Empty(t, m.Inline)
+	assert.NotContains(t, m.HTML, "<img")
+}
+
+func TestService_RenderLiveError(t *testing.T) {
+	s := newService(&mockFetcher{err: errors.New("unavailable")}, &mockCharts{}, &mockSender{})
+
+	_, err := s.Render(context.Background(), templates.Digest, "en", "", true)
+	assert.ErrorIs(t, err, preview.ErrLiveData)
+}
+
+func TestService_RenderUnknown(t *testing.T) {
+	s := newService(&mockFetcher{}, &mockCharts{}, &mockSender{})
+
+	_, err := s.Render(context.Background(), "welcome-back", "en", "", false)
+	assert.ErrorIs(t, err, preview.ErrUnknownTemplate)
+}
+
+func TestService_Send(t *testing.T) {
+	sender := &mockSender{}
+	s := newService(&mockFetcher{}, &mockCharts{}, sender)
+
+	err := s.Send(context.Background(), templates.Confirmation, "uk", "editor@example.com", false)
+	require.NoError(t, err)
+
+	require.Len(t, sender.sent, 1)
+	assert.Equal(t, "editor@example.com", sender.sent[0].To)
+	assert.True(t, strings.HasPrefix(sender.sent[0].Subject, "[Test] Підтвердьте підписку"))
+	assert.Contains(t, sender.sent[0].Body, "editor@example.com")
+}
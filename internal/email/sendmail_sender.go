@@ -0,0 +1,52 @@
+package email
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os/exec"
+	"time"
+)
+
+const sendmailTimeout = 30 * time.Second
+
+// SendmailSender implements the Sender interface by piping the messages to a local
+// sendmail-compatible binary.
+type SendmailSender struct {
+	Path   string
+	Config Config
+	// Signer, if set, signs every message before it is sent.
+	Signer Signer
+}
+
+// NewSendmailSender creates a new SendmailSender.
+func NewSendmailSender(path string, cfg Config) *SendmailSender {
+	return &SendmailSender{
+		Path:   path,
+		Config: cfg,
+	}
+}
+
+// Send pipes the message to sendmail and returns its output, if any.
+func (ss *SendmailSender) Send(params Params) (string, error) {
+	msg, err := writeMessage(ss.Config.Email, params, ss.Signer)
+	if err != nil {
+		return "", err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), sendmailTimeout)
+	defer cancel()
+
+	// -i keeps lines with a single dot, -f sets the envelope sender
+	cmd := exec.CommandContext(ctx, ss.Path, "-i", "-f", ss.Config.Email, "--", params.To)
+	cmd.Stdin = bytes.NewReader(msg)
+
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+
+	if err = cmd.Run(); err != nil {
+		return "", fmt.Errorf("sendmail failed: %w: %s", err, bytes.TrimSpace(stderr.Bytes()))
+	}
+
+	return string(bytes.TrimSpace(stdout.Bytes())), nil
+}
@@ -0,0 +1,75 @@
+package templates
+
+import (
+	"math"
+	"time"
+)
+
+// Names of the embedded templates.
+const (
+	// Digest is the daily rate email, rendered with RateContext.
+	Digest = "digest"
+	// Confirmation asks to confirm a subscription, rendered with ConfirmationContext.
+	Confirmation = "confirmation"
+	// Alert notifies of a significant rate change, rendered with RateContext.
+	Alert = "alert"
+	// Welcome greets a new subscriber, rendered with WelcomeContext.
+	Welcome = "welcome"
+)
+
+// Names are the names of the embedded templates.
+var Names = []string{Digest, Confirmation, Alert, Welcome}
+
+// RateContext is the data the rate emails are rendered with.
+type RateContext struct {
+	Base         string
+	Target       string
+	Rate         float64
+	PreviousRate float64 // zero if unknown
+	Date         time.Time
+	// Chart is the content ID of the inline chart of the recent rates, empty if the
+	// email has none.
+	Chart string
+}
+
+// HasPrevious reports whether the previous rate is known.
+func (c RateContext) HasPrevious() bool {
+	return c.PreviousRate != 0
+}
+
+// Change returns the absolute change of the rate since the previous one.
+func (c RateContext) Change() float64 {
+	if !c.HasPrevious() {
+		return 0
+	}
+	return c.Rate - c.PreviousRate
+}
+
+// ChangePercent returns the relative change of the rate since the previous one,
+// in percent.
+func (c RateContext) ChangePercent() float64 {
+	if !c.HasPrevious() {
+		return 0
+	}
+	return c.Change() / c.PreviousRate * 100
+}
+
+// AbsChangePercent returns the absolute value of ChangePercent.
+func (c RateContext) AbsChangePercent() float64 {
+	return math.Abs(c.ChangePercent())
+}
+
+// ConfirmationContext is the data the confirmation emails are rendered with.
+type ConfirmationContext struct {
+	Email      string
+	Base       string
+	Target     string
+	ConfirmURL string
+}
+
+// WelcomeContext is the data the welcome emails are rendered with. The rate is the
+// one as of the subscription, zero if it could not be fetched.
+type WelcomeContext struct {
+	Email string
+	RateContext
+}
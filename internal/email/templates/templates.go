@@ -0,0 +1,159 @@
+package templates
+
+import (
+	"bytes"
+	"embed"
+	"errors"
+	"fmt"
+	htmltemplate "html/template"
+	"io/fs"
+	"os"
+	"strings"
+	texttemplate "text/template"
+)
+
+// DefaultLocale is the locale used when a template is not available in the
+// requested one.
+const DefaultLocale = "en"
+
+// Locales are the locales the embedded templates are available in.
+var Locales = []string{"en", "uk"}
+
+var ErrTemplateNotFound = errors.New("template not found")
+
+//go:embed files
+var embedded embed.FS
+
+// Email is a rendered email.
+type Email struct {
+	Subject string `json:"subject"`
+	HTML    string `json:"html"`
+	Text    string `json:"text"`
+}
+
+// Renderer renders email templates. Every template consists of a text part, which
+// also defines the `subject` template, and an HTML part, stored as
+// `<name>.<locale>.txt` and `<name>.<locale>.html` files.
+type Renderer struct {
+	sources []fs.FS // in the order of precedence
+}
+
+// New creates a new Renderer of the embedded templates. If dir is not empty, the
+// templates found there override the embedded ones. Templates are read on every
+// render, so the overrides can be edited without a restart.
+func New(dir string) *Renderer {
+	files, _ := fs.Sub(embedded, "files")
+
+	var sources []fs.FS
+	if dir != "" {
+		sources = append(sources, os.DirFS(dir))
+	}
+	sources = append(sources, files)
+
+	return &Renderer{sources: sources}
+}
+
+// Render renders the named template in the given locale, falling back to the base
+// language of the locale and then to DefaultLocale.
+func (r *Renderer) Render(name, locale string, data any) (Email, error) {
+	loc, err := r.resolveLocale(name, locale)
+	if err != nil {
+		return Email{}, err
+	}
+
+	textSrc, err := r.read(name + "." + loc + ".txt")
+	if err != nil {
+		return Email{}, err
+	}
+
+	htmlSrc, err := r.read(name + "." + loc + ".html")
+	if err != nil {
+		return Email{}, err
+	}
+
+	var e Email
+
+	tt, err := texttemplate.New(name).Option("missingkey=error").Parse(textSrc)
+	if err != nil {
+		return Email{}, fmt.Errorf("failed to parse text template %s: %w", name, err)
+	}
+
+	if tt.Lookup("subject") == nil {
+		return Email{}, fmt.Errorf("text template %s does not define a subject", name)
+	}
+
+	var buf bytes.Buffer
+	if err = tt.ExecuteTemplate(&buf, "subject", data); err != nil {
+		return Email{}, fmt.Errorf("failed to render subject of %s: %w", name, err)
+	}
+	e.Subject = strings.TrimSpace(buf.String())
+
+	buf.Reset()
+	if err = tt.Execute(&buf, data); err != nil {
+		return Email{}, fmt.Errorf("failed to render text template %s: %w", name, err)
+	}
+	e.Text = strings.TrimSpace(buf.String()) + "\n"
+
+	ht, err := htmltemplate.New(name).Option("missingkey=error").Parse(htmlSrc)
+	if err != nil {
+		return Email{}, fmt.Errorf("failed to parse html template %s: %w", name, err)
+	}
+
+	buf.Reset()
+	if err = ht.Execute(&buf, data); err != nil {
+		return Email{}, fmt.Errorf("failed to render html template %s: %w", name, err)
+	}
+	e.HTML = buf.String()
+
+	return e, nil
+}
+
+// resolveLocale returns the first locale the named template is available in.
+func (r *Renderer) resolveLocale(name, locale string) (string, error) {
+	candidates := []string{strings.ToLower(locale)}
+	if base, _, found := strings.Cut(candidates[0], "-"); found {
+		candidates = append(candidates, base)
+	}
+	candidates = append(candidates, DefaultLocale)
+
+	for _, loc := range candidates {
+		if _, err := r.read(name + "." + loc + ".txt"); err == nil {
+			return loc, nil
+		}
+	}
+
+	return "", fmt.Errorf("%w: %s", ErrTemplateNotFound, name)
+}
+
+// read reads the file from the first source it is found in.
+func (r *Renderer) read(file string) (string, error) {
+	for _, src := range r.sources {
+		b, err := fs.ReadFile(src, file)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return "", err
+		}
+		return string(b), nil
+	}
+	return "", fmt.Errorf("%w: %s", ErrTemplateNotFound, file)
+}
+
+// MatchLocale returns the supported locale that matches the language tag, such as
+// `uk-UA`, or an Accept-Language header value. It returns DefaultLocale if none of
+// them match.
+func MatchLocale(tags string) string {
+	for _, tag := range strings.Split(tags, ",") {
+		tag, _, _ = strings.Cut(tag, ";")
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		base, _, _ := strings.Cut(tag, "-")
+
+		for _, loc := range Locales {
+			if tag == loc || base == loc {
+				return loc
+			}
+		}
+	}
+	return DefaultLocale
+}
@@ -0,0 +1,133 @@
+package templates_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/vladyslavpavlenko/genesis-api-project/internal/email/templates"
+)
+
+var rateContext = templates.RateContext{
+	Base:         "USD",
+	Target:       "UAH",
+	Rate:         41.5,
+	PreviousRate: 41,
+	Date:         time.Date(2024, time.June, 1, 10, 0, 0, 0, time.UTC),
+}
+
+func TestRenderer_Render(t *testing.T) {
+	r := templates.New("")
+
+	e, err := r.Render("digest", "en", rateContext)
+	require.NoError(t, err)
+
+	assert.Equal(t, "USD to UAH Exchange Rate", e.Subject)
+	assert.Contains(t, e.Text, "is 41.50.")
+	assert.Contains(t, e.Text, "changed by +0.50 (+1.22%)")
+	assert.Contains(t, e.HTML, "<strong style=\"font-size: 1.4em;\">41.50</strong>")
+	assert.NotContains(t, e.HTML, "<img")
+}
+
+func TestRenderer_RenderChart(t *testing.T) {
+	rc := rateContext
+	rc.Chart = "chart.png"
+
+	e, err := templates.New("").Render("digest", "en", rc)
+	require.NoError(t, err)
+
+	assert.Contains(t, e.HTML, `<img src="cid:chart.png"`)
+}
+
+func TestRenderer_RenderLocale(t *testing.T) {
+	r := templates.New("")
+
+	e, err := r.Render("digest", "uk-UA", rateContext)
+	require.NoError(t, err)
+	assert.Equal(t, "Курс USD до UAH", e.Subject)
+	assert.Contains(t, e.Text, "01.06.2024")
+
+	// Unsupported locales fall back to the default one
+	e, err = r.Render("digest", "de", rateContext)
+	require.NoError(t, err)
+	assert.Equal(t, "USD to UAH Exchange Rate", e.Subject)
+}
+
+func TestRenderer_RenderOverride(t *testing.T) {
+	dir := t.TempDir()
+	err := os.WriteFile(filepath.Join(dir, "digest.en.txt"), []byte(`{{define "subject"}}Custom{{end}}Rate: {{.Rate}}`), 0o600)
+	require.NoError(t, err)
+
+	e, err := templates.New(dir).Render("digest", "en", rateContext)
+	require.NoError(t, err)
+
+	assert.Equal(t, "Custom", e.Subject)
+	assert.Equal(t, "Rate: 41.5\n", e.Text)
+
+	// Parts that are not overridden are still embedded
+	assert.Contains(t, e.HTML, "41.50")
+}
+
+func TestRenderer_RenderNotFound(t *testing.T) {
+	_, err := templates.New("").Render("missing", "en", nil)
+	assert.ErrorIs(t, err, templates.ErrTemplateNotFound)
+}
+
+func TestMatchLocale(t *testing.T) {
+	cases := map[string]string{
+		"":                        "en",
+		"uk":                      "uk",
+		"uk-UA":                   "uk",
+		"de-DE,uk;q=0.9,en;q=0.8": "uk",
+		"fr":                      "en",
+	}
+
+	for tag, locale := range cases {
+		assert.Equal(t, locale, templates.MatchLocale(tag), tag)
+	}
+}
+
+func TestRenderer_RenderConfirmation(t *testing.T) {
+	e, err := templates.New("").Render(templates.Confirmation, "en", templates.ConfirmationContext{
+		Email:      "subscriber@example.com",
+		Base:       "USD",
+		Target:     "UAH",
+		ConfirmURL: "https://example.com/confirm?token=abc",
+	})
+	require.NoError(t, err)
+
+	assert.Contains(t, e.Text, "subscriber@example.com")
+	assert.Contains(t, e.Text, "https://example.com/confirm?token=abc")
+	assert.Contains(t, e.HTML, `href="https://example.com/confirm?token=abc"`)
+}
+
+func TestRenderer_RenderAlert(t *testing.T) {
+	rc := rateContext
+	rc.Rate = 40
+
+	e, err := templates.New("").Render(templates.Alert, "en", rc)
+	require.NoError(t, err)
+
+	assert.Contains(t, e.Subject, "2.44%")
+	assert.Contains(t, e.Text, "-1.00")
+}
+
+func TestRenderer_RenderWelcome(t *testing.T) {
+	wc := templates.WelcomeContext{Email: "subscriber@example.com", RateContext: rateContext}
+
+	e, err := templates.New("").Render(templates.Welcome, "uk", wc)
+	require.NoError(t, err)
+	assert.Contains(t, e.Text, "subscriber@example.com")
+	assert.Contains(t, e.Text, "41.50")
+
+	// The rate is left out if it could not be fetched
+	wc.Rate = 0
+	e, err = templates.New("").Render(templates.Welcome, "en", wc)
+	require.NoError(t, err)
+	assert.Contains(t, e.Subject, "Welcome")
+	assert.NotContains(t, e.Text, "current exchange rate")
+	assert.NotContains(t, e.HTML, "current exchange rate")
+}
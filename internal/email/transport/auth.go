@@ -0,0 +1,63 @@
+package transport
+
+import (
+	"errors"
+	"net/smtp"
+	"strings"
+)
+
+// newAuth returns the smtp.Auth of the configured mechanism, or nil if the
+// authentication is disabled.
+func newAuth(cfg *Config) smtp.Auth {
+	switch cfg.Auth {
+	case AuthPlain:
+		return smtp.PlainAuth("", cfg.Username, cfg.Password, cfg.Host)
+	case AuthLogin:
+		return &loginAuth{username: cfg.Username, password: cfg.Password, host: cfg.Host}
+	case AuthCRAMMD5:
+		return smtp.CRAMMD5Auth(cfg.Username, cfg.Password)
+	default:
+		return nil
+	}
+}
+
+// loginAuth implements the LOGIN authentication mechanism, which net/smtp lacks.
+type loginAuth struct {
+	username string
+	password string
+	host     string
+}
+
+// Start begins the authentication with the server.
+func (a *loginAuth) Start(server *smtp.ServerInfo) (proto string, toServer []byte, err error) {
+	// Like smtp.PlainAuth, refuse to send the credentials over an unencrypted
+	// connection to a remote host
+	if !server.TLS && !isLocalhost(server.Name) {
+		return "", nil, errors.New("unencrypted connection")
+	}
+	if server.Name != a.host {
+		return "", nil, errors.New("wrong host name")
+	}
+	return "LOGIN", nil, nil
+}
+
+// Next continues the authentication with the server challenges.
+func (a *loginAuth) Next(fromServer []byte, more bool) ([]byte, error) {
+	if !more {
+		return nil, nil
+	}
+
+	switch strings.ToLower(strings.TrimSpace(string(fromServer))) {
+	case "username:":
+		return []byte(a.username), nil
+	case "password:":
+		return []byte(a.password), nil
+	default:
+		return nil, errors.New("unexpected server challenge")
+	}
+}
+
+// isLocalhost reports whether the host is the local machine.
+func isLocalhost(host string) bool {
+	return host == "localhost" || host == "127.0.0.1" || host == "::1"
+}
@@ -0,0 +1,93 @@
+package transport
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Authentication mechanisms.
+const (
+	AuthPlain   = "plain"
+	AuthLogin   = "login"
+	AuthCRAMMD5 = "cram-md5"
+	AuthNone    = "none"
+)
+
+// TLS modes.
+const (
+	// TLSStartTLS upgrades a plain connection with the STARTTLS command, which the
+	// server is required to support.
+	TLSStartTLS = "starttls"
+	// TLSImplicit connects over TLS right away (SMTPS, usually port 465).
+	TLSImplicit = "implicit"
+	// TLSNone never encrypts the connection.
+	TLSNone = "none"
+)
+
+// Config holds the SMTP transport configuration.
+type Config struct {
+	Host     string
+	Port     int
+	Username string
+	Password string
+	Auth     string // AuthPlain, AuthLogin, AuthCRAMMD5, AuthNone
+	TLS      string // TLSStartTLS, TLSImplicit, TLSNone
+
+	// LocalName is the host name sent with the EHLO command.
+	LocalName string
+
+	// PoolSize is the maximum number of connections open at the same time.
+	PoolSize int
+	// MaxMessagesPerConn is the number of messages after which a connection is
+	// closed and replaced by a new one.
+	MaxMessagesPerConn int
+	// KeepAlive is the interval at which idle connections are checked with NOOP.
+	KeepAlive time.Duration
+	// IdleTimeout is the time after which an idle connection is closed.
+	IdleTimeout time.Duration
+	// DialTimeout bounds establishing a connection.
+	DialTimeout time.Duration
+
+	// Signer, if set, signs every message before it is sent, e.g. with DKIM.
+	Signer Signer
+}
+
+// Signer signs a message, returning it with the signature added.
+type Signer interface {
+	Sign(msg []byte) ([]byte, error)
+}
+
+// Validate validates an instance of Config to check whether the provided parameters
+// are correct.
+func (cfg *Config) Validate() error {
+	if cfg.Host == "" {
+		return errors.New("smtp host is empty")
+	}
+
+	if cfg.Port <= 0 || cfg.Port > 65535 {
+		return fmt.Errorf("smtp port %d is invalid", cfg.Port)
+	}
+
+	switch cfg.Auth {
+	case AuthPlain, AuthLogin, AuthCRAMMD5:
+		if cfg.Username == "" {
+			return fmt.Errorf("smtp username is required for %s auth", cfg.Auth)
+		}
+	case AuthNone:
+	default:
+		return fmt.Errorf("smtp auth %q is unsupported", cfg.Auth)
+	}
+
+	switch cfg.TLS {
+	case TLSStartTLS, TLSImplicit, TLSNone:
+	default:
+		return fmt.Errorf("smtp tls mode %q is unsupported", cfg.TLS)
+	}
+
+	if cfg.PoolSize < 1 {
+		return errors.New("smtp pool size must be positive")
+	}
+
+	return nil
+}
@@ -0,0 +1,188 @@
+package transport
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"strconv"
+	"time"
+
+	"gopkg.in/gomail.v2"
+)
+
+// conn is a single connection to the SMTP server. It implements gomail.SendCloser.
+type conn struct {
+	client   *smtp.Client
+	sent     int
+	lastUsed time.Time
+}
+
+// dial connects to the SMTP server, negotiates TLS according to the configured mode
+// and authenticates.
+func dial(cfg *Config) (*conn, error) {
+	addr := net.JoinHostPort(cfg.Host, strconv.Itoa(cfg.Port))
+	dialer := &net.Dialer{Timeout: cfg.DialTimeout}
+	tlsConfig := &tls.Config{ServerName: cfg.Host, MinVersion: tls.VersionTLS12}
+
+	var (
+		nc  net.Conn
+		err error
+	)
+	if cfg.TLS == TLSImplicit {
+		nc, err = tls.DialWithDialer(dialer, "tcp", addr, tlsConfig)
+	} else {
+		nc, err = dialer.Dial("tcp", addr)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error connecting to %s: %w", addr, err)
+	}
+
+	c, err := smtp.NewClient(nc, cfg.Host)
+	if err != nil {
+		nc.Close()
+		return nil, err
+	}
+
+	if err = setup(c, cfg, tlsConfig); err != nil {
+		c.Close()
+		return nil, err
+	}
+
+	return &conn{client: c, lastUsed: time.Now()}, nil
+}
+
+// setup greets the server, upgrades the connection with STARTTLS if required and
+// authenticates.
+func setup(c *smtp.Client, cfg *Config, tlsConfig *tls.Config) error {
+	if cfg.LocalName != "" {
+		if err := c.Hello(cfg.LocalName); err != nil {
+			return err
+		}
+	}
+
+	if cfg.TLS == TLSStartTLS {
+		if ok, _ := c.Extension("STARTTLS"); !ok {
+			return errors.New("smtp server does not support STARTTLS")
+		}
+		if err := c.StartTLS(tlsConfig); err != nil {
+			return err
+		}
+	}
+
+	if auth := newAuth(cfg); auth != nil {
+		if ok, _ := c.Extension("AUTH"); !ok {
+			return errors.New("smtp server does not support AUTH")
+		}
+		if err := c.Auth(auth); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Send sends the message over the connection and returns the reply of the server
+// to the message, which usually holds its queue ID. The errors returned by the server
+// are returned as is, so that the callers can inspect the *textproto.Error.
+func (c *conn) Send(from string, to []string, msg io.WriterTo) (string, error) {
+	err := c.client.Mail(from)
+	if err != nil {
+		return "", err
+	}
+
+	for _, addr := range to {
+		if err = c.client.Rcpt(addr); err != nil {
+			return "", err
+		}
+	}
+
+	// smtp.Client.Data discards the reply to the message, so the DATA command is
+	// issued directly
+	id, err := c.client.Text.Cmd("DATA")
+	if err != nil {
+		return "", err
+	}
+	c.client.Text.StartResponse(id)
+	_, _, err = c.client.Text.ReadResponse(354)
+	c.client.Text.EndResponse(id)
+	if err != nil {
+		return "", err
+	}
+
+	w := c.client.Text.DotWriter()
+	if _, err = msg.WriteTo(w); err != nil {
+		w.Close()
+		return "", err
+	}
+	if err = w.Close(); err != nil {
+		return "", err
+	}
+
+	code, reply, err := c.client.Text.ReadResponse(250)
+	if err != nil {
+		return "", err
+	}
+
+	c.sent++
+	c.lastUsed = time.Now()
+
+	return fmt.Sprintf("%d %s", code, reply), nil
+}
+
+// reset aborts the current mail transaction so that the connection can be reused.
+func (c *conn) reset() error {
+	return c.client.Reset()
+}
+
+// noop checks whether the connection is still alive.
+func (c *conn) noop() error {
+	return c.client.Noop()
+}
+
+// Close closes the connection gracefully, falling back to closing the underlying
+// network connection.
+func (c *conn) Close() error {
+	if err := c.client.Quit(); err != nil {
+		return c.client.Close()
+	}
+	return nil
+}
+
+// envelope returns the envelope sender and recipients of the message.
+func envelope(m *gomail.Message) (from string, to []string, err error) {
+	fromHeader := m.GetHeader("Sender")
+	if len(fromHeader) == 0 {
+		fromHeader = m.GetHeader("From")
+	}
+	if len(fromHeader) == 0 {
+		return "", nil, errors.New(`message has no "From" header`)
+	}
+
+	addr, err := mail.ParseAddress(fromHeader[0])
+	if err != nil {
+		return "", nil, fmt.Errorf("invalid sender address: %w", err)
+	}
+	from = addr.Address
+
+	for _, field := range []string{"To", "Cc", "Bcc"} {
+		for _, v := range m.GetHeader(field) {
+			list, err := mail.ParseAddressList(v)
+			if err != nil {
+				return "", nil, fmt.Errorf("invalid %s address: %w", field, err)
+			}
+			for _, a := range list {
+				to = append(to, a.Address)
+			}
+		}
+	}
+
+	if len(to) == 0 {
+		return "", nil, errors.New("message has no recipients")
+	}
+
+	return from, to, nil
+}
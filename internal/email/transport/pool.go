@@ -0,0 +1,298 @@
+package transport
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net/textproto"
+	"sync"
+	"time"
+
+	"gopkg.in/gomail.v2"
+)
+
+// ErrPoolClosed is returned when sending through a closed Pool.
+var ErrPoolClosed = errors.New("smtp pool is closed")
+
+// Default values used for the unset Config fields.
+const (
+	defaultMaxMessagesPerConn = 100
+	defaultKeepAlive          = 30 * time.Second
+	defaultIdleTimeout        = 2 * time.Minute
+	defaultDialTimeout        = 10 * time.Second
+)
+
+// Pool is a pool of persistent SMTP connections. It implements the email.Dialer
+// interface, so it can be used in place of gomail.Dialer, which opens a new
+// connection for every call.
+type Pool struct {
+	cfg   Config
+	idle  chan *conn
+	slots chan struct{}
+
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// NewPool creates a new Pool and starts checking its idle connections.
+func NewPool(cfg Config) (*Pool, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+
+	if cfg.MaxMessagesPerConn == 0 {
+		cfg.MaxMessagesPerConn = defaultMaxMessagesPerConn
+	}
+	if cfg.KeepAlive == 0 {
+		cfg.KeepAlive = defaultKeepAlive
+	}
+	if cfg.IdleTimeout == 0 {
+		cfg.IdleTimeout = defaultIdleTimeout
+	}
+	if cfg.DialTimeout == 0 {
+		cfg.DialTimeout = defaultDialTimeout
+	}
+
+	p := &Pool{
+		cfg:   cfg,
+		idle:  make(chan *conn, cfg.PoolSize),
+		slots: make(chan struct{}, cfg.PoolSize),
+		done:  make(chan struct{}),
+	}
+
+	go p.keepAlive()
+
+	return p, nil
+}
+
+// DialAndSend sends the messages over the pooled connections.
+func (p *Pool) DialAndSend(m ...*gomail.Message) error {
+	for i, msg := range m {
+		if _, err := p.send(msg); err != nil {
+			return fmt.Errorf("error sending email %d: %w", i+1, err)
+		}
+	}
+	return nil
+}
+
+// Send sends the message over a pooled connection and returns the reply of the
+// server to it.
+func (p *Pool) Send(m *gomail.Message) (string, error) {
+	return p.send(m)
+}
+
+// Close closes the idle connections. The connections in use are closed once they
+// are released.
+func (p *Pool) Close() error {
+	p.closeOnce.Do(func() {
+		close(p.done)
+		for {
+			select {
+			case c := <-p.idle:
+				p.discard(c)
+			default:
+				return
+			}
+		}
+	})
+	return nil
+}
+
+// send sends the message and returns the reply of the server. If a reused
+// connection turns out to be broken, the message is resent over another one.
+func (p *Pool) send(m *gomail.Message) (string, error) {
+	from, to, err := envelope(m)
+	if err != nil {
+		return "", err
+	}
+
+	msg, err := p.message(m)
+	if err != nil {
+		return "", err
+	}
+
+	for {
+		c, reused, err := p.get()
+		if err != nil {
+			return "", err
+		}
+
+		// Every attempt reads the message anew, as a failed one may have read it
+		// partially
+		reply, err := c.Send(from, to, bytes.NewReader(msg))
+		if err == nil {
+			p.put(c)
+			return reply, nil
+		}
+
+		// The server rejected the message, but the connection is still usable
+		var tpErr *textproto.Error
+		if errors.As(err, &tpErr) {
+			if c.reset() != nil {
+				p.discard(c)
+			} else {
+				p.put(c)
+			}
+			return "", err
+		}
+
+		p.discard(c)
+
+		// A freshly dialed connection failed, so the server is likely unreachable
+		if !reused {
+			return "", err
+		}
+	}
+}
+
+// message writes the message and signs it if a Signer is configured. The Bcc header
+// field is left out, the same way gomail does when sending, so that the Bcc recipients
+// are only disclosed in the envelope and are not covered by the signature.
+func (p *Pool) message(m *gomail.Message) ([]byte, error) {
+	var buf bytes.Buffer
+	if _, err := m.WriteTo(&buf); err != nil {
+		return nil, fmt.Errorf("error writing message: %w", err)
+	}
+	msg := stripBcc(buf.Bytes())
+
+	if p.cfg.Signer == nil {
+		return msg, nil
+	}
+
+	signed, err := p.cfg.Signer.Sign(msg)
+	if err != nil {
+		return nil, fmt.Errorf("error signing message: %w", err)
+	}
+
+	return signed, nil
+}
+
+// stripBcc removes the Bcc header field, including its continuation lines, from the
+// message. gomail only leaves out the field set as "Bcc", so other spellings of its
+// name are removed here as well.
+func stripBcc(msg []byte) []byte {
+	// The header ends with the first empty line
+	end := bytes.Index(msg, []byte("\r\n\r\n"))
+	if end < 0 {
+		return msg
+	}
+
+	out := make([]byte, 0, len(msg))
+	skip := false
+	for _, line := range bytes.SplitAfter(msg[:end+2], []byte("\r\n")) {
+		if len(line) > 0 && line[0] != ' ' && line[0] != '\t' {
+			name, _, _ := bytes.Cut(line, []byte(":"))
+			skip = bytes.EqualFold(bytes.TrimSpace(name), []byte("Bcc"))
+		}
+		if !skip {
+			out = append(out, line...)
+		}
+	}
+
+	return append(out, msg[end+2:]...)
+}
+
+// get returns an idle connection or dials a new one if the pool is not full. It
+// reports whether the connection has been used before.
+func (p *Pool) get() (c *conn, reused bool, err error) {
+	for {
+		select {
+		case <-p.done:
+			return nil, false, ErrPoolClosed
+		default:
+		}
+
+		// Prefer the idle connections over dialing new ones
+		select {
+		case c = <-p.idle:
+			if p.expired(c) {
+				p.discard(c)
+				continue
+			}
+			return c, true, nil
+		default:
+		}
+
+		select {
+		case <-p.done:
+			return nil, false, ErrPoolClosed
+		case c = <-p.idle:
+			if p.expired(c) {
+				p.discard(c)
+				continue
+			}
+			return c, true, nil
+		case p.slots <- struct{}{}:
+			c, err = dial(&p.cfg)
+			if err != nil {
+				<-p.slots
+				return nil, false, err
+			}
+			return c, false, nil
+		}
+	}
+}
+
+// put returns the connection to the pool, closing it if it has reached the limit
+// of messages or if the pool is closed.
+func (p *Pool) put(c *conn) {
+	if c.sent >= p.cfg.MaxMessagesPerConn {
+		p.discard(c)
+		return
+	}
+
+	select {
+	case <-p.done:
+		p.discard(c)
+	default:
+		// Never blocks, since the number of open connections is bounded by the
+		// capacity of the idle channel
+		p.idle <- c
+	}
+}
+
+// expired reports whether the connection has been idle for longer than the
+// IdleTimeout.
+func (p *Pool) expired(c *conn) bool {
+	return time.Since(c.lastUsed) > p.cfg.IdleTimeout
+}
+
+// discard closes the connection and frees its slot.
+func (p *Pool) discard(c *conn) {
+	_ = c.Close()
+	<-p.slots
+}
+
+// keepAlive periodically checks the idle connections with NOOP, closing the
+// broken ones and those idle for longer than the IdleTimeout.
+func (p *Pool) keepAlive() {
+	ticker := time.NewTicker(p.cfg.KeepAlive)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-p.done:
+			return
+		case <-ticker.C:
+			p.checkIdle()
+		}
+	}
+}
+
+// checkIdle checks each of the currently idle connections once.
+func (p *Pool) checkIdle() {
+	for n := len(p.idle); n > 0; n-- {
+		var c *conn
+		select {
+		case c = <-p.idle:
+		default:
+			return
+		}
+
+		if p.expired(c) || c.noop() != nil {
+			p.discard(c)
+			continue
+		}
+		p.put(c)
+	}
+}
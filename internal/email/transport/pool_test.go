@@ -0,0 +1,298 @@
+package transport_test
+
+import (
+	"errors"
+	"net"
+	"net/textproto"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/vladyslavpavlenko/genesis-api-project/internal/email/transport"
+	"gopkg.in/gomail.v2"
+)
+
+// fakeServer is a minimal SMTP server that accepts every message except those
+// addressed to rejected recipients.
+type fakeServer struct {
+	ln       net.Listener
+	conns    atomic.Int32
+	messages atomic.Int32
+	rejected string
+	wg       sync.WaitGroup
+
+	// drops is the number of connections to drop once they issue MAIL
+	drops atomic.Int32
+
+	mu   sync.Mutex
+	rcpt []string
+	data []string
+}
+
+func newFakeServer(t *testing.T) *fakeServer {
+	t.Helper()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	s := &fakeServer{ln: ln, rejected: "rejected@example.com"}
+	s.wg.Add(1)
+	go s.serve()
+
+	t.Cleanup(func() {
+		ln.Close()
+		s.wg.Wait()
+	})
+
+	return s
+}
+
+func (s *fakeServer) port() int {
+	return s.ln.Addr().(*net.TCPAddr).Port
+}
+
+func (s *fakeServer) serve() {
+	defer s.wg.Done()
+	for {
+		c, err := s.ln.Accept()
+		if err != nil {
+			return
+		}
+		s.conns.Add(1)
+		s.wg.Add(1)
+		go s.handle(c)
+	}
+}
+
+func (s *fakeServer) handle(c net.Conn) {
+	defer s.wg.Done()
+	defer c.Close()
+
+	tp := textproto.NewConn(c)
+	_ = tp.PrintfLine("220 localhost ESMTP")
+
+	for {
+		line, err := tp.ReadLine()
+		if err != nil {
+			return
+		}
+
+		cmd := strings.ToUpper(strings.SplitN(line, " ", 2)[0])
+		switch cmd {
+		case "EHLO", "HELO":
+			_ = tp.PrintfLine("250 localhost")
+		case "MAIL":
+			if s.drops.Add(-1) >= 0 {
+				return
+			}
+			_ = tp.PrintfLine("250 OK")
+		case "RCPT":
+			if strings.Contains(line, s.rejected) {
+				_ = tp.PrintfLine("550 5.1.1 User unknown")
+				continue
+			}
+			s.mu.Lock()
+			s.rcpt = append(s.rcpt, line)
+			s.mu.Unlock()
+			_ = tp.PrintfLine("250 OK")
+		case "DATA":
+			_ = tp.PrintfLine("354 Go ahead")
+			data, err := tp.ReadDotBytes()
+			if err != nil {
+				return
+			}
+			s.mu.Lock()
+			s.data = append(s.data, string(data))
+			s.mu.Unlock()
+			n := s.messages.Add(1)
+			_ = tp.PrintfLine("250 2.0.0 Ok: queued as Q%d", n)
+		case "QUIT":
+			_ = tp.PrintfLine("221 Bye")
+			return
+		default:
+			_ = tp.PrintfLine("250 OK")
+		}
+	}
+}
+
+// received returns the recipients and the data of the received messages.
+func (s *fakeServer) received() (rcpt, data []string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return slices.Clone(s.rcpt), slices.Clone(s.data)
+}
+
+func newMessage(to string) *gomail.Message {
+	m := gomail.NewMessage()
+	m.SetHeader("From", "sender@example.com")
+	m.SetHeader("To", to)
+	m.SetHeader("Subject", "Test")
+	m.SetBody("text/plain", "Hello")
+	return m
+}
+
+// prefixSigner "signs" the messages by prepending a header field to them.
+type prefixSigner struct{}
+
+func (prefixSigner) Sign(msg []byte) ([]byte, error) {
+	return append([]byte("X-Signature: test\r\n"), msg...), nil
+}
+
+func newPool(t *testing.T, s *fakeServer, maxMessages int) *transport.Pool {
+	t.Helper()
+	return newSigningPool(t, s, maxMessages, nil)
+}
+
+func newSigningPool(t *testing.T, s *fakeServer, maxMessages int, signer transport.Signer) *transport.Pool {
+	t.Helper()
+
+	p, err := transport.NewPool(transport.Config{
+		Host:               "127.0.0.1",
+		Port:               s.port(),
+		Auth:               transport.AuthNone,
+		TLS:                transport.TLSNone,
+		PoolSize:           2,
+		MaxMessagesPerConn: maxMessages,
+		Signer:             signer,
+	})
+	require.NoError(t, err)
+	t.Cleanup(func() { p.Close() })
+
+	return p
+}
+
+func TestPool_ReusesConnections(t *testing.T) {
+	s := newFakeServer(t)
+	p := newPool(t, s, 100)
+
+	for i := 0; i < 10; i++ {
+		require.NoError(t, p.DialAndSend(newMessage("user"+strconv.Itoa(i)+"@example.com")))
+	}
+
+	assert.Equal(t, int32(10), s.messages.Load())
+	assert.Equal(t, int32(1), s.conns.Load())
+}
+
+func TestPool_MaxMessagesPerConn(t *testing.T) {
+	s := newFakeServer(t)
+	p := newPool(t, s, 3)
+
+	for i := 0; i < 7; i++ {
+		require.NoError(t, p.DialAndSend(newMessage("user@example.com")))
+	}
+
+	assert.Equal(t, int32(7), s.messages.Load())
+	assert.Equal(t, int32(3), s.conns.Load())
+}
+
+func TestPool_PreservesServerErrors(t *testing.T) {
+	s := newFakeServer(t)
+	p := newPool(t, s, 100)
+
+	err := p.DialAndSend(newMessage(s.rejected))
+
+	var tpErr *textproto.Error
+	require.True(t, errors.As(err, &tpErr))
+	assert.Equal(t, 550, tpErr.Code)
+
+	// The connection survives the rejection
+	require.NoError(t, p.DialAndSend(newMessage("user@example.com")))
+	assert.Equal(t, int32(1), s.conns.Load())
+}
+
+func TestPool_Closed(t *testing.T) {
+	s := newFakeServer(t)
+	p := newPool(t, s, 100)
+	require.NoError(t, p.Close())
+
+	err := p.DialAndSend(newMessage("user@example.com"))
+	assert.ErrorIs(t, err, transport.ErrPoolClosed)
+}
+
+func TestConfig_Validate(t *testing.T) {
+	valid := transport.Config{
+		Host: "smtp.example.com", Port: 587, Username: "user",
+		Auth: transport.AuthLogin, TLS: transport.TLSStartTLS, PoolSize: 1,
+	}
+	require.NoError(t, valid.Validate())
+
+	tests := map[string]func(c *transport.Config){
+		"empty host":       func(c *transport.Config) { c.Host = "" },
+		"invalid port":     func(c *transport.Config) { c.Port = 0 },
+		"unknown auth":     func(c *transport.Config) { c.Auth = "xoauth2" },
+		"missing username": func(c *transport.Config) { c.Username = "" },
+		"unknown tls mode": func(c *transport.Config) { c.TLS = "ssl" },
+		"empty pool":       func(c *transport.Config) { c.PoolSize = 0 },
+	}
+	for name, mutate := range tests {
+		t.Run(name, func(t *testing.T) {
+			cfg := valid
+			mutate(&cfg)
+			assert.Error(t, cfg.Validate())
+		})
+	}
+}
+
+func TestPool_Send(t *testing.T) {
+	s := newFakeServer(t)
+	p := newPool(t, s, 0)
+
+	// The reply to the message is returned, along with the queue ID
+	reply, err := p.Send(newMessage("user@example.com"))
+	require.NoError(t, err)
+	assert.Equal(t, "250 2.0.0 Ok: queued as Q1", reply)
+
+	reply, err = p.Send(newMessage("user@example.com"))
+	require.NoError(t, err)
+	assert.Equal(t, "250 2.0.0 Ok: queued as Q2", reply)
+
+	_, err = p.Send(newMessage(s.rejected))
+	var tpErr *textproto.Error
+	require.ErrorAs(t, err, &tpErr)
+	assert.Equal(t, 550, tpErr.Code)
+}
+
+func TestPool_RetriesBrokenConnection(t *testing.T) {
+	s := newFakeServer(t)
+	p := newSigningPool(t, s, 0, prefixSigner{})
+
+	_, err := p.Send(newMessage("user@example.com"))
+	require.NoError(t, err)
+
+	// The idle connection is dropped, so the message is resent over a new one
+	s.drops.Store(1)
+	_, err = p.Send(newMessage("user@example.com"))
+	require.NoError(t, err)
+	assert.Equal(t, int32(2), s.conns.Load())
+
+	// The resent message is complete
+	_, data := s.received()
+	require.Len(t, data, 2)
+	assert.True(t, strings.HasPrefix(data[1], "X-Signature: test\n"))
+	assert.Contains(t, data[1], "Hello")
+}
+
+func TestPool_StripsBcc(t *testing.T) {
+	s := newFakeServer(t)
+	p := newSigningPool(t, s, 0, prefixSigner{})
+
+	m := newMessage("user@example.com")
+	m.SetHeader("Bcc", "hidden@example.com")
+	m.SetHeader("BCC", "other@example.com")
+	_, err := p.Send(m)
+	require.NoError(t, err)
+
+	// The Bcc recipients are only disclosed in the envelope
+	rcpt, data := s.received()
+	assert.Contains(t, rcpt, "RCPT TO:<hidden@example.com>")
+	require.Len(t, data, 1)
+	assert.NotContains(t, strings.ToLower(data[0]), "bcc")
+	assert.NotContains(t, data[0], "hidden@example.com")
+	assert.NotContains(t, data[0], "other@example.com")
+	assert.Contains(t, data[0], "To: user@example.com")
+}
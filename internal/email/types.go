@@ -2,16 +2,42 @@ package email
 
 import (
 	"net/mail"
+	"strings"
 
 	"gopkg.in/gomail.v2"
 )
 
 type Email string
 
-// Validate checks if the given email address is valid.
+// Validate checks if the given email address is valid. Addresses with a display
+// name, e.g. `Bob <bob@example.com>`, are not valid.
 func (e Email) Validate() bool {
-	_, err := mail.ParseAddress(string(e))
-	return err == nil
+	addr, err := mail.ParseAddress(string(e))
+	return err == nil && addr.Name == "" && addr.Address == string(e)
+}
+
+// Masked returns the address with all but the first character of the local part
+// hidden, e.g. `b***@example.com`, so that it can be logged.
+func (e Email) Masked() string {
+	addr := string(e)
+	i := strings.LastIndex(addr, "@")
+	if i <= 0 {
+		return "***"
+	}
+	return addr[:1] + "***" + addr[i:]
+}
+
+// Sender defines an interface for sending emails. Send returns the reply of the
+// server that has accepted the email, e.g. the SMTP status line with the queue ID,
+// or an empty string if there is none.
+type Sender interface {
+	Send(params Params) (string, error)
+}
+
+// Signer defines an interface for signing messages, e.g. with DKIM. Sign returns the
+// message with the signature added.
+type Signer interface {
+	Sign(msg []byte) ([]byte, error)
 }
 
 // Dialer defines an interface for a dialer to an SMTP server.
@@ -19,9 +45,20 @@ type Dialer interface {
 	DialAndSend(m ...*gomail.Message) error
 }
 
-// Params holds the email message data.
+// Params holds the email message data. If HTML is set, the email is sent as
+// multipart/alternative with Body as the plain-text alternative.
 type Params struct {
 	To      string
 	Subject string
 	Body    string
+	HTML    string
+	Inline  []Inline
+}
+
+// Inline is a file embedded into the email, which the HTML part refers to as
+// `cid:<Name>`, e.g. an image.
+type Inline struct {
+	Name        string
+	ContentType string
+	Data        []byte
 }
@@ -13,6 +13,9 @@ func TestEmail_Validate(t *testing.T) {
 	}{
 		{"test@example.com", true},
 		{"invalid-email", false},
+		{"Bob <bob@example.com>", false},
+		{"<bob@example.com>", false},
+		{" bob@example.com", false},
 	}
 
 	for _, tc := range cases {
@@ -22,3 +25,23 @@ func TestEmail_Validate(t *testing.T) {
 		}
 	}
 }
+
+func TestEmail_Masked(t *testing.T) {
+	cases := []struct {
+		email  string
+		masked string
+	}{
+		{"bob@example.com", "b***@example.com"},
+		{"b@example.com", "b***@example.com"},
+		{"alice+news@x.example", "a***@x.example"},
+		{"@example.com", "***"},
+		{"invalid-email", "***"},
+		{"", "***"},
+	}
+
+	for _, tc := range cases {
+		if got := email.Email(tc.email).Masked(); got != tc.masked {
+			t.Errorf("Expected %s for masked %s, got %s", tc.masked, tc.email, got)
+		}
+	}
+}
@@ -0,0 +1,68 @@
+package handlers
+
+import (
+	"crypto/subtle"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/go-chi/chi"
+	"github.com/vladyslavpavlenko/genesis-api-project/pkg/jsonutils"
+)
+
+const (
+	defaultPageLimit = 50
+	maxPageLimit     = 500
+)
+
+var (
+	errAdminDisabled = errors.New("admin API is disabled")
+	errUnauthorized  = errors.New("unauthorized")
+	errInvalidID     = errors.New("invalid id")
+)
+
+// RequireAdmin is a middleware that only lets through requests bearing the admin token.
+func (h *Handlers) RequireAdmin(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if h.App.AdminToken == "" {
+			_ = jsonutils.ErrorJSON(w, errAdminDisabled, http.StatusForbidden)
+			return
+		}
+
+		token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if subtle.ConstantTimeCompare([]byte(token), []byte(h.App.AdminToken)) != 1 {
+			_ = jsonutils.ErrorJSON(w, errUnauthorized, http.StatusUnauthorized)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// parsePagination parses the `limit` and `offset` query parameters of the http.Request.
+func parsePagination(r *http.Request) (limit, offset int) {
+	limit, err := strconv.Atoi(r.URL.Query().Get("limit"))
+	if err != nil || limit <= 0 {
+		limit = defaultPageLimit
+	}
+	if limit > maxPageLimit {
+		limit = maxPageLimit
+	}
+
+	offset, err = strconv.Atoi(r.URL.Query().Get("offset"))
+	if err != nil || offset < 0 {
+		offset = 0
+	}
+
+	return limit, offset
+}
+
+// parseID parses the `id` URL parameter of the http.Request.
+func parseID(r *http.Request) (uint, error) {
+	id, err := strconv.ParseUint(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		return 0, errInvalidID
+	}
+	return uint(id), nil
+}
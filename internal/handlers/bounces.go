@@ -0,0 +1,94 @@
+package handlers
+
+import (
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+
+	"github.com/go-chi/chi"
+	"github.com/vladyslavpavlenko/genesis-api-project/internal/bounce"
+	"github.com/vladyslavpavlenko/genesis-api-project/pkg/jsonutils"
+)
+
+const maxReportSize = 10 << 20
+
+var (
+	errBounces          = errors.New("failed to process bounce")
+	errSuppressions     = errors.New("failed to process suppressions")
+	errNotSuppressed    = errors.New("email is not suppressed")
+	errMissingReportMsg = errors.New("message is required")
+)
+
+// ReceiveBounce handles the `/admin/bounces` request. It accepts a delivery status
+// notification or an abuse feedback report either as a raw RFC 822 request body or
+// as a `message` file of a multipart form.
+func (h *Handlers) ReceiveBounce(w http.ResponseWriter, r *http.Request) {
+	body, err := reportBody(w, r)
+	if err != nil {
+		_ = jsonutils.ErrorJSON(w, err, http.StatusBadRequest)
+		return
+	}
+	defer body.Close()
+
+	events, err := h.Services.Bounces.ProcessMessage(body)
+	if err != nil {
+		if errors.Is(err, bounce.ErrUnsupportedReport) {
+			_ = jsonutils.ErrorJSON(w, err, http.StatusUnprocessableEntity)
+			return
+		}
+		h.handleError(w, r, err, http.StatusInternalServerError, errBounces.Error())
+		return
+	}
+
+	_ = jsonutils.WriteJSON(w, http.StatusOK, jsonutils.Response{Data: events})
+}
+
+// GetSuppressions handles the `/admin/suppressions` request.
+func (h *Handlers) GetSuppressions(w http.ResponseWriter, r *http.Request) {
+	limit, offset := parsePagination(r)
+
+	suppressions, err := h.Services.Suppression.GetSuppressions(limit, offset)
+	if err != nil {
+		h.handleError(w, r, err, http.StatusInternalServerError, errSuppressions.Error())
+		return
+	}
+
+	_ = jsonutils.WriteJSON(w, http.StatusOK, jsonutils.Response{Data: suppressions})
+}
+
+// DeleteSuppression handles the `DELETE /admin/suppressions/{email}` request.
+func (h *Handlers) DeleteSuppression(w http.ResponseWriter, r *http.Request) {
+	deleted, err := h.Services.Suppression.DeleteSuppression(chi.URLParam(r, "email"))
+	if err != nil {
+		h.handleError(w, r, err, http.StatusInternalServerError, errSuppressions.Error())
+		return
+	}
+
+	if !deleted {
+		_ = jsonutils.ErrorJSON(w, errNotSuppressed, http.StatusNotFound)
+		return
+	}
+
+	_ = jsonutils.WriteJSON(w, http.StatusOK, jsonutils.Response{Message: unsuppressed})
+}
+
+// reportBody returns the raw report message of the http.Request.
+func reportBody(w http.ResponseWriter, r *http.Request) (io.ReadCloser, error) {
+	r.Body = http.MaxBytesReader(w, r.Body, maxReportSize)
+
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mediaType != "multipart/form-data" {
+		return r.Body, nil
+	}
+
+	if err := r.ParseMultipartForm(maxReportSize); err != nil {
+		return nil, errors.New("failed to parse form")
+	}
+
+	f, _, err := r.FormFile("message")
+	if err != nil {
+		return nil, errMissingReportMsg
+	}
+	return f, nil
+}
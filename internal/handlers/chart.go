@@ -0,0 +1,43 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/vladyslavpavlenko/genesis-api-project/pkg/chart"
+	"github.com/vladyslavpavlenko/genesis-api-project/pkg/jsonutils"
+)
+
+var (
+	errRenderingChart = errors.New("failed to render chart")
+	errNoRateHistory  = errors.New("not enough rate history to draw a chart")
+)
+
+// GetRateChart handles the `/rate/chart.png` request. It serves the PNG chart of the
+// rates of the last 30 days of the `base` to `target` pair, USD to UAH by default.
+func (h *Handlers) GetRateChart(w http.ResponseWriter, r *http.Request) {
+	base, target := strings.ToUpper(r.URL.Query().Get("base")), strings.ToUpper(r.URL.Query().Get("target"))
+	if base == "" {
+		base = "USD"
+	}
+	if target == "" {
+		target = "UAH"
+	}
+
+	png, err := h.Services.Charts.Chart(base, target)
+	if err != nil {
+		if errors.Is(err, chart.ErrNotEnoughData) {
+			_ = jsonutils.ErrorJSON(w, errNoRateHistory, http.StatusNotFound)
+			return
+		}
+
+		h.handleError(w, r, err, http.StatusInternalServerError, errRenderingChart.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", "image/png")
+	w.Header().Set("Cache-Control", "public, max-age=600")
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(png)
+}
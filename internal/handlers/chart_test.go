@@ -0,0 +1,47 @@
+package handlers_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/vladyslavpavlenko/genesis-api-project/internal/app/config"
+	"github.com/vladyslavpavlenko/genesis-api-project/internal/handlers"
+	"github.com/vladyslavpavlenko/genesis-api-project/pkg/chart"
+)
+
+type mockCharts struct {
+	png          []byte
+	err          error
+	base, target string
+}
+
+func (m *mockCharts) Chart(base, target string) ([]byte, error) {
+	m.base, m.target = base, target
+	return m.png, m.err
+}
+
+func TestGetRateChart(t *testing.T) {
+	charts := &mockCharts{png: []byte("png")}
+	h := handlers.NewHandlers(&config.Config{}, &handlers.Services{Charts: charts}, nil)
+
+	rr := httptest.NewRecorder()
+	h.GetRateChart(rr, httptest.NewRequest(http.MethodGet, "/api/v1/rate/chart.png?base=eur", nil))
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, "image/png", rr.Header().Get("Content-Type"))
+	assert.Equal(t, "png", rr.Body.String())
+	assert.Equal(t, "EUR", charts.base)
+	assert.Equal(t, "UAH", charts.target)
+}
+
+func TestGetRateChart_NotEnoughData(t *testing.T) {
+	charts := &mockCharts{err: chart.ErrNotEnoughData}
+	h := handlers.NewHandlers(&config.Config{}, &handlers.Services{Charts: charts}, nil)
+
+	rr := httptest.NewRecorder()
+	h.GetRateChart(rr, httptest.NewRequest(http.MethodGet, "/api/v1/rate/chart.png", nil))
+
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+}
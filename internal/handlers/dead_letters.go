@@ -0,0 +1,88 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/vladyslavpavlenko/genesis-api-project/internal/email/consumer"
+	"github.com/vladyslavpavlenko/genesis-api-project/pkg/jsonutils"
+)
+
+const (
+	replayed     = "replayed"
+	discarded    = "discarded"
+	unsuppressed = "unsuppressed"
+)
+
+var errDeadLetters = errors.New("failed to process dead letters")
+
+// GetDeadLetters handles the `/admin/dead-letters` request.
+func (h *Handlers) GetDeadLetters(w http.ResponseWriter, r *http.Request) {
+	limit, offset := parsePagination(r)
+
+	dls, err := h.Services.DeadLetters.GetDeadLetters(limit, offset)
+	if err != nil {
+		h.handleError(w, r, err, http.StatusInternalServerError, errDeadLetters.Error())
+		return
+	}
+
+	_ = jsonutils.WriteJSON(w, http.StatusOK, jsonutils.Response{Data: dls})
+}
+
+// GetDeadLetter handles the `/admin/dead-letters/{id}` request.
+func (h *Handlers) GetDeadLetter(w http.ResponseWriter, r *http.Request) {
+	id, err := parseID(r)
+	if err != nil {
+		_ = jsonutils.ErrorJSON(w, err, http.StatusBadRequest)
+		return
+	}
+
+	dl, err := h.Services.DeadLetters.GetDeadLetter(id)
+	if err != nil {
+		h.handleDeadLetterError(w, r, err)
+		return
+	}
+
+	_ = jsonutils.WriteJSON(w, http.StatusOK, jsonutils.Response{Data: dl})
+}
+
+// ReplayDeadLetter handles the `/admin/dead-letters/{id}/replay` request.
+func (h *Handlers) ReplayDeadLetter(w http.ResponseWriter, r *http.Request) {
+	id, err := parseID(r)
+	if err != nil {
+		_ = jsonutils.ErrorJSON(w, err, http.StatusBadRequest)
+		return
+	}
+
+	if err = h.Services.DeadLetters.ReplayDeadLetter(r.Context(), id); err != nil {
+		h.handleDeadLetterError(w, r, err)
+		return
+	}
+
+	_ = jsonutils.WriteJSON(w, http.StatusOK, jsonutils.Response{Message: replayed})
+}
+
+// DiscardDeadLetter handles the `DELETE /admin/dead-letters/{id}` request.
+func (h *Handlers) DiscardDeadLetter(w http.ResponseWriter, r *http.Request) {
+	id, err := parseID(r)
+	if err != nil {
+		_ = jsonutils.ErrorJSON(w, err, http.StatusBadRequest)
+		return
+	}
+
+	if err = h.Services.DeadLetters.DiscardDeadLetter(id); err != nil {
+		h.handleDeadLetterError(w, r, err)
+		return
+	}
+
+	_ = jsonutils.WriteJSON(w, http.StatusOK, jsonutils.Response{Message: discarded})
+}
+
+// handleDeadLetterError maps dead-letter errors to the corresponding status codes.
+func (h *Handlers) handleDeadLetterError(w http.ResponseWriter, r *http.Request, err error) {
+	if errors.Is(err, consumer.ErrDeadLetterNotFound) {
+		_ = jsonutils.ErrorJSON(w, err, http.StatusNotFound)
+		return
+	}
+	h.handleError(w, r, err, http.StatusInternalServerError, errDeadLetters.Error())
+}
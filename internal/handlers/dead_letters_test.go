@@ -0,0 +1,167 @@
+package handlers_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/vladyslavpavlenko/genesis-api-project/internal/app/config"
+	"github.com/vladyslavpavlenko/genesis-api-project/internal/email/consumer"
+	"github.com/vladyslavpavlenko/genesis-api-project/internal/handlers"
+	"github.com/vladyslavpavlenko/genesis-api-project/internal/handlers/routes"
+	"github.com/vladyslavpavlenko/genesis-api-project/internal/models"
+	"github.com/vladyslavpavlenko/genesis-api-project/pkg/logger"
+)
+
+const adminToken = "secret"
+
+type mockDeadLetters struct {
+	err           error
+	limit, offset int
+	replayed      []uint
+	discarded     []uint
+}
+
+func (m *mockDeadLetters) GetDeadLetters(limit, offset int) ([]models.DeadLetter, error) {
+	m.limit, m.offset = limit, offset
+	return []models.DeadLetter{{ID: 7, Topic: "emails-topic"}}, m.err
+}
+
+func (m *mockDeadLetters) GetDeadLetter(id uint) (models.DeadLetter, error) {
+	if id != 7 {
+		return models.DeadLetter{}, consumer.ErrDeadLetterNotFound
+	}
+	return models.DeadLetter{ID: 7, Topic: "emails-topic"}, m.err
+}
+
+func (m *mockDeadLetters) ReplayDeadLetter(_ context.Context, id uint) error {
+	if _, err := m.GetDeadLetter(id); err != nil {
+		return err
+	}
+	m.replayed = append(m.replayed, id)
+	return nil
+}
+
+func (m *mockDeadLetters) DiscardDeadLetter(id uint) error {
+	if _, err := m.GetDeadLetter(id); err != nil {
+		return err
+	}
+	m.discarded = append(m.discarded, id)
+	return nil
+}
+
+// adminRequest serves an admin API request bearing the token.
+func adminRequest(services *handlers.Services, token, method, target string) *httptest.ResponseRecorder {
+	h := handlers.NewHandlers(&config.Config{AdminToken: adminToken}, services, logger.New(false))
+
+	req := httptest.NewRequest(method, "/api/v1/admin"+target, http.NoBody)
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	rr := httptest.NewRecorder()
+	routes.API(h).ServeHTTP(rr, req)
+	return rr
+}
+
+func TestRequireAdmin(t *testing.T) {
+	services := &handlers.Services{DeadLetters: &mockDeadLetters{}}
+
+	rr := adminRequest(services, "", http.MethodGet, "/dead-letters")
+	assert.Equal(t, http.StatusUnauthorized, rr.Code)
+
+	rr = adminRequest(services, "wrong", http.MethodGet, "/dead-letters")
+	assert.Equal(t, http.StatusUnauthorized, rr.Code)
+
+	rr = adminRequest(services, adminToken, http.MethodGet, "/dead-letters")
+	assert.Equal(t, http.StatusOK, rr.Code)
+
+	// The admin API is disabled unless the token is configured
+	h := handlers.NewHandlers(&config.Config{}, services, logger.New(false))
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/admin/dead-letters", http.NoBody)
+	req.Header.Set("Authorization", "Bearer ")
+	rr = httptest.NewRecorder()
+	routes.API(h).ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusForbidden, rr.Code)
+}
+
+func TestGetDeadLetters(t *testing.T) {
+	dls := &mockDeadLetters{}
+	services := &handlers.Services{DeadLetters: dls}
+
+	rr := adminRequest(services, adminToken, http.MethodGet, "/dead-letters?limit=10&offset=20")
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Contains(t, rr.Body.String(), `"topic":"emails-topic"`)
+	assert.Equal(t, 10, dls.limit)
+	assert.Equal(t, 20, dls.offset)
+
+	// The pagination is bounded
+	adminRequest(services, adminToken, http.MethodGet, "/dead-letters?limit=100000&offset=-1")
+	assert.Equal(t, 500, dls.limit)
+	assert.Equal(t, 0, dls.offset)
+
+	adminRequest(services, adminToken, http.MethodGet, "/dead-letters?limit=invalid")
+	assert.Equal(t, 50, dls.limit)
+
+	dls.err = errors.New("database is down")
+	rr = adminRequest(services, adminToken, http.MethodGet, "/dead-letters")
+	assert.Equal(t, http.StatusInternalServerError, rr.Code)
+}
+
+func TestGetDeadLetter(t *testing.T) {
+	services := &handlers.Services{DeadLetters: &mockDeadLetters{}}
+
+	tests := []struct {
+		target string
+		code   int
+	}{
+		{"/dead-letters/7", http.StatusOK},
+		{"/dead-letters/8", http.StatusNotFound},
+		{"/dead-letters/invalid", http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.target, func(t *testing.T) {
+			rr := adminRequest(services, adminToken, http.MethodGet, tt.target)
+			assert.Equal(t, tt.code, rr.Code)
+		})
+	}
+}
+
+func TestReplayDeadLetter(t *testing.T) {
+	dls := &mockDeadLetters{}
+	services := &handlers.Services{DeadLetters: dls}
+
+	rr := adminRequest(services, adminToken, http.MethodPost, "/dead-letters/7/replay")
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Contains(t, rr.Body.String(), "replayed")
+	assert.Equal(t, []uint{7}, dls.replayed)
+
+	rr = adminRequest(services, adminToken, http.MethodPost, "/dead-letters/8/replay")
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+
+	rr = adminRequest(services, adminToken, http.MethodPost, "/dead-letters/invalid/replay")
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+
+	dls.err = errors.New("broker unavailable")
+	rr = adminRequest(services, adminToken, http.MethodPost, "/dead-letters/7/replay")
+	assert.Equal(t, http.StatusInternalServerError, rr.Code)
+	assert.Equal(t, []uint{7}, dls.replayed)
+}
+
+func TestDiscardDeadLetter(t *testing.T) {
+	dls := &mockDeadLetters{}
+	services := &handlers.Services{DeadLetters: dls}
+
+	rr := adminRequest(services, adminToken, http.MethodDelete, "/dead-letters/7")
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Contains(t, rr.Body.String(), "discarded")
+	assert.Equal(t, []uint{7}, dls.discarded)
+
+	rr = adminRequest(services, adminToken, http.MethodDelete, "/dead-letters/8")
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+	assert.Equal(t, []uint{7}, dls.discarded)
+}
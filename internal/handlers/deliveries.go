@@ -0,0 +1,25 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/vladyslavpavlenko/genesis-api-project/pkg/jsonutils"
+)
+
+var errDeliveries = errors.New("failed to fetch deliveries")
+
+// GetDeliveries handles the `/admin/deliveries` request. The delivery history can be
+// filtered by the `email` of the subscriber and by the `run_id` of the mailing run.
+func (h *Handlers) GetDeliveries(w http.ResponseWriter, r *http.Request) {
+	limit, offset := parsePagination(r)
+	query := r.URL.Query()
+
+	deliveries, err := h.Services.Deliveries.GetDeliveries(query.Get("email"), query.Get("run_id"), limit, offset)
+	if err != nil {
+		h.handleError(w, r, err, http.StatusInternalServerError, errDeliveries.Error())
+		return
+	}
+
+	_ = jsonutils.WriteJSON(w, http.StatusOK, jsonutils.Response{Data: deliveries})
+}
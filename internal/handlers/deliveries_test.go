@@ -0,0 +1,50 @@
+package handlers_test
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/vladyslavpavlenko/genesis-api-project/internal/handlers"
+	"github.com/vladyslavpavlenko/genesis-api-project/internal/models"
+)
+
+type mockDeliveries struct {
+	err              error
+	recipient, runID string
+	limit, offset    int
+}
+
+func (m *mockDeliveries) GetDeliveries(recipient, runID string, limit, offset int) ([]models.Delivery, error) {
+	m.recipient, m.runID, m.limit, m.offset = recipient, runID, limit, offset
+	return []models.Delivery{{ID: 1, Recipient: recipient, Response: "250 2.0.0 Ok: queued as 4F3A1"}}, m.err
+}
+
+func TestGetDeliveries(t *testing.T) {
+	deliveries := &mockDeliveries{}
+	services := &handlers.Services{Deliveries: deliveries}
+
+	rr := adminRequest(services, adminToken, http.MethodGet,
+		"/deliveries?email=alice@example.com&run_id=digest-2024-06-01&limit=10&offset=5")
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Contains(t, rr.Body.String(), `"response":"250 2.0.0 Ok: queued as 4F3A1"`)
+	assert.Equal(t, "alice@example.com", deliveries.recipient)
+	assert.Equal(t, "digest-2024-06-01", deliveries.runID)
+	assert.Equal(t, 10, deliveries.limit)
+	assert.Equal(t, 5, deliveries.offset)
+
+	// The filters are optional
+	rr = adminRequest(services, adminToken, http.MethodGet, "/deliveries")
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Empty(t, deliveries.recipient)
+	assert.Empty(t, deliveries.runID)
+	assert.Equal(t, 50, deliveries.limit)
+
+	rr = adminRequest(services, "", http.MethodGet, "/deliveries")
+	assert.Equal(t, http.StatusUnauthorized, rr.Code)
+
+	deliveries.err = errors.New("database is down")
+	rr = adminRequest(services, adminToken, http.MethodGet, "/deliveries")
+	assert.Equal(t, http.StatusInternalServerError, rr.Code)
+}
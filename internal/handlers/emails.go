@@ -0,0 +1,115 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/go-chi/chi"
+	emailpkg "github.com/vladyslavpavlenko/genesis-api-project/internal/email"
+	"github.com/vladyslavpavlenko/genesis-api-project/internal/email/preview"
+	"github.com/vladyslavpavlenko/genesis-api-project/pkg/jsonutils"
+)
+
+const testEmailSent = "test email sent"
+
+var (
+	errPreviewingEmail   = errors.New("failed to render email")
+	errSendingTestEmail  = errors.New("failed to send test email")
+	errInvalidDataSource = errors.New("data must be either sample or live")
+	errInvalidFormat     = errors.New("format must be one of json, html or text")
+)
+
+// PreviewEmail handles the `/admin/emails/{template}` request. It renders the
+// template in the `locale` with the `data` being either `sample` (by default) or
+// `live`, addressed to the optional `email`. The `format` is either `json` (by
+// default) for both parts, or `html` or `text` for one of them.
+func (h *Handlers) PreviewEmail(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+
+	live, err := parseDataSource(q.Get("data"))
+	if err != nil {
+		_ = jsonutils.ErrorJSON(w, err, http.StatusBadRequest)
+		return
+	}
+
+	recipient := q.Get("email")
+	if recipient != "" && !emailpkg.Email(recipient).Validate() {
+		_ = jsonutils.ErrorJSON(w, errInvalidEmail, http.StatusBadRequest)
+		return
+	}
+
+	format := q.Get("format")
+	if format != "" && format != "json" && format != "html" && format != "text" {
+		_ = jsonutils.ErrorJSON(w, errInvalidFormat, http.StatusBadRequest)
+		return
+	}
+
+	msg, err := h.Services.Previews.Render(r.Context(), chi.URLParam(r, "template"), q.Get("locale"), recipient, live)
+	if err != nil {
+		h.handlePreviewError(w, r, err, errPreviewingEmail)
+		return
+	}
+
+	switch format {
+	case "html":
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write([]byte(msg.HTMLWithDataURIs()))
+	case "text":
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write([]byte(msg.Text))
+	default:
+		_ = jsonutils.WriteJSON(w, http.StatusOK, jsonutils.Response{Data: msg})
+	}
+}
+
+// SendTestEmail handles the `/admin/emails/{template}/test` request. It sends the
+// template rendered like by PreviewEmail to the `email` form value through the
+// configured sender. The subscriptions are left untouched.
+func (h *Handlers) SendTestEmail(w http.ResponseWriter, r *http.Request) {
+	recipient, err := parseEmail(r)
+	if err != nil {
+		_ = jsonutils.ErrorJSON(w, err, http.StatusBadRequest)
+		return
+	}
+
+	live, err := parseDataSource(r.FormValue("data"))
+	if err != nil {
+		_ = jsonutils.ErrorJSON(w, err, http.StatusBadRequest)
+		return
+	}
+
+	err = h.Services.Previews.Send(r.Context(), chi.URLParam(r, "template"), r.FormValue("locale"), recipient, live)
+	if err != nil {
+		h.handlePreviewError(w, r, err, errSendingTestEmail)
+		return
+	}
+
+	_ = jsonutils.WriteJSON(w, http.StatusOK, jsonutils.Response{Message: testEmailSent})
+}
+
+// handlePreviewError responds with the status matching the error of the preview
+// service.
+func (h *Handlers) handlePreviewError(w http.ResponseWriter, r *http.Request, err, logMessage error) {
+	switch {
+	case errors.Is(err, preview.ErrUnknownTemplate):
+		_ = jsonutils.ErrorJSON(w, err, http.StatusNotFound)
+	case errors.Is(err, preview.ErrLiveData):
+		h.handleError(w, r, err, http.StatusServiceUnavailable, logMessage.Error())
+	default:
+		h.handleError(w, r, err, http.StatusInternalServerError, logMessage.Error())
+	}
+}
+
+// parseDataSource reports whether the `data` parameter asks for live data.
+func parseDataSource(data string) (bool, error) {
+	switch data {
+	case "", "sample":
+		return false, nil
+	case "live":
+		return true, nil
+	default:
+		return false, errInvalidDataSource
+	}
+}
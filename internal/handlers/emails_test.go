@@ -0,0 +1,145 @@
+package handlers_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-chi/chi"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/vladyslavpavlenko/genesis-api-project/internal/app/config"
+	"github.com/vladyslavpavlenko/genesis-api-project/internal/email"
+	"github.com/vladyslavpavlenko/genesis-api-project/internal/email/preview"
+	"github.com/vladyslavpavlenko/genesis-api-project/internal/email/templates"
+	"github.com/vladyslavpavlenko/genesis-api-project/internal/handlers"
+	"github.com/vladyslavpavlenko/genesis-api-project/pkg/logger"
+)
+
+// jsonContentType is the content type set by jsonutils.
+const jsonContentType = "application/jsonutils"
+
+type mockPreviews struct {
+	msg  preview.Message
+	err  error
+	sent []string
+	live bool
+}
+
+func (m *mockPreviews) Render(_ context.Context, name, _, _ string, live bool) (preview.Message, error) {
+	m.live = live
+	if name != templates.Digest {
+		return preview.Message{}, preview.ErrUnknownTemplate
+	}
+	return m.msg, m.err
+}
+
+func (m *mockPreviews) Send(_ context.Context, name, _, recipient string, live bool) error {
+	m.live = live
+	if name != templates.Digest {
+		return preview.ErrUnknownTemplate
+	}
+	m.sent = append(m.sent, recipient)
+	return m.err
+}
+
+func emailsRouter(previews *mockPreviews) http.Handler {
+	h := handlers.NewHandlers(&config.Config{}, &handlers.Services{Previews: previews}, logger.New(false))
+
+	mux := chi.NewRouter()
+	mux.Get("/emails/{template}", h.PreviewEmail)
+	mux.Post("/emails/{template}/test", h.SendTestEmail)
+	return mux
+}
+
+func TestPreviewEmail(t *testing.T) {
+	previews := &mockPreviews{msg: preview.Message{
+		Email:  templates.Email{Subject: "Rate", Text: "41.00", HTML: `<img src="cid:chart.png">`},
+		Inline: []email.Inline{{Name: "chart.png", ContentType: "image/png", Data: []byte("png")}},
+	}}
+	mux := emailsRouter(previews)
+
+	tests := []struct {
+		query       string
+		code        int
+		contentType string
+		body        string
+	}{
+		{"", http.StatusOK, jsonContentType, `"subject":"Rate"`},
+		{"?format=text", http.StatusOK, "text/plain; charset=utf-8", "41.00"},
+		{"?format=html", http.StatusOK, "text/html; charset=utf-8", `src="data:image/png;base64,cG5n"`},
+		{"?format=pdf", http.StatusBadRequest, jsonContentType, "format"},
+		{"?data=recorded", http.StatusBadRequest, jsonContentType, "data"},
+		{"?email=invalid", http.StatusBadRequest, jsonContentType, "invalid email"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			mux.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/emails/digest"+tt.query, nil))
+
+			assert.Equal(t, tt.code, rr.Code)
+			assert.Equal(t, tt.contentType, rr.Header().Get("Content-Type"))
+			assert.Contains(t, rr.Body.String(), tt.body)
+		})
+	}
+}
+
+func TestPreviewEmail_Errors(t *testing.T) {
+	rr := httptest.NewRecorder()
+	emailsRouter(&mockPreviews{}).ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/emails/unknown", nil))
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+
+	previews := &mockPreviews{err: preview.ErrLiveData}
+	rr = httptest.NewRecorder()
+	emailsRouter(previews).ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/emails/digest?data=live", nil))
+	assert.Equal(t, http.StatusServiceUnavailable, rr.Code)
+	assert.True(t, previews.live)
+
+	rr = httptest.NewRecorder()
+	emailsRouter(&mockPreviews{err: errors.New("template error")}).
+		ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/emails/digest", nil))
+	assert.Equal(t, http.StatusInternalServerError, rr.Code)
+}
+
+func TestSendTestEmail(t *testing.T) {
+	previews := &mockPreviews{}
+	mux := emailsRouter(previews)
+
+	var body bytes.Buffer
+	w := multipart.NewWriter(&body)
+	require.NoError(t, w.WriteField("email", "editor@example.com"))
+	require.NoError(t, w.WriteField("data", "live"))
+	require.NoError(t, w.Close())
+
+	req := httptest.NewRequest(http.MethodPost, "/emails/digest/test", &body)
+	req.Header.Set("Content-Type", w.FormDataContentType())
+
+	rr := httptest.NewRecorder()
+	mux.ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, []string{"editor@example.com"}, previews.sent)
+	assert.True(t, previews.live)
+}
+
+func TestSendTestEmail_MissingEmail(t *testing.T) {
+	previews := &mockPreviews{}
+
+	var body bytes.Buffer
+	w := multipart.NewWriter(&body)
+	require.NoError(t, w.Close())
+
+	req := httptest.NewRequest(http.MethodPost, "/emails/digest/test", &body)
+	req.Header.Set("Content-Type", w.FormDataContentType())
+
+	rr := httptest.NewRecorder()
+	emailsRouter(previews).ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+	assert.Empty(t, previews.sent)
+}
@@ -9,6 +9,8 @@ import (
 
 	"github.com/VictoriaMetrics/metrics"
 	emailpkg "github.com/vladyslavpavlenko/genesis-api-project/internal/email"
+	"github.com/vladyslavpavlenko/genesis-api-project/internal/email/templates"
+	"github.com/vladyslavpavlenko/genesis-api-project/internal/subscriber/gormsubscriber"
 
 	"github.com/vladyslavpavlenko/genesis-api-project/pkg/jsonutils"
 )
@@ -62,9 +64,18 @@ func (h *Handlers) GetRate(w http.ResponseWriter, r *http.Request) {
 	_ = jsonutils.WriteJSON(w, http.StatusOK, payload)
 }
 
-// Subscribe handles the `/subscribe` request.
+// Subscribe handles the `/subscribe` request. The locale of the emails is taken from
+// the optional `locale` form value, falling back to the Accept-Language header.
 func (h *Handlers) Subscribe(w http.ResponseWriter, r *http.Request) {
-	h.handleSubscription(w, r, h.Services.Subscriber.AddSubscription, subscribed, errSubscribing)
+	subscribe := func(email string) error {
+		locale := r.FormValue("locale")
+		if locale == "" {
+			locale = r.Header.Get("Accept-Language")
+		}
+		return h.Services.Subscriber.AddSubscription(email, templates.MatchLocale(locale))
+	}
+
+	h.handleSubscription(w, r, subscribe, subscribed, errSubscribing)
 }
 
 // Unsubscribe handles the `/unsubscribe` request.
@@ -114,7 +125,7 @@ func (h *Handlers) handleSubscription(w http.ResponseWriter, r *http.Request, ac
 
 	err = action(email)
 	if err != nil {
-		h.handleError(w, r, err, http.StatusInternalServerError, errorMessage.Error())
+		h.handleSubscriptionError(w, r, err, errorMessage)
 		return
 	}
 
@@ -125,6 +136,21 @@ func (h *Handlers) handleSubscription(w http.ResponseWriter, r *http.Request, ac
 	_ = jsonutils.WriteJSON(w, http.StatusOK, payload)
 }
 
+// handleSubscriptionError responds with the status matching the error of the
+// subscriber. Addresses with a plus tag rejected by the policy are invalid.
+func (h *Handlers) handleSubscriptionError(w http.ResponseWriter, r *http.Request, err, logMessage error) {
+	switch {
+	case errors.Is(err, gormsubscriber.ErrorInvalidEmail):
+		_ = jsonutils.ErrorJSON(w, err, http.StatusBadRequest)
+	case errors.Is(err, gormsubscriber.ErrDuplicateSubscription):
+		_ = jsonutils.ErrorJSON(w, err, http.StatusConflict)
+	case errors.Is(err, gormsubscriber.ErrSuppressedAddress):
+		_ = jsonutils.ErrorJSON(w, err, http.StatusUnprocessableEntity)
+	default:
+		h.handleError(w, r, err, http.StatusInternalServerError, logMessage.Error())
+	}
+}
+
 // handleError handles errors and logs them with the request ID.
 func (h *Handlers) handleError(w http.ResponseWriter, r *http.Request, err error, statusCode int, logMessage string) {
 	reqID, ok := r.Context().Value(middleware.RequestIDKey).(string)
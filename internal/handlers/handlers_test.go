@@ -0,0 +1,59 @@
+package handlers_test
+
+import (
+	"bytes"
+	"fmt"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/vladyslavpavlenko/genesis-api-project/internal/app/config"
+	"github.com/vladyslavpavlenko/genesis-api-project/internal/email"
+	"github.com/vladyslavpavlenko/genesis-api-project/internal/handlers"
+	"github.com/vladyslavpavlenko/genesis-api-project/internal/subscriber/gormsubscriber"
+	"github.com/vladyslavpavlenko/genesis-api-project/pkg/logger"
+)
+
+// subscribeRequest returns a `/subscribe` request with the email in its multipart form.
+func subscribeRequest(t *testing.T, addr string) *http.Request {
+	var body bytes.Buffer
+	w := multipart.NewWriter(&body)
+	require.NoError(t, w.WriteField("email", addr))
+	require.NoError(t, w.Close())
+
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/subscribe", &body)
+	req.Header.Set("Content-Type", w.FormDataContentType())
+	return req
+}
+
+func TestSubscribe_Errors(t *testing.T) {
+	tests := []struct {
+		err  error
+		code int
+	}{
+		{nil, http.StatusOK},
+		{gormsubscriber.ErrorInvalidEmail, http.StatusBadRequest},
+		{fmt.Errorf("%w: %w", gormsubscriber.ErrorInvalidEmail, email.ErrPlusTag), http.StatusBadRequest},
+		{gormsubscriber.ErrDuplicateSubscription, http.StatusConflict},
+		{gormsubscriber.ErrSuppressedAddress, http.StatusUnprocessableEntity},
+		{gormsubscriber.ErrInternal, http.StatusInternalServerError},
+	}
+
+	for _, tt := range tests {
+		t.Run(fmt.Sprint(tt.err), func(t *testing.T) {
+			services := &handlers.Services{Subscriber: &mockSubscriber{err: tt.err}}
+			h := handlers.NewHandlers(&config.Config{}, services, logger.New(false))
+
+			rr := httptest.NewRecorder()
+			h.Subscribe(rr, subscribeRequest(t, "alice@example.com"))
+
+			assert.Equal(t, tt.code, rr.Code)
+			if tt.err != nil {
+				assert.Contains(t, rr.Body.String(), tt.err.Error())
+			}
+		})
+	}
+}
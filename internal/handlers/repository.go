@@ -2,10 +2,15 @@ package handlers
 
 import (
 	"context"
+	"io"
 
 	"github.com/vladyslavpavlenko/genesis-api-project/internal/app/config"
+	"github.com/vladyslavpavlenko/genesis-api-project/internal/bounce"
+	"github.com/vladyslavpavlenko/genesis-api-project/internal/email/preview"
 	"github.com/vladyslavpavlenko/genesis-api-project/internal/models"
 	"github.com/vladyslavpavlenko/genesis-api-project/internal/notifier"
+	"github.com/vladyslavpavlenko/genesis-api-project/internal/ratefeed"
+	"github.com/vladyslavpavlenko/genesis-api-project/internal/sagaadmin"
 	"github.com/vladyslavpavlenko/genesis-api-project/pkg/logger"
 )
 
@@ -14,18 +19,74 @@ type (
 		Fetch(ctx context.Context, base, target string) (string, error)
 	}
 
+	chartRenderer interface {
+		Chart(base, target string) ([]byte, error)
+	}
+
 	subscriber interface {
-		AddSubscription(emailAddr string) error
+		AddSubscription(emailAddr, locale string) error
 		DeleteSubscription(emailAddr string) error
 		GetSubscriptions(limit, offset int) ([]models.Subscription, error)
 	}
+
+	deadLetterQueue interface {
+		GetDeadLetters(limit, offset int) ([]models.DeadLetter, error)
+		GetDeadLetter(id uint) (models.DeadLetter, error)
+		ReplayDeadLetter(ctx context.Context, id uint) error
+		DiscardDeadLetter(id uint) error
+	}
+
+	deliveryLog interface {
+		GetDeliveries(recipient, runID string, limit, offset int) ([]models.Delivery, error)
+	}
+
+	bounceProcessor interface {
+		ProcessMessage(r io.Reader) ([]bounce.Event, error)
+	}
+
+	emailPreviewer interface {
+		Render(ctx context.Context, name, locale, recipient string, live bool) (preview.Message, error)
+		Send(ctx context.Context, name, locale, recipient string, live bool) error
+	}
+
+	privacyService interface {
+		Export(addr string) (models.SubjectData, error)
+		Erase(addr, requestID string) (models.Erasure, error)
+		GetErasures(addr string, limit, offset int) ([]models.Erasure, error)
+	}
+
+	sagaAdmin interface {
+		GetSagas(q sagaadmin.Query, limit, offset int) ([]models.SubjectSaga, error)
+		GetSaga(id string) (models.SubjectSaga, error)
+		Retry(ctx context.Context, id string) (models.SubjectSaga, error)
+		Compensate(ctx context.Context, id, reason string) (models.SubjectSaga, error)
+		Resolve(ctx context.Context, id, resolution string) (models.SubjectSaga, error)
+	}
+
+	rateStream interface {
+		Subscribe(pairs []ratefeed.Pair, lastEventID string) (*ratefeed.Subscription, error)
+	}
+
+	suppressionList interface {
+		GetSuppressions(limit, offset int) ([]models.Suppression, error)
+		DeleteSuppression(email string) (bool, error)
+	}
 )
 
 // Services is the repository type for the services necessary for API handlers.
 type Services struct {
-	Fetcher    fetcher
-	Notifier   *notifier.Notifier
-	Subscriber subscriber
+	Fetcher     fetcher
+	Charts      chartRenderer
+	Notifier    *notifier.Notifier
+	Subscriber  subscriber
+	DeadLetters deadLetterQueue
+	Deliveries  deliveryLog
+	Bounces     bounceProcessor
+	Suppression suppressionList
+	Previews    emailPreviewer
+	Privacy     privacyService
+	Sagas       sagaAdmin
+	RateStream  rateStream
 }
 
 // Handlers is the repository type for API handlers.
@@ -18,14 +18,16 @@ func (m *mockFetcher) Fetch(_ context.Context, _, _ string) (string, error) {
 	return "mocked-fetch", nil
 }
 
-type mockSubscriber struct{}
+type mockSubscriber struct {
+	err error
+}
 
-func (m *mockSubscriber) AddSubscription(_ string) error {
-	return nil
+func (m *mockSubscriber) AddSubscription(_, _ string) error {
+	return m.err
 }
 
 func (m *mockSubscriber) DeleteSubscription(_ string) error {
-	return nil
+	return m.err
 }
 
 func (m *mockSubscriber) GetSubscriptions(_, _ int) ([]models.Subscription, error) {
@@ -20,9 +20,40 @@ func API(h *handlers.Handlers) http.Handler {
 	mux.Route("/api", func(mux chi.Router) {
 		mux.Route("/v1", func(mux chi.Router) {
 			mux.Get("/rate", h.GetRate)
+			mux.Get("/rate/chart.png", h.GetRateChart)
+			mux.Get("/rate/stream", h.StreamRate)
+			mux.Get("/rate/ws", h.StreamRateWebSocket)
 			mux.Post("/subscribe", h.Subscribe)
 			mux.Post("/unsubscribe", h.Unsubscribe)
 			mux.Post("/sendEmails", h.SendEmails)
+
+			mux.Route("/admin", func(mux chi.Router) {
+				mux.Use(h.RequireAdmin)
+
+				mux.Get("/dead-letters", h.GetDeadLetters)
+				mux.Get("/dead-letters/{id}", h.GetDeadLetter)
+				mux.Post("/dead-letters/{id}/replay", h.ReplayDeadLetter)
+				mux.Delete("/dead-letters/{id}", h.DiscardDeadLetter)
+
+				mux.Get("/deliveries", h.GetDeliveries)
+
+				mux.Post("/bounces", h.ReceiveBounce)
+				mux.Get("/suppressions", h.GetSuppressions)
+				mux.Delete("/suppressions/{email}", h.DeleteSuppression)
+
+				mux.Get("/emails/{template}", h.PreviewEmail)
+				mux.Post("/emails/{template}/test", h.SendTestEmail)
+
+				mux.Get("/subjects/{email}", h.ExportSubject)
+				mux.Delete("/subjects/{email}", h.EraseSubject)
+				mux.Get("/erasures", h.GetErasures)
+
+				mux.Get("/sagas", h.GetSagas)
+				mux.Get("/sagas/{id}", h.GetSaga)
+				mux.Post("/sagas/{id}/retry", h.RetrySaga)
+				mux.Post("/sagas/{id}/compensate", h.CompensateSaga)
+				mux.Post("/sagas/{id}/resolve", h.ResolveSaga)
+			})
 		})
 	})
 
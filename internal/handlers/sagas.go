@@ -0,0 +1,129 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi"
+	"github.com/vladyslavpavlenko/genesis-api-project/internal/sagaadmin"
+	"github.com/vladyslavpavlenko/genesis-api-project/pkg/jsonutils"
+	"github.com/vladyslavpavlenko/genesis-api-project/pkg/saga"
+)
+
+const (
+	retried     = "retried"
+	compensated = "compensated"
+	resolved    = "resolved"
+)
+
+var (
+	errSagas      = errors.New("failed to process sagas")
+	errInvalidAge = errors.New("min_age and max_age must be durations, e.g. 30m or 24h")
+)
+
+// GetSagas handles the `/admin/sagas` request. The sagas can be filtered by the
+// `name`, the `status`, the `email` they are about, and their `min_age` and `max_age`.
+func (h *Handlers) GetSagas(w http.ResponseWriter, r *http.Request) {
+	limit, offset := parsePagination(r)
+
+	q := r.URL.Query()
+	minAge, err := parseAge(q.Get("min_age"))
+	if err != nil {
+		_ = jsonutils.ErrorJSON(w, err, http.StatusBadRequest)
+		return
+	}
+	maxAge, err := parseAge(q.Get("max_age"))
+	if err != nil {
+		_ = jsonutils.ErrorJSON(w, err, http.StatusBadRequest)
+		return
+	}
+
+	sagas, err := h.Services.Sagas.GetSagas(sagaadmin.Query{
+		Name:   q.Get("name"),
+		Status: q.Get("status"),
+		Email:  q.Get("email"),
+		MinAge: minAge,
+		MaxAge: maxAge,
+	}, limit, offset)
+	if err != nil {
+		h.handleSagaError(w, r, err)
+		return
+	}
+
+	_ = jsonutils.WriteJSON(w, http.StatusOK, jsonutils.Response{Data: sagas})
+}
+
+// GetSaga handles the `/admin/sagas/{id}` request. It returns the saga along with the
+// log of its steps.
+func (h *Handlers) GetSaga(w http.ResponseWriter, r *http.Request) {
+	s, err := h.Services.Sagas.GetSaga(chi.URLParam(r, "id"))
+	if err != nil {
+		h.handleSagaError(w, r, err)
+		return
+	}
+
+	_ = jsonutils.WriteJSON(w, http.StatusOK, jsonutils.Response{Data: s})
+}
+
+// RetrySaga handles the `/admin/sagas/{id}/retry` request.
+func (h *Handlers) RetrySaga(w http.ResponseWriter, r *http.Request) {
+	s, err := h.Services.Sagas.Retry(r.Context(), chi.URLParam(r, "id"))
+	if err != nil {
+		h.handleSagaError(w, r, err)
+		return
+	}
+
+	_ = jsonutils.WriteJSON(w, http.StatusOK, jsonutils.Response{Message: retried, Data: s})
+}
+
+// CompensateSaga handles the `/admin/sagas/{id}/compensate` request. The optional
+// `reason` form value is stored as the error of the saga.
+func (h *Handlers) CompensateSaga(w http.ResponseWriter, r *http.Request) {
+	s, err := h.Services.Sagas.Compensate(r.Context(), chi.URLParam(r, "id"), r.FormValue("reason"))
+	if err != nil {
+		h.handleSagaError(w, r, err)
+		return
+	}
+
+	_ = jsonutils.WriteJSON(w, http.StatusOK, jsonutils.Response{Message: compensated, Data: s})
+}
+
+// ResolveSaga handles the `/admin/sagas/{id}/resolve` request. The `resolution` form
+// value is required.
+func (h *Handlers) ResolveSaga(w http.ResponseWriter, r *http.Request) {
+	s, err := h.Services.Sagas.Resolve(r.Context(), chi.URLParam(r, "id"), r.FormValue("resolution"))
+	if err != nil {
+		h.handleSagaError(w, r, err)
+		return
+	}
+
+	_ = jsonutils.WriteJSON(w, http.StatusOK, jsonutils.Response{Message: resolved, Data: s})
+}
+
+// handleSagaError maps saga errors to the corresponding status codes.
+func (h *Handlers) handleSagaError(w http.ResponseWriter, r *http.Request, err error) {
+	switch {
+	case errors.Is(err, sagaadmin.ErrInvalidAddress), errors.Is(err, sagaadmin.ErrInvalidStatus),
+		errors.Is(err, sagaadmin.ErrMissingResolution):
+		_ = jsonutils.ErrorJSON(w, err, http.StatusBadRequest)
+	case errors.Is(err, saga.ErrSagaNotFound):
+		_ = jsonutils.ErrorJSON(w, saga.ErrSagaNotFound, http.StatusNotFound)
+	case errors.Is(err, saga.ErrSagaLeased), errors.Is(err, saga.ErrInvalidStatus):
+		_ = jsonutils.ErrorJSON(w, err, http.StatusConflict)
+	default:
+		h.handleError(w, r, err, http.StatusInternalServerError, errSagas.Error())
+	}
+}
+
+// parseAge parses the optional age of the sagas.
+func parseAge(age string) (time.Duration, error) {
+	if age == "" {
+		return 0, nil
+	}
+	d, err := time.ParseDuration(age)
+	if err != nil || d < 0 {
+		return 0, errInvalidAge
+	}
+	return d, nil
+}
@@ -0,0 +1,219 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/VictoriaMetrics/metrics"
+	"github.com/vladyslavpavlenko/genesis-api-project/internal/ratefeed"
+	"github.com/vladyslavpavlenko/genesis-api-project/pkg/jsonutils"
+	"golang.org/x/net/websocket"
+)
+
+const (
+	// defaultStreamHeartbeat is the interval of the heartbeats unless configured.
+	defaultStreamHeartbeat = 15 * time.Second
+	// streamWriteTimeout is the time a client has to receive a message, so a client
+	// that does not read is disconnected rather than blocking its stream.
+	streamWriteTimeout = 10 * time.Second
+	// streamRetry is the reconnection delay suggested to the SSE clients.
+	streamRetry = 3 * time.Second
+	// maxStreamPairs is the number of pairs a single client can stream.
+	maxStreamPairs = 10
+
+	transportSSE       = "sse"
+	transportWebSocket = "websocket"
+)
+
+var (
+	errTooManyStreamPairs = fmt.Errorf("at most %d pairs can be streamed", maxStreamPairs)
+	errStreamUnavailable  = errors.New("rate stream is unavailable")
+	errStreamUnsupported  = errors.New("streaming is not supported")
+)
+
+// streamMessage is a message of the WebSocket stream, either a quote or a heartbeat.
+type streamMessage struct {
+	Type string `json:"type"`
+	*ratefeed.Quote
+}
+
+// StreamRate handles the `/rate/stream` request. It streams the quotes of the pairs
+// listed in the `pairs` parameter, USD/UAH by default, as Server-Sent Events, starting
+// after the `Last-Event-ID` header, or the `last_event_id` parameter, if given.
+func (h *Handlers) StreamRate(w http.ResponseWriter, r *http.Request) {
+	lastEventID := r.Header.Get("Last-Event-ID")
+	if lastEventID == "" {
+		lastEventID = r.URL.Query().Get("last_event_id")
+	}
+
+	sub, ok := h.subscribeRate(w, r, lastEventID)
+	if !ok {
+		return
+	}
+	defer sub.Close()
+
+	rc := http.NewResponseController(w)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	_, _ = fmt.Fprintf(w, "retry: %d\n\n", streamRetry.Milliseconds())
+
+	defer streamConnected(transportSSE)()
+
+	h.stream(r.Context().Done(), sub, func(q *ratefeed.Quote) error {
+		if err := rc.SetWriteDeadline(time.Now().Add(streamWriteTimeout)); err != nil &&
+			!errors.Is(err, http.ErrNotSupported) {
+			return err
+		}
+
+		if q == nil {
+			_, _ = fmt.Fprint(w, ": heartbeat\n\n")
+		} else {
+			data, err := json.Marshal(q)
+			if err != nil {
+				return err
+			}
+			_, _ = fmt.Fprintf(w, "id: %d\nevent: quote\ndata: %s\n\n", q.ID, data)
+		}
+		return rc.Flush()
+	})
+}
+
+// StreamRateWebSocket handles the `/rate/ws` request. It streams the same quotes as
+// StreamRate over a WebSocket as JSON messages, starting after the `last_event_id`
+// parameter, if given.
+func (h *Handlers) StreamRateWebSocket(w http.ResponseWriter, r *http.Request) {
+	sub, ok := h.subscribeRate(w, r, r.URL.Query().Get("last_event_id"))
+	if !ok {
+		return
+	}
+	defer sub.Close()
+
+	// The Origin is not checked, the same way as for the other endpoints
+	websocket.Server{Handler: func(ws *websocket.Conn) {
+		defer streamConnected(transportWebSocket)()
+
+		// The messages of the client are discarded, but reading them is how the
+		// closing of the connection is noticed
+		closed := make(chan struct{})
+		go func() {
+			defer close(closed)
+			var msg []byte
+			for {
+				if err := websocket.Message.Receive(ws, &msg); err != nil {
+					return
+				}
+			}
+		}()
+
+		h.stream(closed, sub, func(q *ratefeed.Quote) error {
+			if err := ws.SetWriteDeadline(time.Now().Add(streamWriteTimeout)); err != nil {
+				return err
+			}
+			if q == nil {
+				return websocket.JSON.Send(ws, streamMessage{Type: "heartbeat"})
+			}
+			return websocket.JSON.Send(ws, streamMessage{Type: "quote", Quote: q})
+		})
+	}}.ServeHTTP(w, r)
+}
+
+// subscribeRate subscribes to the pairs requested. It writes the error response and
+// returns false if the subscription cannot be made.
+func (h *Handlers) subscribeRate(w http.ResponseWriter, r *http.Request, lastEventID string,
+) (*ratefeed.Subscription, bool) {
+	if h.Services.RateStream == nil {
+		_ = jsonutils.ErrorJSON(w, errStreamUnsupported, http.StatusNotImplemented)
+		return nil, false
+	}
+
+	pairs, err := parsePairs(r)
+	if err != nil {
+		_ = jsonutils.ErrorJSON(w, err, http.StatusBadRequest)
+		return nil, false
+	}
+
+	sub, err := h.Services.RateStream.Subscribe(pairs, lastEventID)
+	switch {
+	case errors.Is(err, ratefeed.ErrPairNotStreamed):
+		_ = jsonutils.ErrorJSON(w, err, http.StatusBadRequest)
+		return nil, false
+	case errors.Is(err, ratefeed.ErrTooManyPairs), errors.Is(err, ratefeed.ErrSamplerClosed):
+		_ = jsonutils.ErrorJSON(w, errStreamUnavailable, http.StatusServiceUnavailable)
+		return nil, false
+	case err != nil:
+		h.handleError(w, r, err, http.StatusInternalServerError, errStreamUnavailable.Error())
+		return nil, false
+	}
+	return sub, true
+}
+
+// stream sends the quotes of the subscription, and a heartbeat, that is a nil quote,
+// once in a while, until the client is gone, the sending fails, or the subscription
+// is closed on shutdown.
+func (h *Handlers) stream(gone <-chan struct{}, sub *ratefeed.Subscription, send func(q *ratefeed.Quote) error) {
+	interval := h.App.StreamHeartbeat
+	if interval <= 0 {
+		interval = defaultStreamHeartbeat
+	}
+	heartbeat := time.NewTicker(interval)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-gone:
+			return
+		case <-sub.Done():
+			return
+		case <-heartbeat.C:
+			if send(nil) != nil {
+				return
+			}
+		case <-sub.Ready():
+			for _, q := range sub.Take() {
+				if send(&q) != nil {
+					return
+				}
+			}
+		}
+	}
+}
+
+// parsePairs parses the comma-separated `pairs` parameter, USD/UAH by default.
+func parsePairs(r *http.Request) ([]ratefeed.Pair, error) {
+	param := r.URL.Query().Get("pairs")
+	if param == "" {
+		return []ratefeed.Pair{ratefeed.DefaultPair}, nil
+	}
+
+	names := strings.Split(param, ",")
+	if len(names) > maxStreamPairs {
+		return nil, errTooManyStreamPairs
+	}
+
+	pairs := make([]ratefeed.Pair, 0, len(names))
+	for _, name := range names {
+		p, err := ratefeed.ParsePair(name)
+		if err != nil {
+			return nil, err
+		}
+		pairs = append(pairs, p)
+	}
+	return pairs, nil
+}
+
+// streamConnected counts the new connection of the transport and returns the
+// function to be called once it is closed.
+func streamConnected(transport string) func() {
+	metrics.GetOrCreateCounter(fmt.Sprintf(`rate_stream_connections_total{transport=%q}`, transport)).Inc()
+
+	connections := metrics.GetOrCreateGauge(fmt.Sprintf(`rate_stream_connections{transport=%q}`, transport), nil)
+	connections.Inc()
+	return connections.Dec
+}
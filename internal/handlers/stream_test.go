@@ -0,0 +1,226 @@
+package handlers_test
+
+import (
+	"bufio"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/vladyslavpavlenko/genesis-api-project/internal/app/config"
+	"github.com/vladyslavpavlenko/genesis-api-project/internal/handlers"
+	"github.com/vladyslavpavlenko/genesis-api-project/internal/handlers/routes"
+	"github.com/vladyslavpavlenko/genesis-api-project/internal/rateapi/chain"
+	"github.com/vladyslavpavlenko/genesis-api-project/internal/ratefeed"
+	"github.com/vladyslavpavlenko/genesis-api-project/pkg/logger"
+	"golang.org/x/net/websocket"
+)
+
+type mockQuoteFetcher struct {
+	mu   sync.Mutex
+	rate string
+}
+
+func (m *mockQuoteFetcher) set(rate string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.rate = rate
+}
+
+func (m *mockQuoteFetcher) FetchQuote(_ context.Context, _, _ string) (chain.Quote, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return chain.Quote{Rate: m.rate, Provider: "coinbase"}, nil
+}
+
+// newStreamServer starts a server streaming the rates of the fetcher. The sampler is
+// stopped by the returned function, the same way as on shutdown.
+func newStreamServer(t *testing.T, f *mockQuoteFetcher) (*httptest.Server, context.CancelFunc) {
+	t.Helper()
+
+	sampler := ratefeed.NewSampler(f, 5*time.Millisecond, logger.New(false))
+	require.NoError(t, sampler.Allow([]ratefeed.Pair{ratefeed.DefaultPair, {Base: "EUR", Target: "UAH"}}))
+	ctx, cancel := context.WithCancel(context.Background())
+	go sampler.Run(ctx)
+
+	h := handlers.NewHandlers(&config.Config{StreamHeartbeat: 50 * time.Millisecond},
+		&handlers.Services{RateStream: sampler}, logger.New(false))
+	srv := httptest.NewServer(routes.API(h))
+	t.Cleanup(func() {
+		cancel()
+		srv.Close()
+	})
+	return srv, cancel
+}
+
+// sseReader reads the events of the SSE stream.
+type sseReader struct {
+	t       *testing.T
+	scanner *bufio.Scanner
+}
+
+// next returns the lines of the next event, skipping the heartbeats unless asked for.
+func (r *sseReader) next(heartbeats bool) []string {
+	r.t.Helper()
+
+	var lines []string
+	for r.scanner.Scan() {
+		line := r.scanner.Text()
+		if line != "" {
+			lines = append(lines, line)
+			continue
+		}
+		if len(lines) == 0 || (!heartbeats && lines[0] == ": heartbeat") {
+			lines = nil
+			continue
+		}
+		return lines
+	}
+	return lines
+}
+
+func openSSE(t *testing.T, url, lastEventID string) (*http.Response, *sseReader) {
+	t.Helper()
+
+	req, err := http.NewRequest(http.MethodGet, url, http.NoBody)
+	require.NoError(t, err)
+	if lastEventID != "" {
+		req.Header.Set("Last-Event-ID", lastEventID)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	t.Cleanup(func() { resp.Body.Close() })
+
+	return resp, &sseReader{t: t, scanner: bufio.NewScanner(resp.Body)}
+}
+
+func TestStreamRate(t *testing.T) {
+	f := &mockQuoteFetcher{rate: "41.5"}
+	srv, _ := newStreamServer(t, f)
+
+	resp, events := openSSE(t, srv.URL+"/api/v1/rate/stream?pairs=usd/uah", "")
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+
+	assert.Equal(t, []string{"retry: 3000"}, events.next(false))
+
+	first := events.next(false)
+	require.Len(t, first, 3)
+	assert.Regexp(t, `^id: \d+$`, first[0])
+	assert.Equal(t, "event: quote", first[1])
+	assert.Contains(t, first[2], `"base":"USD","target":"UAH","rate":41.5,"provider":"coinbase"`)
+
+	f.set("41.7")
+	second := events.next(false)
+	require.Len(t, second, 3)
+	assert.Contains(t, second[2], `"rate":41.7`)
+
+	assert.Equal(t, []string{": heartbeat"}, events.next(true))
+
+	// The stream is resumed after the last event received
+	f.set("41.9")
+	assert.Contains(t, events.next(false)[2], `"rate":41.9`)
+
+	_, resumed := openSSE(t, srv.URL+"/api/v1/rate/stream", strings.TrimPrefix(first[0], "id: "))
+	resumed.next(false)
+	assert.Equal(t, second, resumed.next(false))
+	assert.Contains(t, resumed.next(false)[2], `"rate":41.9`)
+}
+
+func TestStreamRate_InvalidPairs(t *testing.T) {
+	srv, _ := newStreamServer(t, &mockQuoteFetcher{rate: "41.5"})
+
+	queries := []string{
+		"pairs=USD",
+		"pairs=USD/UAH,",
+		"pairs=" + strings.Repeat("USD/UAH,", 10) + "EUR/UAH",
+		"pairs=EUR/UAH,GBP/UAH", // not allowed
+	}
+	for _, query := range queries {
+		resp, err := http.Get(srv.URL + "/api/v1/rate/stream?" + query)
+		require.NoError(t, err)
+		resp.Body.Close()
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode, query)
+	}
+}
+
+func TestStreamRate_Shutdown(t *testing.T) {
+	srv, stop := newStreamServer(t, &mockQuoteFetcher{rate: "41.5"})
+
+	_, events := openSSE(t, srv.URL+"/api/v1/rate/stream", "")
+	events.next(false)
+	events.next(false)
+
+	// The stream ends once the sampler is stopped, and no new ones are accepted
+	stop()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for events.scanner.Scan() {
+		}
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		require.Fail(t, "stream not closed")
+	}
+
+	resp, err := http.Get(srv.URL + "/api/v1/rate/stream")
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
+}
+
+func TestStreamRateWebSocket(t *testing.T) {
+	f := &mockQuoteFetcher{rate: "41.5"}
+	srv, stop := newStreamServer(t, f)
+
+	url := "ws" + strings.TrimPrefix(srv.URL, "http") + "/api/v1/rate/ws?pairs=USD/UAH"
+	ws, err := websocket.Dial(url, "", srv.URL)
+	require.NoError(t, err)
+	defer ws.Close()
+	require.NoError(t, ws.SetReadDeadline(time.Now().Add(time.Second)))
+
+	type message struct {
+		Type string  `json:"type"`
+		ID   uint64  `json:"id"`
+		Rate float64 `json:"rate"`
+	}
+	next := func(heartbeats bool) message {
+		for {
+			var msg message
+			require.NoError(t, websocket.JSON.Receive(ws, &msg))
+			if heartbeats || msg.Type != "heartbeat" {
+				return msg
+			}
+		}
+	}
+
+	first := next(false)
+	assert.Equal(t, "quote", first.Type)
+	assert.InDelta(t, 41.5, first.Rate, 1e-9)
+
+	f.set("41.7")
+	second := next(false)
+	assert.Equal(t, "quote", second.Type)
+	assert.InDelta(t, 41.7, second.Rate, 1e-9)
+	assert.Greater(t, second.ID, first.ID)
+
+	assert.Equal(t, "heartbeat", next(true).Type)
+
+	// The connection is closed once the sampler is stopped
+	stop()
+	for {
+		var msg message
+		if err = websocket.JSON.Receive(ws, &msg); err != nil {
+			break
+		}
+	}
+	assert.NotErrorIs(t, err, context.DeadlineExceeded)
+}
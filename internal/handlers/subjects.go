@@ -0,0 +1,70 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/go-chi/chi"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/vladyslavpavlenko/genesis-api-project/internal/privacy"
+	"github.com/vladyslavpavlenko/genesis-api-project/pkg/jsonutils"
+)
+
+const erased = "erased"
+
+var (
+	errExportSubject = errors.New("failed to export subject data")
+	errEraseSubject  = errors.New("failed to erase subject data")
+	errErasures      = errors.New("failed to fetch erasures")
+)
+
+// ExportSubject handles the `GET /admin/subjects/{email}` request. It returns
+// everything held about the email address.
+func (h *Handlers) ExportSubject(w http.ResponseWriter, r *http.Request) {
+	data, err := h.Services.Privacy.Export(chi.URLParam(r, "email"))
+	if err != nil {
+		h.handlePrivacyError(w, r, err, errExportSubject)
+		return
+	}
+
+	_ = jsonutils.WriteJSON(w, http.StatusOK, jsonutils.Response{Data: data})
+}
+
+// EraseSubject handles the `DELETE /admin/subjects/{email}` request. It erases the
+// email address and returns the audit record of the erasure.
+func (h *Handlers) EraseSubject(w http.ResponseWriter, r *http.Request) {
+	erasure, err := h.Services.Privacy.Erase(chi.URLParam(r, "email"), middleware.GetReqID(r.Context()))
+	if err != nil {
+		h.handlePrivacyError(w, r, err, errEraseSubject)
+		return
+	}
+
+	_ = jsonutils.WriteJSON(w, http.StatusOK, jsonutils.Response{Message: erased, Data: erasure})
+}
+
+// GetErasures handles the `/admin/erasures` request. The audit records can be
+// filtered by the `email` of the erased subject.
+func (h *Handlers) GetErasures(w http.ResponseWriter, r *http.Request) {
+	limit, offset := parsePagination(r)
+
+	erasures, err := h.Services.Privacy.GetErasures(r.URL.Query().Get("email"), limit, offset)
+	if err != nil {
+		h.handlePrivacyError(w, r, err, errErasures)
+		return
+	}
+
+	_ = jsonutils.WriteJSON(w, http.StatusOK, jsonutils.Response{Data: erasures})
+}
+
+// handlePrivacyError responds with the status matching the error of the privacy
+// service.
+func (h *Handlers) handlePrivacyError(w http.ResponseWriter, r *http.Request, err, logMessage error) {
+	switch {
+	case errors.Is(err, privacy.ErrInvalidAddress):
+		_ = jsonutils.ErrorJSON(w, err, http.StatusBadRequest)
+	case errors.Is(err, privacy.ErrSubjectNotFound):
+		_ = jsonutils.ErrorJSON(w, err, http.StatusNotFound)
+	default:
+		h.handleError(w, r, err, http.StatusInternalServerError, logMessage.Error())
+	}
+}
@@ -0,0 +1,16 @@
+package models
+
+import "time"
+
+// DeadLetter is a GORM model of a Kafka message that could not be processed after
+// exhausting all the retry attempts.
+type DeadLetter struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	EventID   uint      `json:"event_id"`
+	Topic     string    `gorm:"not null" json:"topic"`
+	Key       string    `json:"key"`
+	Value     string    `gorm:"type:text" json:"value"`
+	Attempts  int       `json:"attempts"`
+	Reason    string    `gorm:"type:text" json:"reason"`
+	CreatedAt time.Time `json:"created_at"`
+}
@@ -0,0 +1,28 @@
+package models
+
+import "time"
+
+const (
+	DeliveryStatusSent     = "sent"
+	DeliveryStatusRetrying = "retrying"
+	DeliveryStatusFailed   = "failed"
+)
+
+// Delivery is a GORM model of a single attempt to deliver an email.
+type Delivery struct {
+	ID         uint      `gorm:"primaryKey" json:"id"`
+	EventID    uint      `gorm:"index" json:"event_id"`
+	RunID      string    `gorm:"index" json:"run_id,omitempty"`
+	Attempt    int       `json:"attempt"`
+	Status     string    `json:"status"` // DeliveryStatusSent, DeliveryStatusRetrying, DeliveryStatusFailed
+	Response   string    `gorm:"type:text" json:"response,omitempty"`
+	StartedAt  time.Time `json:"started_at"`
+	FinishedAt time.Time `json:"finished_at"`
+	DurationMs int64     `json:"duration_ms"`
+
+	// Recipient is stored encrypted if the encryption is enabled. See envelope.Keyring.
+	Recipient string `json:"recipient"`
+	// RecipientIndex is the blind index of the lower-cased Recipient, which finds the
+	// deliveries to the address.
+	RecipientIndex string `gorm:"index" json:"-"`
+}
@@ -0,0 +1,12 @@
+package models
+
+import "time"
+
+// Rate is a GORM model of an exchange rate fetched at a certain time.
+type Rate struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	Base      string    `gorm:"index:idx_rates_pair" json:"base"`
+	Target    string    `gorm:"index:idx_rates_pair" json:"target"`
+	Value     float64   `json:"value"`
+	CreatedAt time.Time `gorm:"index" json:"created_at"`
+}
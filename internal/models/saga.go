@@ -0,0 +1,14 @@
+package models
+
+import "time"
+
+// SagaFilter narrows down the sagas listed. The zero values match every saga.
+type SagaFilter struct {
+	Name   string
+	Status string
+	// Normalized is the normalized email address the sagas are about.
+	Normalized string
+	// CreatedAfter and CreatedBefore bound the time the sagas were started at.
+	CreatedAfter  time.Time
+	CreatedBefore time.Time
+}
@@ -0,0 +1,83 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// SubjectData is everything held about a data subject, that is an email address,
+// including the addresses of its subscriptions and sagas.
+type SubjectData struct {
+	Email         string                `json:"email"`
+	Subscriptions []Subscription        `json:"subscriptions"`
+	History       []SubscriptionHistory `json:"subscription_history"`
+	Sagas         []SubjectSaga         `json:"sagas"`
+	Events        []SubjectEvent        `json:"events"`
+	Deliveries    []Delivery            `json:"deliveries"`
+	Bounces       []Bounce              `json:"bounces"`
+	Suppressions  []Suppression         `json:"suppressions"`
+	DeadLetters   []DeadLetter          `json:"dead_letters"`
+}
+
+// Empty reports whether nothing is held about the subject.
+func (d SubjectData) Empty() bool {
+	return len(d.Subscriptions) == 0 && len(d.Sagas) == 0 && len(d.Events) == 0 &&
+		len(d.Deliveries) == 0 && len(d.Bounces) == 0 && len(d.Suppressions) == 0 &&
+		len(d.DeadLetters) == 0
+}
+
+// SubjectSaga is a read-only view of a saga along with the log of its steps.
+type SubjectSaga struct {
+	ID           string            `json:"id"`
+	Name         string            `json:"name"`
+	CurrentStep  int               `json:"current_step"`
+	Compensating bool              `json:"compensating"`
+	Status       string            `json:"status"`
+	Data         json.RawMessage   `json:"data"`
+	Error        string            `json:"error,omitempty"`
+	Resolution   string            `json:"resolution,omitempty"`
+	CreatedAt    time.Time         `json:"created_at"`
+	UpdatedAt    time.Time         `json:"updated_at"`
+	Steps        []SubjectSagaStep `json:"steps,omitempty"`
+}
+
+// SubjectSagaStep is a read-only view of a single attempt of a saga step.
+type SubjectSagaStep struct {
+	Step      string          `json:"step"`
+	Phase     string          `json:"phase"`
+	Attempt   int             `json:"attempt"`
+	Input     json.RawMessage `json:"input"`
+	Output    json.RawMessage `json:"output,omitempty"`
+	Error     string          `json:"error,omitempty"`
+	Duration  time.Duration   `json:"duration"`
+	StartedAt time.Time       `json:"started_at"`
+}
+
+// SubjectEvent is an outbox event addressed to the subject, along with the time it
+// was consumed at, if it was.
+type SubjectEvent struct {
+	ID         uint            `json:"id"`
+	Data       json.RawMessage `json:"data"`
+	CreatedAt  time.Time       `json:"created_at"`
+	ConsumedAt *time.Time      `json:"consumed_at,omitempty"`
+}
+
+// Erasure is a GORM model of the audit record of an erased data subject. The address
+// is not kept, only its blind index, along with the pseudonym that replaced it and
+// the number of affected records of each table.
+type Erasure struct {
+	ID             uint      `gorm:"primaryKey" json:"id"`
+	SubjectHash    string    `gorm:"index;not null" json:"subject_hash"`
+	Pseudonym      string    `gorm:"not null" json:"pseudonym"`
+	RequestID      string    `json:"request_id,omitempty"`
+	Subscriptions  int64     `json:"subscriptions"`
+	Sagas          int64     `json:"sagas"`
+	SagaSteps      int64     `json:"saga_steps"`
+	Events         int64     `json:"events"`
+	ConsumedEvents int64     `json:"consumed_events"`
+	Deliveries     int64     `json:"deliveries"`
+	Bounces        int64     `json:"bounces"`
+	Suppressions   int64     `json:"suppressions"`
+	DeadLetters    int64     `json:"dead_letters"`
+	CreatedAt      time.Time `json:"created_at"`
+}
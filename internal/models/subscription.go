@@ -2,9 +2,59 @@ package models
 
 import "time"
 
+const (
+	// SubscriptionStatusPending is the status of a subscription that is being set up.
+	SubscriptionStatusPending      = "pending"
+	SubscriptionStatusActive       = "active"
+	SubscriptionStatusUnsubscribed = "unsubscribed"
+	// SubscriptionStatusSuppressed is the status of a subscription whose address has
+	// been suppressed due to bounces or complaints.
+	SubscriptionStatusSuppressed = "suppressed"
+)
+
+const (
+	SubscriptionReasonSignUp       = "sign_up"
+	SubscriptionReasonResubscribe  = "resubscribe"
+	SubscriptionReasonSubscribed   = "subscribed"
+	SubscriptionReasonSignUpFailed = "sign_up_failed"
+	SubscriptionReasonUserRequest  = "user_request"
+	// SubscriptionReasonMerged is the reason of a subscription removed as a duplicate
+	// of another one with the same normalized email.
+	SubscriptionReasonMerged = "merged"
+)
+
 // Subscription is a GORM subscription models.
 type Subscription struct {
-	ID        uint      `gorm:"primaryKey" json:"id"`
-	Email     string    `gorm:"unique" json:"email"`
+	ID uint `gorm:"primaryKey" json:"id"`
+	// Email is stored encrypted if the encryption is enabled. See envelope.Keyring.
+	Email     string    `gorm:"not null" json:"email"`
+	Locale    string    `gorm:"not null;default:en" json:"locale"`
 	CreatedAt time.Time `json:"created_at"`
+
+	// NormalizedEmail is the blind index of the canonical form of Email, unique
+	// across the subscriptions. See email.Normalizer.
+	NormalizedEmail string `gorm:"uniqueIndex" json:"normalized_email"`
+	// EmailIndex is the blind index of the lower-cased Email, which finds the
+	// subscriptions of the exact address.
+	EmailIndex string `gorm:"index" json:"-"`
+
+	Status          string    `gorm:"not null;default:active;index" json:"status"` // SubscriptionStatusPending, SubscriptionStatusActive, ...
+	StatusReason    string    `json:"status_reason,omitempty"`
+	StatusChangedAt time.Time `json:"status_changed_at"`
+}
+
+// SubscriptionHistory is a GORM model of a change of the status of a subscription.
+// The records are only ever appended.
+type SubscriptionHistory struct {
+	ID             uint      `gorm:"primaryKey" json:"id"`
+	SubscriptionID uint      `gorm:"index;not null" json:"subscription_id"`
+	FromStatus     string    `json:"from_status,omitempty"`
+	ToStatus       string    `gorm:"not null" json:"to_status"`
+	Reason         string    `json:"reason,omitempty"`
+	CreatedAt      time.Time `json:"created_at"`
+}
+
+// TableName overrides the pluralized table name.
+func (SubscriptionHistory) TableName() string {
+	return "subscription_history"
 }
@@ -0,0 +1,35 @@
+package models
+
+import "time"
+
+const (
+	SuppressionReasonHardBounces = "hard_bounces"
+	SuppressionReasonComplaint   = "complaint"
+)
+
+// Bounce is a GORM model of a bounce or a complaint received for an email address.
+type Bounce struct {
+	ID         uint      `gorm:"primaryKey" json:"id"`
+	Type       string    `gorm:"not null" json:"type"`
+	Status     string    `json:"status,omitempty"`
+	Diagnostic string    `gorm:"type:text" json:"diagnostic,omitempty"`
+	CreatedAt  time.Time `json:"created_at"`
+
+	// Email is stored encrypted if the encryption is enabled. See envelope.Keyring.
+	Email string `gorm:"not null" json:"email"`
+	// EmailIndex is the blind index of the lower-cased Email, which finds the bounces
+	// of the address.
+	EmailIndex string `gorm:"index" json:"-"`
+}
+
+// Suppression is a GORM model of an email address no emails are sent to.
+type Suppression struct {
+	// EmailIndex is the blind index of the lower-cased Email, so that an address is
+	// suppressed once.
+	EmailIndex string `gorm:"primaryKey" json:"-"`
+	// Email is stored encrypted if the encryption is enabled. See envelope.Keyring.
+	Email string `gorm:"not null" json:"email"`
+
+	Reason    string    `json:"reason"` // SuppressionReasonHardBounces, SuppressionReasonComplaint
+	CreatedAt time.Time `json:"created_at"`
+}
@@ -4,13 +4,20 @@ import (
 	"context"
 	"fmt"
 	"strconv"
+	"strings"
 	"sync"
+	"time"
 
 	"github.com/vladyslavpavlenko/genesis-api-project/internal/models"
 	outboxpkg "github.com/vladyslavpavlenko/genesis-api-project/internal/outbox"
 )
 
-const batchSize = 100
+const (
+	batchSize = 100
+
+	base   = "USD"
+	target = "UAH"
+)
 
 // subscriber defines an interface for managing subscribers.
 type subscriber interface {
@@ -27,24 +34,46 @@ type outbox interface {
 	AddEvent(data outboxpkg.Data) error
 }
 
+// suppressionList defines an interface for checking whether emails are suppressed.
+type suppressionList interface {
+	GetSuppressedAmong(emails []string) (map[string]bool, error)
+}
+
+// rateHistory defines an interface for storing the fetched rates.
+type rateHistory interface {
+	AddRate(rate *models.Rate) error
+	GetLastRateBefore(base, target string, before time.Time) (models.Rate, error)
+}
+
 type Notifier struct {
-	Subscriber subscriber
-	Fetcher    fetcher
-	Outbox     outbox
+	Subscriber   subscriber
+	Fetcher      fetcher
+	Outbox       outbox
+	Suppressions suppressionList
+	History      rateHistory
 }
 
 // NewNotifier creates a new Notifier.
-func NewNotifier(s subscriber, f fetcher, o outbox) *Notifier {
+func NewNotifier(s subscriber, f fetcher, o outbox, sl suppressionList, h rateHistory) *Notifier {
 	return &Notifier{
-		Subscriber: s,
-		Fetcher:    f,
-		Outbox:     o,
+		Subscriber:   s,
+		Fetcher:      f,
+		Outbox:       o,
+		Suppressions: sl,
+		History:      h,
 	}
 }
 
+// RunID returns the ID of the mailing run for the given time. There is a single
+// digest a day, so a subscriber never gets two copies of it even if the mailing is
+// triggered more than once.
+func RunID(t time.Time) string {
+	return "digest-" + t.UTC().Format(time.DateOnly)
+}
+
 // Start handles producing events for currency rate update emails.
 func (n *Notifier) Start() error {
-	rate, err := n.Fetcher.Fetch(context.Background(), "USD", "UAH")
+	rate, err := n.Fetcher.Fetch(context.Background(), base, target)
 	if err != nil {
 		return fmt.Errorf("failed to retrieve rate: %w", err)
 	}
@@ -54,6 +83,14 @@ func (n *Notifier) Start() error {
 		return fmt.Errorf("failed to parse rate: %w", err)
 	}
 
+	now := time.Now()
+	runID := RunID(now)
+
+	previousRate, err := n.recordRate(floatRate, now)
+	if err != nil {
+		return err
+	}
+
 	var offset int
 	errChan := make(chan error, 1)
 	for {
@@ -65,15 +102,31 @@ func (n *Notifier) Start() error {
 			break
 		}
 
+		suppressed, err := n.suppressedAmong(subscriptions)
+		if err != nil {
+			return fmt.Errorf("failed to check suppressions: %w", err)
+		}
+
 		var wg sync.WaitGroup
 		for _, sub := range subscriptions {
+			if suppressed[strings.ToLower(sub.Email)] {
+				continue
+			}
+
 			wg.Add(1)
 			go func(sub models.Subscription) {
 				defer wg.Done()
 
 				data := outboxpkg.Data{
-					Email: sub.Email,
-					Rate:  floatRate,
+					Type:         outboxpkg.TypeRateDigest,
+					Email:        sub.Email,
+					Locale:       sub.Locale,
+					Base:         base,
+					Target:       target,
+					Rate:         floatRate,
+					PreviousRate: previousRate,
+					RatedAt:      now,
+					RunID:        runID,
 				}
 				if localErr := n.Outbox.AddEvent(data); localErr != nil {
 					select {
@@ -95,3 +148,37 @@ func (n *Notifier) Start() error {
 	}
 	return nil
 }
+
+// recordRate adds the rate to the rate history and returns the last rate recorded
+// before the current day, or zero if there is none.
+func (n *Notifier) recordRate(rate float64, now time.Time) (float64, error) {
+	var previous float64
+
+	today := now.UTC().Truncate(24 * time.Hour)
+	last, err := n.History.GetLastRateBefore(base, target, today)
+	if err == nil {
+		previous = last.Value
+	}
+
+	err = n.History.AddRate(&models.Rate{
+		Base:      base,
+		Target:    target,
+		Value:     rate,
+		CreatedAt: now,
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to record rate: %w", err)
+	}
+
+	return previous, nil
+}
+
+// suppressedAmong returns the set of the lower-cased emails of the subscriptions that
+// are suppressed.
+func (n *Notifier) suppressedAmong(subscriptions []models.Subscription) (map[string]bool, error) {
+	emails := make([]string, 0, len(subscriptions))
+	for _, sub := range subscriptions {
+		emails = append(emails, sub.Email)
+	}
+	return n.Suppressions.GetSuppressedAmong(emails)
+}
@@ -2,20 +2,141 @@ package outbox
 
 import (
 	"encoding/json"
+	"strings"
 	"time"
+
+	"github.com/pkg/errors"
+	"github.com/vladyslavpavlenko/genesis-api-project/pkg/envelope"
+)
+
+const (
+	// HeaderEventID is the header of a published message that holds the ID of the
+	// Event.
+	HeaderEventID = "x-event-id"
+	// HeaderEventType is the header of a published message that holds the type of the
+	// Event.
+	HeaderEventType = "x-event-type"
+)
+
+// Streams of the events. Each stream is published to its own topic.
+const (
+	// StreamEmails are the emails to send, whose data is Data.
+	StreamEmails = "emails"
+	// StreamSubscriptions are the subscription domain events, whose data is
+	// SubscriptionEvent.
+	StreamSubscriptions = "subscriptions"
+	// StreamRates are the changes of the rates, whose data is RateEvent.
+	StreamRates = "rates"
+)
+
+// Types of the events.
+const (
+	// TypeRateDigest is the daily rate email. The events stored before the events had
+	// types are digests.
+	TypeRateDigest = "rate.digest"
+	// TypeSubscriptionCreated is the welcome email of a new subscription in the emails
+	// stream, and the creation of the subscription in the subscriptions stream.
+	TypeSubscriptionCreated = "subscription.created"
+	// TypeSubscriptionConfirmed is the activation of a subscription.
+	TypeSubscriptionConfirmed = "subscription.confirmed"
+	// TypeSubscriptionCancelled is the end of a subscription, e.g. once unsubscribed.
+	TypeSubscriptionCancelled = "subscription.cancelled"
+	// TypeRateUpdated is a change of a rate.
+	TypeRateUpdated = "rate.updated"
 )
 
 // Event is a query message model stored in the database.
 type Event struct {
-	ID        uint `gorm:"primaryKey"`
+	ID        uint   `gorm:"primaryKey"`
+	Key       string `gorm:"index"`
+	Stream    string `gorm:"default:emails"`
+	Type      string
 	Data      string
 	CreatedAt time.Time
 }
 
+// NewEvent creates a new Event of the email data, encrypted with the keyring. The
+// event is keyed by the blind index of the recipient.
+func NewEvent(data Data, keys *envelope.Keyring) (*Event, error) {
+	return newEvent(StreamEmails, data.EventType(), data.Key(), data, keys)
+}
+
+// NewSubscriptionEvent creates a new Event of the subscription domain event,
+// encrypted with the keyring. The event is keyed by the blind index of the
+// subscriber, the same way as the emails.
+func NewSubscriptionEvent(e SubscriptionEvent, keys *envelope.Keyring) (*Event, error) {
+	return newEvent(StreamSubscriptions, e.Type, e.Key(), e, keys)
+}
+
+// NewRateEvent creates a new Event of the rate change, encrypted with the keyring like
+// the rest of the events. The event is keyed by the currency pair, which, unlike the
+// addresses, is not blind indexed.
+func NewRateEvent(e RateEvent, keys *envelope.Keyring) (*Event, error) {
+	event, err := newEvent(StreamRates, e.Type, e.Key(), e, keys)
+	if err != nil {
+		return nil, err
+	}
+
+	event.Key = e.Key()
+	return event, nil
+}
+
+// newEvent creates a new Event of the data serialized as JSON.
+func newEvent(stream, typ, key string, data any, keys *envelope.Keyring) (*Event, error) {
+	b, err := json.Marshal(data)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to serialize data")
+	}
+
+	sealed, err := keys.Seal(string(b))
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to encrypt data")
+	}
+
+	return &Event{
+		Key:       keys.BlindIndex(key),
+		Stream:    stream,
+		Type:      typ,
+		Data:      sealed,
+		CreatedAt: time.Now(),
+	}, nil
+}
+
 // Data is an event data model.
 type Data struct {
-	Email string  `json:"email"`
-	Rate  float64 `json:"rate"`
+	Type         string    `json:"type,omitempty"`
+	Email        string    `json:"email"`
+	Locale       string    `json:"locale,omitempty"`
+	Base         string    `json:"base,omitempty"`
+	Target       string    `json:"target,omitempty"`
+	Rate         float64   `json:"rate"`
+	PreviousRate float64   `json:"previous_rate,omitempty"`
+	RatedAt      time.Time `json:"rated_at"`
+	RunID        string    `json:"run_id,omitempty"`
+}
+
+// Key returns the partitioning key of the event. Events of the same recipient share
+// the key, so they are delivered in order.
+func (d Data) Key() string {
+	return strings.ToLower(d.Email)
+}
+
+// EventType returns the type of the event, which defaults to TypeRateDigest.
+func (d Data) EventType() string {
+	if d.Type == "" {
+		return TypeRateDigest
+	}
+	return d.Type
+}
+
+// IdempotencyKey returns the business key of the email, which identifies the
+// recipient within a single mailing run. It returns an empty string if the
+// run is unknown.
+func (d Data) IdempotencyKey() string {
+	if d.RunID == "" {
+		return ""
+	}
+	return strings.ToLower(d.Email) + ":" + d.RunID
 }
 
 // Serialize takes a Data struct and serializes it to a JSON string.
@@ -1,46 +1,69 @@
 package gormoutbox
 
 import (
-	"time"
+	"encoding/json"
 
 	"github.com/vladyslavpavlenko/genesis-api-project/internal/outbox"
-
-	"github.com/pkg/errors"
+	"github.com/vladyslavpavlenko/genesis-api-project/pkg/envelope"
 )
 
 // dbConnection defines an interface for the database connection.
 type dbConnection interface {
-	Migrate(models ...any) error
 	AddEvent(event *outbox.Event) error
+	GetLastEvent(stream, key string) (outbox.Event, error)
 }
 
 // Outbox defines an interface for the transactional outbox.
 type Outbox struct {
-	db dbConnection
+	db   dbConnection
+	keys *envelope.Keyring
+}
+
+// New creates a new Outbox on top of the `events` table, which stores all the events
+// ever occurred. The data of the events is encrypted with the keyring, and only the
+// consumer decrypts it.
+func New(db dbConnection, keys *envelope.Keyring) (*Outbox, error) {
+	return &Outbox{db: db, keys: keys}, nil
 }
 
-// New creates `events` table to implement a transactional outbox.
-// `events` table stores all the events ever occurred.
-func New(db dbConnection) (*Outbox, error) {
-	err := db.Migrate(&outbox.Event{})
+// AddEvent creates a new Event record. The event is keyed by the blind index of the
+// recipient.
+func (o *Outbox) AddEvent(data outbox.Data) error {
+	event, err := outbox.NewEvent(data, o.keys)
 	if err != nil {
-		return nil, errors.Wrap(err, "failed to migrate events")
+		return err
 	}
-	return &Outbox{db: db}, nil
+
+	return o.db.AddEvent(event)
 }
 
-// AddEvent creates a new Event record.
-func (o *Outbox) AddEvent(data outbox.Data) error {
-	event := &outbox.Event{
-		CreatedAt: time.Now(),
+// AddRateEvent creates a new Event record of the rate change.
+func (o *Outbox) AddRateEvent(e outbox.RateEvent) error {
+	event, err := outbox.NewRateEvent(e, o.keys)
+	if err != nil {
+		return err
 	}
 
-	sData, err := data.Serialize()
+	return o.db.AddEvent(event)
+}
+
+// GetLastRateEvent returns the latest change of the rate of the currency pair.
+func (o *Outbox) GetLastRateEvent(base, target string) (outbox.RateEvent, error) {
+	key := outbox.RateEvent{Base: base, Target: target}.Key()
+
+	event, err := o.db.GetLastEvent(outbox.StreamRates, key)
 	if err != nil {
-		return errors.Wrap(err, "failed to serialize data")
+		return outbox.RateEvent{}, err
 	}
 
-	event.Data = sData
+	plaintext, err := o.keys.Open(event.Data)
+	if err != nil {
+		return outbox.RateEvent{}, err
+	}
 
-	return o.db.AddEvent(event)
+	var e outbox.RateEvent
+	if err = json.Unmarshal([]byte(plaintext), &e); err != nil {
+		return outbox.RateEvent{}, err
+	}
+	return e, nil
 }
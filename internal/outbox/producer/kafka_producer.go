@@ -10,6 +10,7 @@ import (
 
 	"github.com/pkg/errors"
 	"github.com/vladyslavpavlenko/genesis-api-project/internal/outbox"
+	"github.com/vladyslavpavlenko/genesis-api-project/pkg/envelope"
 
 	"gorm.io/gorm"
 
@@ -21,10 +22,9 @@ type Outbox interface {
 }
 
 type dbConnection interface {
-	Migrate(models ...any) error
 	BeginTransaction() (*gorm.DB, error)
 	GetLastOffset(topic string, partition int) (Offset, error)
-	FetchUnpublishedEvents(lastOffset uint) ([]outbox.Event, error)
+	FetchUnpublishedEvents(lastOffset uint, stream string) ([]outbox.Event, error)
 	UpdateOffset(offset *Offset) error
 }
 
@@ -32,23 +32,20 @@ type KafkaProducer struct {
 	db     dbConnection
 	Writer *kafka.Writer
 	Outbox Outbox
+	stream string
+	keys   *envelope.Keyring
 	l      *logger.Logger
 }
 
-// NewKafkaProducer initializes a new KafkaProducer.
+// NewKafkaProducer initializes a new KafkaProducer of the outbox.StreamEmails events.
 func NewKafkaProducer(kafkaURL string, o Outbox, db dbConnection, l *logger.Logger) (*KafkaProducer, error) {
 	w := &kafka.Writer{
 		Addr:                   kafka.TCP(kafkaURL),
-		Balancer:               &kafka.LeastBytes{},
+		Balancer:               &kafka.Hash{},
 		AllowAutoTopicCreation: true,
 	}
 
-	err := db.Migrate(&Offset{})
-	if err != nil {
-		return nil, errors.Wrap(err, "failed to migrate offset")
-	}
-
-	return &KafkaProducer{Writer: w, Outbox: o, db: db, l: l}, nil
+	return &KafkaProducer{Writer: w, Outbox: o, db: db, stream: outbox.StreamEmails, l: l}, nil
 }
 
 // NewTopic creates a new kafka.TopicConfig if it doesn't exist.
@@ -77,7 +74,20 @@ func (p *KafkaProducer) SetTopic(topic string) {
 	p.Writer.Topic = topic
 }
 
+// SetStream changes the stream of the outbox events published.
+func (p *KafkaProducer) SetStream(stream string) {
+	p.stream = stream
+}
+
+// Decrypt makes the producer decrypt the data of the events with the keyring before
+// publishing them, for the topics consumed by the services that do not hold the keys.
+func (p *KafkaProducer) Decrypt(keys *envelope.Keyring) {
+	p.keys = keys
+}
+
 // Produce fetches for unpublished events, publishes them, and marks them as published.
+// The partition identifies the stream of the outbox offsets and is not related to the
+// Kafka partitions, which are selected by the event key.
 func (p *KafkaProducer) Produce(ctx context.Context, frequency time.Duration, topic string, partition int) {
 	ticker := time.NewTicker(frequency)
 	defer ticker.Stop()
@@ -127,7 +137,7 @@ func (p *KafkaProducer) processEvents(ctx context.Context, topic string, partiti
 	}
 
 	// Fetch unpublished events based on the last offset
-	events, err := p.db.FetchUnpublishedEvents(lastOffset.Offset)
+	events, err := p.db.FetchUnpublishedEvents(lastOffset.Offset, p.stream)
 	if err != nil {
 		tx.Rollback()
 		p.l.Error("failed to fetch unpublished events", zap.Error(err))
@@ -141,11 +151,31 @@ func (p *KafkaProducer) processEvents(ctx context.Context, topic string, partiti
 
 	// Process each event
 	for _, event := range events {
-		key := []byte(strconv.Itoa(int(event.ID)))
+		eventID := strconv.Itoa(int(event.ID))
+
+		// Events are partitioned by their key, so that the events of a single
+		// recipient keep their order
+		key := event.Key
+		if key == "" {
+			key = eventID
+		}
+
+		value := event.Data
+		if p.keys != nil {
+			if value, err = p.keys.Open(event.Data); err != nil {
+				tx.Rollback()
+				p.l.Error("failed to decrypt message", zap.Int("message_id", int(event.ID)), zap.Error(err))
+				return
+			}
+		}
+
 		msg := &kafka.Message{
-			Key:       key,
-			Value:     []byte(event.Data),
-			Partition: partition,
+			Key:   []byte(key),
+			Value: []byte(value),
+			Headers: []kafka.Header{
+				{Key: outbox.HeaderEventID, Value: []byte(eventID)},
+				{Key: outbox.HeaderEventType, Value: []byte(event.Type)},
+			},
 		}
 
 		p.l.Info("sending message to kafka", zap.Int("message_id", int(event.ID)))
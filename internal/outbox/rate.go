@@ -0,0 +1,49 @@
+package outbox
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// RateEventVersion is the version of the RateEvent schema, which is documented in
+// docs/events/rate.schema.json. It is only bumped by changes that break the consumers.
+const RateEventVersion = 1
+
+// RateEvent is a change of a rate published to the downstream services.
+type RateEvent struct {
+	// ID identifies the event, so the consumers can skip the redelivered ones.
+	ID      string `json:"id"`
+	Type    string `json:"type"`
+	Version int    `json:"version"`
+	// OccurredAt is the time the rate was fetched at.
+	OccurredAt time.Time `json:"occurred_at"`
+	Base       string    `json:"base"`
+	Target     string    `json:"target"`
+	Rate       float64   `json:"rate"`
+	// PreviousRate is the rate of the previous event, or zero if there is none.
+	PreviousRate float64 `json:"previous_rate"`
+	// Provider is the name of the rate API that has returned the rate.
+	Provider string `json:"provider"`
+}
+
+// NewRateEventData returns a new RateEvent of the rate fetched now.
+func NewRateEventData(base, target string, rate, previousRate float64, provider string) RateEvent {
+	return RateEvent{
+		ID:           uuid.New().String(),
+		Type:         TypeRateUpdated,
+		Version:      RateEventVersion,
+		OccurredAt:   time.Now().UTC(),
+		Base:         base,
+		Target:       target,
+		Rate:         rate,
+		PreviousRate: previousRate,
+		Provider:     provider,
+	}
+}
+
+// Key returns the partitioning key of the event. Events of the same currency pair
+// share the key, so they are published in order.
+func (e RateEvent) Key() string {
+	return e.Base + "/" + e.Target
+}
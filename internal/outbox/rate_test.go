@@ -0,0 +1,30 @@
+package outbox_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/vladyslavpavlenko/genesis-api-project/internal/outbox"
+)
+
+// TestRateEvent_Schema checks that the documented schema is in line with the events
+// published.
+func TestRateEvent_Schema(t *testing.T) {
+	e := outbox.NewRateEventData("USD", "UAH", 41.5, 41.2, "coinbase")
+
+	schema := checkSchema(t, "rate", e)
+	assert.Equal(t, []string{outbox.TypeRateUpdated}, schema.Properties["type"].Enum)
+	assert.EqualValues(t, outbox.RateEventVersion, schema.Properties["version"].Const)
+}
+
+func TestNewRateEvent(t *testing.T) {
+	e := outbox.NewRateEventData("USD", "UAH", 41.5, 41.2, "coinbase")
+
+	event, err := outbox.NewRateEvent(e, nil)
+	require.NoError(t, err)
+	assert.Equal(t, outbox.StreamRates, event.Stream)
+	assert.Equal(t, outbox.TypeRateUpdated, event.Type)
+	assert.Equal(t, "USD/UAH", event.Key)
+	assert.Contains(t, event.Data, `"provider":"coinbase"`)
+}
@@ -0,0 +1,46 @@
+package outbox_test
+
+import (
+	"encoding/json"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// schema is the part of a JSON schema of docs/events checked by the tests.
+type schema struct {
+	Required   []string `json:"required"`
+	Properties map[string]struct {
+		Enum  []string `json:"enum"`
+		Const any      `json:"const"`
+	} `json:"properties"`
+}
+
+// checkSchema checks that the documented schema of the name has exactly the fields
+// of the event serialized, and returns the schema for the further checks.
+func checkSchema(t *testing.T, name string, event any) schema {
+	t.Helper()
+
+	b, err := os.ReadFile("../../docs/events/" + name + ".schema.json")
+	require.NoError(t, err)
+
+	var s schema
+	require.NoError(t, json.Unmarshal(b, &s))
+
+	b, err = json.Marshal(event)
+	require.NoError(t, err)
+
+	var fields map[string]any
+	require.NoError(t, json.Unmarshal(b, &fields))
+
+	var names []string
+	for name := range fields {
+		names = append(names, name)
+		assert.Contains(t, s.Properties, name)
+	}
+	assert.ElementsMatch(t, s.Required, names)
+
+	return s
+}
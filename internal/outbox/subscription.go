@@ -0,0 +1,53 @@
+package outbox
+
+import (
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// SubscriptionEventVersion is the version of the SubscriptionEvent schema, which is
+// documented in docs/events/subscription.schema.json. It is only bumped by changes
+// that break the consumers.
+const SubscriptionEventVersion = 1
+
+// SubscriptionEvent is a subscription domain event published to the downstream
+// services.
+type SubscriptionEvent struct {
+	// ID identifies the event, so the consumers can skip the redelivered ones.
+	ID      string `json:"id"`
+	Type    string `json:"type"`
+	Version int    `json:"version"`
+	// OccurredAt is the time the subscription was changed at.
+	OccurredAt     time.Time `json:"occurred_at"`
+	SubscriptionID uint      `json:"subscription_id"`
+	Email          string    `json:"email"`
+	Locale         string    `json:"locale"`
+	// Status is the status of the subscription after the change, and Reason is the
+	// reason for it.
+	Status string `json:"status"`
+	Reason string `json:"reason"`
+}
+
+// NewSubscriptionEventData returns a new SubscriptionEvent of the type occurred now.
+func NewSubscriptionEventData(typ string, subscriptionID uint, email, locale, status, reason string,
+) SubscriptionEvent {
+	return SubscriptionEvent{
+		ID:             uuid.New().String(),
+		Type:           typ,
+		Version:        SubscriptionEventVersion,
+		OccurredAt:     time.Now().UTC(),
+		SubscriptionID: subscriptionID,
+		Email:          email,
+		Locale:         locale,
+		Status:         status,
+		Reason:         reason,
+	}
+}
+
+// Key returns the partitioning key of the event. Events of the same subscriber share
+// the key, so they are published in order.
+func (e SubscriptionEvent) Key() string {
+	return strings.ToLower(e.Email)
+}
@@ -0,0 +1,31 @@
+package outbox_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/vladyslavpavlenko/genesis-api-project/internal/models"
+	"github.com/vladyslavpavlenko/genesis-api-project/internal/outbox"
+)
+
+// TestSubscriptionEvent_Schema checks that the documented schema is in line with the
+// events published.
+func TestSubscriptionEvent_Schema(t *testing.T) {
+	e := outbox.NewSubscriptionEventData(outbox.TypeSubscriptionCreated, 1, "Alice@example.com", "en",
+		models.SubscriptionStatusPending, models.SubscriptionReasonSignUp)
+
+	schema := checkSchema(t, "subscription", e)
+	assert.ElementsMatch(t, []string{outbox.TypeSubscriptionCreated, outbox.TypeSubscriptionConfirmed,
+		outbox.TypeSubscriptionCancelled}, schema.Properties["type"].Enum)
+	assert.ElementsMatch(t, []string{models.SubscriptionStatusPending, models.SubscriptionStatusActive,
+		models.SubscriptionStatusUnsubscribed, models.SubscriptionStatusSuppressed}, schema.Properties["status"].Enum)
+	assert.EqualValues(t, outbox.SubscriptionEventVersion, schema.Properties["version"].Const)
+}
+
+func TestSubscriptionEvent_Key(t *testing.T) {
+	e := outbox.NewSubscriptionEventData(outbox.TypeSubscriptionCancelled, 1, "Alice@example.com", "en",
+		models.SubscriptionStatusUnsubscribed, models.SubscriptionReasonUserRequest)
+
+	assert.Equal(t, "alice@example.com", e.Key())
+	assert.Equal(t, outbox.Data{Email: "alice@Example.com"}.Key(), e.Key())
+}
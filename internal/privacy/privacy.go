@@ -0,0 +1,156 @@
+// Package privacy implements the rights of the data subjects, that is the
+// subscribers, to access and to erase the data held about their email addresses.
+package privacy
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"strings"
+
+	"github.com/vladyslavpavlenko/genesis-api-project/internal/email"
+	"github.com/vladyslavpavlenko/genesis-api-project/internal/models"
+	"github.com/vladyslavpavlenko/genesis-api-project/pkg/envelope"
+	"github.com/vladyslavpavlenko/genesis-api-project/pkg/logger"
+	"go.uber.org/zap"
+)
+
+// pseudonymDomain is the domain of the pseudonyms replacing the erased addresses.
+// The .invalid TLD is reserved by RFC 2606, so the pseudonyms are never delivered.
+const pseudonymDomain = "erased.invalid"
+
+var (
+	ErrInvalidAddress  = errors.New("invalid email address")
+	ErrSubjectNotFound = errors.New("no data is held about the email address")
+)
+
+type store interface {
+	ExportSubject(email, normalized string) (models.SubjectData, error)
+	EraseSubject(email, normalized string, erasure *models.Erasure) error
+	GetErasures(subjectHash string, limit, offset int) ([]models.Erasure, error)
+}
+
+// Service exports and erases the data of the data subjects.
+type Service struct {
+	store      store
+	normalizer *email.Normalizer
+	keys       *envelope.Keyring
+	l          *logger.Logger
+}
+
+// NewService creates a new Service. The subjects are identified by the normalized
+// email addresses, the same way as the subscribers, and the audit records identify
+// them by the blind index of the keyring.
+func NewService(store store, normalizer *email.Normalizer, keys *envelope.Keyring, l *logger.Logger) *Service {
+	return &Service{
+		store:      store,
+		normalizer: normalizer,
+		keys:       keys,
+		l:          l,
+	}
+}
+
+// Export returns everything held about the email address. It returns
+// ErrSubjectNotFound if nothing is.
+func (s *Service) Export(addr string) (models.SubjectData, error) {
+	a, err := s.normalize(addr)
+	if err != nil {
+		return models.SubjectData{}, err
+	}
+
+	data, err := s.store.ExportSubject(a.Email, a.Normalized)
+	if err != nil {
+		return models.SubjectData{}, err
+	}
+
+	if data.Empty() {
+		return models.SubjectData{}, ErrSubjectNotFound
+	}
+
+	return data, nil
+}
+
+// Erase removes or pseudonymizes the email address everywhere it is held, and
+// returns the audit record of the erasure. Every address is replaced with a random
+// pseudonym, so the erased records cannot be linked to each other across erasures.
+// The erasure is recorded even if nothing is held about the address, so that the
+// request can be proven to have been fulfilled.
+func (s *Service) Erase(addr, requestID string) (models.Erasure, error) {
+	a, err := s.normalize(addr)
+	if err != nil {
+		return models.Erasure{}, err
+	}
+
+	pseudonym, err := newPseudonym()
+	if err != nil {
+		return models.Erasure{}, err
+	}
+
+	erasure := models.Erasure{
+		SubjectHash: s.subjectHash(a.Normalized),
+		Pseudonym:   pseudonym,
+		RequestID:   requestID,
+	}
+	if err = s.store.EraseSubject(a.Email, a.Normalized, &erasure); err != nil {
+		return models.Erasure{}, err
+	}
+
+	s.l.Info("data subject erased",
+		zap.Uint("erasure_id", erasure.ID),
+		zap.String("subject_hash", erasure.SubjectHash),
+		zap.Int64("subscriptions", erasure.Subscriptions),
+		zap.Int64("events", erasure.Events))
+
+	return erasure, nil
+}
+
+// GetErasures returns a paginated list of the audit records of the erasures, newest
+// first. The records are filtered by the email address, unless it is empty.
+func (s *Service) GetErasures(addr string, limit, offset int) ([]models.Erasure, error) {
+	var subjectHash string
+	if addr != "" {
+		a, err := s.normalize(addr)
+		if err != nil {
+			return nil, err
+		}
+		subjectHash = s.subjectHash(a.Normalized)
+	}
+
+	return s.store.GetErasures(subjectHash, limit, offset)
+}
+
+// subjectHash returns the blind index of the normalized address, which identifies
+// the subject in the audit records. Without the index key, the address would be
+// stored as is, so its SHA-256 hash is returned instead.
+func (s *Service) subjectHash(normalized string) string {
+	if s.keys.Indexed() {
+		return s.keys.BlindIndex(normalized)
+	}
+
+	sum := sha256.Sum256([]byte(normalized))
+	return hex.EncodeToString(sum[:])
+}
+
+// normalize canonicalizes the address. The addresses the plus-tag policy rejects
+// may still be held, e.g. if the policy has changed, so they are only lower-cased.
+func (s *Service) normalize(addr string) (email.Address, error) {
+	a, err := s.normalizer.Normalize(addr)
+	if errors.Is(err, email.ErrInvalidAddress) {
+		return email.Address{}, ErrInvalidAddress
+	}
+	if err != nil {
+		addr = strings.ToLower(strings.TrimSpace(addr))
+		return email.Address{Email: addr, Normalized: addr}, nil
+	}
+	return a, nil
+}
+
+// newPseudonym returns a random address in the pseudonymDomain.
+func newPseudonym() (string, error) {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return "erased-" + hex.EncodeToString(b) + "@" + pseudonymDomain, nil
+}
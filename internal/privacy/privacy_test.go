@@ -0,0 +1,107 @@
+package privacy_test
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/vladyslavpavlenko/genesis-api-project/internal/email"
+	"github.com/vladyslavpavlenko/genesis-api-project/internal/models"
+	"github.com/vladyslavpavlenko/genesis-api-project/internal/privacy"
+	"github.com/vladyslavpavlenko/genesis-api-project/pkg/envelope"
+	"github.com/vladyslavpavlenko/genesis-api-project/pkg/logger"
+)
+
+type mockStore struct {
+	email, normalized string
+	data              models.SubjectData
+	erasures          []models.Erasure
+	hash              string
+}
+
+func (m *mockStore) ExportSubject(email, normalized string) (models.SubjectData, error) {
+	m.email, m.normalized = email, normalized
+	return m.data, nil
+}
+
+func (m *mockStore) EraseSubject(email, normalized string, erasure *models.Erasure) error {
+	m.email, m.normalized = email, normalized
+	erasure.ID = uint(len(m.erasures) + 1)
+	m.erasures = append(m.erasures, *erasure)
+	return nil
+}
+
+func (m *mockStore) GetErasures(subjectHash string, _, _ int) ([]models.Erasure, error) {
+	m.hash = subjectHash
+	return m.erasures, nil
+}
+
+func newService(t *testing.T, store *mockStore, plusTags string, keys *envelope.Keyring) *privacy.Service {
+	normalizer, err := email.NewNormalizer(plusTags)
+	require.NoError(t, err)
+	return privacy.NewService(store, normalizer, keys, logger.New(false))
+}
+
+func TestService_Export(t *testing.T) {
+	store := &mockStore{}
+	s := newService(t, store, email.PlusTagStrip, nil)
+
+	_, err := s.Export("Alice+news@Example.com")
+	assert.ErrorIs(t, err, privacy.ErrSubjectNotFound)
+	assert.Equal(t, "Alice+news@example.com", store.email)
+	assert.Equal(t, "alice@example.com", store.normalized)
+
+	store.data = models.SubjectData{Subscriptions: []models.Subscription{{ID: 1}}}
+	data, err := s.Export("alice@example.com")
+	require.NoError(t, err)
+	assert.Len(t, data.Subscriptions, 1)
+
+	_, err = s.Export("Alice <alice@example.com>")
+	assert.ErrorIs(t, err, privacy.ErrInvalidAddress)
+}
+
+func TestService_Erase(t *testing.T) {
+	keys, err := envelope.New(nil, bytes.Repeat([]byte{1}, envelope.KeySize))
+	require.NoError(t, err)
+	store := &mockStore{}
+	s := newService(t, store, email.PlusTagReject, keys)
+
+	// The subject is identified by the keyed blind index of the address
+	first, err := s.Erase("alice@example.com", "req-1")
+	require.NoError(t, err)
+	assert.Equal(t, keys.BlindIndex("alice@example.com"), first.SubjectHash)
+	assert.Equal(t, "req-1", first.RequestID)
+	assert.True(t, strings.HasSuffix(first.Pseudonym, "@erased.invalid"), first.Pseudonym)
+	assert.True(t, email.Email(first.Pseudonym).Validate(), first.Pseudonym)
+
+	// The pseudonyms are not derived from the address
+	second, err := s.Erase("alice@example.com", "req-2")
+	require.NoError(t, err)
+	assert.Equal(t, first.SubjectHash, second.SubjectHash)
+	assert.NotEqual(t, first.Pseudonym, second.Pseudonym)
+
+	// The addresses the plus-tag policy rejects can still be erased
+	_, err = s.Erase("Alice+News@example.com", "")
+	require.NoError(t, err)
+	assert.Equal(t, "alice+news@example.com", store.normalized)
+
+	_, err = s.GetErasures("ALICE@example.com", 10, 0)
+	require.NoError(t, err)
+	assert.Equal(t, first.SubjectHash, store.hash)
+
+	_, err = s.GetErasures("", 10, 0)
+	require.NoError(t, err)
+	assert.Empty(t, store.hash)
+}
+
+func TestService_Erase_WithoutIndexKey(t *testing.T) {
+	s := newService(t, &mockStore{}, email.PlusTagReject, nil)
+
+	// The address is never recorded as is
+	erasure, err := s.Erase("alice@example.com", "")
+	require.NoError(t, err)
+	assert.NotContains(t, erasure.SubjectHash, "alice")
+	assert.Len(t, erasure.SubjectHash, 64)
+}
@@ -11,6 +11,18 @@ type Fetcher interface {
 	Fetch(ctx context.Context, base, target string) (string, error)
 }
 
+// named is implemented by the fetchers that have a name, e.g. the provider of the
+// rates.
+type named interface {
+	Name() string
+}
+
+// Quote is a rate along with the provider that has returned it.
+type Quote struct {
+	Rate     string
+	Provider string
+}
+
 // Chain interface defines a chain of responsibility for rate fetching.
 type Chain interface {
 	Fetcher
@@ -35,17 +47,35 @@ func (n *Node) SetNext(next Chain) {
 	n.next = next
 }
 
+// Name returns the name of the node's fetcher, or an empty string if it has none.
+func (n *Node) Name() string {
+	if f, ok := n.fetcher.(named); ok {
+		return f.Name()
+	}
+	return ""
+}
+
 // Fetch fetches the rate and delegates to the next chain if necessary.
 func (n *Node) Fetch(ctx context.Context, base, target string) (string, error) {
+	q, err := n.FetchQuote(ctx, base, target)
+	return q.Rate, err
+}
+
+// FetchQuote fetches the rate along with the name of the fetcher that has returned
+// it, delegating to the next nodes the same way as Fetch.
+func (n *Node) FetchQuote(ctx context.Context, base, target string) (Quote, error) {
 	rate, err := n.fetcher.Fetch(ctx, base, target)
 	if err != nil {
-		next := n.next
-		if next == nil {
-			return "", ErrFetching
+		switch next := n.next.(type) {
+		case nil:
+			return Quote{}, ErrFetching
+		case *Node:
+			return next.FetchQuote(ctx, base, target)
+		default:
+			rate, err = next.Fetch(ctx, base, target)
+			return Quote{Rate: rate}, err
 		}
-
-		return next.Fetch(ctx, base, target)
 	}
 
-	return rate, nil
+	return Quote{Rate: rate, Provider: n.Name()}, nil
 }
@@ -16,6 +16,15 @@ func (m *MockFetcher) Fetch(ctx context.Context, base, target string) (string, e
 	return m.FetchFunc(ctx, base, target)
 }
 
+type namedFetcher struct {
+	MockFetcher
+	name string
+}
+
+func (f *namedFetcher) Name() string {
+	return f.name
+}
+
 func TestNode_Fetch(t *testing.T) {
 	tests := []struct {
 		name          string
@@ -109,3 +118,27 @@ func TestNode_Fetch(t *testing.T) {
 		})
 	}
 }
+
+func TestNode_FetchQuote(t *testing.T) {
+	failing := &namedFetcher{name: "first", MockFetcher: MockFetcher{
+		FetchFunc: func(_ context.Context, _, _ string) (string, error) {
+			return "", errors.New("fetch error")
+		},
+	}}
+	succeeding := &namedFetcher{name: "second", MockFetcher: MockFetcher{
+		FetchFunc: func(_ context.Context, _, _ string) (string, error) {
+			return "20.0", nil
+		},
+	}}
+
+	node := chain.NewNode(failing)
+	node.SetNext(chain.NewNode(succeeding))
+
+	q, err := node.FetchQuote(context.Background(), "USD", "UAH")
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if q.Rate != "20.0" || q.Provider != "second" {
+		t.Errorf("expected rate 20.0 of second, got %s of %s", q.Rate, q.Provider)
+	}
+}
@@ -27,6 +27,11 @@ func NewFetcherWithLogger(name string, f fetcher, l *logger.Logger) *FetcherWith
 	}
 }
 
+// Name returns the name of the fetcher.
+func (f *FetcherWithLogger) Name() string {
+	return f.name
+}
+
 // Fetch performs a call to the Fetcher.
 func (f *FetcherWithLogger) Fetch(ctx context.Context, base, target string) (string, error) {
 	rate, err := f.fetcher.Fetch(ctx, base, target)
@@ -0,0 +1,91 @@
+package ratechart
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/vladyslavpavlenko/genesis-api-project/internal/models"
+	"github.com/vladyslavpavlenko/genesis-api-project/pkg/chart"
+)
+
+const (
+	// Days is the number of days the chart covers.
+	Days = 30
+
+	// cacheTTL is the time a rendered chart is reused for, so that a digest run does
+	// not render it for every subscriber.
+	cacheTTL = 10 * time.Minute
+)
+
+type rateHistory interface {
+	GetRatesSince(base, target string, since time.Time) ([]models.Rate, error)
+}
+
+// cached is a rendered chart.
+type cached struct {
+	png        []byte
+	err        error
+	renderedAt time.Time
+}
+
+// Renderer renders PNG charts of the stored rate history.
+type Renderer struct {
+	db   rateHistory
+	opts chart.Options
+
+	mu    sync.Mutex
+	cache map[string]cached
+	now   func() time.Time
+}
+
+// NewRenderer creates a new Renderer.
+func NewRenderer(db rateHistory) *Renderer {
+	return &Renderer{
+		db:    db,
+		opts:  chart.DefaultOptions(),
+		cache: make(map[string]cached),
+		now:   time.Now,
+	}
+}
+
+// Chart returns the PNG chart of the rates of the currency pair over the last Days
+// days. It returns chart.ErrNotEnoughData if fewer than two rates are stored.
+func (r *Renderer) Chart(base, target string) ([]byte, error) {
+	key := base + "/" + target
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if c, ok := r.cache[key]; ok && r.now().Sub(c.renderedAt) < cacheTTL {
+		return c.png, c.err
+	}
+
+	png, err := r.render(base, target)
+	if err == nil || errors.Is(err, chart.ErrNotEnoughData) {
+		r.cache[key] = cached{png: png, err: err, renderedAt: r.now()}
+	}
+
+	return png, err
+}
+
+func (r *Renderer) render(base, target string) ([]byte, error) {
+	rates, err := r.db.GetRatesSince(base, target, r.now().AddDate(0, 0, -Days))
+	if err != nil {
+		return nil, fmt.Errorf("error getting rates: %w", err)
+	}
+
+	points := make([]chart.Point, len(rates))
+	for i, rate := range rates {
+		points[i] = chart.Point{Time: rate.CreatedAt, Value: rate.Value}
+	}
+
+	var buf bytes.Buffer
+	if err = chart.LinePNG(&buf, points, r.opts); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
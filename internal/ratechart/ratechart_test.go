@@ -0,0 +1,69 @@
+package ratechart_test
+
+import (
+	"bytes"
+	"errors"
+	"image/png"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/vladyslavpavlenko/genesis-api-project/internal/models"
+	"github.com/vladyslavpavlenko/genesis-api-project/internal/ratechart"
+	"github.com/vladyslavpavlenko/genesis-api-project/pkg/chart"
+)
+
+type mockHistory struct {
+	rates []models.Rate
+	err   error
+	calls int
+	since time.Time
+}
+
+func (m *mockHistory) GetRatesSince(_, _ string, since time.Time) ([]models.Rate, error) {
+	m.calls++
+	m.since = since
+	return m.rates, m.err
+}
+
+func TestRenderer_Chart(t *testing.T) {
+	now := time.Now()
+	db := &mockHistory{rates: []models.Rate{
+		{Value: 40.9, CreatedAt: now.AddDate(0, 0, -2)},
+		{Value: 41.1, CreatedAt: now.AddDate(0, 0, -1)},
+		{Value: 41.0, CreatedAt: now},
+	}}
+	r := ratechart.NewRenderer(db)
+
+	b, err := r.Chart("USD", "UAH")
+	require.NoError(t, err)
+
+	_, err = png.Decode(bytes.NewReader(b))
+	require.NoError(t, err)
+	assert.WithinDuration(t, now.AddDate(0, 0, -ratechart.Days), db.since, time.Minute)
+
+	// The chart is rendered once for a digest run
+	_, err = r.Chart("USD", "UAH")
+	require.NoError(t, err)
+	assert.Equal(t, 1, db.calls)
+}
+
+func TestRenderer_ChartNotEnoughData(t *testing.T) {
+	r := ratechart.NewRenderer(&mockHistory{rates: []models.Rate{{Value: 41}}})
+
+	_, err := r.Chart("USD", "UAH")
+	assert.ErrorIs(t, err, chart.ErrNotEnoughData)
+}
+
+func TestRenderer_ChartErrorNotCached(t *testing.T) {
+	db := &mockHistory{err: errors.New("connection refused")}
+	r := ratechart.NewRenderer(db)
+
+	_, err := r.Chart("USD", "UAH")
+	require.Error(t, err)
+	_, err = r.Chart("USD", "UAH")
+	require.Error(t, err)
+
+	assert.Equal(t, 2, db.calls)
+}
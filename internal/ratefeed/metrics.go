@@ -0,0 +1,23 @@
+package ratefeed
+
+import (
+	"fmt"
+
+	"github.com/VictoriaMetrics/metrics"
+)
+
+func samplesCounter(provider string) *metrics.Counter {
+	return metrics.GetOrCreateCounter(fmt.Sprintf(`rate_samples_count{provider=%q}`, provider))
+}
+
+func sampleErrorsCounter(p Pair) *metrics.Counter {
+	return metrics.GetOrCreateCounter(fmt.Sprintf(`rate_sample_errors_count{pair=%q}`, p))
+}
+
+func publishedCounter() *metrics.Counter {
+	return metrics.GetOrCreateCounter(`rate_updates_published_count`)
+}
+
+func coalescedCounter() *metrics.Counter {
+	return metrics.GetOrCreateCounter(`rate_stream_coalesced_quotes_count`)
+}
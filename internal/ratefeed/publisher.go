@@ -0,0 +1,80 @@
+// Package ratefeed samples the rates and shares them with the clients streaming them
+// and with the other services, which subscribe to the changes instead of polling the
+// API.
+package ratefeed
+
+import (
+	"errors"
+	"fmt"
+	"math"
+
+	outboxpkg "github.com/vladyslavpavlenko/genesis-api-project/internal/outbox"
+	"github.com/vladyslavpavlenko/genesis-api-project/pkg/logger"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+// outbox defines an interface for writing the rate events to the outbox.
+type outbox interface {
+	AddRateEvent(e outboxpkg.RateEvent) error
+	GetLastRateEvent(base, target string) (outboxpkg.RateEvent, error)
+}
+
+// Publisher adds a rate.updated event to the outbox whenever the rate observed has
+// moved by more than the epsilon since the last event.
+type Publisher struct {
+	outbox  outbox
+	epsilon float64
+	last    map[Pair]outboxpkg.RateEvent
+	l       *logger.Logger
+}
+
+// NewPublisher creates a new Publisher of the changes greater than epsilon.
+func NewPublisher(o outbox, epsilon float64, l *logger.Logger) *Publisher {
+	return &Publisher{
+		outbox:  o,
+		epsilon: epsilon,
+		last:    make(map[Pair]outboxpkg.RateEvent),
+		l:       l,
+	}
+}
+
+// Publish publishes the quote if the rate has changed enough. It is an Observer of
+// the Sampler. The first quote of a pair is compared with the last event stored, so a
+// restart does not publish the same rate again.
+func (p *Publisher) Publish(q Quote) error {
+	pair := q.Pair()
+
+	last, ok := p.last[pair]
+	if !ok {
+		var err error
+		last, err = p.outbox.GetLastRateEvent(pair.Base, pair.Target)
+		switch {
+		case errors.Is(err, gorm.ErrRecordNotFound):
+		case err != nil:
+			return fmt.Errorf("failed to get last rate event: %w", err)
+		default:
+			ok = true
+			p.last[pair] = last
+		}
+	}
+
+	var previous float64
+	if ok {
+		if math.Abs(q.Rate-last.Rate) <= p.epsilon {
+			return nil
+		}
+		previous = last.Rate
+	}
+
+	e := outboxpkg.NewRateEventData(pair.Base, pair.Target, q.Rate, previous, q.Provider)
+	if err := p.outbox.AddRateEvent(e); err != nil {
+		return fmt.Errorf("failed to add rate event: %w", err)
+	}
+	publishedCounter().Inc()
+	p.last[pair] = e
+
+	p.l.Info("rate updated", zap.Stringer("pair", pair), zap.Float64("rate", q.Rate),
+		zap.Float64("previous_rate", previous), zap.String("provider", q.Provider))
+	return nil
+}
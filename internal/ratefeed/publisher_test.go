@@ -0,0 +1,70 @@
+package ratefeed_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/vladyslavpavlenko/genesis-api-project/internal/outbox"
+	"github.com/vladyslavpavlenko/genesis-api-project/internal/ratefeed"
+	"github.com/vladyslavpavlenko/genesis-api-project/pkg/logger"
+	"gorm.io/gorm"
+)
+
+type mockOutbox struct {
+	events []outbox.RateEvent
+}
+
+func (m *mockOutbox) AddRateEvent(e outbox.RateEvent) error {
+	m.events = append(m.events, e)
+	return nil
+}
+
+func (m *mockOutbox) GetLastRateEvent(_, _ string) (outbox.RateEvent, error) {
+	if len(m.events) == 0 {
+		return outbox.RateEvent{}, gorm.ErrRecordNotFound
+	}
+	return m.events[len(m.events)-1], nil
+}
+
+func quote(rate float64, provider string) ratefeed.Quote {
+	return ratefeed.Quote{Base: "USD", Target: "UAH", Rate: rate, Provider: provider}
+}
+
+func TestPublisher_Publish(t *testing.T) {
+	o := &mockOutbox{}
+	p := ratefeed.NewPublisher(o, 0.1, logger.New(false))
+
+	require.NoError(t, p.Publish(quote(41.5, "coinbase")))
+	require.Len(t, o.events, 1)
+	assert.Equal(t, outbox.TypeRateUpdated, o.events[0].Type)
+	assert.Equal(t, "USD", o.events[0].Base)
+	assert.Equal(t, "UAH", o.events[0].Target)
+	assert.InDelta(t, 41.5, o.events[0].Rate, 1e-9)
+	assert.Zero(t, o.events[0].PreviousRate)
+	assert.Equal(t, "coinbase", o.events[0].Provider)
+
+	// The changes within the epsilon of the last event are not published, even if
+	// they add up
+	require.NoError(t, p.Publish(quote(41.58, "coinbase")))
+	require.NoError(t, p.Publish(quote(41.42, "coinbase")))
+	assert.Len(t, o.events, 1)
+
+	require.NoError(t, p.Publish(quote(41.65, "bank.gov.ua")))
+	require.Len(t, o.events, 2)
+	assert.InDelta(t, 41.65, o.events[1].Rate, 1e-9)
+	assert.InDelta(t, 41.5, o.events[1].PreviousRate, 1e-9)
+	assert.Equal(t, "bank.gov.ua", o.events[1].Provider)
+}
+
+func TestPublisher_PublishAfterRestart(t *testing.T) {
+	o := &mockOutbox{events: []outbox.RateEvent{outbox.NewRateEventData("USD", "UAH", 41.45, 0, "coinbase")}}
+
+	// The rate is compared with the last event stored
+	require.NoError(t, ratefeed.NewPublisher(o, 0.1, logger.New(false)).Publish(quote(41.5, "coinbase")))
+	assert.Len(t, o.events, 1)
+
+	require.NoError(t, ratefeed.NewPublisher(o, 0.1, logger.New(false)).Publish(quote(41.6, "coinbase")))
+	require.Len(t, o.events, 2)
+	assert.InDelta(t, 41.45, o.events[1].PreviousRate, 1e-9)
+}
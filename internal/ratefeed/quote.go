@@ -0,0 +1,63 @@
+package ratefeed
+
+import (
+	"errors"
+	"strings"
+	"time"
+)
+
+var ErrInvalidPair = errors.New("pair must be two currency codes separated by a slash, e.g. USD/UAH")
+
+// DefaultPair is the pair the rate events are published for, and the pair streamed
+// unless others are requested.
+var DefaultPair = Pair{Base: "USD", Target: "UAH"}
+
+// Pair is a currency pair.
+type Pair struct {
+	Base   string
+	Target string
+}
+
+// ParsePair parses the pair written as BASE/TARGET, e.g. usd/uah.
+func ParsePair(s string) (Pair, error) {
+	base, target, ok := strings.Cut(strings.ToUpper(strings.TrimSpace(s)), "/")
+	if !ok || !isCurrencyCode(base) || !isCurrencyCode(target) || base == target {
+		return Pair{}, ErrInvalidPair
+	}
+	return Pair{Base: base, Target: target}, nil
+}
+
+// String returns the pair written as BASE/TARGET.
+func (p Pair) String() string {
+	return p.Base + "/" + p.Target
+}
+
+// isCurrencyCode reports whether s looks like an ISO 4217 code.
+func isCurrencyCode(s string) bool {
+	if len(s) != 3 {
+		return false
+	}
+	for _, r := range s {
+		if r < 'A' || r > 'Z' {
+			return false
+		}
+	}
+	return true
+}
+
+// Quote is a rate sampled by the Sampler.
+type Quote struct {
+	// ID identifies the change of the rate. The IDs only increase, even across the
+	// restarts, so the clients can resume after the last quote they have received.
+	ID        uint64    `json:"id"`
+	Base      string    `json:"base"`
+	Target    string    `json:"target"`
+	Rate      float64   `json:"rate"`
+	Provider  string    `json:"provider"`
+	SampledAt time.Time `json:"sampled_at"`
+}
+
+// Pair returns the pair of the quote.
+func (q Quote) Pair() Pair {
+	return Pair{Base: q.Base, Target: q.Target}
+}
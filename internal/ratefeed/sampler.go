@@ -0,0 +1,320 @@
+package ratefeed
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/vladyslavpavlenko/genesis-api-project/internal/rateapi/chain"
+	"github.com/vladyslavpavlenko/genesis-api-project/pkg/logger"
+	"go.uber.org/zap"
+)
+
+const (
+	// maxPairs is the number of pairs sampled at once, so the clients cannot make the
+	// sampler call the rate APIs for any number of pairs.
+	maxPairs = 20
+	// historySize is the number of the latest quotes kept for the clients resuming.
+	historySize = 256
+)
+
+var (
+	ErrTooManyPairs    = errors.New("too many pairs are streamed")
+	ErrPairNotStreamed = errors.New("pair is not streamed")
+	ErrSamplerClosed   = errors.New("rate sampler is closed")
+)
+
+// fetcher defines an interface for fetching the rates along with their provider.
+type fetcher interface {
+	FetchQuote(ctx context.Context, base, target string) (chain.Quote, error)
+}
+
+// Observer is called with every quote of the pair it observes, changed or not.
+type Observer func(q Quote) error
+
+// Sampler samples the rates of the pairs that are observed or subscribed to every
+// interval, and shares the quotes with all of them, so the rate APIs are called once
+// per pair no matter how many clients there are.
+type Sampler struct {
+	fetcher  fetcher
+	interval time.Duration
+	wake     chan struct{}
+	l        *logger.Logger
+
+	mu        sync.Mutex
+	seq       uint64
+	observers map[Pair][]Observer
+	allowed   map[Pair]bool // nil if any pair can be subscribed to
+	refs      map[Pair]int
+	latest    map[Pair]Quote
+	history   []Quote
+	subs      map[*Subscription]struct{}
+	closed    bool
+}
+
+// NewSampler creates a new Sampler of the rates fetched by f.
+func NewSampler(f fetcher, interval time.Duration, l *logger.Logger) *Sampler {
+	return &Sampler{
+		fetcher:  f,
+		interval: interval,
+		wake:     make(chan struct{}, 1),
+		l:        l,
+		// The IDs start from the current time, so they keep increasing after a
+		// restart, and the IDs of the previous run are not mistaken for the new ones
+		seq:       uint64(time.Now().UnixMilli()),
+		observers: make(map[Pair][]Observer),
+		refs:      make(map[Pair]int),
+		latest:    make(map[Pair]Quote),
+		subs:      make(map[*Subscription]struct{}),
+	}
+}
+
+// Observe makes the sampler sample the pair for as long as it runs and call o with
+// every quote of it. It is to be called before Run.
+func (s *Sampler) Observe(p Pair, o Observer) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.observers[p] = append(s.observers[p], o)
+}
+
+// Allow limits the pairs that can be subscribed to, so that a single client cannot take
+// up all the pairs sampled at once with the pairs nobody else streams. The observed
+// pairs do not have to be allowed. It is to be called before Run.
+func (s *Sampler) Allow(pairs []Pair) error {
+	if len(pairs) > maxPairs {
+		return fmt.Errorf("%w: at most %d pairs can be allowed", ErrTooManyPairs, maxPairs)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.allowed = make(map[Pair]bool, len(pairs))
+	for _, p := range pairs {
+		s.allowed[p] = true
+	}
+	return nil
+}
+
+// Subscribe subscribes to the quotes of the pairs. The subscription starts with the
+// quotes that have changed after the quote with lastEventID, if it is still known,
+// or with the latest quotes of the pairs otherwise. The subscription is to be closed
+// once no longer needed.
+func (s *Sampler) Subscribe(pairs []Pair, lastEventID string) (*Subscription, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return nil, ErrSamplerClosed
+	}
+
+	sub := newSubscription(s, pairs)
+
+	added := 0
+	for p := range sub.pairs {
+		if s.allowed != nil && !s.allowed[p] && len(s.observers[p]) == 0 {
+			return nil, fmt.Errorf("%w: %s", ErrPairNotStreamed, p)
+		}
+		if s.refs[p] == 0 && len(s.observers[p]) == 0 {
+			added++
+		}
+	}
+	if len(s.sampledPairs())+added > maxPairs {
+		return nil, ErrTooManyPairs
+	}
+	for p := range sub.pairs {
+		s.refs[p]++
+	}
+	s.subs[sub] = struct{}{}
+
+	sub.backlog = s.backlog(sub, lastEventID)
+	if added > 0 {
+		// The new pairs are sampled right away rather than after the interval
+		select {
+		case s.wake <- struct{}{}:
+		default:
+		}
+	}
+
+	return sub, nil
+}
+
+// backlog returns the quotes the subscription starts with.
+func (s *Sampler) backlog(sub *Subscription, lastEventID string) []Quote {
+	var backlog []Quote
+
+	// The quotes after the last one received are resumed, unless some of them are no
+	// longer known
+	lastID, err := strconv.ParseUint(lastEventID, 10, 64)
+	if err == nil && len(s.history) > 0 && lastID+1 >= s.history[0].ID && lastID <= s.seq {
+		for _, q := range s.history {
+			if q.ID > lastID && sub.pairs[q.Pair()] {
+				backlog = append(backlog, q)
+			}
+		}
+		return backlog
+	}
+
+	for p := range sub.pairs {
+		if q, ok := s.latest[p]; ok {
+			backlog = append(backlog, q)
+		}
+	}
+	sort.Slice(backlog, func(i, j int) bool { return backlog[i].ID < backlog[j].ID })
+	return backlog
+}
+
+// unsubscribe removes the subscription, so its pairs are no longer sampled unless
+// subscribed to or observed otherwise. The latest quotes of the pairs no longer sampled
+// are forgotten, as they are no longer kept up to date.
+func (s *Sampler) unsubscribe(sub *Subscription) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.subs[sub]; !ok {
+		return
+	}
+	delete(s.subs, sub)
+
+	for p := range sub.pairs {
+		if s.refs[p]--; s.refs[p] == 0 {
+			delete(s.refs, p)
+			if len(s.observers[p]) == 0 {
+				// The pair is sampled right away once subscribed to again
+				delete(s.latest, p)
+			}
+		}
+	}
+}
+
+// Run samples the rates every interval until the context is canceled, and then
+// closes all the subscriptions.
+func (s *Sampler) Run(ctx context.Context) {
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+	defer s.close()
+
+	all := true
+	for {
+		s.sample(ctx, all)
+
+		select {
+		case <-ctx.Done():
+			s.l.Info("shutting down rate sampler...")
+			return
+		case <-ticker.C:
+			all = true
+		case <-s.wake:
+			all = false
+		}
+	}
+}
+
+// sample samples the rates of all the pairs, or only of those without a quote yet.
+func (s *Sampler) sample(ctx context.Context, all bool) {
+	s.mu.Lock()
+	pairs := make([]Pair, 0, maxPairs)
+	for _, p := range s.sampledPairs() {
+		if _, ok := s.latest[p]; all || !ok {
+			pairs = append(pairs, p)
+		}
+	}
+	s.mu.Unlock()
+
+	for _, p := range pairs {
+		if ctx.Err() != nil {
+			return
+		}
+
+		fetched, err := s.fetcher.FetchQuote(ctx, p.Base, p.Target)
+		if err != nil {
+			sampleErrorsCounter(p).Inc()
+			s.l.Error("failed to sample rate", zap.Stringer("pair", p), zap.Error(err))
+			continue
+		}
+
+		rate, err := strconv.ParseFloat(fetched.Rate, 64)
+		if err != nil {
+			sampleErrorsCounter(p).Inc()
+			s.l.Error("failed to parse rate", zap.Stringer("pair", p), zap.Error(err))
+			continue
+		}
+		samplesCounter(fetched.Provider).Inc()
+
+		q, observers := s.record(p, rate, fetched.Provider)
+		for _, o := range observers {
+			if err = o(q); err != nil {
+				s.l.Error("failed to observe rate", zap.Stringer("pair", p), zap.Error(err))
+			}
+		}
+	}
+}
+
+// record stores the rate of the pair and pushes it to the subscriptions if it has
+// changed. It returns the quote along with the observers of the pair.
+func (s *Sampler) record(p Pair, rate float64, provider string) (Quote, []Observer) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now().UTC()
+	if q, ok := s.latest[p]; ok && q.Rate == rate {
+		q.Provider, q.SampledAt = provider, now
+		s.latest[p] = q
+		return q, s.observers[p]
+	}
+
+	s.seq++
+	q := Quote{
+		ID:        s.seq,
+		Base:      p.Base,
+		Target:    p.Target,
+		Rate:      rate,
+		Provider:  provider,
+		SampledAt: now,
+	}
+	s.latest[p] = q
+
+	s.history = append(s.history, q)
+	if len(s.history) > historySize {
+		s.history = append(s.history[:0], s.history[len(s.history)-historySize:]...)
+	}
+
+	for sub := range s.subs {
+		if sub.pairs[p] {
+			sub.push(q)
+		}
+	}
+
+	return q, s.observers[p]
+}
+
+// sampledPairs returns the pairs that are observed or subscribed to.
+func (s *Sampler) sampledPairs() []Pair {
+	pairs := make([]Pair, 0, len(s.observers)+len(s.refs))
+	for p := range s.observers {
+		pairs = append(pairs, p)
+	}
+	for p := range s.refs {
+		if len(s.observers[p]) == 0 {
+			pairs = append(pairs, p)
+		}
+	}
+	return pairs
+}
+
+// close closes all the subscriptions and rejects the new ones.
+func (s *Sampler) close() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.closed = true
+	for sub := range s.subs {
+		close(sub.done)
+	}
+	s.subs = make(map[*Subscription]struct{})
+	s.refs = make(map[Pair]int)
+}
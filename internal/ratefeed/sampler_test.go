@@ -0,0 +1,330 @@
+package ratefeed_test
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/vladyslavpavlenko/genesis-api-project/internal/rateapi/chain"
+	"github.com/vladyslavpavlenko/genesis-api-project/internal/ratefeed"
+	"github.com/vladyslavpavlenko/genesis-api-project/pkg/logger"
+)
+
+// mockFetcher returns the rates set by the test, counting the calls.
+type mockFetcher struct {
+	mu    sync.Mutex
+	rates map[string]string
+	calls map[string]int
+}
+
+func newMockFetcher() *mockFetcher {
+	return &mockFetcher{rates: make(map[string]string), calls: make(map[string]int)}
+}
+
+func (m *mockFetcher) set(pair, rate string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.rates[pair] = rate
+}
+
+func (m *mockFetcher) called(pair string) int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.calls[pair]
+}
+
+func (m *mockFetcher) FetchQuote(_ context.Context, base, target string) (chain.Quote, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	pair := base + "/" + target
+	m.calls[pair]++
+	rate, ok := m.rates[pair]
+	if !ok {
+		return chain.Quote{}, chain.ErrFetching
+	}
+	return chain.Quote{Rate: rate, Provider: "coinbase"}, nil
+}
+
+func runSampler(t *testing.T, f *mockFetcher) (*ratefeed.Sampler, context.CancelFunc) {
+	t.Helper()
+
+	s := ratefeed.NewSampler(f, 5*time.Millisecond, logger.New(false))
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		s.Run(ctx)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-done
+	})
+	return s, cancel
+}
+
+// take waits for the quotes of the subscription until there are n of them.
+func take(t *testing.T, sub *ratefeed.Subscription, n int) []ratefeed.Quote {
+	t.Helper()
+
+	var quotes []ratefeed.Quote
+	timeout := time.After(time.Second)
+	for len(quotes) < n {
+		select {
+		case <-sub.Ready():
+			quotes = append(quotes, sub.Take()...)
+		case <-timeout:
+			require.Failf(t, "timed out", "got %d of %d quotes", len(quotes), n)
+		}
+	}
+	return quotes
+}
+
+func pairs(t *testing.T, names ...string) []ratefeed.Pair {
+	t.Helper()
+
+	var ps []ratefeed.Pair
+	for _, name := range names {
+		p, err := ratefeed.ParsePair(name)
+		require.NoError(t, err)
+		ps = append(ps, p)
+	}
+	return ps
+}
+
+func TestParsePair(t *testing.T) {
+	p, err := ratefeed.ParsePair(" usd/uah ")
+	require.NoError(t, err)
+	assert.Equal(t, ratefeed.DefaultPair, p)
+	assert.Equal(t, "USD/UAH", p.String())
+
+	for _, s := range []string{"", "USD", "USDUAH", "USD/UA", "USD/UAH/EUR", "US1/UAH", "UAH/UAH"} {
+		_, err = ratefeed.ParsePair(s)
+		assert.ErrorIs(t, err, ratefeed.ErrInvalidPair, s)
+	}
+}
+
+func TestSampler_Subscribe(t *testing.T) {
+	f := newMockFetcher()
+	f.set("USD/UAH", "41.5")
+	f.set("EUR/UAH", "45.1")
+	s, _ := runSampler(t, f)
+
+	sub, err := s.Subscribe(pairs(t, "USD/UAH", "EUR/UAH"), "")
+	require.NoError(t, err)
+	defer sub.Close()
+
+	quotes := take(t, sub, 2)
+	require.Len(t, quotes, 2)
+	rates := map[string]float64{}
+	for _, q := range quotes {
+		rates[q.Pair().String()] = q.Rate
+		assert.Equal(t, "coinbase", q.Provider)
+	}
+	assert.Equal(t, map[string]float64{"USD/UAH": 41.5, "EUR/UAH": 45.1}, rates)
+
+	// Only the changes are pushed
+	f.set("USD/UAH", "41.7")
+	quotes = append(quotes, take(t, sub, 1)...)
+	require.Len(t, quotes, 3)
+	assert.Equal(t, "USD/UAH", quotes[2].Pair().String())
+	assert.InDelta(t, 41.7, quotes[2].Rate, 1e-9)
+	assert.Greater(t, quotes[2].ID, quotes[1].ID)
+
+	// The pairs no one subscribes to are no longer sampled
+	sub.Close()
+	time.Sleep(20 * time.Millisecond)
+	calls := f.called("EUR/UAH")
+	time.Sleep(20 * time.Millisecond)
+	assert.Equal(t, calls, f.called("EUR/UAH"))
+}
+
+func TestSampler_Observe(t *testing.T) {
+	f := newMockFetcher()
+	f.set("USD/UAH", "41.5")
+
+	s := ratefeed.NewSampler(f, 5*time.Millisecond, logger.New(false))
+	observed := make(chan ratefeed.Quote, 100)
+	s.Observe(ratefeed.DefaultPair, func(q ratefeed.Quote) error {
+		observed <- q
+		return nil
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go s.Run(ctx)
+
+	// The observed pair is sampled without subscribers, and every sample is observed
+	for i := 0; i < 3; i++ {
+		select {
+		case q := <-observed:
+			assert.InDelta(t, 41.5, q.Rate, 1e-9)
+		case <-time.After(time.Second):
+			require.Fail(t, "timed out")
+		}
+	}
+}
+
+func TestSampler_Resume(t *testing.T) {
+	f := newMockFetcher()
+	f.set("USD/UAH", "41.5")
+	f.set("EUR/UAH", "45.1")
+	s, _ := runSampler(t, f)
+
+	sub, err := s.Subscribe(pairs(t, "USD/UAH", "EUR/UAH"), "")
+	require.NoError(t, err)
+	defer sub.Close()
+	first := take(t, sub, 2)
+
+	f.set("USD/UAH", "41.7")
+	take(t, sub, 1)
+	f.set("EUR/UAH", "45.3")
+	take(t, sub, 1)
+
+	// The quotes after the last one received are resumed
+	lastID := strconv.FormatUint(first[1].ID, 10)
+	resumed, err := s.Subscribe(pairs(t, "USD/UAH"), lastID)
+	require.NoError(t, err)
+	defer resumed.Close()
+	quotes := resumed.Take()
+	require.Len(t, quotes, 1)
+	assert.InDelta(t, 41.7, quotes[0].Rate, 1e-9)
+
+	// The latest quotes are sent if the last one is unknown
+	for _, id := range []string{"", "1", "not a number", fmt.Sprint(^uint64(0))} {
+		latest, err := s.Subscribe(pairs(t, "USD/UAH", "EUR/UAH"), id)
+		require.NoError(t, err)
+		quotes = latest.Take()
+		latest.Close()
+		require.Len(t, quotes, 2, id)
+		assert.InDelta(t, 41.7, quotes[0].Rate, 1e-9, id)
+		assert.InDelta(t, 45.3, quotes[1].Rate, 1e-9, id)
+	}
+}
+
+func TestSampler_Backpressure(t *testing.T) {
+	f := newMockFetcher()
+	f.set("USD/UAH", "41.5")
+	s, _ := runSampler(t, f)
+
+	fast, err := s.Subscribe(pairs(t, "USD/UAH"), "")
+	require.NoError(t, err)
+	defer fast.Close()
+	slow, err := s.Subscribe(pairs(t, "USD/UAH"), "")
+	require.NoError(t, err)
+	defer slow.Close()
+
+	take(t, fast, 1)
+	take(t, slow, 1)
+
+	// The slow subscriber only gets the latest of the quotes it has not taken
+	for _, rate := range []string{"41.6", "41.7", "41.8"} {
+		f.set("USD/UAH", rate)
+		quotes := take(t, fast, 1)
+		assert.Equal(t, rate, strconv.FormatFloat(quotes[len(quotes)-1].Rate, 'f', -1, 64))
+	}
+
+	quotes := slow.Take()
+	require.Len(t, quotes, 1)
+	assert.InDelta(t, 41.8, quotes[0].Rate, 1e-9)
+}
+
+func TestSampler_TooManyPairs(t *testing.T) {
+	s, _ := runSampler(t, newMockFetcher())
+
+	var many []ratefeed.Pair
+	for i := 0; i < 21; i++ {
+		many = append(many, ratefeed.Pair{Base: fmt.Sprintf("A%c%c", 'A'+i/26, 'A'+i%26), Target: "UAH"})
+	}
+
+	_, err := s.Subscribe(many, "")
+	assert.ErrorIs(t, err, ratefeed.ErrTooManyPairs)
+
+	sub, err := s.Subscribe(many[:20], "")
+	require.NoError(t, err)
+	// The pairs already sampled are shared
+	shared, err := s.Subscribe(many[:1], "")
+	require.NoError(t, err)
+	shared.Close()
+	_, err = s.Subscribe(many[20:], "")
+	assert.ErrorIs(t, err, ratefeed.ErrTooManyPairs)
+
+	sub.Close()
+	sub, err = s.Subscribe(many[20:], "")
+	require.NoError(t, err)
+	sub.Close()
+}
+
+func TestSampler_Allow(t *testing.T) {
+	f := newMockFetcher()
+	f.set("USD/UAH", "41.5")
+	f.set("EUR/UAH", "45.1")
+	s := ratefeed.NewSampler(f, 5*time.Millisecond, logger.New(false))
+	s.Observe(ratefeed.DefaultPair, func(ratefeed.Quote) error { return nil })
+	require.NoError(t, s.Allow(pairs(t, "EUR/UAH")))
+
+	sub, err := s.Subscribe(pairs(t, "EUR/UAH"), "")
+	require.NoError(t, err)
+	sub.Close()
+
+	// The observed pairs are sampled anyway
+	sub, err = s.Subscribe(pairs(t, "USD/UAH"), "")
+	require.NoError(t, err)
+	sub.Close()
+
+	_, err = s.Subscribe(pairs(t, "EUR/UAH", "GBP/UAH"), "")
+	assert.ErrorIs(t, err, ratefeed.ErrPairNotStreamed)
+
+	var many []ratefeed.Pair
+	for i := 0; i < 21; i++ {
+		many = append(many, ratefeed.Pair{Base: fmt.Sprintf("A%c%c", 'A'+i/26, 'A'+i%26), Target: "UAH"})
+	}
+	assert.ErrorIs(t, s.Allow(many), ratefeed.ErrTooManyPairs)
+}
+
+func TestSampler_Unsubscribe(t *testing.T) {
+	f := newMockFetcher()
+	f.set("EUR/UAH", "45.1")
+	s, _ := runSampler(t, f)
+
+	sub, err := s.Subscribe(pairs(t, "EUR/UAH"), "")
+	require.NoError(t, err)
+	assert.InDelta(t, 45.1, take(t, sub, 1)[0].Rate, 1e-9)
+	sub.Close()
+
+	// The pair is no longer sampled, so its last quote is not served once it is
+	// subscribed to again, and it is sampled right away instead
+	f.set("EUR/UAH", "46.3")
+	sub, err = s.Subscribe(pairs(t, "EUR/UAH"), "")
+	require.NoError(t, err)
+	defer sub.Close()
+
+	quotes := take(t, sub, 1)
+	require.Len(t, quotes, 1)
+	assert.InDelta(t, 46.3, quotes[0].Rate, 1e-9)
+}
+
+func TestSampler_Close(t *testing.T) {
+	f := newMockFetcher()
+	f.set("USD/UAH", "41.5")
+	s, cancel := runSampler(t, f)
+
+	sub, err := s.Subscribe(pairs(t, "USD/UAH"), "")
+	require.NoError(t, err)
+	defer sub.Close()
+
+	cancel()
+	select {
+	case <-sub.Done():
+	case <-time.After(time.Second):
+		require.Fail(t, "subscription not closed")
+	}
+
+	_, err = s.Subscribe(pairs(t, "USD/UAH"), "")
+	assert.ErrorIs(t, err, ratefeed.ErrSamplerClosed)
+}
@@ -0,0 +1,90 @@
+package ratefeed
+
+import (
+	"sort"
+	"sync"
+)
+
+// Subscription is a subscription to the quotes of some pairs. The quotes a client has
+// not taken yet are coalesced by pair, so a slow client gets the latest quote of every
+// pair rather than a growing queue of the stale ones.
+type Subscription struct {
+	sampler *Sampler
+	pairs   map[Pair]bool
+	ready   chan struct{}
+	done    chan struct{}
+	once    sync.Once
+
+	mu      sync.Mutex
+	backlog []Quote
+	pending map[Pair]Quote
+}
+
+// newSubscription creates a new Subscription to the pairs of the sampler.
+func newSubscription(s *Sampler, pairs []Pair) *Subscription {
+	sub := &Subscription{
+		sampler: s,
+		pairs:   make(map[Pair]bool, len(pairs)),
+		ready:   make(chan struct{}, 1),
+		done:    make(chan struct{}),
+		pending: make(map[Pair]Quote),
+	}
+	for _, p := range pairs {
+		sub.pairs[p] = true
+	}
+	// The backlog is ready to be taken right away
+	sub.ready <- struct{}{}
+	return sub
+}
+
+// Ready is signaled once there are quotes to take.
+func (sub *Subscription) Ready() <-chan struct{} {
+	return sub.ready
+}
+
+// Done is closed once the sampler is stopped.
+func (sub *Subscription) Done() <-chan struct{} {
+	return sub.done
+}
+
+// Take returns the quotes received since the last call, oldest first. The first call
+// returns the backlog as well.
+func (sub *Subscription) Take() []Quote {
+	sub.mu.Lock()
+	defer sub.mu.Unlock()
+
+	quotes := sub.backlog
+	sub.backlog = nil
+
+	pending := make([]Quote, 0, len(sub.pending))
+	for p, q := range sub.pending {
+		pending = append(pending, q)
+		delete(sub.pending, p)
+	}
+	sort.Slice(pending, func(i, j int) bool { return pending[i].ID < pending[j].ID })
+
+	return append(quotes, pending...)
+}
+
+// Close closes the subscription.
+func (sub *Subscription) Close() {
+	sub.once.Do(func() {
+		sub.sampler.unsubscribe(sub)
+	})
+}
+
+// push adds the quote to the ones to be taken, replacing the quote of the same pair
+// that has not been taken yet.
+func (sub *Subscription) push(q Quote) {
+	sub.mu.Lock()
+	if _, ok := sub.pending[q.Pair()]; ok {
+		coalescedCounter().Inc()
+	}
+	sub.pending[q.Pair()] = q
+	sub.mu.Unlock()
+
+	select {
+	case sub.ready <- struct{}{}:
+	default:
+	}
+}
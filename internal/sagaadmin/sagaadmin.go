@@ -0,0 +1,133 @@
+// Package sagaadmin lets the operators inspect the sagas, e.g. the subscriptions,
+// and intervene in the ones that have failed or got stuck.
+package sagaadmin
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/vladyslavpavlenko/genesis-api-project/internal/email"
+	"github.com/vladyslavpavlenko/genesis-api-project/internal/models"
+	"github.com/vladyslavpavlenko/genesis-api-project/pkg/saga"
+)
+
+var (
+	ErrInvalidAddress    = errors.New("invalid email address")
+	ErrInvalidStatus     = errors.New("status must be one of in_progress, completed, failed or resolved")
+	ErrMissingResolution = errors.New("resolution is required")
+)
+
+type store interface {
+	GetSagas(filter models.SagaFilter, limit, offset int) ([]models.SubjectSaga, error)
+	GetSagaHistory(id string) (models.SubjectSaga, error)
+}
+
+type orchestrator interface {
+	Retry(ctx context.Context, id string) error
+	Compensate(ctx context.Context, id, reason string) error
+	Resolve(ctx context.Context, id, resolution string) error
+}
+
+// Query narrows down the sagas listed. The zero values match every saga.
+type Query struct {
+	Name   string
+	Status string
+	// Email is the address the sagas are about. The other forms of the address are
+	// matched as well.
+	Email string
+	// MinAge and MaxAge bound how long ago the sagas were started.
+	MinAge time.Duration
+	MaxAge time.Duration
+}
+
+// Service lists the sagas and intervenes in them.
+type Service struct {
+	store      store
+	sagas      orchestrator
+	normalizer *email.Normalizer
+}
+
+// NewService creates a new Service. The sagas are looked up by the normalized email
+// addresses, the same way as the subscribers.
+func NewService(store store, sagas orchestrator, normalizer *email.Normalizer) *Service {
+	return &Service{
+		store:      store,
+		sagas:      sagas,
+		normalizer: normalizer,
+	}
+}
+
+// GetSagas returns a paginated list of the sagas matching the query, newest first.
+func (s *Service) GetSagas(q Query, limit, offset int) ([]models.SubjectSaga, error) {
+	switch q.Status {
+	case "", saga.StatusInProgress, saga.StatusCompleted, saga.StatusFailed, saga.StatusResolved:
+	default:
+		return nil, ErrInvalidStatus
+	}
+
+	filter := models.SagaFilter{Name: q.Name, Status: q.Status}
+
+	if q.Email != "" {
+		a, err := s.normalizer.Normalize(q.Email)
+		if errors.Is(err, email.ErrInvalidAddress) {
+			return nil, ErrInvalidAddress
+		}
+		if err != nil {
+			// The addresses the plus-tag policy rejects never start a saga past
+			// validation, but are still stored as they are
+			filter.Normalized = strings.ToLower(strings.TrimSpace(q.Email))
+		} else {
+			filter.Normalized = a.Normalized
+		}
+	}
+
+	now := time.Now()
+	if q.MinAge > 0 {
+		filter.CreatedBefore = now.Add(-q.MinAge)
+	}
+	if q.MaxAge > 0 {
+		filter.CreatedAfter = now.Add(-q.MaxAge)
+	}
+
+	return s.store.GetSagas(filter, limit, offset)
+}
+
+// GetSaga returns the saga along with the log of its steps.
+func (s *Service) GetSaga(id string) (models.SubjectSaga, error) {
+	return s.store.GetSagaHistory(id)
+}
+
+// Retry resumes the saga in progress right away and returns it as it ends up. A saga
+// that fails again and is compensated is returned as well.
+func (s *Service) Retry(ctx context.Context, id string) (models.SubjectSaga, error) {
+	return s.intervene(id, s.sagas.Retry(ctx, id))
+}
+
+// Compensate compensates the saga in progress for the reason and returns it as it ends
+// up.
+func (s *Service) Compensate(ctx context.Context, id, reason string) (models.SubjectSaga, error) {
+	if reason == "" {
+		reason = "compensated manually"
+	}
+	return s.intervene(id, s.sagas.Compensate(ctx, id, reason))
+}
+
+// Resolve marks the saga as resolved with the resolution, which is required, and
+// returns it.
+func (s *Service) Resolve(ctx context.Context, id, resolution string) (models.SubjectSaga, error) {
+	if strings.TrimSpace(resolution) == "" {
+		return models.SubjectSaga{}, ErrMissingResolution
+	}
+	return s.intervene(id, s.sagas.Resolve(ctx, id, resolution))
+}
+
+// intervene returns the saga once the intervention has ended with the error.
+func (s *Service) intervene(id string, err error) (models.SubjectSaga, error) {
+	if err != nil && !errors.Is(err, saga.ErrCompensated) {
+		return models.SubjectSaga{}, fmt.Errorf("failed to intervene in saga: %w", err)
+	}
+	return s.store.GetSagaHistory(id)
+}
@@ -0,0 +1,106 @@
+package sagaadmin_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/vladyslavpavlenko/genesis-api-project/internal/email"
+	"github.com/vladyslavpavlenko/genesis-api-project/internal/models"
+	"github.com/vladyslavpavlenko/genesis-api-project/internal/sagaadmin"
+	"github.com/vladyslavpavlenko/genesis-api-project/pkg/saga"
+)
+
+type mockStore struct {
+	filter models.SagaFilter
+}
+
+func (m *mockStore) GetSagas(filter models.SagaFilter, _, _ int) ([]models.SubjectSaga, error) {
+	m.filter = filter
+	return nil, nil
+}
+
+func (m *mockStore) GetSagaHistory(id string) (models.SubjectSaga, error) {
+	return models.SubjectSaga{ID: id, Status: saga.StatusFailed}, nil
+}
+
+type mockOrchestrator struct {
+	err        error
+	reason     string
+	resolution string
+}
+
+func (m *mockOrchestrator) Retry(context.Context, string) error {
+	return m.err
+}
+
+func (m *mockOrchestrator) Compensate(_ context.Context, _, reason string) error {
+	m.reason = reason
+	return m.err
+}
+
+func (m *mockOrchestrator) Resolve(_ context.Context, _, resolution string) error {
+	m.resolution = resolution
+	return m.err
+}
+
+func newService(t *testing.T, store *mockStore, sagas *mockOrchestrator) *sagaadmin.Service {
+	normalizer, err := email.NewNormalizer(email.PlusTagStrip)
+	require.NoError(t, err)
+	return sagaadmin.NewService(store, sagas, normalizer)
+}
+
+func TestService_GetSagas(t *testing.T) {
+	store := &mockStore{}
+	s := newService(t, store, &mockOrchestrator{})
+
+	_, err := s.GetSagas(sagaadmin.Query{
+		Name:   "subscribe",
+		Status: saga.StatusFailed,
+		Email:  "Alice+news@Example.com",
+		MinAge: time.Hour,
+		MaxAge: 24 * time.Hour,
+	}, 10, 0)
+	require.NoError(t, err)
+	assert.Equal(t, "subscribe", store.filter.Name)
+	assert.Equal(t, saga.StatusFailed, store.filter.Status)
+	assert.Equal(t, "alice@example.com", store.filter.Normalized)
+	assert.WithinDuration(t, time.Now().Add(-time.Hour), store.filter.CreatedBefore, time.Second)
+	assert.WithinDuration(t, time.Now().Add(-24*time.Hour), store.filter.CreatedAfter, time.Second)
+
+	_, err = s.GetSagas(sagaadmin.Query{}, 10, 0)
+	require.NoError(t, err)
+	assert.Equal(t, models.SagaFilter{}, store.filter)
+
+	_, err = s.GetSagas(sagaadmin.Query{Status: "stuck"}, 10, 0)
+	assert.ErrorIs(t, err, sagaadmin.ErrInvalidStatus)
+
+	_, err = s.GetSagas(sagaadmin.Query{Email: "Alice <alice@example.com>"}, 10, 0)
+	assert.ErrorIs(t, err, sagaadmin.ErrInvalidAddress)
+}
+
+func TestService_Interventions(t *testing.T) {
+	sagas := &mockOrchestrator{}
+	s := newService(t, &mockStore{}, sagas)
+	ctx := context.Background()
+
+	_, err := s.Compensate(ctx, "id", "")
+	require.NoError(t, err)
+	assert.Equal(t, "compensated manually", sagas.reason)
+
+	_, err = s.Resolve(ctx, "id", " ")
+	assert.ErrorIs(t, err, sagaadmin.ErrMissingResolution)
+	assert.Empty(t, sagas.resolution)
+
+	// The saga compensated again is an outcome rather than an error
+	sagas.err = &saga.CompensatedError{Err: assert.AnError}
+	retried, err := s.Retry(ctx, "id")
+	require.NoError(t, err)
+	assert.Equal(t, saga.StatusFailed, retried.Status)
+
+	sagas.err = saga.ErrSagaLeased
+	_, err = s.Retry(ctx, "id")
+	assert.ErrorIs(t, err, saga.ErrSagaLeased)
+}
@@ -2,18 +2,114 @@ package gormstorage
 
 import (
 	"context"
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 
 	"github.com/vladyslavpavlenko/genesis-api-project/internal/email/consumer"
+	"github.com/vladyslavpavlenko/genesis-api-project/internal/outbox"
 )
 
-// AddConsumedEvent creates a new consumer.ConsumedEvent record.
-func (c *Connection) AddConsumedEvent(event consumer.ConsumedEvent) error {
+// claimTimeout is how long an event is claimed by the consumer processing it. It has
+// to outlive the processing of the event (e.g., an SMTP round trip), as the claim of
+// a consumer that has crashed in the meantime is only released once it expires.
+const claimTimeout = 5 * time.Minute
+
+// ConsumeOnce claims the consumer.ConsumedEvent as pending, runs process, and marks
+// the event as done. If an event with the same ID or idempotency key has already been
+// consumed, process is not run and consumer.ErrEventAlreadyConsumed is returned, or
+// consumer.ErrEventInProgress if it is still claimed by someone else. If process
+// fails, the claim is released so that the event can be consumed again.
+//
+// Process is run outside a transaction, so no connection or lock is held while the
+// event is processed.
+func (c *Connection) ConsumeOnce(event *consumer.ConsumedEvent, process func() error) error {
+	if err := c.claimEvent(event); err != nil {
+		return err
+	}
+
+	if err := process(); err != nil {
+		if releaseErr := c.releaseEvent(event); releaseErr != nil {
+			return errors.Join(err, releaseErr)
+		}
+		return err
+	}
+
+	return c.completeEvent(event)
+}
+
+// claimEvent records the event as pending, unless it is already recorded. The expired
+// claims of the event are released first.
+func (c *Connection) claimEvent(event *consumer.ConsumedEvent) error {
 	ctx, cancel := context.WithTimeout(context.Background(), RequestTimeout)
 	defer cancel()
 
-	result := c.db.WithContext(ctx).Create(event)
-	if result.Error != nil {
-		return result.Error
-	}
-	return nil
+	now := time.Now()
+	claimedUntil := now.Add(claimTimeout)
+	event.Status, event.ClaimedUntil = consumer.ConsumedEventStatusPending, &claimedUntil
+
+	return c.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		conflicting := tx.Where("id = ?", event.ID)
+		if event.IdempotencyKey != nil {
+			conflicting = conflicting.Or("idempotency_key = ?", *event.IdempotencyKey)
+		}
+
+		err := tx.Where(conflicting).Where("status = ? AND claimed_until < ?", consumer.ConsumedEventStatusPending, now).
+			Delete(&consumer.ConsumedEvent{}).Error
+		if err != nil {
+			return err
+		}
+
+		result := tx.Omit("Event").Clauses(clause.OnConflict{DoNothing: true}).Create(event)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected > 0 {
+			return nil
+		}
+
+		var existing consumer.ConsumedEvent
+		if err = tx.Where(conflicting).First(&existing).Error; err != nil {
+			return err
+		}
+		if existing.Status == consumer.ConsumedEventStatusPending {
+			return consumer.ErrEventInProgress
+		}
+		return consumer.ErrEventAlreadyConsumed
+	})
+}
+
+// releaseEvent deletes the pending claim of the event.
+func (c *Connection) releaseEvent(event *consumer.ConsumedEvent) error {
+	ctx, cancel := context.WithTimeout(context.Background(), RequestTimeout)
+	defer cancel()
+
+	return c.db.WithContext(ctx).
+		Where("id = ? AND status = ?", event.ID, consumer.ConsumedEventStatusPending).
+		Delete(&consumer.ConsumedEvent{}).Error
+}
+
+// completeEvent marks the claimed event as done.
+func (c *Connection) completeEvent(event *consumer.ConsumedEvent) error {
+	ctx, cancel := context.WithTimeout(context.Background(), RequestTimeout)
+	defer cancel()
+
+	event.Status, event.ClaimedUntil, event.ConsumedAt = consumer.ConsumedEventStatusDone, nil, time.Now()
+
+	return c.db.WithContext(ctx).Model(&consumer.ConsumedEvent{}).Where("id = ?", event.ID).
+		Updates(map[string]any{
+			"status":        event.Status,
+			"claimed_until": nil,
+			"consumed_at":   event.ConsumedAt,
+		}).Error
+}
+
+// SkipEmail marks the email event as consumed, so that it is never sent, unless it has
+// been consumed, or claimed, already. It is to be called in the transaction that has
+// made the email obsolete.
+func SkipEmail(db *gorm.DB, event *outbox.Event) error {
+	return db.Omit("Event").Clauses(clause.OnConflict{DoNothing: true}).
+		Create(&consumer.ConsumedEvent{ID: event.ID, Data: event.Data, ConsumedAt: time.Now()}).Error
 }
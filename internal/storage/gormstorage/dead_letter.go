@@ -0,0 +1,56 @@
+package gormstorage
+
+import (
+	"context"
+	"errors"
+
+	"github.com/vladyslavpavlenko/genesis-api-project/internal/email/consumer"
+	"github.com/vladyslavpavlenko/genesis-api-project/internal/models"
+	"gorm.io/gorm"
+)
+
+// AddDeadLetter creates a new models.DeadLetter record.
+func (c *Connection) AddDeadLetter(dl *models.DeadLetter) error {
+	ctx, cancel := context.WithTimeout(context.Background(), RequestTimeout)
+	defer cancel()
+
+	return c.db.WithContext(ctx).Create(dl).Error
+}
+
+// GetDeadLetters returns a paginated list of models.DeadLetter records, newest first.
+func (c *Connection) GetDeadLetters(limit, offset int) ([]models.DeadLetter, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), RequestTimeout)
+	defer cancel()
+
+	var dls []models.DeadLetter
+	err := c.db.WithContext(ctx).Order("id DESC").Limit(limit).Offset(offset).Find(&dls).Error
+	if err != nil {
+		return nil, err
+	}
+	return dls, nil
+}
+
+// GetDeadLetter returns a models.DeadLetter record by its ID, or
+// consumer.ErrDeadLetterNotFound if there is none.
+func (c *Connection) GetDeadLetter(id uint) (models.DeadLetter, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), RequestTimeout)
+	defer cancel()
+
+	var dl models.DeadLetter
+	err := c.db.WithContext(ctx).First(&dl, id).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return models.DeadLetter{}, consumer.ErrDeadLetterNotFound
+	}
+	if err != nil {
+		return models.DeadLetter{}, err
+	}
+	return dl, nil
+}
+
+// DeleteDeadLetter deletes a models.DeadLetter record by its ID.
+func (c *Connection) DeleteDeadLetter(id uint) error {
+	ctx, cancel := context.WithTimeout(context.Background(), RequestTimeout)
+	defer cancel()
+
+	return c.db.WithContext(ctx).Delete(&models.DeadLetter{}, id).Error
+}
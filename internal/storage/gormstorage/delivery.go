@@ -0,0 +1,71 @@
+package gormstorage
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/vladyslavpavlenko/genesis-api-project/internal/models"
+)
+
+// AddDelivery creates a new models.Delivery record. The recipient is encrypted with
+// the keyring and indexed by its blind index.
+func (c *Connection) AddDelivery(d *models.Delivery) error {
+	ctx, cancel := context.WithTimeout(context.Background(), RequestTimeout)
+	defer cancel()
+
+	var err error
+	if d.Recipient, d.RecipientIndex, err = c.sealAddress(d.Recipient); err != nil {
+		return err
+	}
+	return c.db.WithContext(ctx).Create(d).Error
+}
+
+// GetDeliveries returns a paginated list of models.Delivery records, newest first,
+// with the recipients decrypted. The records are filtered by the recipient and the
+// mailing run, unless they are empty.
+func (c *Connection) GetDeliveries(recipient, runID string, limit, offset int) ([]models.Delivery, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), RequestTimeout)
+	defer cancel()
+
+	query := c.db.WithContext(ctx)
+	if recipient != "" {
+		query = query.Where("recipient_index = ?", c.keys.BlindIndex(strings.ToLower(recipient)))
+	}
+	if runID != "" {
+		query = query.Where("run_id = ?", runID)
+	}
+
+	var deliveries []models.Delivery
+	err := query.Order("id DESC").Limit(limit).Offset(offset).Find(&deliveries).Error
+	if err != nil {
+		return nil, err
+	}
+	if err = c.openDeliveries(deliveries); err != nil {
+		return nil, err
+	}
+	return deliveries, nil
+}
+
+// openDeliveries decrypts the recipients of the deliveries.
+func (c *Connection) openDeliveries(deliveries []models.Delivery) error {
+	for i := range deliveries {
+		d := &deliveries[i]
+		addr, err := c.keys.Open(d.Recipient)
+		if err != nil {
+			return fmt.Errorf("failed to decrypt delivery %d: %w", d.ID, err)
+		}
+		d.Recipient = addr
+	}
+	return nil
+}
+
+// sealAddress encrypts the address with the keyring, and returns it along with the
+// blind index of the lower-cased address.
+func (c *Connection) sealAddress(addr string) (string, string, error) {
+	sealed, err := c.keys.Seal(addr)
+	if err != nil {
+		return "", "", err
+	}
+	return sealed, c.keys.BlindIndex(strings.ToLower(addr)), nil
+}
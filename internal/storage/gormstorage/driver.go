@@ -2,13 +2,17 @@ package gormstorage
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"strings"
 	"time"
 
 	glogger "gorm.io/gorm/logger"
 
+	"github.com/vladyslavpavlenko/genesis-api-project/pkg/envelope"
 	"github.com/vladyslavpavlenko/genesis-api-project/pkg/logger"
 
+	"github.com/glebarez/sqlite"
 	"go.uber.org/zap"
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
@@ -16,9 +20,23 @@ import (
 
 const RequestTimeout = time.Second * 5
 
+// Supported database drivers.
+const (
+	DriverPostgres = "postgres"
+	// DriverSQLite is a pure-Go SQLite driver, meant for local development and
+	// tests. The DSN is the path to the database file.
+	DriverSQLite = "sqlite"
+)
+
+// sqlitePragmas are applied to every SQLite connection. The busy timeout lets the
+// writers wait for each other instead of failing, as SQLite allows a single one.
+const sqlitePragmas = "_pragma=foreign_keys(1)&_pragma=busy_timeout(60000)&_pragma=journal_mode(WAL)"
+
 type Connection struct {
-	db *gorm.DB
-	l  *logger.Logger
+	db     *gorm.DB
+	driver string
+	keys   *envelope.Keyring
+	l      *logger.Logger
 }
 
 // DB returns a pointer to gorm.DB.
@@ -26,17 +44,38 @@ func (c *Connection) DB() *gorm.DB {
 	return c.db
 }
 
-// Setup sets up a new Connection with a logger.
-func (c *Connection) Setup(dsn string, l *logger.Logger) error {
+// Driver returns the name of the database driver.
+func (c *Connection) Driver() string {
+	return c.driver
+}
+
+// UseKeyring sets the envelope.Keyring the stored email addresses are encrypted and
+// indexed with. Without it, the addresses are stored in plain text.
+func (c *Connection) UseKeyring(keys *envelope.Keyring) {
+	c.keys = keys
+}
+
+// Keyring returns the envelope.Keyring set by UseKeyring.
+func (c *Connection) Keyring() *envelope.Keyring {
+	return c.keys
+}
+
+// Setup sets up a new Connection of the given driver with a logger.
+func (c *Connection) Setup(driver, dsn string, l *logger.Logger) error {
 	c.l = l
+	c.driver = driver
 	var counts int64
 	for {
-		db, err := openDB(dsn)
+		db, err := openDB(driver, dsn)
+		if errors.Is(err, errUnknownDriver) {
+			return err
+		}
 		if err != nil {
-			c.l.Error("Postgres not yet ready...", zap.Int64("attempt", counts), zap.Error(err))
+			c.l.Error("database not yet ready...", zap.String("driver", driver), zap.Int64("attempt", counts),
+				zap.Error(err))
 			counts++
 		} else {
-			c.l.Debug("connected to Postgres!")
+			c.l.Debug("connected to database!", zap.String("driver", driver))
 			c.db = db
 			return nil
 		}
@@ -51,10 +90,25 @@ func (c *Connection) Setup(dsn string, l *logger.Logger) error {
 	}
 }
 
-// openDB initializes a new gorm.DB database connection.
-func openDB(dsn string) (*gorm.DB, error) {
-	db, err := gorm.Open(postgres.Open(dsn), &gorm.Config{
-		Logger: glogger.Default.LogMode(glogger.Silent),
+var errUnknownDriver = errors.New("unknown database driver")
+
+// openDB initializes a new gorm.DB database connection. The driver errors are
+// translated, so that duplicate keys are reported as gorm.ErrDuplicatedKey by both
+// drivers.
+func openDB(driver, dsn string) (*gorm.DB, error) {
+	var dialector gorm.Dialector
+	switch driver {
+	case DriverPostgres:
+		dialector = postgres.Open(dsn)
+	case DriverSQLite:
+		dialector = sqlite.Open(sqliteDSN(dsn))
+	default:
+		return nil, fmt.Errorf("%w: %q", errUnknownDriver, driver)
+	}
+
+	db, err := gorm.Open(dialector, &gorm.Config{
+		Logger:         glogger.Default.LogMode(glogger.Silent),
+		TranslateError: true,
 	})
 	if err != nil {
 		return nil, err
@@ -62,6 +116,15 @@ func openDB(dsn string) (*gorm.DB, error) {
 	return db, nil
 }
 
+// sqliteDSN appends the pragmas to the path of the SQLite database.
+func sqliteDSN(path string) string {
+	sep := "?"
+	if strings.Contains(path, "?") {
+		sep = "&"
+	}
+	return "file:" + path + sep + sqlitePragmas
+}
+
 // Close closes a database connection.
 func (c *Connection) Close() error {
 	sqlDB, err := c.db.DB()
@@ -71,19 +134,6 @@ func (c *Connection) Close() error {
 	return sqlDB.Close()
 }
 
-// Migrate performs a database migration for given models.
-func (c *Connection) Migrate(models ...any) error {
-	ctx, cancel := context.WithTimeout(context.Background(), RequestTimeout)
-	defer cancel()
-
-	err := c.db.WithContext(ctx).AutoMigrate(models...)
-	if err != nil {
-		return fmt.Errorf("error migrating models: %w", err)
-	}
-
-	return nil
-}
-
 // BeginTransaction begins a transaction.
 func (c *Connection) BeginTransaction() (*gorm.DB, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), RequestTimeout)
@@ -18,16 +18,29 @@ func (c *Connection) AddEvent(event *outbox.Event) error {
 	return nil
 }
 
-// FetchUnpublishedEvents retrieves all events from the database that have not been
-// published after the specified offset.
-func (c *Connection) FetchUnpublishedEvents(lastOffset uint) ([]outbox.Event, error) {
+// FetchUnpublishedEvents retrieves all events of the stream from the database that
+// have not been published after the specified offset.
+func (c *Connection) FetchUnpublishedEvents(lastOffset uint, stream string) ([]outbox.Event, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), RequestTimeout)
 	defer cancel()
 
 	var events []outbox.Event
-	err := c.db.WithContext(ctx).Where("id > ?", lastOffset).Find(&events).Error
+	err := c.db.WithContext(ctx).Where("stream = ? AND id > ?", stream, lastOffset).Order("id").Find(&events).Error
 	if err != nil {
 		return nil, err
 	}
 	return events, nil
 }
+
+// GetLastEvent returns the latest event of the stream with the key.
+func (c *Connection) GetLastEvent(stream, key string) (outbox.Event, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), RequestTimeout)
+	defer cancel()
+
+	var event outbox.Event
+	err := c.db.WithContext(ctx).Where("stream = ? AND key = ?", stream, key).Order("id DESC").First(&event).Error
+	if err != nil {
+		return outbox.Event{}, err
+	}
+	return event, nil
+}
@@ -0,0 +1,36 @@
+// Package gormstoragetest provides migrated SQLite databases for the integration
+// tests of the storage and its users.
+package gormstoragetest
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/vladyslavpavlenko/genesis-api-project/internal/storage/gormstorage"
+	"github.com/vladyslavpavlenko/genesis-api-project/pkg/logger"
+)
+
+// NewConnection returns a connection to a fresh SQLite database with all the
+// migrations applied. The database is removed when the test finishes.
+func NewConnection(t testing.TB) *gormstorage.Connection {
+	t.Helper()
+
+	var conn gormstorage.Connection
+	err := conn.Setup(gormstorage.DriverSQLite, filepath.Join(t.TempDir(), "test.db"), logger.New(false))
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+	t.Cleanup(func() { _ = conn.Close() })
+
+	m, err := conn.Migrator()
+	if err != nil {
+		t.Fatalf("failed to load migrations: %v", err)
+	}
+
+	if _, err = m.Up(context.Background()); err != nil {
+		t.Fatalf("failed to migrate database: %v", err)
+	}
+
+	return &conn
+}
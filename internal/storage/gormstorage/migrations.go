@@ -0,0 +1,36 @@
+package gormstorage
+
+import (
+	"embed"
+	"io/fs"
+
+	"github.com/vladyslavpavlenko/genesis-api-project/pkg/migrate"
+)
+
+// migrationLock is the key of the advisory lock held while migrating a Postgres
+// database, so that concurrent replicas run the migrations one at a time.
+const migrationLock = migrate.AdvisoryLock(0x67656e65736973) // "genesis"
+
+//go:embed migrations/postgres/*.sql migrations/sqlite/*.sql
+var migrations embed.FS
+
+// Migrator returns the migrate.Migrator of the embedded migrations of the driver.
+func (c *Connection) Migrator() (*migrate.Migrator, error) {
+	sqlDB, err := c.db.DB()
+	if err != nil {
+		return nil, err
+	}
+
+	fsys, err := fs.Sub(migrations, "migrations/"+c.driver)
+	if err != nil {
+		return nil, err
+	}
+
+	// SQLite allows a single writer anyway
+	var locker migrate.Locker
+	if c.driver == DriverPostgres {
+		locker = migrationLock
+	}
+
+	return migrate.New(sqlDB, fsys, locker)
+}
@@ -0,0 +1,115 @@
+-- The tables are created only if missing, so that the databases previously set up
+-- by GORM AutoMigrate can adopt the migrations. The columns and constraints those
+-- lack are added at the end.
+
+CREATE TABLE IF NOT EXISTS subscriptions (
+    id         BIGSERIAL PRIMARY KEY,
+    email      TEXT NOT NULL,
+    locale     TEXT NOT NULL DEFAULT 'en',
+    created_at TIMESTAMPTZ
+);
+
+CREATE TABLE IF NOT EXISTS events (
+    id         BIGSERIAL PRIMARY KEY,
+    key        TEXT,
+    data       TEXT,
+    created_at TIMESTAMPTZ
+);
+
+CREATE TABLE IF NOT EXISTS offsets (
+    topic       TEXT,
+    "partition" BIGINT,
+    "offset"    BIGINT,
+    PRIMARY KEY (topic, "partition")
+);
+
+CREATE TABLE IF NOT EXISTS consumed_events (
+    id              BIGINT PRIMARY KEY,
+    idempotency_key TEXT,
+    data            TEXT,
+    consumed_at     TIMESTAMPTZ,
+    updated_at      TIMESTAMPTZ,
+    CONSTRAINT fk_consumed_events_event FOREIGN KEY (id) REFERENCES events (id)
+);
+
+CREATE TABLE IF NOT EXISTS dead_letters (
+    id         BIGSERIAL PRIMARY KEY,
+    event_id   BIGINT,
+    topic      TEXT NOT NULL,
+    key        TEXT,
+    value      TEXT,
+    attempts   BIGINT,
+    reason     TEXT,
+    created_at TIMESTAMPTZ
+);
+
+CREATE TABLE IF NOT EXISTS deliveries (
+    id          BIGSERIAL PRIMARY KEY,
+    event_id    BIGINT,
+    run_id      TEXT,
+    recipient   TEXT,
+    attempt     BIGINT,
+    status      TEXT,
+    response    TEXT,
+    started_at  TIMESTAMPTZ,
+    finished_at TIMESTAMPTZ,
+    duration_ms BIGINT
+);
+CREATE INDEX IF NOT EXISTS idx_deliveries_event_id ON deliveries (event_id);
+CREATE INDEX IF NOT EXISTS idx_deliveries_run_id ON deliveries (run_id);
+CREATE INDEX IF NOT EXISTS idx_deliveries_recipient ON deliveries (recipient);
+
+CREATE TABLE IF NOT EXISTS bounces (
+    id         BIGSERIAL PRIMARY KEY,
+    email      TEXT NOT NULL,
+    type       TEXT NOT NULL,
+    status     TEXT,
+    diagnostic TEXT,
+    created_at TIMESTAMPTZ
+);
+CREATE INDEX IF NOT EXISTS idx_bounces_email ON bounces (email);
+
+CREATE TABLE IF NOT EXISTS suppressions (
+    email      TEXT PRIMARY KEY,
+    reason     TEXT,
+    created_at TIMESTAMPTZ
+);
+
+CREATE TABLE IF NOT EXISTS rates (
+    id         BIGSERIAL PRIMARY KEY,
+    base       TEXT,
+    target     TEXT,
+    value      DECIMAL,
+    created_at TIMESTAMPTZ
+);
+CREATE INDEX IF NOT EXISTS idx_rates_pair ON rates (base, target);
+CREATE INDEX IF NOT EXISTS idx_rates_created_at ON rates (created_at);
+
+CREATE TABLE IF NOT EXISTS states (
+    id              TEXT PRIMARY KEY,
+    current_step    BIGINT,
+    email           TEXT,
+    locale          TEXT,
+    is_compensating BOOLEAN,
+    status          TEXT
+);
+
+-- Adopted databases
+
+ALTER TABLE subscriptions ADD COLUMN IF NOT EXISTS locale TEXT NOT NULL DEFAULT 'en';
+-- The addresses are unique by their normalized email instead
+ALTER TABLE subscriptions DROP CONSTRAINT IF EXISTS uni_subscriptions_email;
+
+ALTER TABLE events ADD COLUMN IF NOT EXISTS key TEXT;
+
+ALTER TABLE consumed_events ADD COLUMN IF NOT EXISTS idempotency_key TEXT;
+DO $$
+BEGIN
+    IF NOT EXISTS (SELECT 1 FROM pg_constraint WHERE conrelid = 'consumed_events'::regclass AND contype = 'p') THEN
+        ALTER TABLE consumed_events ADD PRIMARY KEY (id);
+    END IF;
+END
+$$;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_consumed_events_idempotency_key ON consumed_events (idempotency_key);
+
+ALTER TABLE states ADD COLUMN IF NOT EXISTS locale TEXT;
@@ -0,0 +1,5 @@
+ALTER TABLE states DROP COLUMN IF EXISTS normalized_email;
+
+DROP INDEX IF EXISTS idx_subscriptions_normalized_email;
+
+ALTER TABLE subscriptions DROP COLUMN IF EXISTS normalized_email;
@@ -0,0 +1,18 @@
+-- The normalized email is backfilled with the lower-cased address, and only the
+-- oldest of the subscriptions sharing it is kept. `migrate up` then re-normalizes
+-- the addresses according to EMAIL_PLUS_TAGS.
+
+ALTER TABLE subscriptions ADD COLUMN IF NOT EXISTS normalized_email TEXT;
+
+UPDATE subscriptions
+SET normalized_email = lower(trim(email))
+WHERE normalized_email IS NULL OR normalized_email = '';
+
+DELETE FROM subscriptions s
+USING subscriptions kept
+WHERE s.normalized_email = kept.normalized_email
+  AND s.id > kept.id;
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_subscriptions_normalized_email ON subscriptions (normalized_email);
+
+ALTER TABLE states ADD COLUMN IF NOT EXISTS normalized_email TEXT;
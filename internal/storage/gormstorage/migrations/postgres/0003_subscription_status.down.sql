@@ -0,0 +1,15 @@
+ALTER TABLE states
+    DROP COLUMN previous_status,
+    DROP COLUMN subscription_id;
+
+-- Only the active subscriptions existed before
+DELETE FROM subscriptions WHERE status <> 'active';
+
+DROP TABLE subscription_history;
+
+DROP INDEX idx_subscriptions_status;
+
+ALTER TABLE subscriptions
+    DROP COLUMN status_changed_at,
+    DROP COLUMN status_reason,
+    DROP COLUMN status;
@@ -0,0 +1,36 @@
+ALTER TABLE subscriptions
+    ADD COLUMN status            TEXT NOT NULL DEFAULT 'active',
+    ADD COLUMN status_reason     TEXT,
+    ADD COLUMN status_changed_at TIMESTAMPTZ;
+
+UPDATE subscriptions SET status_changed_at = created_at;
+
+CREATE INDEX idx_subscriptions_status ON subscriptions (status);
+
+CREATE TABLE subscription_history (
+    id              BIGSERIAL PRIMARY KEY,
+    subscription_id BIGINT NOT NULL REFERENCES subscriptions (id) ON DELETE CASCADE,
+    from_status     TEXT,
+    to_status       TEXT NOT NULL,
+    reason          TEXT,
+    created_at      TIMESTAMPTZ
+);
+CREATE INDEX idx_subscription_history_subscription_id ON subscription_history (subscription_id);
+
+INSERT INTO subscription_history (subscription_id, from_status, to_status, reason, created_at)
+SELECT id, '', 'active', 'sign_up', created_at FROM subscriptions;
+
+-- The addresses suppressed so far no longer receive emails
+INSERT INTO subscription_history (subscription_id, from_status, to_status, reason, created_at)
+SELECT s.id, 'active', 'suppressed', sp.reason, now()
+FROM subscriptions s
+JOIN suppressions sp ON sp.email = lower(s.email);
+
+UPDATE subscriptions s
+SET status = 'suppressed', status_reason = sp.reason, status_changed_at = now()
+FROM suppressions sp
+WHERE sp.email = lower(s.email);
+
+ALTER TABLE states
+    ADD COLUMN subscription_id BIGINT,
+    ADD COLUMN previous_status TEXT;
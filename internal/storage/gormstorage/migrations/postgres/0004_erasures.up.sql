@@ -0,0 +1,18 @@
+CREATE TABLE erasures (
+    id              BIGSERIAL PRIMARY KEY,
+    subject_hash    TEXT NOT NULL,
+    pseudonym       TEXT NOT NULL,
+    request_id      TEXT,
+    subscriptions   BIGINT NOT NULL DEFAULT 0,
+    states          BIGINT NOT NULL DEFAULT 0,
+    events          BIGINT NOT NULL DEFAULT 0,
+    consumed_events BIGINT NOT NULL DEFAULT 0,
+    deliveries      BIGINT NOT NULL DEFAULT 0,
+    bounces         BIGINT NOT NULL DEFAULT 0,
+    suppressions    BIGINT NOT NULL DEFAULT 0,
+    dead_letters    BIGINT NOT NULL DEFAULT 0,
+    created_at      TIMESTAMPTZ
+);
+CREATE INDEX idx_erasures_subject_hash ON erasures (subject_hash);
+
+CREATE INDEX idx_events_key ON events (key);
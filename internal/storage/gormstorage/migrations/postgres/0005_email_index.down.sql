@@ -0,0 +1,3 @@
+DROP INDEX idx_subscriptions_email_index;
+
+ALTER TABLE subscriptions DROP COLUMN email_index;
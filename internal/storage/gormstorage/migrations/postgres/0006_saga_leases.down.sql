@@ -0,0 +1,5 @@
+DROP INDEX idx_states_status;
+
+ALTER TABLE states
+    DROP COLUMN lease_expires_at,
+    DROP COLUMN lease_owner;
@@ -0,0 +1,5 @@
+ALTER TABLE states
+    ADD COLUMN lease_owner      TEXT,
+    ADD COLUMN lease_expires_at TIMESTAMPTZ;
+
+CREATE INDEX idx_states_status ON states (status);
@@ -0,0 +1,36 @@
+ALTER TABLE erasures DROP COLUMN saga_steps;
+ALTER TABLE erasures RENAME COLUMN sagas TO states;
+
+CREATE TABLE states (
+    id               TEXT PRIMARY KEY,
+    current_step     BIGINT,
+    email            TEXT,
+    locale           TEXT,
+    is_compensating  BOOLEAN,
+    status           TEXT,
+    normalized_email TEXT,
+    subscription_id  BIGINT,
+    previous_status  TEXT,
+    lease_owner      TEXT,
+    lease_expires_at TIMESTAMPTZ
+);
+CREATE INDEX idx_states_status ON states (status);
+
+INSERT INTO states (id, current_step, email, locale, is_compensating, status, normalized_email, subscription_id,
+                    previous_status, lease_owner, lease_expires_at)
+SELECT id,
+       current_step,
+       data::json ->> 'email',
+       data::json ->> 'locale',
+       compensating,
+       status,
+       key,
+       (data::json ->> 'subscription_id')::bigint,
+       data::json ->> 'previous_status',
+       lease_owner,
+       lease_expires_at
+FROM sagas
+WHERE name = 'subscribe';
+
+DROP TABLE saga_steps;
+DROP TABLE sagas;
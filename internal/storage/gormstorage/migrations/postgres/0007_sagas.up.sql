@@ -0,0 +1,53 @@
+CREATE TABLE sagas (
+    id               TEXT PRIMARY KEY,
+    name             TEXT NOT NULL,
+    key              TEXT,
+    current_step     BIGINT NOT NULL DEFAULT 0,
+    compensating     BOOLEAN NOT NULL DEFAULT FALSE,
+    status           TEXT NOT NULL,
+    data             TEXT,
+    error            TEXT,
+    lease_owner      TEXT,
+    lease_expires_at TIMESTAMPTZ,
+    created_at       TIMESTAMPTZ,
+    updated_at       TIMESTAMPTZ
+);
+CREATE INDEX idx_sagas_status ON sagas (status);
+CREATE INDEX idx_sagas_key ON sagas (key);
+
+CREATE TABLE saga_steps (
+    id         BIGSERIAL PRIMARY KEY,
+    saga_id    TEXT NOT NULL REFERENCES sagas (id) ON DELETE CASCADE,
+    step       TEXT NOT NULL,
+    step_index BIGINT NOT NULL,
+    phase      TEXT NOT NULL,
+    attempt    BIGINT NOT NULL,
+    input      TEXT,
+    output     TEXT,
+    error      TEXT,
+    duration   BIGINT,
+    started_at TIMESTAMPTZ
+);
+CREATE INDEX idx_saga_steps_saga_id ON saga_steps (saga_id);
+
+-- The subscription sagas are carried over with the same steps
+INSERT INTO sagas (id, name, key, current_step, compensating, status, data, lease_owner, lease_expires_at,
+                   created_at, updated_at)
+SELECT id,
+       'subscribe',
+       normalized_email,
+       COALESCE(current_step, 0),
+       COALESCE(is_compensating, FALSE),
+       COALESCE(status, 'in_progress'),
+       json_build_object('email', email, 'normalized_email', normalized_email, 'locale', locale,
+                         'subscription_id', subscription_id, 'previous_status', previous_status)::text,
+       lease_owner,
+       lease_expires_at,
+       now(),
+       now()
+FROM states;
+
+DROP TABLE states;
+
+ALTER TABLE erasures RENAME COLUMN states TO sagas;
+ALTER TABLE erasures ADD COLUMN saga_steps BIGINT NOT NULL DEFAULT 0;
@@ -0,0 +1,3 @@
+DROP INDEX idx_events_stream;
+
+ALTER TABLE events DROP COLUMN stream;
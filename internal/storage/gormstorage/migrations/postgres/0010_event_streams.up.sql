@@ -0,0 +1,3 @@
+ALTER TABLE events ADD COLUMN stream TEXT NOT NULL DEFAULT 'emails';
+
+CREATE INDEX idx_events_stream ON events (stream, id);
@@ -0,0 +1,5 @@
+DELETE FROM consumed_events WHERE status = 'pending';
+
+ALTER TABLE consumed_events
+    DROP COLUMN claimed_until,
+    DROP COLUMN status;
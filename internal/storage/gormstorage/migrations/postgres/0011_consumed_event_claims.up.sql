@@ -0,0 +1,3 @@
+ALTER TABLE consumed_events
+    ADD COLUMN status        TEXT NOT NULL DEFAULT 'done',
+    ADD COLUMN claimed_until TIMESTAMPTZ;
@@ -0,0 +1,11 @@
+ALTER TABLE suppressions DROP CONSTRAINT suppressions_pkey;
+ALTER TABLE suppressions DROP COLUMN email_index;
+ALTER TABLE suppressions ADD PRIMARY KEY (email);
+
+DROP INDEX idx_bounces_email_index;
+ALTER TABLE bounces DROP COLUMN email_index;
+CREATE INDEX idx_bounces_email ON bounces (email);
+
+DROP INDEX idx_deliveries_recipient_index;
+ALTER TABLE deliveries DROP COLUMN recipient_index;
+CREATE INDEX idx_deliveries_recipient ON deliveries (recipient);
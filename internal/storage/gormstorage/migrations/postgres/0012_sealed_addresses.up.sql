@@ -0,0 +1,23 @@
+-- The indexes are computed in plain text until the encryption is enabled, after
+-- which `migrate up` recomputes them along with encrypting the addresses
+ALTER TABLE deliveries ADD COLUMN recipient_index TEXT;
+
+UPDATE deliveries SET recipient_index = lower(recipient);
+
+DROP INDEX IF EXISTS idx_deliveries_recipient;
+CREATE INDEX idx_deliveries_recipient_index ON deliveries (recipient_index);
+
+ALTER TABLE bounces ADD COLUMN email_index TEXT;
+
+UPDATE bounces SET email_index = lower(email);
+
+DROP INDEX IF EXISTS idx_bounces_email;
+CREATE INDEX idx_bounces_email_index ON bounces (email_index);
+
+-- The addresses are suppressed once by their index, as the encrypted ones differ
+ALTER TABLE suppressions ADD COLUMN email_index TEXT;
+
+UPDATE suppressions SET email_index = lower(email);
+
+ALTER TABLE suppressions DROP CONSTRAINT suppressions_pkey;
+ALTER TABLE suppressions ADD PRIMARY KEY (email_index);
@@ -0,0 +1,10 @@
+DROP TABLE IF EXISTS states;
+DROP TABLE IF EXISTS rates;
+DROP TABLE IF EXISTS suppressions;
+DROP TABLE IF EXISTS bounces;
+DROP TABLE IF EXISTS deliveries;
+DROP TABLE IF EXISTS dead_letters;
+DROP TABLE IF EXISTS consumed_events;
+DROP TABLE IF EXISTS offsets;
+DROP TABLE IF EXISTS events;
+DROP TABLE IF EXISTS subscriptions;
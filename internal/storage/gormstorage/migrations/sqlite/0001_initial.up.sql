@@ -0,0 +1,92 @@
+CREATE TABLE subscriptions (
+    id         INTEGER PRIMARY KEY AUTOINCREMENT,
+    email      TEXT NOT NULL,
+    locale     TEXT NOT NULL DEFAULT 'en',
+    created_at DATETIME
+);
+
+CREATE TABLE events (
+    id         INTEGER PRIMARY KEY AUTOINCREMENT,
+    key        TEXT,
+    data       TEXT,
+    created_at DATETIME
+);
+
+CREATE TABLE offsets (
+    topic       TEXT,
+    "partition" INTEGER,
+    "offset"    INTEGER,
+    PRIMARY KEY (topic, "partition")
+);
+
+CREATE TABLE consumed_events (
+    id              INTEGER PRIMARY KEY,
+    idempotency_key TEXT,
+    data            TEXT,
+    consumed_at     DATETIME,
+    updated_at      DATETIME,
+    CONSTRAINT fk_consumed_events_event FOREIGN KEY (id) REFERENCES events (id)
+);
+CREATE UNIQUE INDEX idx_consumed_events_idempotency_key ON consumed_events (idempotency_key);
+
+CREATE TABLE dead_letters (
+    id         INTEGER PRIMARY KEY AUTOINCREMENT,
+    event_id   INTEGER,
+    topic      TEXT NOT NULL,
+    key        TEXT,
+    value      TEXT,
+    attempts   INTEGER,
+    reason     TEXT,
+    created_at DATETIME
+);
+
+CREATE TABLE deliveries (
+    id          INTEGER PRIMARY KEY AUTOINCREMENT,
+    event_id    INTEGER,
+    run_id      TEXT,
+    recipient   TEXT,
+    attempt     INTEGER,
+    status      TEXT,
+    response    TEXT,
+    started_at  DATETIME,
+    finished_at DATETIME,
+    duration_ms INTEGER
+);
+CREATE INDEX idx_deliveries_event_id ON deliveries (event_id);
+CREATE INDEX idx_deliveries_run_id ON deliveries (run_id);
+CREATE INDEX idx_deliveries_recipient ON deliveries (recipient);
+
+CREATE TABLE bounces (
+    id         INTEGER PRIMARY KEY AUTOINCREMENT,
+    email      TEXT NOT NULL,
+    type       TEXT NOT NULL,
+    status     TEXT,
+    diagnostic TEXT,
+    created_at DATETIME
+);
+CREATE INDEX idx_bounces_email ON bounces (email);
+
+CREATE TABLE suppressions (
+    email      TEXT PRIMARY KEY,
+    reason     TEXT,
+    created_at DATETIME
+);
+
+CREATE TABLE rates (
+    id         INTEGER PRIMARY KEY AUTOINCREMENT,
+    base       TEXT,
+    target     TEXT,
+    value      REAL,
+    created_at DATETIME
+);
+CREATE INDEX idx_rates_pair ON rates (base, target);
+CREATE INDEX idx_rates_created_at ON rates (created_at);
+
+CREATE TABLE states (
+    id              TEXT PRIMARY KEY,
+    current_step    INTEGER,
+    email           TEXT,
+    locale          TEXT,
+    is_compensating NUMERIC,
+    status          TEXT
+);
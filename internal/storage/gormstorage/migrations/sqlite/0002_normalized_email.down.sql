@@ -0,0 +1,5 @@
+ALTER TABLE states DROP COLUMN normalized_email;
+
+DROP INDEX idx_subscriptions_normalized_email;
+
+ALTER TABLE subscriptions DROP COLUMN normalized_email;
@@ -0,0 +1,10 @@
+ALTER TABLE subscriptions ADD COLUMN normalized_email TEXT;
+
+UPDATE subscriptions SET normalized_email = lower(trim(email));
+
+DELETE FROM subscriptions
+WHERE id NOT IN (SELECT min(id) FROM subscriptions GROUP BY normalized_email);
+
+CREATE UNIQUE INDEX idx_subscriptions_normalized_email ON subscriptions (normalized_email);
+
+ALTER TABLE states ADD COLUMN normalized_email TEXT;
@@ -0,0 +1,12 @@
+ALTER TABLE states DROP COLUMN previous_status;
+ALTER TABLE states DROP COLUMN subscription_id;
+
+DELETE FROM subscriptions WHERE status <> 'active';
+
+DROP TABLE subscription_history;
+
+DROP INDEX idx_subscriptions_status;
+
+ALTER TABLE subscriptions DROP COLUMN status_changed_at;
+ALTER TABLE subscriptions DROP COLUMN status_reason;
+ALTER TABLE subscriptions DROP COLUMN status;
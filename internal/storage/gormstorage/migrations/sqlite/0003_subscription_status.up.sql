@@ -0,0 +1,34 @@
+ALTER TABLE subscriptions ADD COLUMN status TEXT NOT NULL DEFAULT 'active';
+ALTER TABLE subscriptions ADD COLUMN status_reason TEXT;
+ALTER TABLE subscriptions ADD COLUMN status_changed_at DATETIME;
+
+UPDATE subscriptions SET status_changed_at = created_at;
+
+CREATE INDEX idx_subscriptions_status ON subscriptions (status);
+
+CREATE TABLE subscription_history (
+    id              INTEGER PRIMARY KEY AUTOINCREMENT,
+    subscription_id INTEGER NOT NULL REFERENCES subscriptions (id) ON DELETE CASCADE,
+    from_status     TEXT,
+    to_status       TEXT NOT NULL,
+    reason          TEXT,
+    created_at      DATETIME
+);
+CREATE INDEX idx_subscription_history_subscription_id ON subscription_history (subscription_id);
+
+INSERT INTO subscription_history (subscription_id, from_status, to_status, reason, created_at)
+SELECT id, '', 'active', 'sign_up', created_at FROM subscriptions;
+
+INSERT INTO subscription_history (subscription_id, from_status, to_status, reason, created_at)
+SELECT s.id, 'active', 'suppressed', sp.reason, CURRENT_TIMESTAMP
+FROM subscriptions s
+JOIN suppressions sp ON sp.email = lower(s.email);
+
+UPDATE subscriptions
+SET status = 'suppressed',
+    status_reason = (SELECT reason FROM suppressions WHERE email = lower(subscriptions.email)),
+    status_changed_at = CURRENT_TIMESTAMP
+WHERE lower(email) IN (SELECT email FROM suppressions);
+
+ALTER TABLE states ADD COLUMN subscription_id INTEGER;
+ALTER TABLE states ADD COLUMN previous_status TEXT;
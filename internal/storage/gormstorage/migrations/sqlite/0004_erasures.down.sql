@@ -0,0 +1,3 @@
+DROP INDEX idx_events_key;
+
+DROP TABLE erasures;
@@ -0,0 +1,18 @@
+CREATE TABLE erasures (
+    id              INTEGER PRIMARY KEY AUTOINCREMENT,
+    subject_hash    TEXT NOT NULL,
+    pseudonym       TEXT NOT NULL,
+    request_id      TEXT,
+    subscriptions   INTEGER NOT NULL DEFAULT 0,
+    states          INTEGER NOT NULL DEFAULT 0,
+    events          INTEGER NOT NULL DEFAULT 0,
+    consumed_events INTEGER NOT NULL DEFAULT 0,
+    deliveries      INTEGER NOT NULL DEFAULT 0,
+    bounces         INTEGER NOT NULL DEFAULT 0,
+    suppressions    INTEGER NOT NULL DEFAULT 0,
+    dead_letters    INTEGER NOT NULL DEFAULT 0,
+    created_at      DATETIME
+);
+CREATE INDEX idx_erasures_subject_hash ON erasures (subject_hash);
+
+CREATE INDEX idx_events_key ON events (key);
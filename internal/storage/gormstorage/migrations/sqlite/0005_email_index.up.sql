@@ -0,0 +1,7 @@
+-- The index is computed in plain text until the encryption is enabled, after which
+-- `migrate up` recomputes it along with encrypting the addresses
+ALTER TABLE subscriptions ADD COLUMN email_index TEXT;
+
+UPDATE subscriptions SET email_index = lower(email);
+
+CREATE INDEX idx_subscriptions_email_index ON subscriptions (email_index);
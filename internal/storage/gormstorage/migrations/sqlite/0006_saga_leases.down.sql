@@ -0,0 +1,4 @@
+DROP INDEX idx_states_status;
+
+ALTER TABLE states DROP COLUMN lease_expires_at;
+ALTER TABLE states DROP COLUMN lease_owner;
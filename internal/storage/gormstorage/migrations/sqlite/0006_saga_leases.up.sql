@@ -0,0 +1,4 @@
+ALTER TABLE states ADD COLUMN lease_owner TEXT;
+ALTER TABLE states ADD COLUMN lease_expires_at DATETIME;
+
+CREATE INDEX idx_states_status ON states (status);
@@ -0,0 +1,52 @@
+CREATE TABLE sagas (
+    id               TEXT PRIMARY KEY,
+    name             TEXT NOT NULL,
+    key              TEXT,
+    current_step     INTEGER NOT NULL DEFAULT 0,
+    compensating     NUMERIC NOT NULL DEFAULT 0,
+    status           TEXT NOT NULL,
+    data             TEXT,
+    error            TEXT,
+    lease_owner      TEXT,
+    lease_expires_at DATETIME,
+    created_at       DATETIME,
+    updated_at       DATETIME
+);
+CREATE INDEX idx_sagas_status ON sagas (status);
+CREATE INDEX idx_sagas_key ON sagas (key);
+
+CREATE TABLE saga_steps (
+    id         INTEGER PRIMARY KEY AUTOINCREMENT,
+    saga_id    TEXT NOT NULL REFERENCES sagas (id) ON DELETE CASCADE,
+    step       TEXT NOT NULL,
+    step_index INTEGER NOT NULL,
+    phase      TEXT NOT NULL,
+    attempt    INTEGER NOT NULL,
+    input      TEXT,
+    output     TEXT,
+    error      TEXT,
+    duration   INTEGER,
+    started_at DATETIME
+);
+CREATE INDEX idx_saga_steps_saga_id ON saga_steps (saga_id);
+
+INSERT INTO sagas (id, name, key, current_step, compensating, status, data, lease_owner, lease_expires_at,
+                   created_at, updated_at)
+SELECT id,
+       'subscribe',
+       normalized_email,
+       COALESCE(current_step, 0),
+       COALESCE(is_compensating, 0),
+       COALESCE(status, 'in_progress'),
+       json_object('email', email, 'normalized_email', normalized_email, 'locale', locale,
+                   'subscription_id', subscription_id, 'previous_status', previous_status),
+       lease_owner,
+       lease_expires_at,
+       CURRENT_TIMESTAMP,
+       CURRENT_TIMESTAMP
+FROM states;
+
+DROP TABLE states;
+
+ALTER TABLE erasures RENAME COLUMN states TO sagas;
+ALTER TABLE erasures ADD COLUMN saga_steps INTEGER NOT NULL DEFAULT 0;
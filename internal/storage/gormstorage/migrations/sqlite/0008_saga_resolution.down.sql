@@ -0,0 +1,3 @@
+DROP INDEX idx_sagas_created_at;
+
+ALTER TABLE sagas DROP COLUMN resolution;
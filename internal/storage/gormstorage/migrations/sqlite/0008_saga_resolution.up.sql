@@ -0,0 +1,3 @@
+ALTER TABLE sagas ADD COLUMN resolution TEXT;
+
+CREATE INDEX idx_sagas_created_at ON sagas (created_at);
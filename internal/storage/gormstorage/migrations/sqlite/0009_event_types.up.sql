@@ -0,0 +1 @@
+ALTER TABLE events ADD COLUMN type TEXT NOT NULL DEFAULT 'rate.digest';
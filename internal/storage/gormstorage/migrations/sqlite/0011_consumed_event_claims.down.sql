@@ -0,0 +1,4 @@
+DELETE FROM consumed_events WHERE status = 'pending';
+
+ALTER TABLE consumed_events DROP COLUMN claimed_until;
+ALTER TABLE consumed_events DROP COLUMN status;
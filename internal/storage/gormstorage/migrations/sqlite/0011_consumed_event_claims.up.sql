@@ -0,0 +1,2 @@
+ALTER TABLE consumed_events ADD COLUMN status TEXT NOT NULL DEFAULT 'done';
+ALTER TABLE consumed_events ADD COLUMN claimed_until DATETIME;
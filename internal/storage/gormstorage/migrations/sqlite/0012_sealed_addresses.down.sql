@@ -0,0 +1,19 @@
+CREATE TABLE suppressions_old (
+    email      TEXT PRIMARY KEY,
+    reason     TEXT,
+    created_at DATETIME
+);
+
+INSERT INTO suppressions_old (email, reason, created_at)
+SELECT email, reason, created_at FROM suppressions;
+
+DROP TABLE suppressions;
+ALTER TABLE suppressions_old RENAME TO suppressions;
+
+DROP INDEX idx_bounces_email_index;
+ALTER TABLE bounces DROP COLUMN email_index;
+CREATE INDEX idx_bounces_email ON bounces (email);
+
+DROP INDEX idx_deliveries_recipient_index;
+ALTER TABLE deliveries DROP COLUMN recipient_index;
+CREATE INDEX idx_deliveries_recipient ON deliveries (recipient);
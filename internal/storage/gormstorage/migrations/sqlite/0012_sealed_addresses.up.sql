@@ -0,0 +1,30 @@
+-- The indexes are computed in plain text until the encryption is enabled, after
+-- which `migrate up` recomputes them along with encrypting the addresses
+ALTER TABLE deliveries ADD COLUMN recipient_index TEXT;
+
+UPDATE deliveries SET recipient_index = lower(recipient);
+
+DROP INDEX idx_deliveries_recipient;
+CREATE INDEX idx_deliveries_recipient_index ON deliveries (recipient_index);
+
+ALTER TABLE bounces ADD COLUMN email_index TEXT;
+
+UPDATE bounces SET email_index = lower(email);
+
+DROP INDEX idx_bounces_email;
+CREATE INDEX idx_bounces_email_index ON bounces (email_index);
+
+-- The addresses are suppressed once by their index, as the encrypted ones differ.
+-- SQLite cannot change the primary key of a table, so it is rebuilt.
+CREATE TABLE suppressions_new (
+    email_index TEXT PRIMARY KEY,
+    email       TEXT NOT NULL,
+    reason      TEXT,
+    created_at  DATETIME
+);
+
+INSERT INTO suppressions_new (email_index, email, reason, created_at)
+SELECT lower(email), email, reason, created_at FROM suppressions;
+
+DROP TABLE suppressions;
+ALTER TABLE suppressions_new RENAME TO suppressions;
@@ -0,0 +1,129 @@
+package gormstorage_test
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/vladyslavpavlenko/genesis-api-project/internal/models"
+	"github.com/vladyslavpavlenko/genesis-api-project/internal/storage/gormstorage"
+	"github.com/vladyslavpavlenko/genesis-api-project/pkg/logger"
+)
+
+// postgresDSNEnv holds the keyword/value DSN of the PostgreSQL database the tests
+// against PostgreSQL run on. They are skipped if it is not set.
+const postgresDSNEnv = "POSTGRES_TEST_DSN"
+
+// The models as the first version of the application set them up with GORM
+// AutoMigrate.
+type (
+	baselineSubscription struct {
+		ID        uint   `gorm:"primaryKey"`
+		Email     string `gorm:"unique"`
+		CreatedAt time.Time
+	}
+
+	baselineEvent struct {
+		ID        uint `gorm:"primaryKey"`
+		Data      string
+		CreatedAt time.Time
+	}
+
+	baselineOffset struct {
+		Topic     string `gorm:"primaryKey"`
+		Partition int    `gorm:"primaryKey"`
+		Offset    uint
+	}
+
+	baselineConsumedEvent struct {
+		ID         uint          `gorm:"not null;index"`
+		Event      baselineEvent `gorm:"foreignKey:ID"`
+		Data       string
+		ConsumedAt time.Time
+		UpdatedAt  time.Time
+	}
+
+	baselineState struct {
+		ID             string `gorm:"primary_key"`
+		CurrentStep    int
+		Email          string
+		IsCompensating bool
+		Status         string
+	}
+)
+
+func (baselineSubscription) TableName() string  { return "subscriptions" }
+func (baselineEvent) TableName() string         { return "events" }
+func (baselineOffset) TableName() string        { return "offsets" }
+func (baselineConsumedEvent) TableName() string { return "consumed_events" }
+func (baselineState) TableName() string         { return "states" }
+
+// newPostgresConnection returns a connection to a fresh schema of the PostgreSQL
+// database, which is dropped when the test finishes.
+func newPostgresConnection(t *testing.T) *gormstorage.Connection {
+	t.Helper()
+
+	dsn := os.Getenv(postgresDSNEnv)
+	if dsn == "" {
+		t.Skipf("%s is not set", postgresDSNEnv)
+	}
+
+	var admin gormstorage.Connection
+	require.NoError(t, admin.Setup(gormstorage.DriverPostgres, dsn, logger.New(false)))
+	t.Cleanup(func() { _ = admin.Close() })
+
+	schema := fmt.Sprintf("test_%d", time.Now().UnixNano())
+	require.NoError(t, admin.DB().Exec("CREATE SCHEMA "+schema).Error)
+	t.Cleanup(func() { admin.DB().Exec("DROP SCHEMA " + schema + " CASCADE") })
+
+	var conn gormstorage.Connection
+	require.NoError(t, conn.Setup(gormstorage.DriverPostgres, dsn+" search_path="+schema, logger.New(false)))
+	t.Cleanup(func() { _ = conn.Close() })
+	return &conn
+}
+
+func TestMigrator_PostgresAdoptsAutoMigrate(t *testing.T) {
+	conn := newPostgresConnection(t)
+	db := conn.DB()
+	ctx := context.Background()
+
+	require.NoError(t, db.AutoMigrate(&baselineSubscription{}, &baselineEvent{}, &baselineOffset{},
+		&baselineConsumedEvent{}, &baselineState{}))
+
+	now := time.Now()
+	require.NoError(t, db.Create(&baselineSubscription{Email: "alice@example.com", CreatedAt: now}).Error)
+	event := baselineEvent{Data: `{"email":"alice@example.com"}`, CreatedAt: now}
+	require.NoError(t, db.Create(&event).Error)
+	require.NoError(t, db.Omit("Event").Create(&baselineConsumedEvent{ID: event.ID, ConsumedAt: now}).Error)
+	require.NoError(t, db.Create(&baselineState{ID: "saga-1", Email: "bob@example.com", Status: "in_progress"}).Error)
+
+	m, err := conn.Migrator()
+	require.NoError(t, err)
+
+	applied, err := m.Up(ctx)
+	require.NoError(t, err)
+	statuses, err := m.Status(ctx)
+	require.NoError(t, err)
+	assert.Len(t, applied, len(statuses))
+
+	// The existing records are carried over
+	var sub models.Subscription
+	require.NoError(t, db.First(&sub).Error)
+	assert.Equal(t, "en", sub.Locale)
+	assert.Equal(t, models.SubscriptionStatusActive, sub.Status)
+	assert.Equal(t, "alice@example.com", sub.NormalizedEmail)
+
+	var count int64
+	require.NoError(t, db.Table("sagas").Where("id = ?", "saga-1").Count(&count).Error)
+	assert.Equal(t, int64(1), count)
+
+	// A consumed event is recorded once
+	result := db.Exec("INSERT INTO consumed_events (id, consumed_at) VALUES (?, ?) ON CONFLICT DO NOTHING",
+		event.ID, now)
+	require.NoError(t, result.Error)
+	assert.Zero(t, result.RowsAffected)
+}
@@ -0,0 +1,99 @@
+package gormstorage_test
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/vladyslavpavlenko/genesis-api-project/internal/storage/gormstorage/gormstoragetest"
+	"github.com/vladyslavpavlenko/genesis-api-project/pkg/migrate"
+)
+
+func TestMigrator_SQLite(t *testing.T) {
+	conn := gormstoragetest.NewConnection(t)
+	ctx := context.Background()
+
+	m, err := conn.Migrator()
+	require.NoError(t, err)
+
+	pending, err := m.Pending(ctx)
+	require.NoError(t, err)
+	assert.Empty(t, pending)
+
+	statuses, err := m.Status(ctx)
+	require.NoError(t, err)
+	require.NotEmpty(t, statuses)
+	for _, s := range statuses {
+		assert.True(t, s.Applied, s.Migration.String())
+		assert.False(t, s.AppliedAt.IsZero())
+	}
+
+	// Revert everything and apply it again
+	reverted, err := m.Down(ctx, len(statuses))
+	require.NoError(t, err)
+	assert.Len(t, reverted, len(statuses))
+	assert.Equal(t, statuses[len(statuses)-1].Version, reverted[0].Version)
+	assert.False(t, conn.DB().Migrator().HasTable("subscriptions"))
+
+	applied, err := m.Up(ctx)
+	require.NoError(t, err)
+	assert.Len(t, applied, len(statuses))
+	assert.True(t, conn.DB().Migrator().HasTable("subscriptions"))
+
+	applied, err = m.Up(ctx)
+	require.NoError(t, err)
+	assert.Empty(t, applied)
+}
+
+// recordingLocker records when the lock is taken and released.
+type recordingLocker struct {
+	events *[]string
+}
+
+func (l recordingLocker) Lock(context.Context, *sql.Conn) error {
+	*l.events = append(*l.events, "lock")
+	return nil
+}
+
+func (l recordingLocker) Unlock(context.Context, *sql.Conn) error {
+	*l.events = append(*l.events, "unlock")
+	return nil
+}
+
+func TestMigrator_UpAndRun(t *testing.T) {
+	conn := gormstoragetest.NewConnection(t)
+	ctx := context.Background()
+
+	sqlDB, err := conn.DB().DB()
+	require.NoError(t, err)
+
+	// The version follows the embedded migrations, which share the table
+	fsys := fstest.MapFS{
+		"9001_notes.up.sql":   {Data: []byte("CREATE TABLE notes (id INTEGER);")},
+		"9001_notes.down.sql": {Data: []byte("DROP TABLE notes;")},
+	}
+
+	var events []string
+	m, err := migrate.New(sqlDB, fsys, recordingLocker{events: &events})
+	require.NoError(t, err)
+
+	// fn runs after the migrations, while the lock is still held
+	applied, err := m.UpAndRun(ctx, func(context.Context) error {
+		events = append(events, "run")
+		assert.True(t, conn.DB().Migrator().HasTable("notes"))
+		return nil
+	})
+	require.NoError(t, err)
+	assert.Len(t, applied, 1)
+	assert.Equal(t, []string{"lock", "run", "unlock"}, events)
+
+	// fn runs without pending migrations too, and its error is returned
+	fnErr := errors.New("data migration failed")
+	applied, err = m.UpAndRun(ctx, func(context.Context) error { return fnErr })
+	assert.ErrorIs(t, err, fnErr)
+	assert.Empty(t, applied)
+}
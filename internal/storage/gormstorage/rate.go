@@ -0,0 +1,50 @@
+package gormstorage
+
+import (
+	"context"
+	"time"
+
+	"github.com/vladyslavpavlenko/genesis-api-project/internal/models"
+)
+
+// AddRate creates a new models.Rate record.
+func (c *Connection) AddRate(rate *models.Rate) error {
+	ctx, cancel := context.WithTimeout(context.Background(), RequestTimeout)
+	defer cancel()
+
+	return c.db.WithContext(ctx).Create(rate).Error
+}
+
+// GetLastRateBefore returns the latest models.Rate record of the currency pair created
+// before the given time.
+func (c *Connection) GetLastRateBefore(base, target string, before time.Time) (models.Rate, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), RequestTimeout)
+	defer cancel()
+
+	var rate models.Rate
+	err := c.db.WithContext(ctx).
+		Where("base = ? AND target = ? AND created_at < ?", base, target, before).
+		Order("created_at DESC").
+		First(&rate).Error
+	if err != nil {
+		return models.Rate{}, err
+	}
+	return rate, nil
+}
+
+// GetRatesSince returns the models.Rate records of the currency pair created since the
+// given time, oldest first.
+func (c *Connection) GetRatesSince(base, target string, since time.Time) ([]models.Rate, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), RequestTimeout)
+	defer cancel()
+
+	var rates []models.Rate
+	err := c.db.WithContext(ctx).
+		Where("base = ? AND target = ? AND created_at >= ?", base, target, since).
+		Order("created_at").
+		Find(&rates).Error
+	if err != nil {
+		return nil, err
+	}
+	return rates, nil
+}
@@ -0,0 +1,323 @@
+package gormstorage
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/vladyslavpavlenko/genesis-api-project/internal/email/consumer"
+	"github.com/vladyslavpavlenko/genesis-api-project/internal/models"
+	"github.com/vladyslavpavlenko/genesis-api-project/internal/outbox"
+	"github.com/vladyslavpavlenko/genesis-api-project/pkg/saga"
+	"gorm.io/gorm"
+)
+
+const (
+	// resealTimeout bounds Reseal, which reads every stored event.
+	resealTimeout   = 10 * time.Minute
+	resealBatchSize = 500
+)
+
+// Reseal brings the addresses stored in the sagas and the logs of their steps, the
+// outbox events, the consumed events, the dead letters, the deliveries, the bounces,
+// and the suppressions in line with the keyring, the same way NormalizeSubscriptions
+// does with the subscriptions: the values are encrypted with the primary key, and the
+// blind indexes, that is the keys of the sagas, the events, and the dead letters, the
+// idempotency keys, and the indexes of the addresses, are recomputed. It returns the
+// number of updated records.
+func (c *Connection) Reseal(normalize func(email string) (string, error)) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), resealTimeout)
+	defer cancel()
+
+	db := c.db.WithContext(ctx)
+	updated := 0
+
+	var sagas []saga.Instance
+	err := db.FindInBatches(&sagas, resealBatchSize, func(tx *gorm.DB, _ int) error {
+		for _, s := range sagas {
+			var addr string
+			data, changed, err := c.resealSagaData(s.Data, &addr)
+			if err != nil {
+				return fmt.Errorf("failed to reseal saga %s: %w", s.ID, err)
+			}
+
+			key := s.Key
+			if addr != "" && s.Key != "" {
+				normalized, err := normalize(addr)
+				if err != nil {
+					normalized = strings.ToLower(strings.TrimSpace(addr))
+				}
+				key = c.keys.BlindIndex(normalized)
+			}
+
+			if !changed && key == s.Key {
+				continue
+			}
+			err = tx.Model(&saga.Instance{}).Where("id = ?", s.ID).
+				Updates(map[string]any{"key": key, "data": data}).Error
+			if err != nil {
+				return err
+			}
+			updated++
+		}
+		return nil
+	}).Error
+	if err != nil {
+		return updated, err
+	}
+
+	var logs []saga.StepLog
+	err = db.FindInBatches(&logs, resealBatchSize, func(tx *gorm.DB, _ int) error {
+		for _, l := range logs {
+			input, inputChanged, err := c.resealSagaData(l.Input, nil)
+			if err != nil {
+				return fmt.Errorf("failed to reseal saga step %d: %w", l.ID, err)
+			}
+			output, outputChanged, err := c.resealSagaData(l.Output, nil)
+			if err != nil {
+				return fmt.Errorf("failed to reseal saga step %d: %w", l.ID, err)
+			}
+
+			if !inputChanged && !outputChanged {
+				continue
+			}
+			err = tx.Model(&saga.StepLog{}).Where("id = ?", l.ID).
+				Updates(map[string]any{"input": input, "output": output}).Error
+			if err != nil {
+				return err
+			}
+			updated++
+		}
+		return nil
+	}).Error
+	if err != nil {
+		return updated, err
+	}
+
+	var events []outbox.Event
+	err = db.FindInBatches(&events, resealBatchSize, func(tx *gorm.DB, _ int) error {
+		for _, e := range events {
+			sealed, data, changed, err := c.resealData(e.Data)
+			if err != nil {
+				return fmt.Errorf("failed to reseal event %d: %w", e.ID, err)
+			}
+
+			key := e.Key
+			if data.Email != "" {
+				key = c.keys.BlindIndex(data.Key())
+			}
+
+			if !changed && key == e.Key {
+				continue
+			}
+			err = tx.Model(&outbox.Event{}).Where("id = ?", e.ID).
+				Updates(map[string]any{"key": key, "data": sealed}).Error
+			if err != nil {
+				return err
+			}
+			updated++
+		}
+		return nil
+	}).Error
+	if err != nil {
+		return updated, err
+	}
+
+	var consumed []consumer.ConsumedEvent
+	err = db.Omit("Event").FindInBatches(&consumed, resealBatchSize, func(tx *gorm.DB, _ int) error {
+		for _, ce := range consumed {
+			sealed, data, changed, err := c.resealData(ce.Data)
+			if err != nil {
+				return fmt.Errorf("failed to reseal consumed event %d: %w", ce.ID, err)
+			}
+
+			updates := map[string]any{"data": sealed}
+			if ce.IdempotencyKey != nil && data.IdempotencyKey() != "" {
+				if key := c.keys.BlindIndex(data.IdempotencyKey()); key != *ce.IdempotencyKey {
+					updates["idempotency_key"] = key
+					changed = true
+				}
+			}
+
+			if !changed {
+				continue
+			}
+			err = tx.Model(&consumer.ConsumedEvent{}).Where("id = ?", ce.ID).Updates(updates).Error
+			if err != nil {
+				return err
+			}
+			updated++
+		}
+		return nil
+	}).Error
+	if err != nil {
+		return updated, err
+	}
+
+	var deadLetters []models.DeadLetter
+	err = db.FindInBatches(&deadLetters, resealBatchSize, func(tx *gorm.DB, _ int) error {
+		for _, dl := range deadLetters {
+			sealed, data, changed, err := c.resealData(dl.Value)
+			if err != nil {
+				return fmt.Errorf("failed to reseal dead letter %d: %w", dl.ID, err)
+			}
+
+			key := dl.Key
+			if data.Email != "" {
+				key = c.keys.BlindIndex(data.Key())
+			}
+
+			if !changed && key == dl.Key {
+				continue
+			}
+			err = tx.Model(&models.DeadLetter{}).Where("id = ?", dl.ID).
+				Updates(map[string]any{"key": key, "value": sealed}).Error
+			if err != nil {
+				return err
+			}
+			updated++
+		}
+		return nil
+	}).Error
+	if err != nil {
+		return updated, err
+	}
+
+	n, err := c.resealAddresses(db)
+	return updated + n, err
+}
+
+// resealAddresses reseals the addresses of the deliveries, the bounces, and the
+// suppressions, and recomputes their indexes. It returns the number of updated
+// records.
+func (c *Connection) resealAddresses(db *gorm.DB) (int, error) {
+	updated := 0
+
+	var deliveries []models.Delivery
+	err := db.FindInBatches(&deliveries, resealBatchSize, func(tx *gorm.DB, _ int) error {
+		for _, d := range deliveries {
+			sealed, index, changed, err := c.resealAddress(d.Recipient, d.RecipientIndex)
+			if err != nil {
+				return fmt.Errorf("failed to reseal delivery %d: %w", d.ID, err)
+			}
+			if !changed {
+				continue
+			}
+
+			err = tx.Model(&models.Delivery{}).Where("id = ?", d.ID).
+				Updates(map[string]any{"recipient": sealed, "recipient_index": index}).Error
+			if err != nil {
+				return err
+			}
+			updated++
+		}
+		return nil
+	}).Error
+	if err != nil {
+		return updated, err
+	}
+
+	var bounces []models.Bounce
+	err = db.FindInBatches(&bounces, resealBatchSize, func(tx *gorm.DB, _ int) error {
+		for _, b := range bounces {
+			sealed, index, changed, err := c.resealAddress(b.Email, b.EmailIndex)
+			if err != nil {
+				return fmt.Errorf("failed to reseal bounce %d: %w", b.ID, err)
+			}
+			if !changed {
+				continue
+			}
+
+			err = tx.Model(&models.Bounce{}).Where("id = ?", b.ID).
+				Updates(map[string]any{"email": sealed, "email_index": index}).Error
+			if err != nil {
+				return err
+			}
+			updated++
+		}
+		return nil
+	}).Error
+	if err != nil {
+		return updated, err
+	}
+
+	// The suppressions are keyed by their indexes, which are changed along the way,
+	// so they are not read in batches
+	var suppressions []models.Suppression
+	if err = db.Find(&suppressions).Error; err != nil {
+		return updated, err
+	}
+	for _, s := range suppressions {
+		sealed, index, changed, err := c.resealAddress(s.Email, s.EmailIndex)
+		if err != nil {
+			return updated, fmt.Errorf("failed to reseal suppression: %w", err)
+		}
+		if !changed {
+			continue
+		}
+
+		err = db.Model(&models.Suppression{}).Where("email_index = ?", s.EmailIndex).
+			Updates(map[string]any{"email": sealed, "email_index": index}).Error
+		if err != nil {
+			return updated, err
+		}
+		updated++
+	}
+
+	return updated, nil
+}
+
+// resealAddress rewraps the address and recomputes the blind index of the lower-cased
+// address. It reports whether either has changed.
+func (c *Connection) resealAddress(value, index string) (string, string, bool, error) {
+	addr, err := c.keys.Open(value)
+	if err != nil {
+		return "", "", false, err
+	}
+
+	sealed, changed, err := c.keys.Rewrap(value)
+	if err != nil {
+		return "", "", false, err
+	}
+
+	newIndex := c.keys.BlindIndex(strings.ToLower(addr))
+	return sealed, newIndex, changed || newIndex != index, nil
+}
+
+// resealData rewraps the serialized outbox.Data and returns it along with the
+// decrypted data, which is empty if it cannot be deserialized.
+func (c *Connection) resealData(value string) (string, outbox.Data, bool, error) {
+	plaintext, err := c.keys.Open(value)
+	if err != nil {
+		return "", outbox.Data{}, false, err
+	}
+
+	sealed, changed, err := c.keys.Rewrap(value)
+	if err != nil {
+		return "", outbox.Data{}, false, err
+	}
+
+	data, _ := outbox.DeserializeData([]byte(plaintext))
+	return sealed, data, changed, nil
+}
+
+// resealSagaData rewraps the address in the saga data and reports whether it has
+// changed. The decrypted address is stored to addr, unless it is nil.
+func (c *Connection) resealSagaData(value string, addr *string) (string, bool, error) {
+	changed := false
+	data, err := jsonEmail(value, func(email string) (string, error) {
+		if addr != nil {
+			plaintext, err := c.keys.Open(email)
+			if err != nil {
+				return "", err
+			}
+			*addr = plaintext
+		}
+
+		sealed, ok, err := c.keys.Rewrap(email)
+		changed = ok
+		return sealed, err
+	})
+	return data, changed, err
+}
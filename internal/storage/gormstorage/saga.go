@@ -0,0 +1,219 @@
+package gormstorage
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/vladyslavpavlenko/genesis-api-project/internal/models"
+	"github.com/vladyslavpavlenko/genesis-api-project/pkg/saga"
+	"gorm.io/gorm"
+)
+
+// SaveSaga creates the saga.Instance or updates it, provided it is still leased to
+// its owner. It returns saga.ErrLeaseLost if the saga has been leased to another
+// owner since.
+func (c *Connection) SaveSaga(ctx context.Context, s *saga.Instance) error {
+	ctx, cancel := context.WithTimeout(ctx, RequestTimeout)
+	defer cancel()
+
+	db := c.db.WithContext(ctx)
+	result := db.Model(&saga.Instance{}).Where("id = ? AND lease_owner = ?", s.ID, s.LeaseOwner).
+		Updates(map[string]any{
+			"key":              s.Key,
+			"current_step":     s.CurrentStep,
+			"compensating":     s.Compensating,
+			"status":           s.Status,
+			"data":             s.Data,
+			"error":            s.Error,
+			"lease_expires_at": s.LeaseExpiresAt,
+			"updated_at":       s.UpdatedAt,
+		})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected > 0 {
+		return nil
+	}
+
+	err := db.Create(s).Error
+	if errors.Is(err, gorm.ErrDuplicatedKey) {
+		return saga.ErrLeaseLost
+	}
+	return err
+}
+
+// AddStepLog adds a new saga.StepLog record.
+func (c *Connection) AddStepLog(ctx context.Context, l *saga.StepLog) error {
+	ctx, cancel := context.WithTimeout(ctx, RequestTimeout)
+	defer cancel()
+
+	return c.db.WithContext(ctx).Create(l).Error
+}
+
+// ExpiredSagas returns the IDs of at most limit sagas in progress whose leases have
+// expired by now, oldest first.
+func (c *Connection) ExpiredSagas(ctx context.Context, now time.Time, limit int) ([]string, error) {
+	ctx, cancel := context.WithTimeout(ctx, RequestTimeout)
+	defer cancel()
+
+	var ids []string
+	err := c.db.WithContext(ctx).Model(&saga.Instance{}).
+		Where("status = ? AND (lease_expires_at IS NULL OR lease_expires_at < ?)", saga.StatusInProgress, now).
+		Order("created_at").
+		Limit(limit).
+		Pluck("id", &ids).Error
+	if err != nil {
+		return nil, err
+	}
+	return ids, nil
+}
+
+// LeaseSaga leases the saga in progress to the owner until expiresAt, provided its
+// lease has expired by now, and returns it. It reports false if the saga is no
+// longer in progress or is leased to another owner.
+func (c *Connection) LeaseSaga(ctx context.Context, id, owner string, now, expiresAt time.Time,
+) (*saga.Instance, bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, RequestTimeout)
+	defer cancel()
+
+	db := c.db.WithContext(ctx)
+	result := db.Model(&saga.Instance{}).
+		Where("id = ? AND status = ? AND (lease_expires_at IS NULL OR lease_expires_at < ?)",
+			id, saga.StatusInProgress, now).
+		Updates(map[string]any{"lease_owner": owner, "lease_expires_at": expiresAt})
+	if result.Error != nil || result.RowsAffected == 0 {
+		return nil, false, result.Error
+	}
+
+	var s saga.Instance
+	if err := db.First(&s, "id = ?", id).Error; err != nil {
+		return nil, false, err
+	}
+	return &s, true, nil
+}
+
+// GetSaga returns the saga.Instance. It returns saga.ErrSagaNotFound if there is none.
+func (c *Connection) GetSaga(ctx context.Context, id string) (*saga.Instance, error) {
+	ctx, cancel := context.WithTimeout(ctx, RequestTimeout)
+	defer cancel()
+
+	var s saga.Instance
+	err := c.db.WithContext(ctx).First(&s, "id = ?", id).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, saga.ErrSagaNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+// ResolveSaga marks the failed saga, or the saga in progress whose lease has expired
+// by now, as resolved with the resolution. It reports false if the saga cannot be
+// resolved.
+func (c *Connection) ResolveSaga(ctx context.Context, id, resolution string, now time.Time) (bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, RequestTimeout)
+	defer cancel()
+
+	result := c.db.WithContext(ctx).Model(&saga.Instance{}).
+		Where("id = ? AND (status = ? OR (status = ? AND (lease_expires_at IS NULL OR lease_expires_at < ?)))",
+			id, saga.StatusFailed, saga.StatusInProgress, now).
+		Updates(map[string]any{
+			"status":     saga.StatusResolved,
+			"resolution": resolution,
+			"updated_at": now,
+		})
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected > 0, nil
+}
+
+// GetSagas returns the sagas matching the filter, newest first, without the logs of
+// their steps.
+func (c *Connection) GetSagas(filter models.SagaFilter, limit, offset int) ([]models.SubjectSaga, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), RequestTimeout)
+	defer cancel()
+
+	query := c.db.WithContext(ctx)
+	if filter.Name != "" {
+		query = query.Where("name = ?", filter.Name)
+	}
+	if filter.Status != "" {
+		query = query.Where("status = ?", filter.Status)
+	}
+	if filter.Normalized != "" {
+		query = query.Where("key = ?", c.keys.BlindIndex(filter.Normalized))
+	}
+	if !filter.CreatedAfter.IsZero() {
+		query = query.Where("created_at > ?", filter.CreatedAfter)
+	}
+	if !filter.CreatedBefore.IsZero() {
+		query = query.Where("created_at < ?", filter.CreatedBefore)
+	}
+
+	var sagas []saga.Instance
+	err := query.Order("created_at DESC").Limit(limit).Offset(offset).Find(&sagas).Error
+	if err != nil {
+		return nil, err
+	}
+	return c.viewSagas(sagas)
+}
+
+// GetSagaHistory returns the saga along with the logs of its steps. It returns
+// saga.ErrSagaNotFound if there is none.
+func (c *Connection) GetSagaHistory(id string) (models.SubjectSaga, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), RequestTimeout)
+	defer cancel()
+
+	db := c.db.WithContext(ctx)
+
+	var s saga.Instance
+	err := db.First(&s, "id = ?", id).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return models.SubjectSaga{}, saga.ErrSagaNotFound
+	}
+	if err != nil {
+		return models.SubjectSaga{}, err
+	}
+
+	exported, err := c.exportSagas(db, []saga.Instance{s})
+	if err != nil {
+		return models.SubjectSaga{}, err
+	}
+	return exported[0], nil
+}
+
+// jsonEmail replaces the email field of the JSON object, e.g. the saga data with the
+// address encrypted, with the result of fn. The data without the field is returned as
+// is.
+func jsonEmail(value string, fn func(email string) (string, error)) (string, error) {
+	var data map[string]json.RawMessage
+	if err := json.Unmarshal([]byte(value), &data); err != nil {
+		return value, nil
+	}
+
+	var email string
+	if raw, ok := data["email"]; !ok || json.Unmarshal(raw, &email) != nil {
+		return value, nil
+	}
+
+	replaced, err := fn(email)
+	if err != nil {
+		return "", err
+	}
+	if replaced == email {
+		return value, nil
+	}
+
+	if data["email"], err = json.Marshal(replaced); err != nil {
+		return "", err
+	}
+	b, err := json.Marshal(data)
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
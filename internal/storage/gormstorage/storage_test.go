@@ -0,0 +1,633 @@
+package gormstorage_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/vladyslavpavlenko/genesis-api-project/internal/email/consumer"
+	"github.com/vladyslavpavlenko/genesis-api-project/internal/models"
+	"github.com/vladyslavpavlenko/genesis-api-project/internal/outbox"
+	"github.com/vladyslavpavlenko/genesis-api-project/internal/outbox/producer"
+	"github.com/vladyslavpavlenko/genesis-api-project/internal/storage/gormstorage/gormstoragetest"
+	"github.com/vladyslavpavlenko/genesis-api-project/pkg/envelope"
+	"github.com/vladyslavpavlenko/genesis-api-project/pkg/saga"
+	"gorm.io/gorm"
+)
+
+func TestConnection_Outbox(t *testing.T) {
+	conn := gormstoragetest.NewConnection(t)
+
+	for _, key := range []string{"a", "b", "c"} {
+		require.NoError(t, conn.AddEvent(&outbox.Event{Key: key, Data: "{}", CreatedAt: time.Now()}))
+	}
+
+	_, err := conn.GetLastOffset("emails-topic", 1)
+	assert.ErrorIs(t, err, gorm.ErrRecordNotFound)
+
+	events, err := conn.FetchUnpublishedEvents(0, outbox.StreamEmails)
+	require.NoError(t, err)
+	require.Len(t, events, 3)
+
+	require.NoError(t, conn.UpdateOffset(&producer.Offset{Topic: "emails-topic", Partition: 1, Offset: events[1].ID}))
+	offset, err := conn.GetLastOffset("emails-topic", 1)
+	require.NoError(t, err)
+	assert.Equal(t, events[1].ID, offset.Offset)
+
+	// The events of the other streams are published separately
+	for _, value := range []float64{41.5, 41.7} {
+		event, err := outbox.NewRateEvent(outbox.NewRateEventData("USD", "UAH", value, 0, "coinbase"), nil)
+		require.NoError(t, err)
+		require.NoError(t, conn.AddEvent(event))
+	}
+
+	events, err = conn.FetchUnpublishedEvents(offset.Offset, outbox.StreamEmails)
+	require.NoError(t, err)
+	require.Len(t, events, 1)
+	assert.Equal(t, "c", events[0].Key)
+
+	events, err = conn.FetchUnpublishedEvents(0, outbox.StreamRates)
+	require.NoError(t, err)
+	require.Len(t, events, 2)
+
+	last, err := conn.GetLastEvent(outbox.StreamRates, "USD/UAH")
+	require.NoError(t, err)
+	assert.Equal(t, events[1].ID, last.ID)
+	_, err = conn.GetLastEvent(outbox.StreamRates, "EUR/UAH")
+	assert.ErrorIs(t, err, gorm.ErrRecordNotFound)
+}
+
+func TestConnection_ConsumeOnce(t *testing.T) {
+	conn := gormstoragetest.NewConnection(t)
+
+	event := outbox.Event{Key: "a", Data: "{}", CreatedAt: time.Now()}
+	require.NoError(t, conn.AddEvent(&event))
+
+	consume := func(process func() error) error {
+		return conn.ConsumeOnce(&consumer.ConsumedEvent{ID: event.ID, ConsumedAt: time.Now()}, process)
+	}
+
+	// A failed attempt is rolled back
+	errSend := errors.New("send failed")
+	assert.ErrorIs(t, consume(func() error { return errSend }), errSend)
+
+	processed := 0
+	require.NoError(t, consume(func() error {
+		processed++
+
+		// The event is claimed while it is processed, outside a transaction
+		var claimed consumer.ConsumedEvent
+		require.NoError(t, conn.DB().First(&claimed, event.ID).Error)
+		assert.Equal(t, consumer.ConsumedEventStatusPending, claimed.Status)
+		require.NotNil(t, claimed.ClaimedUntil)
+		assert.ErrorIs(t, consume(func() error { processed++; return nil }), consumer.ErrEventInProgress)
+		return nil
+	}))
+	assert.ErrorIs(t, consume(func() error { processed++; return nil }), consumer.ErrEventAlreadyConsumed)
+	assert.Equal(t, 1, processed)
+
+	var consumed consumer.ConsumedEvent
+	require.NoError(t, conn.DB().First(&consumed, event.ID).Error)
+	assert.Equal(t, consumer.ConsumedEventStatusDone, consumed.Status)
+	assert.Nil(t, consumed.ClaimedUntil)
+}
+
+func TestConnection_ConsumeOnce_ExpiredClaim(t *testing.T) {
+	conn := gormstoragetest.NewConnection(t)
+
+	events := make([]outbox.Event, 2)
+	for i := range events {
+		events[i] = outbox.Event{Key: "a", Data: "{}", CreatedAt: time.Now()}
+		require.NoError(t, conn.AddEvent(&events[i]))
+	}
+
+	// The consumer has crashed while sending the first event
+	key := "run-1"
+	expired := time.Now().Add(-time.Second)
+	err := conn.DB().Omit("Event").Create(&consumer.ConsumedEvent{ID: events[0].ID, IdempotencyKey: &key,
+		Status: consumer.ConsumedEventStatusPending, ClaimedUntil: &expired}).Error
+	require.NoError(t, err)
+
+	// The event with the same idempotency key takes the expired claim over
+	processed := 0
+	err = conn.ConsumeOnce(&consumer.ConsumedEvent{ID: events[1].ID, IdempotencyKey: &key},
+		func() error { processed++; return nil })
+	require.NoError(t, err)
+
+	err = conn.ConsumeOnce(&consumer.ConsumedEvent{ID: events[0].ID, IdempotencyKey: &key},
+		func() error { processed++; return nil })
+	assert.ErrorIs(t, err, consumer.ErrEventAlreadyConsumed)
+	assert.Equal(t, 1, processed)
+}
+
+func TestConnection_DuplicatedKey(t *testing.T) {
+	conn := gormstoragetest.NewConnection(t)
+
+	err := conn.DB().Create(&models.Subscription{Email: "a@example.com", NormalizedEmail: "a@example.com"}).Error
+	require.NoError(t, err)
+
+	err = conn.DB().Create(&models.Subscription{Email: "A@example.com", NormalizedEmail: "a@example.com"}).Error
+	assert.ErrorIs(t, err, gorm.ErrDuplicatedKey)
+}
+
+func TestConnection_NormalizeSubscriptions(t *testing.T) {
+	conn := gormstoragetest.NewConnection(t)
+
+	for _, email := range []string{"alice+news@example.com", "bob@example.com", "alice@example.com"} {
+		err := conn.DB().Create(&models.Subscription{Email: email, NormalizedEmail: email}).Error
+		require.NoError(t, err)
+	}
+
+	// Strip the plus tags
+	merged, err := conn.NormalizeSubscriptions(func(email string) (string, error) {
+		local, domain, _ := strings.Cut(email, "@")
+		local, _, _ = strings.Cut(local, "+")
+		return local + "@" + domain, nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 1, merged)
+
+	var subscriptions []models.Subscription
+	require.NoError(t, conn.DB().Order("id").Find(&subscriptions).Error)
+	require.Len(t, subscriptions, 3)
+	assert.Equal(t, "alice+news@example.com", subscriptions[0].Email)
+	assert.Equal(t, "alice@example.com", subscriptions[0].NormalizedEmail)
+	assert.Equal(t, "bob@example.com", subscriptions[1].NormalizedEmail)
+
+	// The duplicate is kept unsubscribed, without a normalized email
+	assert.Empty(t, subscriptions[2].NormalizedEmail)
+	assert.Equal(t, models.SubscriptionStatusUnsubscribed, subscriptions[2].Status)
+	assert.Equal(t, models.SubscriptionReasonMerged, subscriptions[2].StatusReason)
+}
+
+func TestConnection_NormalizeSubscriptions_KeepsActive(t *testing.T) {
+	conn := gormstoragetest.NewConnection(t)
+
+	subs := []models.Subscription{
+		{Email: "alice+old@example.com", Status: models.SubscriptionStatusUnsubscribed},
+		{Email: "alice+new@example.com", Status: models.SubscriptionStatusPending},
+		{Email: "alice@example.com", Status: models.SubscriptionStatusActive},
+	}
+	for i := range subs {
+		subs[i].NormalizedEmail = subs[i].Email
+		require.NoError(t, conn.DB().Create(&subs[i]).Error)
+	}
+
+	merged, err := conn.NormalizeSubscriptions(func(email string) (string, error) {
+		local, domain, _ := strings.Cut(email, "@")
+		local, _, _ = strings.Cut(local, "+")
+		return local + "@" + domain, nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 2, merged)
+
+	// The active subscription is kept, although it is the newest
+	var subscriptions []models.Subscription
+	require.NoError(t, conn.DB().Where("normalized_email = ?", "alice@example.com").Find(&subscriptions).Error)
+	require.Len(t, subscriptions, 1)
+	assert.Equal(t, subs[2].ID, subscriptions[0].ID)
+	assert.Equal(t, models.SubscriptionStatusActive, subscriptions[0].Status)
+
+	// The merges are recorded
+	for _, sub := range subs[:2] {
+		history, err := conn.GetSubscriptionHistory(sub.ID)
+		require.NoError(t, err)
+		require.Len(t, history, 1)
+		assert.Equal(t, sub.Status, history[0].FromStatus)
+		assert.Equal(t, models.SubscriptionReasonMerged, history[0].Reason)
+	}
+
+	// Only the pending subscription was not cancelled already
+	var events []outbox.Event
+	require.NoError(t, conn.DB().Where("type = ?", outbox.TypeSubscriptionCancelled).Find(&events).Error)
+	assert.Len(t, events, 1)
+
+	// The merged subscriptions are left alone afterwards
+	merged, err = conn.NormalizeSubscriptions(func(email string) (string, error) { return email, nil })
+	require.NoError(t, err)
+	assert.Zero(t, merged)
+}
+
+func TestConnection_Suppressions(t *testing.T) {
+	conn := gormstoragetest.NewConnection(t)
+
+	require.NoError(t, conn.AddSuppression(&models.Suppression{Email: "a@example.com", CreatedAt: time.Now()}))
+	// Suppressing an address twice is a no-op
+	require.NoError(t, conn.AddSuppression(&models.Suppression{Email: "a@example.com", CreatedAt: time.Now()}))
+
+	suppressed, err := conn.GetSuppressedAmong([]string{"A@example.com", "b@example.com"})
+	require.NoError(t, err)
+	assert.True(t, suppressed["a@example.com"])
+	assert.False(t, suppressed["b@example.com"])
+
+	deleted, err := conn.DeleteSuppression("a@example.com")
+	require.NoError(t, err)
+	assert.True(t, deleted)
+}
+
+func TestConnection_Rates(t *testing.T) {
+	conn := gormstoragetest.NewConnection(t)
+
+	now := time.Now().UTC()
+	for i, value := range []float64{40, 41, 42} {
+		rate := &models.Rate{Base: "USD", Target: "UAH", Value: value, CreatedAt: now.AddDate(0, 0, i-2)}
+		require.NoError(t, conn.AddRate(rate))
+	}
+
+	last, err := conn.GetLastRateBefore("USD", "UAH", now.Add(-time.Hour))
+	require.NoError(t, err)
+	assert.Equal(t, 41.0, last.Value)
+
+	rates, err := conn.GetRatesSince("USD", "UAH", now.AddDate(0, 0, -1).Add(-time.Hour))
+	require.NoError(t, err)
+	require.Len(t, rates, 2)
+	assert.Equal(t, 41.0, rates[0].Value)
+	assert.Equal(t, 42.0, rates[1].Value)
+}
+
+func TestConnection_ExportAndEraseSubject(t *testing.T) {
+	conn := gormstoragetest.NewConnection(t)
+	db := conn.DB()
+
+	sub := models.Subscription{Email: "Alice@example.com", NormalizedEmail: "alice@example.com",
+		EmailIndex: "alice@example.com", Status: models.SubscriptionStatusActive}
+	require.NoError(t, db.Create(&sub).Error)
+	require.NoError(t, db.Create(&models.SubscriptionHistory{SubscriptionID: sub.ID,
+		ToStatus: models.SubscriptionStatusActive}).Error)
+	require.NoError(t, db.Create(&models.Subscription{Email: "bob@example.com", NormalizedEmail: "bob@example.com"}).Error)
+	require.NoError(t, db.Create(&saga.Instance{ID: "saga-1", Name: "subscribe", Key: "alice@example.com",
+		Status: saga.StatusCompleted, Data: `{"email":"Alice@example.com","locale":"en"}`}).Error)
+	require.NoError(t, conn.AddStepLog(context.Background(), &saga.StepLog{SagaID: "saga-1", Step: "validate",
+		Input: `{"email":"Alice@example.com"}`, Output: `{"email":"alice@example.com"}`}))
+
+	var events []outbox.Event
+	for _, addr := range []string{"Alice@example.com", "Alice@example.com", "bob@example.com"} {
+		data, err := outbox.Data{Email: addr, Rate: 41, RunID: "run-1"}.Serialize()
+		require.NoError(t, err)
+		event := outbox.Event{Key: strings.ToLower(addr), Data: data, CreatedAt: time.Now()}
+		require.NoError(t, conn.AddEvent(&event))
+		events = append(events, event)
+	}
+	key := "alice@example.com:run-1"
+	require.NoError(t, conn.ConsumeOnce(&consumer.ConsumedEvent{ID: events[0].ID, IdempotencyKey: &key,
+		Data: events[0].Data, ConsumedAt: time.Now()}, func() error { return nil }))
+
+	require.NoError(t, conn.AddDelivery(&models.Delivery{EventID: events[0].ID, Recipient: "Alice@example.com"}))
+	require.NoError(t, conn.AddBounce(&models.Bounce{Email: "alice@example.com", Type: "hard"}))
+	require.NoError(t, conn.AddSuppression(&models.Suppression{Email: "alice@example.com",
+		Reason: models.SuppressionReasonHardBounces}))
+	require.NoError(t, db.Create(&models.DeadLetter{EventID: events[1].ID, Topic: "emails-topic",
+		Key: "alice@example.com", Value: events[1].Data}).Error)
+
+	data, err := conn.ExportSubject("alice@example.com", "alice@example.com")
+	require.NoError(t, err)
+	assert.Len(t, data.Subscriptions, 1)
+	assert.Len(t, data.History, 2) // sign-up and suppression
+	require.Len(t, data.Sagas, 1)
+	assert.JSONEq(t, `{"email":"Alice@example.com","locale":"en"}`, string(data.Sagas[0].Data))
+	assert.Len(t, data.Sagas[0].Steps, 1)
+	require.Len(t, data.Events, 3) // two emails and the cancellation of the subscription
+	assert.NotNil(t, data.Events[0].ConsumedAt)
+	assert.Nil(t, data.Events[1].ConsumedAt)
+	assert.Contains(t, string(data.Events[2].Data), outbox.TypeSubscriptionCancelled)
+	assert.Contains(t, string(data.Events[0].Data), "Alice@example.com")
+	assert.Len(t, data.Deliveries, 1)
+	assert.Len(t, data.Bounces, 1)
+	assert.Len(t, data.Suppressions, 1)
+	assert.Len(t, data.DeadLetters, 1)
+
+	pseudonym := "erased-1@erased.invalid"
+	erasure := models.Erasure{SubjectHash: "hash", Pseudonym: pseudonym}
+	require.NoError(t, conn.EraseSubject("alice@example.com", "alice@example.com", &erasure))
+	assert.NotZero(t, erasure.ID)
+	assert.Equal(t, models.Erasure{
+		ID: erasure.ID, SubjectHash: "hash", Pseudonym: pseudonym,
+		Subscriptions: 1, Sagas: 1, SagaSteps: 1, Events: 3, ConsumedEvents: 1, Deliveries: 1, Bounces: 1,
+		Suppressions: 1, DeadLetters: 1, CreatedAt: erasure.CreatedAt,
+	}, erasure)
+
+	data, err = conn.ExportSubject("alice@example.com", "alice@example.com")
+	require.NoError(t, err)
+	assert.True(t, data.Empty())
+
+	// The address is gone from every table
+	for _, table := range []string{"subscriptions", "sagas", "events", "consumed_events", "deliveries",
+		"bounces", "suppressions", "dead_letters"} {
+		var rows []map[string]any
+		require.NoError(t, db.Table(table).Find(&rows).Error)
+		for _, row := range rows {
+			for column, value := range row {
+				s, _ := value.(string)
+				assert.NotContains(t, strings.ToLower(s), "alice", "%s.%s", table, column)
+			}
+		}
+	}
+
+	// The unconsumed event is never sent to the pseudonym
+	err = conn.ConsumeOnce(&consumer.ConsumedEvent{ID: events[1].ID, ConsumedAt: time.Now()},
+		func() error { return nil })
+	assert.ErrorIs(t, err, consumer.ErrEventAlreadyConsumed)
+
+	var consumed consumer.ConsumedEvent
+	require.NoError(t, db.First(&consumed, events[0].ID).Error)
+	require.NotNil(t, consumed.IdempotencyKey)
+	assert.Equal(t, pseudonym+":run-1", *consumed.IdempotencyKey)
+
+	// The subscription event keeps everything but the address
+	var cancelled outbox.Event
+	require.NoError(t, db.Where("stream = ?", outbox.StreamSubscriptions).First(&cancelled).Error)
+	var e outbox.SubscriptionEvent
+	require.NoError(t, json.Unmarshal([]byte(cancelled.Data), &e))
+	assert.Equal(t, pseudonym, e.Email)
+	assert.Equal(t, sub.ID, e.SubscriptionID)
+	assert.Equal(t, models.SubscriptionStatusSuppressed, e.Status)
+
+	// Bob is untouched
+	data, err = conn.ExportSubject("bob@example.com", "bob@example.com")
+	require.NoError(t, err)
+	assert.Len(t, data.Subscriptions, 1)
+	assert.Len(t, data.Events, 1)
+
+	erasures, err := conn.GetErasures("hash", 10, 0)
+	require.NoError(t, err)
+	require.Len(t, erasures, 1)
+	assert.Equal(t, erasure.ID, erasures[0].ID)
+}
+
+func TestConnection_EraseSubject_MalformedData(t *testing.T) {
+	conn := gormstoragetest.NewConnection(t)
+	db := conn.DB()
+
+	sub := models.Subscription{Email: "alice@example.com", NormalizedEmail: "alice@example.com",
+		EmailIndex: "alice@example.com", Status: models.SubscriptionStatusActive}
+	require.NoError(t, db.Create(&sub).Error)
+	dl := models.DeadLetter{Topic: "emails-topic", Key: "alice@example.com", Value: "not json"}
+	require.NoError(t, db.Create(&dl).Error)
+
+	// The malformed dead letter fails the erasure instead of being dropped silently
+	erasure := models.Erasure{SubjectHash: "hash", Pseudonym: "erased-1@erased.invalid"}
+	err := conn.EraseSubject("alice@example.com", "alice@example.com", &erasure)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), fmt.Sprintf("dead letter %d", dl.ID))
+
+	// Nothing is erased
+	var count int64
+	require.NoError(t, db.Model(&models.Subscription{}).Where("id = ?", sub.ID).Count(&count).Error)
+	assert.Equal(t, int64(1), count)
+	require.NoError(t, db.Model(&models.Erasure{}).Count(&count).Error)
+	assert.Zero(t, count)
+
+	// Once the dead letter is discarded, the erasure succeeds
+	require.NoError(t, conn.DeleteDeadLetter(dl.ID))
+	require.NoError(t, conn.EraseSubject("alice@example.com", "alice@example.com", &erasure))
+	assert.Equal(t, int64(1), erasure.Subscriptions)
+}
+
+func TestConnection_GetDeadLetter_NotFound(t *testing.T) {
+	conn := gormstoragetest.NewConnection(t)
+
+	_, err := conn.GetDeadLetter(1)
+	assert.ErrorIs(t, err, consumer.ErrDeadLetterNotFound)
+}
+
+func TestConnection_Reseal(t *testing.T) {
+	conn := gormstoragetest.NewConnection(t)
+	db := conn.DB()
+
+	require.NoError(t, db.Create(&models.Subscription{Email: "Alice@example.com",
+		NormalizedEmail: "alice@example.com", EmailIndex: "alice@example.com"}).Error)
+	require.NoError(t, db.Create(&saga.Instance{ID: "saga-1", Name: "subscribe", Key: "alice@example.com",
+		Status: saga.StatusCompleted, Data: `{"email":"Alice@example.com"}`}).Error)
+
+	data, err := outbox.Data{Email: "Alice@example.com", Rate: 41, RunID: "run-1"}.Serialize()
+	require.NoError(t, err)
+	event := outbox.Event{Key: "alice@example.com", Data: data, CreatedAt: time.Now()}
+	require.NoError(t, conn.AddEvent(&event))
+	key := "alice@example.com:run-1"
+	require.NoError(t, conn.ConsumeOnce(&consumer.ConsumedEvent{ID: event.ID, IdempotencyKey: &key,
+		Data: data, ConsumedAt: time.Now()}, func() error { return nil }))
+	require.NoError(t, conn.AddDelivery(&models.Delivery{EventID: event.ID, Recipient: "Alice@example.com"}))
+	require.NoError(t, conn.AddBounce(&models.Bounce{Email: "Alice@example.com", Type: "hard"}))
+	require.NoError(t, conn.AddSuppression(&models.Suppression{Email: "Bob@example.com",
+		Reason: models.SuppressionReasonComplaint}))
+
+	indexKey := bytes.Repeat([]byte{0xff}, envelope.KeySize)
+	k1 := envelope.Key{ID: "k1", Secret: bytes.Repeat([]byte{1}, envelope.KeySize)}
+	keys, err := envelope.New([]envelope.Key{k1}, indexKey)
+	require.NoError(t, err)
+	conn.UseKeyring(keys)
+
+	normalize := func(addr string) (string, error) { return strings.ToLower(addr), nil }
+	_, err = conn.NormalizeSubscriptions(normalize)
+	require.NoError(t, err)
+	updated, err := conn.Reseal(normalize)
+	require.NoError(t, err)
+	assert.Equal(t, 6, updated)
+
+	var sub models.Subscription
+	require.NoError(t, db.First(&sub).Error)
+	assert.True(t, strings.HasPrefix(sub.Email, "enc:v1:k1:"), sub.Email)
+	assert.Equal(t, keys.BlindIndex("alice@example.com"), sub.NormalizedEmail)
+	assert.Equal(t, keys.BlindIndex("alice@example.com"), sub.EmailIndex)
+
+	var instance saga.Instance
+	require.NoError(t, db.First(&instance).Error)
+	assert.Contains(t, instance.Data, `"email":"enc:v1:k1:`)
+	assert.NotContains(t, instance.Data, "Alice")
+	assert.Equal(t, keys.BlindIndex("alice@example.com"), instance.Key)
+
+	require.NoError(t, db.First(&event).Error)
+	assert.True(t, strings.HasPrefix(event.Data, "enc:v1:k1:"), event.Data)
+	assert.Equal(t, keys.BlindIndex("alice@example.com"), event.Key)
+
+	var consumed consumer.ConsumedEvent
+	require.NoError(t, db.Omit("Event").First(&consumed).Error)
+	assert.True(t, strings.HasPrefix(consumed.Data, "enc:v1:k1:"), consumed.Data)
+	assert.Equal(t, keys.BlindIndex(key), *consumed.IdempotencyKey)
+
+	var delivery models.Delivery
+	require.NoError(t, db.First(&delivery).Error)
+	assert.True(t, strings.HasPrefix(delivery.Recipient, "enc:v1:k1:"), delivery.Recipient)
+	assert.Equal(t, keys.BlindIndex("alice@example.com"), delivery.RecipientIndex)
+
+	var bounce models.Bounce
+	require.NoError(t, db.First(&bounce).Error)
+	assert.True(t, strings.HasPrefix(bounce.Email, "enc:v1:k1:"), bounce.Email)
+	assert.Equal(t, keys.BlindIndex("alice@example.com"), bounce.EmailIndex)
+
+	var suppression models.Suppression
+	require.NoError(t, db.First(&suppression).Error)
+	assert.True(t, strings.HasPrefix(suppression.Email, "enc:v1:k1:"), suppression.Email)
+	assert.Equal(t, keys.BlindIndex("bob@example.com"), suppression.EmailIndex)
+
+	// The addresses are looked up by their blind indexes
+	deliveries, err := conn.GetDeliveries("ALICE@example.com", "", 10, 0)
+	require.NoError(t, err)
+	require.Len(t, deliveries, 1)
+	assert.Equal(t, "Alice@example.com", deliveries[0].Recipient)
+
+	count, err := conn.CountBounces("alice@example.com", "hard")
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), count)
+
+	suppressed, err := conn.GetSuppressedAmong([]string{"BOB@example.com", "alice@example.com"})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]bool{"bob@example.com": true}, suppressed)
+
+	suppressions, err := conn.GetSuppressions(10, 0)
+	require.NoError(t, err)
+	require.Len(t, suppressions, 1)
+	assert.Equal(t, "bob@example.com", suppressions[0].Email)
+
+	// Nothing changes until the keys do
+	updated, err = conn.Reseal(normalize)
+	require.NoError(t, err)
+	assert.Zero(t, updated)
+
+	rotated, err := envelope.New([]envelope.Key{{ID: "k2", Secret: bytes.Repeat([]byte{2}, envelope.KeySize)}, k1},
+		indexKey)
+	require.NoError(t, err)
+	conn.UseKeyring(rotated)
+
+	_, err = conn.NormalizeSubscriptions(normalize)
+	require.NoError(t, err)
+	_, err = conn.Reseal(normalize)
+	require.NoError(t, err)
+
+	require.NoError(t, db.First(&sub).Error)
+	assert.True(t, strings.HasPrefix(sub.Email, "enc:v1:k2:"), sub.Email)
+	require.NoError(t, db.First(&event).Error)
+	assert.True(t, strings.HasPrefix(event.Data, "enc:v1:k2:"), event.Data)
+
+	subject, err := conn.ExportSubject("alice@example.com", "alice@example.com")
+	require.NoError(t, err)
+	require.Len(t, subject.Subscriptions, 1)
+	assert.Equal(t, "Alice@example.com", subject.Subscriptions[0].Email)
+	require.Len(t, subject.Sagas, 1)
+	assert.JSONEq(t, `{"email":"Alice@example.com"}`, string(subject.Sagas[0].Data))
+	require.Len(t, subject.Events, 1)
+	assert.Contains(t, string(subject.Events[0].Data), "Alice@example.com")
+	require.Len(t, subject.Deliveries, 1)
+	assert.Equal(t, "Alice@example.com", subject.Deliveries[0].Recipient)
+	require.Len(t, subject.Bounces, 1)
+	assert.Equal(t, "alice@example.com", subject.Bounces[0].Email)
+
+	// The pseudonym replacing the address is encrypted as well
+	erasure := models.Erasure{SubjectHash: "hash", Pseudonym: "erased-1@erased.invalid"}
+	require.NoError(t, conn.EraseSubject("alice@example.com", "alice@example.com", &erasure))
+	assert.Equal(t, int64(1), erasure.Deliveries)
+	assert.Equal(t, int64(1), erasure.Bounces)
+
+	require.NoError(t, db.First(&delivery).Error)
+	assert.True(t, strings.HasPrefix(delivery.Recipient, "enc:v1:k2:"), delivery.Recipient)
+	assert.Equal(t, rotated.BlindIndex("erased-1@erased.invalid"), delivery.RecipientIndex)
+
+	deliveries, err = conn.GetDeliveries("erased-1@erased.invalid", "", 10, 0)
+	require.NoError(t, err)
+	require.Len(t, deliveries, 1)
+	assert.Equal(t, "erased-1@erased.invalid", deliveries[0].Recipient)
+}
+
+func TestConnection_Sagas(t *testing.T) {
+	conn := gormstoragetest.NewConnection(t)
+	ctx := context.Background()
+
+	now := time.Now()
+	expired := now.Add(-time.Minute)
+	for _, s := range []saga.Instance{
+		{ID: "old", Name: "subscribe", Key: "alice@example.com", Status: saga.StatusFailed,
+			Data: `{"email":"Alice@example.com"}`, Error: "failed to activate", CreatedAt: now.Add(-2 * time.Hour)},
+		{ID: "stuck", Name: "subscribe", Key: "bob@example.com", Status: saga.StatusInProgress, Data: `{}`,
+			LeaseOwner: "gone", LeaseExpiresAt: &expired, CreatedAt: now.Add(-time.Hour)},
+		{ID: "new", Name: "unsubscribe", Key: "alice@example.com", Status: saga.StatusCompleted, Data: `{}`,
+			CreatedAt: now},
+	} {
+		require.NoError(t, conn.SaveSaga(ctx, &s))
+	}
+	require.NoError(t, conn.AddStepLog(ctx, &saga.StepLog{SagaID: "old", Step: "activate", Phase: saga.PhaseAction,
+		Attempt: 1, Input: `{"email":"Alice@example.com"}`, Error: "failed to activate", StartedAt: now}))
+
+	ids := func(filter models.SagaFilter) []string {
+		sagas, err := conn.GetSagas(filter, 10, 0)
+		require.NoError(t, err)
+		var ids []string
+		for _, s := range sagas {
+			assert.Empty(t, s.Steps)
+			ids = append(ids, s.ID)
+		}
+		return ids
+	}
+	assert.Equal(t, []string{"new", "stuck", "old"}, ids(models.SagaFilter{}))
+	assert.Equal(t, []string{"new", "old"}, ids(models.SagaFilter{Normalized: "alice@example.com"}))
+	assert.Equal(t, []string{"stuck", "old"}, ids(models.SagaFilter{Name: "subscribe"}))
+	assert.Equal(t, []string{"stuck"}, ids(models.SagaFilter{Status: saga.StatusInProgress}))
+	assert.Equal(t, []string{"stuck"}, ids(models.SagaFilter{
+		CreatedAfter: now.Add(-90 * time.Minute), CreatedBefore: now.Add(-time.Minute)}))
+
+	history, err := conn.GetSagaHistory("old")
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"email":"Alice@example.com"}`, string(history.Data))
+	require.Len(t, history.Steps, 1)
+	assert.Equal(t, "failed to activate", history.Steps[0].Error)
+
+	_, err = conn.GetSagaHistory("missing")
+	assert.ErrorIs(t, err, saga.ErrSagaNotFound)
+	_, err = conn.GetSaga(ctx, "missing")
+	assert.ErrorIs(t, err, saga.ErrSagaNotFound)
+
+	// Only failed sagas and the sagas in progress that are not being run are resolved
+	for id, ok := range map[string]bool{"old": true, "stuck": true, "new": false} {
+		resolved, err := conn.ResolveSaga(ctx, id, "fixed by hand", now)
+		require.NoError(t, err)
+		assert.Equal(t, ok, resolved, id)
+	}
+	s, err := conn.GetSaga(ctx, "stuck")
+	require.NoError(t, err)
+	assert.Equal(t, saga.StatusResolved, s.Status)
+	assert.Equal(t, "fixed by hand", s.Resolution)
+}
+
+func TestConnection_Deliveries(t *testing.T) {
+	conn := gormstoragetest.NewConnection(t)
+
+	event := outbox.Event{Key: "a", Data: "{}", CreatedAt: time.Now()}
+	require.NoError(t, conn.AddEvent(&event))
+
+	deliveries := []models.Delivery{
+		{Recipient: "Alice@example.com", RunID: "digest-2024-06-01", Status: models.DeliveryStatusRetrying,
+			Response: "421 4.7.0 Try again later"},
+		{Recipient: "alice@example.com", RunID: "digest-2024-06-01", Status: models.DeliveryStatusSent,
+			Response: "250 2.0.0 Ok: queued as 4F3A1"},
+		{Recipient: "bob@example.com", RunID: "digest-2024-06-01", Status: models.DeliveryStatusSent},
+		{Recipient: "alice@example.com", RunID: "digest-2024-06-02", Status: models.DeliveryStatusSent},
+	}
+	for i := range deliveries {
+		deliveries[i].EventID = event.ID
+		require.NoError(t, conn.AddDelivery(&deliveries[i]))
+		assert.NotZero(t, deliveries[i].ID)
+	}
+
+	got, err := conn.GetDeliveries("", "", 10, 0)
+	require.NoError(t, err)
+	require.Len(t, got, 4)
+	assert.Equal(t, deliveries[3].ID, got[0].ID)
+
+	// The recipient is matched case-insensitively
+	got, err = conn.GetDeliveries("ALICE@example.com", "digest-2024-06-01", 10, 0)
+	require.NoError(t, err)
+	require.Len(t, got, 2)
+	assert.Equal(t, "250 2.0.0 Ok: queued as 4F3A1", got[0].Response)
+	assert.Equal(t, models.DeliveryStatusRetrying, got[1].Status)
+
+	got, err = conn.GetDeliveries("", "digest-2024-06-01", 1, 1)
+	require.NoError(t, err)
+	require.Len(t, got, 1)
+	assert.Equal(t, deliveries[1].ID, got[0].ID)
+}
@@ -0,0 +1,546 @@
+package gormstorage
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/vladyslavpavlenko/genesis-api-project/internal/email/consumer"
+	"github.com/vladyslavpavlenko/genesis-api-project/internal/models"
+	"github.com/vladyslavpavlenko/genesis-api-project/internal/outbox"
+	"github.com/vladyslavpavlenko/genesis-api-project/pkg/saga"
+	"gorm.io/gorm"
+)
+
+// erasureTimeout bounds the EraseSubject transaction, which rewrites every event
+// of the subject.
+const erasureTimeout = time.Minute
+
+// ExportSubject returns everything held about the email address, decrypted. Besides
+// the address itself, the subject is identified by the normalized email, so the data
+// of the subscriptions and sagas stored under other forms of the address, and of
+// those forms, is returned as well.
+func (c *Connection) ExportSubject(email, normalized string) (models.SubjectData, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), RequestTimeout)
+	defer cancel()
+
+	data := models.SubjectData{Email: email}
+	err := c.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var sagas []saga.Instance
+		addrs, err := c.subjectAddresses(tx, email, normalized, &data.Subscriptions, &sagas)
+		if err != nil {
+			return err
+		}
+		keys := c.eventKeys(addrs)
+
+		if data.Sagas, err = c.exportSagas(tx, sagas); err != nil {
+			return err
+		}
+
+		ids := make([]uint, len(data.Subscriptions))
+		for i, s := range data.Subscriptions {
+			ids[i] = s.ID
+		}
+
+		err = tx.Where("subscription_id IN ?", ids).Order("id").Find(&data.History).Error
+		if err != nil {
+			return err
+		}
+
+		var events []struct {
+			ID         uint
+			Data       string
+			CreatedAt  time.Time
+			ConsumedAt *time.Time
+		}
+		err = tx.Table("events").
+			Select("events.id, events.data, events.created_at, consumed_events.consumed_at").
+			Joins("LEFT JOIN consumed_events ON consumed_events.id = events.id").
+			Where("events.key IN ?", keys).
+			Order("events.id").
+			Scan(&events).Error
+		if err != nil {
+			return err
+		}
+
+		data.Events = make([]models.SubjectEvent, len(events))
+		for i, e := range events {
+			plaintext, err := c.keys.Open(e.Data)
+			if err != nil {
+				return err
+			}
+
+			data.Events[i] = models.SubjectEvent{
+				ID:         e.ID,
+				Data:       rawJSON(plaintext),
+				CreatedAt:  e.CreatedAt,
+				ConsumedAt: e.ConsumedAt,
+			}
+		}
+
+		err = tx.Where("recipient_index IN ?", keys).Order("id").Find(&data.Deliveries).Error
+		if err != nil {
+			return err
+		}
+		if err = c.openDeliveries(data.Deliveries); err != nil {
+			return err
+		}
+
+		err = tx.Where("email_index IN ?", keys).Order("id").Find(&data.Bounces).Error
+		if err != nil {
+			return err
+		}
+		if err = c.openBounces(data.Bounces); err != nil {
+			return err
+		}
+
+		err = tx.Where("email_index IN ?", keys).Find(&data.Suppressions).Error
+		if err != nil {
+			return err
+		}
+		if err = c.openSuppressions(data.Suppressions); err != nil {
+			return err
+		}
+
+		err = tx.Where("key IN ?", keys).Order("id").Find(&data.DeadLetters).Error
+		if err != nil {
+			return err
+		}
+		for i := range data.DeadLetters {
+			if data.DeadLetters[i].Value, err = c.keys.Open(data.DeadLetters[i].Value); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return models.SubjectData{}, err
+	}
+
+	return data, nil
+}
+
+// EraseSubject erases the email address, identified the same way as by
+// ExportSubject, in a single transaction:
+//   - the subscriptions are deleted along with their history;
+//   - the address is replaced with the pseudonym in the sagas, the outbox events, the
+//     consumed events, the deliveries, the bounces, and the dead letters;
+//   - the suppressions and the logs of the saga steps are deleted.
+//
+// The events that have not been consumed yet are marked as consumed, and the sagas
+// left in progress are failed, so that nothing is done for the pseudonym. The erasure
+// is recorded with the number of affected records of each table.
+func (c *Connection) EraseSubject(email, normalized string, erasure *models.Erasure) error {
+	ctx, cancel := context.WithTimeout(context.Background(), erasureTimeout)
+	defer cancel()
+
+	pseudonym := erasure.Pseudonym
+	return c.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var (
+			subscriptions []models.Subscription
+			sagas         []saga.Instance
+		)
+		addrs, err := c.subjectAddresses(tx, email, normalized, &subscriptions, &sagas)
+		if err != nil {
+			return err
+		}
+		keys := c.eventKeys(addrs)
+
+		if len(subscriptions) > 0 {
+			ids := make([]uint, len(subscriptions))
+			for i, s := range subscriptions {
+				ids[i] = s.ID
+			}
+
+			err = tx.Where("subscription_id IN ?", ids).Delete(&models.SubscriptionHistory{}).Error
+			if err != nil {
+				return err
+			}
+
+			result := tx.Delete(&models.Subscription{}, ids)
+			if result.Error != nil {
+				return result.Error
+			}
+			erasure.Subscriptions = result.RowsAffected
+		}
+
+		if err = c.eraseSagas(tx, sagas, erasure); err != nil {
+			return err
+		}
+
+		if err = c.eraseEvents(tx, keys, erasure); err != nil {
+			return err
+		}
+
+		sealed, index, err := c.sealAddress(pseudonym)
+		if err != nil {
+			return err
+		}
+
+		result := tx.Model(&models.Delivery{}).Where("recipient_index IN ?", keys).
+			Updates(map[string]any{"recipient": sealed, "recipient_index": index})
+		if result.Error != nil {
+			return result.Error
+		}
+		erasure.Deliveries = result.RowsAffected
+
+		result = tx.Model(&models.Bounce{}).Where("email_index IN ?", keys).
+			Updates(map[string]any{"email": sealed, "email_index": index})
+		if result.Error != nil {
+			return result.Error
+		}
+		erasure.Bounces = result.RowsAffected
+
+		result = tx.Where("email_index IN ?", keys).Delete(&models.Suppression{})
+		if result.Error != nil {
+			return result.Error
+		}
+		erasure.Suppressions = result.RowsAffected
+
+		var deadLetters []models.DeadLetter
+		if err = tx.Where("key IN ?", keys).Find(&deadLetters).Error; err != nil {
+			return err
+		}
+		for _, dl := range deadLetters {
+			value, _, err := c.pseudonymizeData(dl.Value, pseudonym)
+			if err != nil {
+				return fmt.Errorf("error pseudonymizing dead letter %d: %w", dl.ID, err)
+			}
+
+			err = tx.Model(&dl).Updates(map[string]any{
+				"key":   c.keys.BlindIndex(pseudonym),
+				"value": value,
+			}).Error
+			if err != nil {
+				return err
+			}
+		}
+		erasure.DeadLetters = int64(len(deadLetters))
+
+		return tx.Create(erasure).Error
+	})
+}
+
+// GetErasures returns a paginated list of models.Erasure records, newest first. The
+// records are filtered by the subject hash, unless it is empty.
+func (c *Connection) GetErasures(subjectHash string, limit, offset int) ([]models.Erasure, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), RequestTimeout)
+	defer cancel()
+
+	query := c.db.WithContext(ctx)
+	if subjectHash != "" {
+		query = query.Where("subject_hash = ?", subjectHash)
+	}
+
+	var erasures []models.Erasure
+	err := query.Order("id DESC").Limit(limit).Offset(offset).Find(&erasures).Error
+	if err != nil {
+		return nil, err
+	}
+	return erasures, nil
+}
+
+// eraseEvents replaces the address with the pseudonym in the outbox events with any
+// of the keys and in their consumed events, and marks the emails that have not been
+// consumed yet as consumed.
+func (c *Connection) eraseEvents(tx *gorm.DB, keys []string, erasure *models.Erasure) error {
+	pseudonym := erasure.Pseudonym
+
+	var events []outbox.Event
+	if err := tx.Where("key IN ?", keys).Order("id").Find(&events).Error; err != nil {
+		return err
+	}
+	if len(events) == 0 {
+		return nil
+	}
+
+	ids := make([]uint, len(events))
+	for i, e := range events {
+		ids[i] = e.ID
+	}
+
+	var consumed []consumer.ConsumedEvent
+	if err := tx.Where("id IN ?", ids).Find(&consumed).Error; err != nil {
+		return err
+	}
+	isConsumed := make(map[uint]bool, len(consumed))
+
+	for _, ce := range consumed {
+		isConsumed[ce.ID] = true
+
+		value, data, err := c.pseudonymizeData(ce.Data, pseudonym)
+		if err != nil {
+			return fmt.Errorf("error pseudonymizing consumed event %d: %w", ce.ID, err)
+		}
+
+		updates := map[string]any{"data": value}
+		if ce.IdempotencyKey != nil {
+			var key *string
+			if k := data.IdempotencyKey(); k != "" {
+				k = c.keys.BlindIndex(k)
+				key = &k
+			}
+			updates["idempotency_key"] = key
+		}
+		err = tx.Model(&consumer.ConsumedEvent{}).Where("id = ?", ce.ID).Updates(updates).Error
+		if err != nil {
+			return err
+		}
+	}
+	erasure.ConsumedEvents = int64(len(consumed))
+
+	now := time.Now()
+	for _, e := range events {
+		value, _, err := c.pseudonymizeData(e.Data, pseudonym)
+		if err != nil {
+			return fmt.Errorf("error pseudonymizing event %d: %w", e.ID, err)
+		}
+
+		err = tx.Model(&outbox.Event{}).Where("id = ?", e.ID).
+			Updates(map[string]any{"key": c.keys.BlindIndex(pseudonym), "data": value}).Error
+		if err != nil {
+			return err
+		}
+
+		if isConsumed[e.ID] || e.Stream != outbox.StreamEmails {
+			continue
+		}
+		err = tx.Omit("Event").Create(&consumer.ConsumedEvent{ID: e.ID, Data: value, ConsumedAt: now}).Error
+		if err != nil {
+			return err
+		}
+	}
+	erasure.Events = int64(len(events))
+
+	return nil
+}
+
+// subjectAddresses finds the subscriptions and the sagas of the subject, with the
+// addresses of the subscriptions decrypted, and returns the lower-cased addresses the
+// subject is known by.
+func (c *Connection) subjectAddresses(tx *gorm.DB, email, normalized string,
+	subscriptions *[]models.Subscription, sagas *[]saga.Instance,
+) ([]string, error) {
+	email = strings.ToLower(email)
+	normalizedIndex := c.keys.BlindIndex(normalized)
+
+	err := tx.Where("normalized_email = ? OR email_index = ?", normalizedIndex, c.keys.BlindIndex(email)).
+		Order("id").Find(subscriptions).Error
+	if err != nil {
+		return nil, err
+	}
+
+	err = tx.Where("key = ?", normalizedIndex).Order("created_at").Find(sagas).Error
+	if err != nil {
+		return nil, err
+	}
+
+	seen := map[string]bool{email: true}
+	for i := range *subscriptions {
+		s := &(*subscriptions)[i]
+		if s.Email, err = c.keys.Open(s.Email); err != nil {
+			return nil, err
+		}
+		seen[strings.ToLower(s.Email)] = true
+	}
+	for _, s := range *sagas {
+		_, err = jsonEmail(s.Data, func(addr string) (string, error) {
+			addr, err := c.keys.Open(addr)
+			if addr != "" {
+				seen[strings.ToLower(addr)] = true
+			}
+			return addr, err
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	addrs := make([]string, 0, len(seen))
+	for addr := range seen {
+		addrs = append(addrs, addr)
+	}
+	sort.Strings(addrs)
+
+	return addrs, nil
+}
+
+// exportSagas returns the sagas along with the logs of their steps, with the data
+// decrypted.
+func (c *Connection) exportSagas(tx *gorm.DB, sagas []saga.Instance) ([]models.SubjectSaga, error) {
+	if len(sagas) == 0 {
+		return []models.SubjectSaga{}, nil
+	}
+
+	ids := make([]string, len(sagas))
+	for i, s := range sagas {
+		ids[i] = s.ID
+	}
+
+	var logs []saga.StepLog
+	if err := tx.Where("saga_id IN ?", ids).Order("id").Find(&logs).Error; err != nil {
+		return nil, err
+	}
+
+	steps := make(map[string][]models.SubjectSagaStep, len(sagas))
+	for _, l := range logs {
+		input, err := jsonEmail(l.Input, c.keys.Open)
+		if err != nil {
+			return nil, err
+		}
+		output, err := jsonEmail(l.Output, c.keys.Open)
+		if err != nil {
+			return nil, err
+		}
+
+		step := models.SubjectSagaStep{
+			Step:      l.Step,
+			Phase:     l.Phase,
+			Attempt:   l.Attempt,
+			Input:     rawJSON(input),
+			Error:     l.Error,
+			Duration:  l.Duration,
+			StartedAt: l.StartedAt,
+		}
+		if output != "" {
+			step.Output = rawJSON(output)
+		}
+		steps[l.SagaID] = append(steps[l.SagaID], step)
+	}
+
+	exported, err := c.viewSagas(sagas)
+	if err != nil {
+		return nil, err
+	}
+	for i := range exported {
+		exported[i].Steps = steps[exported[i].ID]
+	}
+
+	return exported, nil
+}
+
+// viewSagas returns the views of the sagas without the logs of their steps, with the
+// data decrypted.
+func (c *Connection) viewSagas(sagas []saga.Instance) ([]models.SubjectSaga, error) {
+	views := make([]models.SubjectSaga, len(sagas))
+	for i, s := range sagas {
+		data, err := jsonEmail(s.Data, c.keys.Open)
+		if err != nil {
+			return nil, err
+		}
+
+		views[i] = models.SubjectSaga{
+			ID:           s.ID,
+			Name:         s.Name,
+			CurrentStep:  s.CurrentStep,
+			Compensating: s.Compensating,
+			Status:       s.Status,
+			Data:         rawJSON(data),
+			Error:        s.Error,
+			Resolution:   s.Resolution,
+			CreatedAt:    s.CreatedAt,
+			UpdatedAt:    s.UpdatedAt,
+		}
+	}
+
+	return views, nil
+}
+
+// eraseSagas replaces the address with the pseudonym in the data of the sagas, fails
+// the sagas left in progress, and deletes the logs of their steps.
+func (c *Connection) eraseSagas(tx *gorm.DB, sagas []saga.Instance, erasure *models.Erasure) error {
+	if len(sagas) == 0 {
+		return nil
+	}
+
+	sealed, err := c.keys.Seal(erasure.Pseudonym)
+	if err != nil {
+		return err
+	}
+	pseudonymize := func(string) (string, error) { return sealed, nil }
+
+	ids := make([]string, len(sagas))
+	for i, s := range sagas {
+		ids[i] = s.ID
+
+		data, err := jsonEmail(s.Data, pseudonymize)
+		if err != nil {
+			return err
+		}
+
+		updates := map[string]any{"key": c.keys.BlindIndex(erasure.Pseudonym), "data": data}
+		if s.Status == saga.StatusInProgress {
+			updates["status"] = saga.StatusFailed
+		}
+		if err = tx.Model(&saga.Instance{}).Where("id = ?", s.ID).Updates(updates).Error; err != nil {
+			return err
+		}
+	}
+	erasure.Sagas = int64(len(sagas))
+
+	result := tx.Where("saga_id IN ?", ids).Delete(&saga.StepLog{})
+	if result.Error != nil {
+		return result.Error
+	}
+	erasure.SagaSteps = result.RowsAffected
+
+	return nil
+}
+
+// eventKeys returns the keys of the outbox events and the dead letters of the
+// addresses, which are the blind indexes of the deliveries, the bounces, and the
+// suppressions as well. The records stored before the encryption was enabled are
+// keyed by the addresses themselves until the keys are resealed.
+func (c *Connection) eventKeys(addrs []string) []string {
+	keys := make([]string, 0, 2*len(addrs))
+	for _, addr := range addrs {
+		keys = append(keys, addr)
+		if index := c.keys.BlindIndex(addr); index != addr {
+			keys = append(keys, index)
+		}
+	}
+	return keys
+}
+
+// pseudonymizeData replaces the address in the serialized, and possibly encrypted,
+// data of the event, e.g. outbox.Data or outbox.SubscriptionEvent. The other fields
+// are kept. The data that cannot be deserialized fails the erasure, as the address in
+// it cannot be told apart, so that it is never left behind unnoticed.
+func (c *Connection) pseudonymizeData(value, pseudonym string) (string, outbox.Data, error) {
+	plaintext, err := c.keys.Open(value)
+	if err != nil {
+		return "", outbox.Data{}, err
+	}
+
+	d, err := outbox.DeserializeData([]byte(plaintext))
+	if err != nil {
+		return "", outbox.Data{}, fmt.Errorf("error deserializing data: %w", err)
+	}
+
+	d.Email = pseudonym
+	s, err := jsonEmail(plaintext, func(string) (string, error) {
+		return pseudonym, nil
+	})
+	if err != nil {
+		return "", outbox.Data{}, err
+	}
+
+	sealed, err := c.keys.Seal(s)
+	if err != nil {
+		return "", outbox.Data{}, err
+	}
+	return sealed, d, nil
+}
+
+// rawJSON returns the value as JSON, quoting it unless it is valid JSON already.
+func rawJSON(value string) json.RawMessage {
+	raw := json.RawMessage(value)
+	if !json.Valid(raw) {
+		raw, _ = json.Marshal(value)
+	}
+	return raw
+}
@@ -0,0 +1,258 @@
+package gormstorage
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/vladyslavpavlenko/genesis-api-project/internal/email"
+	"github.com/vladyslavpavlenko/genesis-api-project/internal/models"
+	"github.com/vladyslavpavlenko/genesis-api-project/internal/outbox"
+	"github.com/vladyslavpavlenko/genesis-api-project/pkg/envelope"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+const normalizeTimeout = time.Minute
+
+// NormalizeSubscriptions brings the normalized emails of the subscriptions in line
+// with the normalize function, e.g., after the plus tag policy has changed. Of the
+// subscriptions sharing a normalized email, only one is kept: the oldest active one,
+// or else the oldest pending one, or else the oldest one. The others are merged into
+// it: they are unsubscribed and lose their normalized email, which is recorded in
+// their history. Addresses the normalize function rejects are only lower-cased. The
+// addresses are resealed with the keyring along the way: they are encrypted with the
+// primary key, and their blind indexes are recomputed. It returns the number of
+// merged duplicates.
+func (c *Connection) NormalizeSubscriptions(normalize func(email string) (string, error)) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), normalizeTimeout)
+	defer cancel()
+
+	merged := 0
+	err := c.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var subscriptions []models.Subscription
+		if err := tx.Order("id").Find(&subscriptions).Error; err != nil {
+			return err
+		}
+
+		keys := make(map[uint]string, len(subscriptions))
+		owners := make(map[string]*models.Subscription, len(subscriptions))
+		for i := range subscriptions {
+			s := &subscriptions[i]
+			addr, err := c.keys.Open(s.Email)
+			if err != nil {
+				return fmt.Errorf("failed to decrypt subscription %d: %w", s.ID, err)
+			}
+
+			sealed, changed, err := c.keys.Rewrap(s.Email)
+			if err != nil {
+				return fmt.Errorf("failed to encrypt subscription %d: %w", s.ID, err)
+			}
+			index := c.keys.BlindIndex(strings.ToLower(addr))
+			if changed || s.EmailIndex != index {
+				err = tx.Model(&models.Subscription{}).Where("id = ?", s.ID).
+					Updates(map[string]any{"email": sealed, "email_index": index}).Error
+				if err != nil {
+					return err
+				}
+			}
+			s.Email = sealed
+
+			if mergedBefore(s) {
+				continue
+			}
+
+			key, err := normalize(addr)
+			if err != nil {
+				key = strings.ToLower(strings.TrimSpace(addr))
+			}
+			key = c.keys.BlindIndex(key)
+			keys[s.ID] = key
+			if owner, ok := owners[key]; !ok || mergeRank(s) < mergeRank(owner) {
+				owners[key] = s
+			}
+		}
+
+		var changed []models.Subscription
+		for i := range subscriptions {
+			s := &subscriptions[i]
+			key, ok := keys[s.ID]
+			if !ok {
+				continue
+			}
+			if owner := owners[key]; owner.ID != s.ID {
+				if err := c.mergeSubscription(tx, s, owner); err != nil {
+					return err
+				}
+				merged++
+				continue
+			}
+			if s.NormalizedEmail != key {
+				changed = append(changed, *s)
+			}
+		}
+
+		if len(changed) == 0 {
+			return nil
+		}
+
+		// Clear the changed keys first, so that they can be swapped between the
+		// subscriptions without violating the unique index
+		ids := make([]uint, len(changed))
+		for i, s := range changed {
+			ids[i] = s.ID
+		}
+		err := tx.Model(&models.Subscription{}).Where("id IN ?", ids).
+			Update("normalized_email", nil).Error
+		if err != nil {
+			return err
+		}
+
+		for _, s := range changed {
+			err = tx.Model(&models.Subscription{}).Where("id = ?", s.ID).
+				Update("normalized_email", keys[s.ID]).Error
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return merged, nil
+}
+
+// mergedBefore reports whether the subscription has been merged into another one before.
+func mergedBefore(s *models.Subscription) bool {
+	return s.NormalizedEmail == "" && s.StatusReason == models.SubscriptionReasonMerged
+}
+
+// mergeRank orders the subscriptions sharing a normalized email by the preference
+// of keeping them: active ones first, then pending ones, then the rest.
+func mergeRank(s *models.Subscription) int {
+	switch s.Status {
+	case models.SubscriptionStatusActive:
+		return 0
+	case models.SubscriptionStatusPending:
+		return 1
+	default:
+		return 2
+	}
+}
+
+// mergeSubscription merges the duplicate subscription into the owner. The duplicate
+// is unsubscribed and loses its normalized email, so it no longer violates the
+// unique index, and the merge is appended to its history. It is cancelled for the
+// downstream services unless it was cancelled already.
+func (c *Connection) mergeSubscription(tx *gorm.DB, sub, owner *models.Subscription) error {
+	now := time.Now()
+	err := tx.Model(&models.Subscription{}).Where("id = ?", sub.ID).Updates(map[string]any{
+		"normalized_email":  nil,
+		"status":            models.SubscriptionStatusUnsubscribed,
+		"status_reason":     models.SubscriptionReasonMerged,
+		"status_changed_at": now,
+	}).Error
+	if err != nil {
+		return err
+	}
+
+	err = tx.Create(&models.SubscriptionHistory{
+		SubscriptionID: sub.ID,
+		FromStatus:     sub.Status,
+		ToStatus:       models.SubscriptionStatusUnsubscribed,
+		Reason:         models.SubscriptionReasonMerged,
+		CreatedAt:      now,
+	}).Error
+	if err != nil {
+		return err
+	}
+
+	cancelled := sub.Status == models.SubscriptionStatusUnsubscribed || sub.Status == models.SubscriptionStatusSuppressed
+	sub.Status, sub.StatusReason, sub.StatusChangedAt = models.SubscriptionStatusUnsubscribed,
+		models.SubscriptionReasonMerged, now
+	if !cancelled {
+		if err = AddSubscriptionEvent(tx, c.keys, outbox.TypeSubscriptionCancelled, sub); err != nil {
+			return err
+		}
+	}
+
+	addr, err := c.keys.Open(sub.Email)
+	if err != nil {
+		return err
+	}
+	c.l.Info("merged duplicate subscription",
+		zap.Uint("id", sub.ID),
+		zap.Uint("into", owner.ID),
+		zap.String("email", email.Email(addr).Masked()))
+	return nil
+}
+
+// ChangeSubscriptionStatus sets the status of the subscription and appends the
+// change to its history in a single transaction, which is nested if db is one
+// already. It does nothing if the status is unchanged.
+func ChangeSubscriptionStatus(db *gorm.DB, sub *models.Subscription, status, reason string) error {
+	if sub.Status == status {
+		return nil
+	}
+
+	now := time.Now()
+	return db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Model(&models.Subscription{}).Where("id = ?", sub.ID).Updates(map[string]any{
+			"status":            status,
+			"status_reason":     reason,
+			"status_changed_at": now,
+		}).Error
+		if err != nil {
+			return err
+		}
+
+		err = tx.Create(&models.SubscriptionHistory{
+			SubscriptionID: sub.ID,
+			FromStatus:     sub.Status,
+			ToStatus:       status,
+			Reason:         reason,
+			CreatedAt:      now,
+		}).Error
+		if err != nil {
+			return err
+		}
+
+		sub.Status, sub.StatusReason, sub.StatusChangedAt = status, reason, now
+		return nil
+	})
+}
+
+// AddSubscriptionEvent adds the outbox.SubscriptionEvent of the type about the
+// subscription as it is now, so it is to be called in the transaction that has
+// changed the subscription.
+func AddSubscriptionEvent(db *gorm.DB, keys *envelope.Keyring, typ string, sub *models.Subscription) error {
+	addr, err := keys.Open(sub.Email)
+	if err != nil {
+		return err
+	}
+
+	event, err := outbox.NewSubscriptionEvent(outbox.NewSubscriptionEventData(typ, sub.ID, addr, sub.Locale,
+		sub.Status, sub.StatusReason), keys)
+	if err != nil {
+		return err
+	}
+	return db.Create(event).Error
+}
+
+// GetSubscriptionHistory returns the status changes of the subscription, oldest
+// first.
+func (c *Connection) GetSubscriptionHistory(subscriptionID uint) ([]models.SubscriptionHistory, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), RequestTimeout)
+	defer cancel()
+
+	var history []models.SubscriptionHistory
+	err := c.db.WithContext(ctx).Where("subscription_id = ?", subscriptionID).Order("id").Find(&history).Error
+	if err != nil {
+		return nil, err
+	}
+	return history, nil
+}
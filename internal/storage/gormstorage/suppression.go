@@ -0,0 +1,169 @@
+package gormstorage
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/vladyslavpavlenko/genesis-api-project/internal/models"
+	"github.com/vladyslavpavlenko/genesis-api-project/internal/outbox"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// AddBounce creates a new models.Bounce record. The lower-cased email is encrypted
+// with the keyring and indexed by its blind index.
+func (c *Connection) AddBounce(b *models.Bounce) error {
+	ctx, cancel := context.WithTimeout(context.Background(), RequestTimeout)
+	defer cancel()
+
+	var err error
+	if b.Email, b.EmailIndex, err = c.sealAddress(strings.ToLower(b.Email)); err != nil {
+		return err
+	}
+	return c.db.WithContext(ctx).Create(b).Error
+}
+
+// CountBounces returns the number of bounces of the given type received for the email.
+func (c *Connection) CountBounces(email, bounceType string) (int64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), RequestTimeout)
+	defer cancel()
+
+	var count int64
+	err := c.db.WithContext(ctx).Model(&models.Bounce{}).
+		Where("email_index = ? AND type = ?", c.keys.BlindIndex(strings.ToLower(email)), bounceType).
+		Count(&count).Error
+	if err != nil {
+		return 0, err
+	}
+	return count, nil
+}
+
+// AddSuppression creates a new models.Suppression record unless the email is already
+// suppressed. The lower-cased email is encrypted with the keyring and indexed by its
+// blind index. The active and pending subscriptions of the email are marked as
+// suppressed with the reason of the suppression, and are cancelled for the
+// downstream services.
+func (c *Connection) AddSuppression(s *models.Suppression) error {
+	ctx, cancel := context.WithTimeout(context.Background(), RequestTimeout)
+	defer cancel()
+
+	var err error
+	if s.Email, s.EmailIndex, err = c.sealAddress(strings.ToLower(s.Email)); err != nil {
+		return err
+	}
+	return c.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(s).Error
+		if err != nil {
+			return err
+		}
+
+		var subscriptions []models.Subscription
+		err = tx.Where("email_index = ? AND status IN ?", s.EmailIndex,
+			[]string{models.SubscriptionStatusActive, models.SubscriptionStatusPending}).
+			Find(&subscriptions).Error
+		if err != nil {
+			return err
+		}
+
+		for i := range subscriptions {
+			err = ChangeSubscriptionStatus(tx, &subscriptions[i], models.SubscriptionStatusSuppressed, s.Reason)
+			if err != nil {
+				return err
+			}
+			err = AddSubscriptionEvent(tx, c.keys, outbox.TypeSubscriptionCancelled, &subscriptions[i])
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+// GetSuppressions returns a paginated list of models.Suppression records, newest
+// first, with the emails decrypted.
+func (c *Connection) GetSuppressions(limit, offset int) ([]models.Suppression, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), RequestTimeout)
+	defer cancel()
+
+	var suppressions []models.Suppression
+	err := c.db.WithContext(ctx).Order("created_at DESC").Limit(limit).Offset(offset).Find(&suppressions).Error
+	if err != nil {
+		return nil, err
+	}
+	if err = c.openSuppressions(suppressions); err != nil {
+		return nil, err
+	}
+	return suppressions, nil
+}
+
+// GetSuppressedAmong returns the set of the given emails, lower-cased, that are
+// suppressed.
+func (c *Connection) GetSuppressedAmong(emails []string) (map[string]bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), RequestTimeout)
+	defer cancel()
+
+	byIndex := make(map[string]string, len(emails))
+	indexes := make([]string, 0, len(emails))
+	for _, e := range emails {
+		lowered := strings.ToLower(e)
+		index := c.keys.BlindIndex(lowered)
+		byIndex[index] = lowered
+		indexes = append(indexes, index)
+	}
+
+	var suppressed []string
+	err := c.db.WithContext(ctx).Model(&models.Suppression{}).
+		Where("email_index IN ?", indexes).
+		Pluck("email_index", &suppressed).Error
+	if err != nil {
+		return nil, err
+	}
+
+	set := make(map[string]bool, len(suppressed))
+	for _, index := range suppressed {
+		set[byIndex[index]] = true
+	}
+	return set, nil
+}
+
+// DeleteSuppression deletes the models.Suppression record of the email. It returns
+// false if the email is not suppressed.
+func (c *Connection) DeleteSuppression(email string) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), RequestTimeout)
+	defer cancel()
+
+	result := c.db.WithContext(ctx).Where("email_index = ?", c.keys.BlindIndex(strings.ToLower(email))).
+		Delete(&models.Suppression{})
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected > 0, nil
+}
+
+// openBounces decrypts the emails of the bounces.
+func (c *Connection) openBounces(bounces []models.Bounce) error {
+	for i := range bounces {
+		b := &bounces[i]
+		addr, err := c.keys.Open(b.Email)
+		if err != nil {
+			return fmt.Errorf("failed to decrypt bounce %d: %w", b.ID, err)
+		}
+		b.Email = addr
+	}
+	return nil
+}
+
+// openSuppressions decrypts the emails of the suppressions.
+func (c *Connection) openSuppressions(suppressions []models.Suppression) error {
+	for i := range suppressions {
+		s := &suppressions[i]
+		addr, err := c.keys.Open(s.Email)
+		if err != nil {
+			return fmt.Errorf("failed to decrypt suppression: %w", err)
+		}
+		s.Email = addr
+	}
+	return nil
+}
@@ -3,60 +3,260 @@ package gormsubscriber
 import (
 	"context"
 	"errors"
+	"fmt"
+	"strconv"
+	"strings"
 	"time"
 
-	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/vladyslavpavlenko/genesis-api-project/internal/email"
 	"github.com/vladyslavpavlenko/genesis-api-project/internal/models"
+	"github.com/vladyslavpavlenko/genesis-api-project/internal/outbox"
 	"github.com/vladyslavpavlenko/genesis-api-project/internal/storage/gormstorage"
+	"github.com/vladyslavpavlenko/genesis-api-project/pkg/saga"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
 )
 
-const UniqueViolationCode = "23505"
+const (
+	// base and target are the currency pair of the welcome emails.
+	base   = "USD"
+	target = "UAH"
+)
 
 var ErrorInvalidEmail = errors.New("invalid email")
 
-// validateSubscription is an action that validates a subscription by validating an
-// email address and checking if it already exists.
-func validateSubscription(saga *State, s *Subscriber) error {
-	// Validate the email format
-	if !email.Email(saga.Email).Validate() {
+// validateSubscription is an action that validates a subscription by canonicalizing
+// an email address and checking if it is already subscribed or is suppressed. The
+// subscription of an address that has left before is reused.
+func (s *Subscriber) validateSubscription(ctx context.Context, data *sagaData) error {
+	// Validate and canonicalize the email
+	addr, err := s.normalizer.Normalize(data.Email)
+	if err != nil {
+		if errors.Is(err, email.ErrPlusTag) {
+			return fmt.Errorf("%w: %w", ErrorInvalidEmail, err)
+		}
 		return ErrorInvalidEmail
 	}
+	data.Email, data.NormalizedEmail = addr.Email, s.keys.BlindIndex(addr.Normalized)
 
 	// Check if the subscription already exists
-	ctx, cancel := context.WithTimeout(context.Background(), gormstorage.RequestTimeout)
-	defer cancel()
+	var existing models.Subscription
+	err = s.db.WithContext(ctx).Where("normalized_email = ?", data.NormalizedEmail).First(&existing).Error
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+	case err != nil:
+		return err
+	case existing.Status == models.SubscriptionStatusActive || existing.Status == models.SubscriptionStatusPending:
+		return ErrDuplicateSubscription
+	default:
+		data.SubscriptionID, data.PreviousStatus = existing.ID, existing.Status
+	}
 
+	// Check if the email is suppressed due to bounces or complaints
 	var count int64
-	err := s.db.WithContext(ctx).Model(&models.Subscription{}).Where("email = ?", saga.Email).Count(&count).Error
+	err = s.db.WithContext(ctx).Model(&models.Suppression{}).
+		Where("email_index = ?", s.keys.BlindIndex(strings.ToLower(data.Email))).Count(&count).Error
 	if err != nil {
 		return err
 	}
 
 	if count > 0 {
-		return ErrDuplicateSubscription
+		return ErrSuppressedAddress
 	}
 
 	return nil
 }
 
-// addSubscription is an action that creates a new models.Subscription record.
-func addSubscription(saga *State, s *Subscriber) error {
-	ctx, cancel := context.WithTimeout(context.Background(), gormstorage.RequestTimeout)
-	defer cancel()
+// addSubscription is an action that creates a new pending models.Subscription record
+// or makes the existing one pending again. The subscription.created outbox events, the
+// domain one and the one the welcome email is sent for, are added in the same
+// transaction, so they are added exactly once.
+func (s *Subscriber) addSubscription(ctx context.Context, data *sagaData) error {
+	db := s.db.WithContext(ctx)
 
-	subscription := models.Subscription{
-		Email:     saga.Email,
-		CreatedAt: time.Now(),
+	sealed, err := s.keys.Seal(data.Email)
+	if err != nil {
+		return err
+	}
+	emailIndex := s.keys.BlindIndex(strings.ToLower(data.Email))
+
+	welcome, err := s.welcomeEvent(ctx, data)
+	if err != nil {
+		return err
+	}
+
+	if data.SubscriptionID != 0 {
+		err = db.Transaction(func(tx *gorm.DB) error {
+			var subscription models.Subscription
+			if err := tx.First(&subscription, data.SubscriptionID).Error; err != nil {
+				return err
+			}
+			if subscription.Status != data.PreviousStatus {
+				// The subscription was added before the saga was interrupted
+				return nil
+			}
+
+			err := tx.Model(&subscription).Updates(map[string]any{
+				"email":       sealed,
+				"email_index": emailIndex,
+				"locale":      data.Locale,
+			}).Error
+			if err != nil {
+				return err
+			}
+			subscription.Email, subscription.Locale = sealed, data.Locale
+
+			err = gormstorage.ChangeSubscriptionStatus(tx, &subscription, models.SubscriptionStatusPending,
+				models.SubscriptionReasonResubscribe)
+			if err != nil {
+				return err
+			}
+			err = gormstorage.AddSubscriptionEvent(tx, s.keys, outbox.TypeSubscriptionCreated, &subscription)
+			if err != nil {
+				return err
+			}
+			return tx.Create(welcome).Error
+		})
+		if err != nil {
+			return err
+		}
+
+		data.WelcomeEventID = welcome.ID
+		return nil
 	}
-	result := s.db.WithContext(ctx).Create(&subscription)
 
-	if result.Error != nil {
-		var pgErr *pgconn.PgError
-		if errors.As(result.Error, &pgErr) && pgErr.Code == UniqueViolationCode {
+	now := time.Now()
+	subscription := models.Subscription{
+		Email:           sealed,
+		NormalizedEmail: data.NormalizedEmail,
+		EmailIndex:      emailIndex,
+		Locale:          data.Locale,
+		CreatedAt:       now,
+		Status:          models.SubscriptionStatusPending,
+		StatusReason:    models.SubscriptionReasonSignUp,
+		StatusChangedAt: now,
+	}
+	err = db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&subscription).Error; err != nil {
+			return err
+		}
+		err := tx.Create(&models.SubscriptionHistory{
+			SubscriptionID: subscription.ID,
+			ToStatus:       models.SubscriptionStatusPending,
+			Reason:         models.SubscriptionReasonSignUp,
+			CreatedAt:      now,
+		}).Error
+		if err != nil {
+			return err
+		}
+		err = gormstorage.AddSubscriptionEvent(tx, s.keys, outbox.TypeSubscriptionCreated, &subscription)
+		if err != nil {
+			return err
+		}
+		return tx.Create(welcome).Error
+	})
+	// The storage translates the driver errors
+	if errors.Is(err, gorm.ErrDuplicatedKey) && saga.Resumed(ctx) {
+		// The subscription may have been added before the saga was interrupted, in
+		// which case it is still pending
+		err = db.Where("normalized_email = ? AND status = ?", data.NormalizedEmail,
+			models.SubscriptionStatusPending).First(&subscription).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			err = gorm.ErrDuplicatedKey
+		}
+	}
+	if err != nil {
+		if errors.Is(err, gorm.ErrDuplicatedKey) {
 			return ErrDuplicateSubscription
 		}
-		return result.Error
+		return err
 	}
+
+	data.SubscriptionID, data.WelcomeEventID = subscription.ID, welcome.ID
 	return nil
 }
+
+// welcomeEvent returns the subscription.created outbox event of the subscription.
+// The current rate is fetched before the transaction is started. The welcome email
+// is sent without the rate rather than not at all if it cannot be fetched.
+func (s *Subscriber) welcomeEvent(ctx context.Context, data *sagaData) (*outbox.Event, error) {
+	welcome := outbox.Data{
+		Type:    outbox.TypeSubscriptionCreated,
+		Email:   data.Email,
+		Locale:  data.Locale,
+		Base:    base,
+		Target:  target,
+		RatedAt: time.Now(),
+	}
+
+	if s.fetcher != nil {
+		price, err := s.fetcher.Fetch(ctx, base, target)
+		if err == nil {
+			welcome.Rate, err = strconv.ParseFloat(price, 64)
+		}
+		if err != nil {
+			s.l.Warn("failed to fetch rate for welcome email", zap.Error(err))
+		}
+	}
+
+	return outbox.NewEvent(welcome, s.keys)
+}
+
+// activateSubscription is an action that makes the pending subscription active.
+func (s *Subscriber) activateSubscription(ctx context.Context, data *sagaData) error {
+	return s.changeStatus(ctx, data.SubscriptionID, models.SubscriptionStatusPending,
+		models.SubscriptionStatusActive, models.SubscriptionReasonSubscribed, outbox.TypeSubscriptionConfirmed)
+}
+
+// findSubscription is an action that finds the active or pending subscription of the
+// email address or of any address with the same normalized form.
+func (s *Subscriber) findSubscription(ctx context.Context, data *sagaData) error {
+	addr, err := s.normalizer.Normalize(data.Email)
+	if err != nil {
+		return ErrNonExistentSubscription
+	}
+	data.NormalizedEmail = s.keys.BlindIndex(addr.Normalized)
+
+	var subscription models.Subscription
+	err = s.db.WithContext(ctx).
+		Where("normalized_email = ? AND status IN ?", data.NormalizedEmail,
+			[]string{models.SubscriptionStatusActive, models.SubscriptionStatusPending}).
+		First(&subscription).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return ErrNonExistentSubscription
+	}
+	if err != nil {
+		return err
+	}
+
+	data.SubscriptionID, data.PreviousStatus = subscription.ID, subscription.Status
+	return nil
+}
+
+// cancelSubscription is an action that unsubscribes the subscription found. The
+// models.Subscription record is kept along with its history.
+func (s *Subscriber) cancelSubscription(ctx context.Context, data *sagaData) error {
+	return s.changeStatus(ctx, data.SubscriptionID, data.PreviousStatus,
+		models.SubscriptionStatusUnsubscribed, models.SubscriptionReasonUserRequest, outbox.TypeSubscriptionCancelled)
+}
+
+// changeStatus changes the status of the subscription and adds the outbox event of
+// the type in a single transaction, provided the subscription still has the expected
+// status. Otherwise, it has been changed before the saga was interrupted, or by
+// someone else since, and is left as it is.
+func (s *Subscriber) changeStatus(ctx context.Context, id uint, expected, status, reason, eventType string) error {
+	return s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var subscription models.Subscription
+		if err := tx.First(&subscription, id).Error; err != nil {
+			return err
+		}
+		if subscription.Status != expected {
+			return nil
+		}
+
+		if err := gormstorage.ChangeSubscriptionStatus(tx, &subscription, status, reason); err != nil {
+			return err
+		}
+		return gormstorage.AddSubscriptionEvent(tx, s.keys, eventType, &subscription)
+	})
+}
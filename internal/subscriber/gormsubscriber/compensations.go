@@ -2,20 +2,88 @@ package gormsubscriber
 
 import (
 	"context"
+	"errors"
+	"strings"
 
 	"github.com/vladyslavpavlenko/genesis-api-project/internal/models"
+	"github.com/vladyslavpavlenko/genesis-api-project/internal/outbox"
 	"github.com/vladyslavpavlenko/genesis-api-project/internal/storage/gormstorage"
+	"gorm.io/gorm"
 )
 
-// deleteSubscription is a compensation to addSubscription that deletes a
-// models.Subscription record, queried by an email address.
-func deleteSubscription(saga *State, s *Subscriber) error {
-	ctx, cancel := context.WithTimeout(context.Background(), gormstorage.RequestTimeout)
-	defer cancel()
+// revertSubscription is a compensation to addSubscription. A new
+// models.Subscription record is deleted along with its history, while an existing
+// one gets its previous status back. Either way, the subscription is cancelled for
+// the downstream services, and its welcome email is skipped in the same transaction
+// unless it has been consumed already.
+func (s *Subscriber) revertSubscription(ctx context.Context, data *sagaData) error {
+	if data.SubscriptionID == 0 {
+		return nil
+	}
+
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var subscription models.Subscription
+		if err := tx.First(&subscription, data.SubscriptionID).Error; err != nil {
+			return err
+		}
+
+		if data.PreviousStatus == "" {
+			err := tx.Where("subscription_id = ?", subscription.ID).Delete(&models.SubscriptionHistory{}).Error
+			if err != nil {
+				return err
+			}
+			if err = tx.Delete(&subscription).Error; err != nil {
+				return err
+			}
+
+			subscription.Status = models.SubscriptionStatusUnsubscribed
+			subscription.StatusReason = models.SubscriptionReasonSignUpFailed
+		} else {
+			if subscription.Status != models.SubscriptionStatusPending {
+				// The subscription was reverted before the saga was interrupted
+				return nil
+			}
+
+			err := gormstorage.ChangeSubscriptionStatus(tx, &subscription, data.PreviousStatus,
+				models.SubscriptionReasonSignUpFailed)
+			if err != nil {
+				return err
+			}
+		}
+
+		err := gormstorage.AddSubscriptionEvent(tx, s.keys, outbox.TypeSubscriptionCancelled, &subscription)
+		if err != nil {
+			return err
+		}
+		return s.skipWelcome(tx, data)
+	})
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		// The subscription was deleted, or erased, before the saga was interrupted
+		return nil
+	}
+	return err
+}
+
+// skipWelcome makes sure that the welcome email of the reverted subscription is never
+// sent, unless it has been consumed already. If the saga was interrupted while adding
+// the subscription, the ID of the email is not known, so the latest welcome email of
+// the address is the one skipped.
+func (s *Subscriber) skipWelcome(tx *gorm.DB, data *sagaData) error {
+	query := tx.Where("stream = ? AND type = ?", outbox.StreamEmails, outbox.TypeSubscriptionCreated)
+	if data.WelcomeEventID != 0 {
+		query = query.Where("id = ?", data.WelcomeEventID)
+	} else {
+		query = query.Where("key = ?", s.keys.BlindIndex(strings.ToLower(data.Email))).Order("id DESC")
+	}
 
-	result := s.db.WithContext(ctx).Where("email = ?", saga.Email).Delete(&models.Subscription{})
-	if result.Error != nil {
-		return result.Error
+	var welcome outbox.Event
+	err := query.First(&welcome).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
 	}
-	return nil
+
+	return gormstorage.SkipEmail(tx, &welcome)
 }
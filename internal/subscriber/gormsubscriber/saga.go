@@ -1,126 +1,109 @@
 package gormsubscriber
 
 import (
-	"context"
+	"encoding/json"
 
-	"github.com/google/uuid"
-	"github.com/pkg/errors"
-	"github.com/vladyslavpavlenko/genesis-api-project/internal/storage/gormstorage"
-	"gorm.io/gorm"
+	"github.com/vladyslavpavlenko/genesis-api-project/pkg/envelope"
+	"github.com/vladyslavpavlenko/genesis-api-project/pkg/saga"
 )
 
 const (
-	StatusCompleted  = "completed"
-	StatusInProgress = "in_progress"
-	StatusFailed     = "failed"
+	// SagaSubscribe and SagaUnsubscribe are the names of the subscription sagas.
+	SagaSubscribe   = "subscribe"
+	SagaUnsubscribe = "unsubscribe"
 )
 
-// State represents the current state of the SAGA transaction.
-type State struct {
-	ID             string `gorm:"primary_key"`
-	CurrentStep    int
-	Email          string
-	IsCompensating bool
-	Status         string // StatusCompleted, StatusInProgress, StatusFailed
+// sagaData is the data of the subscription sagas.
+type sagaData struct {
+	Email string `json:"email"`
+	// NormalizedEmail is the blind index of the normalized email.
+	NormalizedEmail string `json:"normalized_email,omitempty"`
+	Locale          string `json:"locale,omitempty"`
+	// SubscriptionID is the ID of the subscription being changed. PreviousStatus is
+	// its status before, empty if it is a new one.
+	SubscriptionID uint   `json:"subscription_id,omitempty"`
+	PreviousStatus string `json:"previous_status,omitempty"`
+	// WelcomeEventID is the ID of the welcome email of the subscription.
+	WelcomeEventID uint `json:"welcome_event_id,omitempty"`
 }
 
-// Step represents a single step in the SAGA transaction.
-type Step struct {
-	Action       func(saga *State, s *Subscriber) error
-	Compensation func(saga *State, s *Subscriber) error
+// sagaCodec encodes the sagaData as JSON with the email encrypted.
+type sagaCodec struct {
+	keys *envelope.Keyring
 }
 
-// Orchestrator manages the execution of SAGA steps.
-type Orchestrator struct {
-	Steps []Step
-	State State
-	db    *gorm.DB
-}
-
-// NewSagaOrchestrator creates a new SAGA Orchestrator.
-func NewSagaOrchestrator(email string, db *gorm.DB) (*Orchestrator, error) {
-	err := db.AutoMigrate(&State{})
+// Encode encodes the data as JSON with the email encrypted.
+func (c sagaCodec) Encode(data sagaData) (string, error) {
+	sealed, err := c.keys.Seal(data.Email)
 	if err != nil {
-		return nil, errors.Wrap(err, "failed to migrate events")
+		return "", err
 	}
+	data.Email = sealed
 
-	return &Orchestrator{
-		Steps: []Step{
-			{
-				Action:       validateSubscription,
-				Compensation: nil,
-			},
-			{
-				Action:       addSubscription,
-				Compensation: deleteSubscription,
-			},
-		},
-		State: State{
-			ID:             uuid.New().String(),
-			CurrentStep:    0,
-			Email:          email,
-			IsCompensating: false,
-			Status:         StatusInProgress,
-		},
-		db: db,
-	}, nil
+	return saga.JSONCodec[sagaData]{}.Encode(data)
 }
 
-// Run runs the SAGA Orchestrator.
-func (o *Orchestrator) Run(s *Subscriber) error {
-	for o.State.CurrentStep < len(o.Steps) {
-		step := o.Steps[o.State.CurrentStep]
-		var err error
-
-		if o.State.IsCompensating {
-			if step.Compensation != nil {
-				err = step.Compensation(&o.State, s)
-			}
-		} else {
-			err = step.Action(&o.State, s)
-		}
-
-		if err != nil {
-			if errors.Is(err, ErrDuplicateSubscription) {
-				o.State.IsCompensating = false
-				o.State.Status = StatusFailed
-				_ = o.saveState()
-				return err
-			}
-
-			if !o.State.IsCompensating {
-				o.State.IsCompensating = true
-				_ = o.saveState()
-			}
-
-			continue
-		}
-
-		if o.State.IsCompensating {
-			o.State.CurrentStep--
-			if o.State.CurrentStep < 0 {
-				o.State.Status = StatusFailed
-				_ = o.saveState()
-				return errors.New("compensation completed")
-			}
-		} else {
-			o.State.CurrentStep++
-		}
-		_ = o.saveState()
+// Decode decodes the data from JSON and decrypts the email.
+func (c sagaCodec) Decode(s string) (sagaData, error) {
+	var data sagaData
+	if err := json.Unmarshal([]byte(s), &data); err != nil {
+		return sagaData{}, err
 	}
 
-	if !o.State.IsCompensating {
-		o.State.Status = StatusCompleted
-		_ = o.saveState()
+	addr, err := c.keys.Open(data.Email)
+	if err != nil {
+		return sagaData{}, err
 	}
+	data.Email = addr
 
-	return nil
+	return data, nil
 }
 
-// saveState saves the SAGA transaction to the database.
-func (o *Orchestrator) saveState() error {
-	ctx, cancel := context.WithTimeout(context.Background(), gormstorage.RequestTimeout)
-	defer cancel()
+// registerSagas registers the subscription sagas of the Subscriber with the
+// orchestrator.
+func (s *Subscriber) registerSagas(o *saga.Orchestrator) error {
+	codec := sagaCodec{keys: s.keys}
+	key := func(data sagaData) string { return data.NormalizedEmail }
 
-	return o.db.WithContext(ctx).Save(&o.State).Error
+	var err error
+	s.subscribe, err = saga.Register(o, saga.Definition[sagaData]{
+		Name: SagaSubscribe,
+		Steps: []saga.Step[sagaData]{
+			{
+				Name:   "validate",
+				Action: s.validateSubscription,
+			},
+			{
+				Name:         "add",
+				Action:       s.addSubscription,
+				Compensation: s.revertSubscription,
+			},
+			{
+				Name:   "activate",
+				Action: s.activateSubscription,
+			},
+		},
+		Codec: codec,
+		Key:   key,
+	})
+	if err != nil {
+		return err
+	}
+
+	s.unsubscribe, err = saga.Register(o, saga.Definition[sagaData]{
+		Name: SagaUnsubscribe,
+		Steps: []saga.Step[sagaData]{
+			{
+				Name:   "find",
+				Action: s.findSubscription,
+			},
+			{
+				Name:   "cancel",
+				Action: s.cancelSubscription,
+			},
+		},
+		Codec: codec,
+		Key:   key,
+	})
+	return err
 }
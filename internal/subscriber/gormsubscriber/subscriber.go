@@ -2,11 +2,15 @@ package gormsubscriber
 
 import (
 	"context"
+	"fmt"
 
+	"github.com/vladyslavpavlenko/genesis-api-project/pkg/envelope"
 	"github.com/vladyslavpavlenko/genesis-api-project/pkg/logger"
+	"github.com/vladyslavpavlenko/genesis-api-project/pkg/saga"
 	"go.uber.org/zap"
 
 	"github.com/pkg/errors"
+	"github.com/vladyslavpavlenko/genesis-api-project/internal/email"
 	"github.com/vladyslavpavlenko/genesis-api-project/internal/models"
 	"github.com/vladyslavpavlenko/genesis-api-project/internal/storage/gormstorage"
 	"gorm.io/gorm"
@@ -15,75 +19,116 @@ import (
 var (
 	ErrDuplicateSubscription   = errors.New("subscription already exists")
 	ErrNonExistentSubscription = errors.New("subscription does not exist")
+	ErrSuppressedAddress       = errors.New("email address is suppressed")
 	ErrInternal                = errors.New("internal error")
 )
 
-type Subscriber struct {
-	db *gorm.DB
-	l  *logger.Logger
+// fetcher fetches the current exchange rate.
+type fetcher interface {
+	Fetch(ctx context.Context, base, target string) (string, error)
 }
 
-// NewSubscriber creates a new Subscriber.
-func NewSubscriber(db *gorm.DB, l *logger.Logger) (*Subscriber, error) {
-	return &Subscriber{
-		db: db,
-		l:  l,
-	}, nil
+type Subscriber struct {
+	db          *gorm.DB
+	normalizer  *email.Normalizer
+	keys        *envelope.Keyring
+	fetcher     fetcher
+	subscribe   *saga.Saga[sagaData]
+	unsubscribe *saga.Saga[sagaData]
+	l           *logger.Logger
 }
 
-// AddSubscription creates a new models.Subscription record.
-func (s *Subscriber) AddSubscription(email string) error {
-	orchestrator, err := NewSagaOrchestrator(email, s.db)
-	if err != nil {
-		s.l.Error("failed to create orchestrator", zap.Error(err))
-		return ErrInternal
+// NewSubscriber creates a new Subscriber. The email addresses are canonicalized by
+// the normalizer, and stored encrypted with the keyring. The subscriptions are
+// changed by the sagas registered with the orchestrator. The welcome emails of the
+// new subscribers carry the current rate fetched by f, if it is not nil.
+func NewSubscriber(db *gorm.DB, normalizer *email.Normalizer, keys *envelope.Keyring, f fetcher,
+	sagas *saga.Orchestrator, l *logger.Logger,
+) (*Subscriber, error) {
+	s := &Subscriber{
+		db:         db,
+		normalizer: normalizer,
+		keys:       keys,
+		fetcher:    f,
+		l:          l,
 	}
 
-	err = orchestrator.Run(s)
+	if err := s.registerSagas(sagas); err != nil {
+		return nil, fmt.Errorf("failed to register sagas: %w", err)
+	}
+
+	return s, nil
+}
+
+// AddSubscription creates a new models.Subscription record. The emails are sent to
+// the subscriber in the given locale.
+func (s *Subscriber) AddSubscription(emailAddr, locale string) error {
+	data := sagaData{Email: emailAddr, Locale: locale}
+
+	err := s.subscribe.Run(context.Background(), &data)
+	var compensated *saga.CompensatedError
+	if errors.As(err, &compensated) {
+		err = compensated.Err
+	}
 	if err != nil {
 		if errors.Is(err, ErrDuplicateSubscription) {
 			s.l.Info(ErrDuplicateSubscription.Error(),
-				zap.String("email", email),
+				zap.String("email", email.Email(emailAddr).Masked()),
 			)
 			return ErrDuplicateSubscription
 		}
 
+		if errors.Is(err, ErrSuppressedAddress) {
+			s.l.Info(ErrSuppressedAddress.Error(),
+				zap.String("email", email.Email(emailAddr).Masked()),
+			)
+			return ErrSuppressedAddress
+		}
+
+		if errors.Is(err, ErrorInvalidEmail) {
+			s.l.Info(err.Error(),
+				zap.String("email", email.Email(emailAddr).Masked()),
+			)
+			return err
+		}
+
 		s.l.Error("error adding subscription",
-			zap.String("email", email),
+			zap.String("email", email.Email(emailAddr).Masked()),
 			zap.Error(err),
 		)
 
 		return ErrInternal
 	}
 
-	s.l.Info("new subscription", zap.String("email", email))
+	s.l.Info("new subscription",
+		zap.String("email", email.Email(emailAddr).Masked()),
+		zap.Bool("returning", data.PreviousStatus != ""),
+	)
 
 	return nil
 }
 
-// DeleteSubscription deletes a models.Subscription record.
-func (s *Subscriber) DeleteSubscription(email string) error {
-	ctx, cancel := context.WithTimeout(context.Background(), gormstorage.RequestTimeout)
-	defer cancel()
-
-	result := s.db.WithContext(ctx).Where("email = ?", email).Delete(&models.Subscription{})
-	if result.Error != nil {
+// DeleteSubscription unsubscribes the email address or any address with the same
+// normalized form. The models.Subscription record is kept along with its history.
+func (s *Subscriber) DeleteSubscription(emailAddr string) error {
+	err := s.unsubscribe.Run(context.Background(), &sagaData{Email: emailAddr})
+	if errors.Is(err, ErrNonExistentSubscription) {
+		return ErrNonExistentSubscription
+	}
+	if err != nil {
 		s.l.Error("failed to delete subscription",
-			zap.String("email", email),
-			zap.Error(result.Error))
+			zap.String("email", email.Email(emailAddr).Masked()),
+			zap.Error(err))
 		return ErrInternal
 	}
 
-	if result.RowsAffected == 0 {
-		return ErrNonExistentSubscription
-	}
-
-	s.l.Info("subscription deleted", zap.String("email", email))
+	s.l.Info("subscription deleted", zap.String("email", email.Email(emailAddr).Masked()))
 
 	return nil
 }
 
-// GetSubscriptions returns a paginated list of subscriptions. Limit specifies the number of records to be retrieved
+// GetSubscriptions returns a paginated list of the active subscriptions with the
+// email addresses decrypted. Limit specifies the number of records to be retrieved
 // Limit conditions can be canceled by using `Limit(-1)`. Offset specify the number of records to skip before starting
 // to return the records. Offset conditions can be canceled by using `Offset(-1)`.
 func (s *Subscriber) GetSubscriptions(limit, offset int) ([]models.Subscription, error) {
@@ -91,10 +136,19 @@ func (s *Subscriber) GetSubscriptions(limit, offset int) ([]models.Subscription,
 	defer cancel()
 
 	var subscriptions []models.Subscription
-	result := s.db.WithContext(ctx).Limit(limit).Offset(offset).Find(&subscriptions)
+	result := s.db.WithContext(ctx).Where("status = ?", models.SubscriptionStatusActive).
+		Order("id").Limit(limit).Offset(offset).Find(&subscriptions)
 	if result.Error != nil {
 		return nil, result.Error
 	}
 
+	for i := range subscriptions {
+		addr, err := s.keys.Open(subscriptions[i].Email)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decrypt subscription %d: %w", subscriptions[i].ID, err)
+		}
+		subscriptions[i].Email = addr
+	}
+
 	return subscriptions, nil
 }
@@ -0,0 +1,505 @@
+package gormsubscriber_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/vladyslavpavlenko/genesis-api-project/internal/email"
+	"github.com/vladyslavpavlenko/genesis-api-project/internal/email/consumer"
+	"github.com/vladyslavpavlenko/genesis-api-project/internal/models"
+	"github.com/vladyslavpavlenko/genesis-api-project/internal/outbox"
+	"github.com/vladyslavpavlenko/genesis-api-project/internal/storage/gormstorage"
+	"github.com/vladyslavpavlenko/genesis-api-project/internal/storage/gormstorage/gormstoragetest"
+	"github.com/vladyslavpavlenko/genesis-api-project/internal/subscriber/gormsubscriber"
+	"github.com/vladyslavpavlenko/genesis-api-project/pkg/envelope"
+	"github.com/vladyslavpavlenko/genesis-api-project/pkg/logger"
+	"github.com/vladyslavpavlenko/genesis-api-project/pkg/saga"
+	"gorm.io/gorm"
+)
+
+func newSubscriber(t *testing.T, policy string) (*gormsubscriber.Subscriber, *gormstorage.Connection) {
+	t.Helper()
+	s, conn, _ := newSubscriberWithKeys(t, policy, nil)
+	return s, conn
+}
+
+func newSubscriberWithKeys(t *testing.T, policy string, keys *envelope.Keyring,
+) (*gormsubscriber.Subscriber, *gormstorage.Connection, *saga.Orchestrator) {
+	t.Helper()
+
+	conn := gormstoragetest.NewConnection(t)
+	conn.UseKeyring(keys)
+
+	normalizer, err := email.NewNormalizer(policy)
+	require.NoError(t, err)
+
+	require.NoError(t, conn.AddSuppression(&models.Suppression{Email: "suppressed@example.com"}))
+
+	sagas := saga.NewOrchestrator(conn, logger.New(false))
+	s, err := gormsubscriber.NewSubscriber(conn.DB(), normalizer, keys, nil, sagas, logger.New(false))
+	require.NoError(t, err)
+
+	return s, conn, sagas
+}
+
+func TestSubscriber_AddSubscription(t *testing.T) {
+	s, _ := newSubscriber(t, email.PlusTagStrip)
+
+	require.NoError(t, s.AddSubscription("Alice+news@Example.com", "uk"))
+
+	subscriptions, err := s.GetSubscriptions(10, 0)
+	require.NoError(t, err)
+	require.Len(t, subscriptions, 1)
+	assert.Equal(t, "Alice+news@example.com", subscriptions[0].Email)
+	assert.Equal(t, "alice@example.com", subscriptions[0].NormalizedEmail)
+	assert.Equal(t, "uk", subscriptions[0].Locale)
+
+	err = s.AddSubscription("alice@EXAMPLE.com", "en")
+	assert.ErrorIs(t, err, gormsubscriber.ErrDuplicateSubscription)
+}
+
+func TestSubscriber_AddSubscriptionRejected(t *testing.T) {
+	s, _ := newSubscriber(t, email.PlusTagReject)
+
+	assert.ErrorIs(t, s.AddSubscription("suppressed@example.com", "en"), gormsubscriber.ErrSuppressedAddress)
+	assert.ErrorIs(t, s.AddSubscription("alice+news@example.com", "en"), gormsubscriber.ErrorInvalidEmail)
+	assert.ErrorIs(t, s.AddSubscription("not an email", "en"), gormsubscriber.ErrorInvalidEmail)
+
+	subscriptions, err := s.GetSubscriptions(10, 0)
+	require.NoError(t, err)
+	assert.Empty(t, subscriptions)
+}
+
+func TestSubscriber_DeleteSubscription(t *testing.T) {
+	s, _ := newSubscriber(t, email.PlusTagKeep)
+
+	require.NoError(t, s.AddSubscription("alice@example.com", "en"))
+
+	require.NoError(t, s.DeleteSubscription("ALICE@example.com"))
+	assert.ErrorIs(t, s.DeleteSubscription("alice@example.com"), gormsubscriber.ErrNonExistentSubscription)
+}
+
+func TestSubscriber_Resubscribe(t *testing.T) {
+	s, conn := newSubscriber(t, email.PlusTagKeep)
+
+	require.NoError(t, s.AddSubscription("alice@example.com", "en"))
+	require.NoError(t, s.DeleteSubscription("alice@example.com"))
+
+	subscriptions, err := s.GetSubscriptions(10, 0)
+	require.NoError(t, err)
+	assert.Empty(t, subscriptions)
+
+	var unsubscribed models.Subscription
+	require.NoError(t, conn.DB().First(&unsubscribed).Error)
+	assert.Equal(t, models.SubscriptionStatusUnsubscribed, unsubscribed.Status)
+	assert.Equal(t, models.SubscriptionReasonUserRequest, unsubscribed.StatusReason)
+
+	require.NoError(t, s.AddSubscription("Alice@example.com", "uk"))
+
+	subscriptions, err = s.GetSubscriptions(10, 0)
+	require.NoError(t, err)
+	require.Len(t, subscriptions, 1)
+	assert.Equal(t, unsubscribed.ID, subscriptions[0].ID)
+	assert.Equal(t, "uk", subscriptions[0].Locale)
+	assert.Equal(t, models.SubscriptionStatusActive, subscriptions[0].Status)
+
+	history, err := conn.GetSubscriptionHistory(unsubscribed.ID)
+	require.NoError(t, err)
+
+	var changes [][2]string
+	for _, h := range history {
+		changes = append(changes, [2]string{h.FromStatus, h.ToStatus})
+	}
+	assert.Equal(t, [][2]string{
+		{"", models.SubscriptionStatusPending},
+		{models.SubscriptionStatusPending, models.SubscriptionStatusActive},
+		{models.SubscriptionStatusActive, models.SubscriptionStatusUnsubscribed},
+		{models.SubscriptionStatusUnsubscribed, models.SubscriptionStatusPending},
+		{models.SubscriptionStatusPending, models.SubscriptionStatusActive},
+	}, changes)
+	assert.Equal(t, models.SubscriptionReasonResubscribe, history[3].Reason)
+}
+
+func TestSubscriber_Suppressed(t *testing.T) {
+	s, conn := newSubscriber(t, email.PlusTagKeep)
+
+	require.NoError(t, s.AddSubscription("bob@example.com", "en"))
+	require.NoError(t, conn.AddSuppression(&models.Suppression{
+		Email:  "Bob@example.com",
+		Reason: models.SuppressionReasonComplaint,
+	}))
+
+	subscriptions, err := s.GetSubscriptions(10, 0)
+	require.NoError(t, err)
+	assert.Empty(t, subscriptions)
+
+	var suppressed models.Subscription
+	require.NoError(t, conn.DB().First(&suppressed).Error)
+	assert.Equal(t, models.SubscriptionStatusSuppressed, suppressed.Status)
+	assert.Equal(t, models.SuppressionReasonComplaint, suppressed.StatusReason)
+
+	assert.ErrorIs(t, s.AddSubscription("bob@example.com", "en"), gormsubscriber.ErrSuppressedAddress)
+	assert.ErrorIs(t, s.DeleteSubscription("bob@example.com"), gormsubscriber.ErrNonExistentSubscription)
+
+	// Once the suppression is lifted, the subscriber can come back
+	_, err = conn.DeleteSuppression("bob@example.com")
+	require.NoError(t, err)
+	require.NoError(t, s.AddSubscription("bob@example.com", "en"))
+
+	var count int64
+	require.NoError(t, conn.DB().Model(&models.Subscription{}).Count(&count).Error)
+	assert.Equal(t, int64(1), count)
+}
+
+func TestSubscriber_Encrypted(t *testing.T) {
+	keys, err := envelope.New([]envelope.Key{{ID: "k1", Secret: bytes.Repeat([]byte{1}, envelope.KeySize)}},
+		bytes.Repeat([]byte{2}, envelope.KeySize))
+	require.NoError(t, err)
+
+	s, conn, _ := newSubscriberWithKeys(t, email.PlusTagKeep, keys)
+
+	require.NoError(t, s.AddSubscription("Alice@example.com", "en"))
+	assert.ErrorIs(t, s.AddSubscription("alice@EXAMPLE.com", "en"), gormsubscriber.ErrDuplicateSubscription)
+	assert.ErrorIs(t, s.AddSubscription("suppressed@example.com", "en"), gormsubscriber.ErrSuppressedAddress)
+
+	var stored models.Subscription
+	require.NoError(t, conn.DB().First(&stored).Error)
+	assert.True(t, strings.HasPrefix(stored.Email, "enc:v1:k1:"), stored.Email)
+	assert.Equal(t, keys.BlindIndex("alice@example.com"), stored.NormalizedEmail)
+	assert.Equal(t, keys.BlindIndex("alice@example.com"), stored.EmailIndex)
+
+	var instance saga.Instance
+	require.NoError(t, conn.DB().Order("created_at").First(&instance).Error)
+	assert.Contains(t, instance.Data, `"email":"enc:v1:k1:`)
+	assert.Equal(t, keys.BlindIndex("alice@example.com"), instance.Key)
+
+	var steps []saga.StepLog
+	require.NoError(t, conn.DB().Find(&steps).Error)
+	require.NotEmpty(t, steps)
+	for _, step := range steps {
+		assert.NotContains(t, step.Input+step.Output, "Alice", step.Step)
+	}
+
+	subscriptions, err := s.GetSubscriptions(10, 0)
+	require.NoError(t, err)
+	require.Len(t, subscriptions, 1)
+	assert.Equal(t, "Alice@example.com", subscriptions[0].Email)
+
+	require.NoError(t, conn.AddSuppression(&models.Suppression{
+		Email:  "alice@example.com",
+		Reason: models.SuppressionReasonComplaint,
+	}))
+	require.NoError(t, conn.DB().First(&stored).Error)
+	assert.Equal(t, models.SubscriptionStatusSuppressed, stored.Status)
+
+	_, err = conn.DeleteSuppression("alice@example.com")
+	require.NoError(t, err)
+	require.NoError(t, s.AddSubscription("alice@example.com", "en"))
+	require.NoError(t, s.DeleteSubscription("ALICE@example.com"))
+	assert.ErrorIs(t, s.DeleteSubscription("alice@example.com"), gormsubscriber.ErrNonExistentSubscription)
+}
+
+func TestSubscriber_RecoverSagas(t *testing.T) {
+	s, conn, sagas := newSubscriberWithKeys(t, email.PlusTagKeep, nil)
+	db := conn.DB()
+
+	newSaga := func(id string, step int, data string) *saga.Instance {
+		return &saga.Instance{ID: id, Name: gormsubscriber.SagaSubscribe, CurrentStep: step,
+			Status: saga.StatusInProgress, Data: data}
+	}
+
+	// Interrupted after the validation
+	validated := newSaga("validated", 1, `{"email":"carol@example.com","normalized_email":"carol@example.com"}`)
+	require.NoError(t, db.Create(validated).Error)
+
+	// Interrupted after the subscription was added, but before the saga was saved
+	pending := models.Subscription{Email: "dave@example.com", NormalizedEmail: "dave@example.com",
+		EmailIndex: "dave@example.com", Status: models.SubscriptionStatusPending}
+	require.NoError(t, db.Create(&pending).Error)
+	added := newSaga("added", 1, `{"email":"dave@example.com","normalized_email":"dave@example.com"}`)
+	require.NoError(t, db.Create(added).Error)
+
+	// Interrupted while compensating
+	reverted := models.Subscription{Email: "erin@example.com", NormalizedEmail: "erin@example.com",
+		EmailIndex: "erin@example.com", Status: models.SubscriptionStatusPending}
+	require.NoError(t, db.Create(&reverted).Error)
+	compensating := newSaga("compensating", 1, fmt.Sprintf(
+		`{"email":"erin@example.com","normalized_email":"erin@example.com","subscription_id":%d}`, reverted.ID))
+	compensating.Compensating, compensating.Error = true, "failed to activate"
+	require.NoError(t, db.Create(compensating).Error)
+
+	// Still being run by another Subscriber
+	expiresAt := time.Now().Add(time.Hour)
+	leased := newSaga("leased", 1, `{"email":"frank@example.com","normalized_email":"frank@example.com"}`)
+	leased.LeaseOwner, leased.LeaseExpiresAt = "other", &expiresAt
+	require.NoError(t, db.Create(leased).Error)
+
+	recovered, err := sagas.RecoverSagas()
+	require.NoError(t, err)
+	assert.Equal(t, 3, recovered)
+
+	subscriptions, err := s.GetSubscriptions(10, 0)
+	require.NoError(t, err)
+	var emails []string
+	for _, sub := range subscriptions {
+		emails = append(emails, sub.Email)
+	}
+	assert.ElementsMatch(t, []string{"carol@example.com", "dave@example.com"}, emails)
+
+	history, err := conn.GetSubscriptionHistory(pending.ID)
+	require.NoError(t, err)
+	require.Len(t, history, 1)
+	assert.Equal(t, models.SubscriptionStatusActive, history[0].ToStatus)
+
+	assert.ErrorIs(t, db.First(&models.Subscription{}, reverted.ID).Error, gorm.ErrRecordNotFound)
+
+	statuses := map[string]string{}
+	var instances []saga.Instance
+	require.NoError(t, db.Find(&instances).Error)
+	for _, instance := range instances {
+		statuses[instance.ID] = instance.Status
+	}
+	assert.Equal(t, map[string]string{
+		"validated":    saga.StatusCompleted,
+		"added":        saga.StatusCompleted,
+		"compensating": saga.StatusFailed,
+		"leased":       saga.StatusInProgress,
+	}, statuses)
+
+	// Nothing is left to recover, even for another replica
+	other := saga.NewOrchestrator(conn, logger.New(false))
+	_, err = gormsubscriber.NewSubscriber(db, mustNormalizer(t), nil, nil, other, logger.New(false))
+	require.NoError(t, err)
+	recovered, err = other.RecoverSagas()
+	require.NoError(t, err)
+	assert.Zero(t, recovered)
+}
+
+func TestSubscriber_RevertSkipsWelcome(t *testing.T) {
+	_, conn, sagas := newSubscriberWithKeys(t, email.PlusTagKeep, nil)
+	db := conn.DB()
+
+	welcome := func(addr string) *outbox.Event {
+		event, err := outbox.NewEvent(outbox.Data{Type: outbox.TypeSubscriptionCreated, Email: addr}, nil)
+		require.NoError(t, err)
+		require.NoError(t, conn.AddEvent(event))
+		return event
+	}
+	compensating := func(id, data string) {
+		instance := &saga.Instance{ID: id, Name: gormsubscriber.SagaSubscribe, CurrentStep: 1,
+			Status: saga.StatusInProgress, Data: data, Compensating: true, Error: "failed to activate"}
+		require.NoError(t, db.Create(instance).Error)
+	}
+
+	// A new subscription, whose welcome email is known
+	erin := models.Subscription{Email: "erin@example.com", NormalizedEmail: "erin@example.com",
+		EmailIndex: "erin@example.com", Status: models.SubscriptionStatusPending}
+	require.NoError(t, db.Create(&erin).Error)
+	erinWelcome := welcome("erin@example.com")
+	compensating("erin", fmt.Sprintf(`{"email":"erin@example.com","normalized_email":"erin@example.com",`+
+		`"subscription_id":%d,"welcome_event_id":%d}`, erin.ID, erinWelcome.ID))
+
+	// A resubscription added before the saga was interrupted, so the welcome email is
+	// found by the address
+	gina := models.Subscription{Email: "gina@example.com", NormalizedEmail: "gina@example.com",
+		EmailIndex: "gina@example.com", Status: models.SubscriptionStatusPending}
+	require.NoError(t, db.Create(&gina).Error)
+	welcome("gina@example.com")
+	ginaWelcome := welcome("gina@example.com")
+	compensating("gina", fmt.Sprintf(`{"email":"gina@example.com","normalized_email":"gina@example.com",`+
+		`"subscription_id":%d,"previous_status":"unsubscribed"}`, gina.ID))
+
+	// A welcome email that has been sent already
+	hank := models.Subscription{Email: "hank@example.com", NormalizedEmail: "hank@example.com",
+		EmailIndex: "hank@example.com", Status: models.SubscriptionStatusPending}
+	require.NoError(t, db.Create(&hank).Error)
+	hankWelcome := welcome("hank@example.com")
+	require.NoError(t, conn.ConsumeOnce(&consumer.ConsumedEvent{ID: hankWelcome.ID, Data: hankWelcome.Data,
+		ConsumedAt: time.Now()}, func() error { return nil }))
+	compensating("hank", fmt.Sprintf(`{"email":"hank@example.com","normalized_email":"hank@example.com",`+
+		`"subscription_id":%d,"welcome_event_id":%d}`, hank.ID, hankWelcome.ID))
+
+	recovered, err := sagas.RecoverSagas()
+	require.NoError(t, err)
+	assert.Equal(t, 3, recovered)
+
+	assert.ErrorIs(t, db.First(&models.Subscription{}, erin.ID).Error, gorm.ErrRecordNotFound)
+	require.NoError(t, db.First(&gina, gina.ID).Error)
+	assert.Equal(t, models.SubscriptionStatusUnsubscribed, gina.Status)
+
+	// The welcome emails of the reverted subscriptions are never sent
+	for _, event := range []*outbox.Event{erinWelcome, ginaWelcome} {
+		err = conn.ConsumeOnce(&consumer.ConsumedEvent{ID: event.ID, ConsumedAt: time.Now()}, func() error {
+			t.Errorf("welcome email %d sent", event.ID)
+			return nil
+		})
+		assert.ErrorIs(t, err, consumer.ErrEventAlreadyConsumed)
+	}
+
+	var consumed []consumer.ConsumedEvent
+	require.NoError(t, db.Order("id").Find(&consumed).Error)
+	require.Len(t, consumed, 3)
+	for _, ce := range consumed {
+		assert.Equal(t, consumer.ConsumedEventStatusDone, ce.Status)
+	}
+}
+
+func TestSubscriber_SagaSteps(t *testing.T) {
+	s, conn := newSubscriber(t, email.PlusTagKeep)
+
+	require.NoError(t, s.AddSubscription("alice@example.com", "en"))
+	require.NoError(t, s.DeleteSubscription("alice@example.com"))
+	assert.ErrorIs(t, s.AddSubscription("suppressed@example.com", "en"), gormsubscriber.ErrSuppressedAddress)
+
+	var instances []saga.Instance
+	require.NoError(t, conn.DB().Order("created_at").Find(&instances).Error)
+	require.Len(t, instances, 3)
+
+	var names, statuses []string
+	for _, instance := range instances {
+		names = append(names, instance.Name)
+		statuses = append(statuses, instance.Status)
+	}
+	assert.Equal(t, []string{gormsubscriber.SagaSubscribe, gormsubscriber.SagaUnsubscribe,
+		gormsubscriber.SagaSubscribe}, names)
+	assert.Equal(t, []string{saga.StatusCompleted, saga.StatusCompleted, saga.StatusFailed}, statuses)
+	assert.Equal(t, gormsubscriber.ErrSuppressedAddress.Error(), instances[2].Error)
+
+	var steps []saga.StepLog
+	require.NoError(t, conn.DB().Where("saga_id = ?", instances[0].ID).Order("id").Find(&steps).Error)
+	require.Len(t, steps, 3)
+	for i, name := range []string{"validate", "add", "activate"} {
+		assert.Equal(t, name, steps[i].Step)
+		assert.Equal(t, saga.PhaseAction, steps[i].Phase)
+		assert.Empty(t, steps[i].Error)
+	}
+	assert.Contains(t, steps[1].Output, `"subscription_id":1`)
+}
+
+func mustNormalizer(t *testing.T) *email.Normalizer {
+	t.Helper()
+	normalizer, err := email.NewNormalizer(email.PlusTagKeep)
+	require.NoError(t, err)
+	return normalizer
+}
+
+type fetcherFunc func(ctx context.Context, base, target string) (string, error)
+
+func (f fetcherFunc) Fetch(ctx context.Context, base, target string) (string, error) {
+	return f(ctx, base, target)
+}
+
+func TestSubscriber_WelcomeEvent(t *testing.T) {
+	keys, err := envelope.New([]envelope.Key{{ID: "k1", Secret: bytes.Repeat([]byte{1}, envelope.KeySize)}},
+		bytes.Repeat([]byte{2}, envelope.KeySize))
+	require.NoError(t, err)
+
+	conn := gormstoragetest.NewConnection(t)
+	conn.UseKeyring(keys)
+
+	price := "41.5"
+	fetcher := fetcherFunc(func(_ context.Context, base, target string) (string, error) {
+		assert.Equal(t, "USD", base)
+		assert.Equal(t, "UAH", target)
+		if price == "" {
+			return "", errors.New("unavailable")
+		}
+		return price, nil
+	})
+
+	s, err := gormsubscriber.NewSubscriber(conn.DB(), mustNormalizer(t), keys, fetcher,
+		saga.NewOrchestrator(conn, logger.New(false)), logger.New(false))
+	require.NoError(t, err)
+
+	require.NoError(t, s.AddSubscription("Alice@example.com", "uk"))
+	assert.ErrorIs(t, s.AddSubscription("alice@example.com", "en"), gormsubscriber.ErrDuplicateSubscription)
+
+	// The welcome email is sent without the rate if it cannot be fetched
+	require.NoError(t, s.DeleteSubscription("alice@example.com"))
+	price = ""
+	require.NoError(t, s.AddSubscription("alice@example.com", "en"))
+
+	var events []outbox.Event
+	require.NoError(t, conn.DB().Where("stream = ?", outbox.StreamEmails).Order("id").Find(&events).Error)
+	require.Len(t, events, 2)
+
+	var welcomes []outbox.Data
+	for _, event := range events {
+		assert.Equal(t, outbox.TypeSubscriptionCreated, event.Type)
+		assert.Equal(t, keys.BlindIndex("alice@example.com"), event.Key)
+
+		value, err := keys.Open(event.Data)
+		require.NoError(t, err)
+		data, err := outbox.DeserializeData([]byte(value))
+		require.NoError(t, err)
+		welcomes = append(welcomes, data)
+	}
+
+	assert.Equal(t, "Alice@example.com", welcomes[0].Email)
+	assert.Equal(t, "uk", welcomes[0].Locale)
+	assert.InDelta(t, 41.5, welcomes[0].Rate, 1e-9)
+	assert.Equal(t, "en", welcomes[1].Locale)
+	assert.Zero(t, welcomes[1].Rate)
+}
+
+func TestSubscriber_SubscriptionEvents(t *testing.T) {
+	keys, err := envelope.New([]envelope.Key{{ID: "k1", Secret: bytes.Repeat([]byte{1}, envelope.KeySize)}},
+		bytes.Repeat([]byte{2}, envelope.KeySize))
+	require.NoError(t, err)
+
+	s, conn, _ := newSubscriberWithKeys(t, email.PlusTagKeep, keys)
+
+	require.NoError(t, s.AddSubscription("Alice@Example.com", "uk"))
+	require.NoError(t, s.DeleteSubscription("alice@example.com"))
+	require.NoError(t, s.AddSubscription("alice@example.com", "en"))
+	require.NoError(t, conn.AddSuppression(&models.Suppression{Email: "alice@example.com",
+		Reason: models.SuppressionReasonComplaint}))
+
+	var events []outbox.Event
+	require.NoError(t, conn.DB().Where("stream = ?", outbox.StreamSubscriptions).Order("id").Find(&events).Error)
+
+	var got []outbox.SubscriptionEvent
+	for _, event := range events {
+		// The events of a subscriber share the key, so they are published in order
+		assert.Equal(t, keys.BlindIndex("alice@example.com"), event.Key)
+
+		value, err := keys.Open(event.Data)
+		require.NoError(t, err)
+		var e outbox.SubscriptionEvent
+		require.NoError(t, json.Unmarshal([]byte(value), &e))
+		assert.Equal(t, event.Type, e.Type)
+		assert.Equal(t, outbox.SubscriptionEventVersion, e.Version)
+		assert.NotEmpty(t, e.ID)
+		got = append(got, e)
+	}
+
+	// The address and the locale are the ones the subscription has at the time
+	type change struct{ Type, Email, Locale, Status, Reason string }
+	var changes []change
+	for _, e := range got {
+		assert.Equal(t, got[0].SubscriptionID, e.SubscriptionID)
+		changes = append(changes, change{e.Type, e.Email, e.Locale, e.Status, e.Reason})
+	}
+	first, second := "Alice@example.com", "alice@example.com"
+	assert.Equal(t, []change{
+		{outbox.TypeSubscriptionCreated, first, "uk", models.SubscriptionStatusPending, models.SubscriptionReasonSignUp},
+		{outbox.TypeSubscriptionConfirmed, first, "uk", models.SubscriptionStatusActive,
+			models.SubscriptionReasonSubscribed},
+		{outbox.TypeSubscriptionCancelled, first, "uk", models.SubscriptionStatusUnsubscribed,
+			models.SubscriptionReasonUserRequest},
+		{outbox.TypeSubscriptionCreated, second, "en", models.SubscriptionStatusPending,
+			models.SubscriptionReasonResubscribe},
+		{outbox.TypeSubscriptionConfirmed, second, "en", models.SubscriptionStatusActive,
+			models.SubscriptionReasonSubscribed},
+		{outbox.TypeSubscriptionCancelled, second, "en", models.SubscriptionStatusSuppressed,
+			models.SuppressionReasonComplaint},
+	}, changes)
+}
@@ -0,0 +1,102 @@
+package chart
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"math"
+)
+
+// canvas draws antialiased shapes by blending the colors with the coverage of
+// each pixel.
+type canvas struct {
+	img *image.RGBA
+}
+
+func newCanvas(width, height int, background color.Color) *canvas {
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	if background != nil {
+		draw.Draw(img, img.Bounds(), image.NewUniform(background), image.Point{}, draw.Src)
+	}
+	return &canvas{img: img}
+}
+
+// blend blends the color into the pixel with the given coverage in [0, 1].
+func (c *canvas) blend(x, y int, col color.Color, coverage float64) {
+	if !(image.Point{X: x, Y: y}).In(c.img.Bounds()) || coverage <= 0 {
+		return
+	}
+	coverage = math.Min(coverage, 1)
+
+	sr, sg, sb, sa := col.RGBA()
+	a := float64(sa) / 0xffff * coverage
+
+	i := c.img.PixOffset(x, y)
+	pix := c.img.Pix[i : i+4 : i+4]
+	mix := func(dst uint8, src uint32) uint8 {
+		// The source components are premultiplied by their alpha
+		return uint8(math.Round(float64(dst)*(1-a) + float64(src>>8)*coverage))
+	}
+	pix[0] = mix(pix[0], sr)
+	pix[1] = mix(pix[1], sg)
+	pix[2] = mix(pix[2], sb)
+	pix[3] = uint8(math.Round(float64(pix[3])*(1-a) + 0xff*a))
+}
+
+// segment draws a line segment of the given width.
+func (c *canvas) segment(x0, y0, x1, y1, width float64, col color.Color) {
+	half := width / 2
+	minX, maxX := int(math.Floor(math.Min(x0, x1)-half-1)), int(math.Ceil(math.Max(x0, x1)+half+1))
+	minY, maxY := int(math.Floor(math.Min(y0, y1)-half-1)), int(math.Ceil(math.Max(y0, y1)+half+1))
+
+	for y := minY; y <= maxY; y++ {
+		for x := minX; x <= maxX; x++ {
+			d := distToSegment(float64(x)+0.5, float64(y)+0.5, x0, y0, x1, y1)
+			c.blend(x, y, col, half+0.5-d)
+		}
+	}
+}
+
+// disc draws a filled circle.
+func (c *canvas) disc(cx, cy, r float64, col color.Color) {
+	for y := int(cy - r - 1); y <= int(cy+r+1); y++ {
+		for x := int(cx - r - 1); x <= int(cx+r+1); x++ {
+			d := math.Hypot(float64(x)+0.5-cx, float64(y)+0.5-cy)
+			c.blend(x, y, col, r+0.5-d)
+		}
+	}
+}
+
+// fillBelow fills the area between the polyline and the baseline.
+func (c *canvas) fillBelow(line []vec, baseline float64, col color.Color) {
+	for i := 1; i < len(line); i++ {
+		a, b := line[i-1], line[i]
+		for x := int(math.Floor(a.X)); x < int(math.Ceil(b.X)); x++ {
+			cx := float64(x) + 0.5
+			if cx < a.X || cx >= b.X {
+				continue
+			}
+			t := (cx - a.X) / (b.X - a.X)
+			top := a.Y + t*(b.Y-a.Y)
+
+			for y := int(math.Floor(top)); float64(y) < baseline; y++ {
+				// Antialias the top edge
+				c.blend(x, y, col, float64(y)+1-top)
+			}
+		}
+	}
+}
+
+// distToSegment returns the distance from the point to the segment.
+func distToSegment(px, py, x0, y0, x1, y1 float64) float64 {
+	dx, dy := x1-x0, y1-y0
+	lenSq := dx*dx + dy*dy
+	if lenSq == 0 {
+		return math.Hypot(px-x0, py-y0)
+	}
+
+	t := ((px-x0)*dx + (py-y0)*dy) / lenSq
+	t = math.Max(0, math.Min(1, t))
+
+	return math.Hypot(px-(x0+t*dx), py-(y0+t*dy))
+}
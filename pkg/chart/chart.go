@@ -0,0 +1,141 @@
+// Package chart draws line charts of time series as PNG images. It has no
+// dependencies beyond the standard library, so the charts carry no text.
+package chart
+
+import (
+	"errors"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"math"
+	"sort"
+	"time"
+)
+
+// ErrNotEnoughData is returned when drawing a chart of less than two points.
+var ErrNotEnoughData = errors.New("chart needs at least two points")
+
+// Point is a single value of a time series.
+type Point struct {
+	Time  time.Time
+	Value float64
+}
+
+// Options holds the chart appearance.
+type Options struct {
+	Width   int
+	Height  int
+	Padding int
+
+	Background color.Color
+	Line       color.Color
+	// Fill is the color of the area below the line. It is not drawn if nil.
+	Fill color.Color
+	// Grid is the color of the horizontal grid lines. They are not drawn if nil.
+	Grid      color.Color
+	LineWidth float64
+	// MarkerRadius is the radius of the marker of the last point. It is not drawn
+	// if zero.
+	MarkerRadius float64
+}
+
+// DefaultOptions returns the options of a 600x200 chart fitting an email.
+func DefaultOptions() Options {
+	return Options{
+		Width:        600,
+		Height:       200,
+		Padding:      12,
+		Background:   color.White,
+		Line:         color.RGBA{R: 0x09, G: 0x69, B: 0xda, A: 0xff},
+		Fill:         color.NRGBA{R: 0x09, G: 0x69, B: 0xda, A: 0x24},
+		Grid:         color.RGBA{R: 0xe1, G: 0xe4, B: 0xe8, A: 0xff},
+		LineWidth:    2.5,
+		MarkerRadius: 4,
+	}
+}
+
+// Line draws a line chart of the points. The points are placed on the x-axis by
+// their time and the y-axis spans the range of their values.
+func Line(points []Point, opts Options) (*image.RGBA, error) {
+	if len(points) < 2 {
+		return nil, ErrNotEnoughData
+	}
+
+	points = append([]Point(nil), points...)
+	sort.SliceStable(points, func(i, j int) bool {
+		return points[i].Time.Before(points[j].Time)
+	})
+
+	c := newCanvas(opts.Width, opts.Height, opts.Background)
+	plot := project(points, opts)
+
+	if opts.Grid != nil {
+		for i := 0; i <= 3; i++ {
+			y := float64(opts.Padding) + float64(opts.Height-2*opts.Padding)*float64(i)/3
+			c.segment(float64(opts.Padding), y, float64(opts.Width-opts.Padding), y, 1, opts.Grid)
+		}
+	}
+
+	if opts.Fill != nil {
+		c.fillBelow(plot, float64(opts.Height-opts.Padding), opts.Fill)
+	}
+
+	for i := 1; i < len(plot); i++ {
+		c.segment(plot[i-1].X, plot[i-1].Y, plot[i].X, plot[i].Y, opts.LineWidth, opts.Line)
+	}
+
+	if opts.MarkerRadius > 0 {
+		last := plot[len(plot)-1]
+		c.disc(last.X, last.Y, opts.MarkerRadius, opts.Line)
+	}
+
+	return c.img, nil
+}
+
+// LinePNG draws a line chart of the points and writes it to w in the PNG format.
+func LinePNG(w io.Writer, points []Point, opts Options) error {
+	img, err := Line(points, opts)
+	if err != nil {
+		return err
+	}
+	return png.Encode(w, img)
+}
+
+// vec is a point on the canvas.
+type vec struct {
+	X, Y float64
+}
+
+// project maps the points to the plot area of the canvas.
+func project(points []Point, opts Options) []vec {
+	minV, maxV := points[0].Value, points[0].Value
+	for _, p := range points {
+		minV = math.Min(minV, p.Value)
+		maxV = math.Max(maxV, p.Value)
+	}
+	if maxV == minV {
+		// Center a flat line
+		minV, maxV = minV-1, maxV+1
+	}
+
+	start, end := points[0].Time, points[len(points)-1].Time
+	span := end.Sub(start)
+
+	left, top := float64(opts.Padding), float64(opts.Padding)
+	width := float64(opts.Width - 2*opts.Padding)
+	height := float64(opts.Height - 2*opts.Padding)
+
+	plot := make([]vec, len(points))
+	for i, p := range points {
+		x := float64(i) / float64(len(points)-1)
+		if span > 0 {
+			x = float64(p.Time.Sub(start)) / float64(span)
+		}
+		y := (p.Value - minV) / (maxV - minV)
+
+		plot[i] = vec{X: left + x*width, Y: top + (1-y)*height}
+	}
+
+	return plot
+}
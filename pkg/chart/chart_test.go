@@ -0,0 +1,66 @@
+package chart_test
+
+import (
+	"bytes"
+	"image/color"
+	"image/png"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/vladyslavpavlenko/genesis-api-project/pkg/chart"
+)
+
+func series(values ...float64) []chart.Point {
+	start := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+	points := make([]chart.Point, len(values))
+	for i, v := range values {
+		points[i] = chart.Point{Time: start.AddDate(0, 0, i), Value: v}
+	}
+	return points
+}
+
+func TestLine(t *testing.T) {
+	opts := chart.DefaultOptions()
+
+	// Points are drawn in time order, whatever the order they are given in
+	points := series(41.0, 40.5, 41.5)
+	points[0], points[2] = points[2], points[0]
+
+	img, err := chart.Line(points, opts)
+	require.NoError(t, err)
+	assert.Equal(t, opts.Width, img.Bounds().Dx())
+	assert.Equal(t, opts.Height, img.Bounds().Dy())
+
+	// The last and highest point is at the top right corner of the plot area
+	last := img.RGBAAt(opts.Width-opts.Padding, opts.Padding)
+	assert.Equal(t, opts.Line, color.Color(last))
+
+	// The area above the line is left blank
+	assert.Equal(t, color.RGBA{R: 0xff, G: 0xff, B: 0xff, A: 0xff}, img.RGBAAt(opts.Width/4, 1))
+}
+
+func TestLine_Flat(t *testing.T) {
+	opts := chart.DefaultOptions()
+
+	img, err := chart.Line(series(41, 41), opts)
+	require.NoError(t, err)
+
+	// A flat line is drawn in the middle
+	assert.Equal(t, opts.Line, color.Color(img.RGBAAt(opts.Width/2, opts.Height/2)))
+}
+
+func TestLine_NotEnoughData(t *testing.T) {
+	_, err := chart.Line(series(41), chart.DefaultOptions())
+	assert.ErrorIs(t, err, chart.ErrNotEnoughData)
+}
+
+func TestLinePNG(t *testing.T) {
+	var buf bytes.Buffer
+	require.NoError(t, chart.LinePNG(&buf, series(41, 40, 42), chart.DefaultOptions()))
+
+	img, err := png.Decode(&buf)
+	require.NoError(t, err)
+	assert.Equal(t, 600, img.Bounds().Dx())
+}
@@ -0,0 +1,118 @@
+package dkim
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+)
+
+// header is a single header field of a message.
+type header struct {
+	name string
+	// raw is the header field as it appears in the message, including the folding
+	// and the trailing CRLF.
+	raw string
+}
+
+// splitMessage splits the message into its header fields and body. Bare LF line
+// endings are converted to CRLF.
+func splitMessage(msg []byte) ([]header, []byte, error) {
+	msg = toCRLF(msg)
+
+	var headerPart, body []byte
+	if i := bytes.Index(msg, []byte("\r\n\r\n")); i >= 0 {
+		headerPart, body = msg[:i+2], msg[i+4:]
+	} else {
+		headerPart = msg
+	}
+
+	var headers []header
+	for _, line := range strings.SplitAfter(string(headerPart), "\r\n") {
+		if line == "" {
+			continue
+		}
+
+		if line[0] == ' ' || line[0] == '\t' {
+			if len(headers) == 0 {
+				return nil, nil, errors.New("message starts with a continuation line")
+			}
+			headers[len(headers)-1].raw += line
+			continue
+		}
+
+		name, _, ok := strings.Cut(line, ":")
+		if !ok {
+			return nil, nil, errors.New("malformed header field")
+		}
+		headers = append(headers, header{name: strings.TrimSpace(name), raw: line})
+	}
+
+	return headers, body, nil
+}
+
+// toCRLF converts bare LF line endings to CRLF.
+func toCRLF(msg []byte) []byte {
+	if !bytes.Contains(msg, []byte("\n")) {
+		return msg
+	}
+	msg = bytes.ReplaceAll(msg, []byte("\r\n"), []byte("\n"))
+	return bytes.ReplaceAll(msg, []byte("\n"), []byte("\r\n"))
+}
+
+// relaxedHeader canonicalizes the header field with the "relaxed" algorithm
+// (RFC 6376, section 3.4.2).
+func relaxedHeader(raw string) string {
+	name, value, _ := strings.Cut(raw, ":")
+
+	// Unfold, reduce every whitespace sequence to a single space and remove the
+	// whitespace around the value
+	value = strings.ReplaceAll(value, "\r\n", "")
+	value = strings.TrimFunc(reduceWSP(value), isWSP)
+
+	return strings.ToLower(strings.TrimSpace(name)) + ":" + value + "\r\n"
+}
+
+// relaxedBody canonicalizes the body with the "relaxed" algorithm (RFC 6376,
+// section 3.4.4).
+func relaxedBody(body []byte) []byte {
+	var b strings.Builder
+	empty := 0
+	for _, line := range strings.Split(string(body), "\r\n") {
+		line = strings.TrimRightFunc(reduceWSP(line), isWSP)
+		if line == "" {
+			// Empty lines are only written once followed by a non-empty line, so
+			// that the trailing ones are ignored
+			empty++
+			continue
+		}
+		for ; empty > 0; empty-- {
+			b.WriteString("\r\n")
+		}
+		b.WriteString(line)
+		b.WriteString("\r\n")
+	}
+
+	return []byte(b.String())
+}
+
+// reduceWSP reduces every whitespace sequence to a single space.
+func reduceWSP(s string) string {
+	var b strings.Builder
+	inWSP := false
+	for _, r := range s {
+		if isWSP(r) {
+			if !inWSP {
+				b.WriteByte(' ')
+			}
+			inWSP = true
+			continue
+		}
+		inWSP = false
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+func isWSP(r rune) bool {
+	return r == ' ' || r == '\t'
+}
@@ -0,0 +1,212 @@
+// Package dkim signs email messages with DKIM signatures (RFC 6376) using the
+// rsa-sha256 and ed25519-sha256 (RFC 8463) algorithms and the relaxed/relaxed
+// canonicalization.
+package dkim
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const headerName = "DKIM-Signature"
+
+// DefaultHeaders is the list of header fields signed if none is configured.
+var DefaultHeaders = []string{
+	"From", "To", "Subject", "Date", "Message-ID", "MIME-Version", "Content-Type",
+}
+
+// Config holds the DKIM signing configuration.
+type Config struct {
+	Domain   string
+	Selector string
+	// Headers is the list of signed header fields. From is always signed.
+	Headers []string
+}
+
+// Signer signs messages with a DKIM signature.
+type Signer struct {
+	cfg       Config
+	key       crypto.Signer
+	algorithm string
+	now       func() time.Time
+}
+
+// NewSigner creates a new Signer with the given RSA or Ed25519 private key.
+func NewSigner(cfg Config, key crypto.Signer) (*Signer, error) {
+	if cfg.Domain == "" {
+		return nil, errors.New("dkim domain is empty")
+	}
+	if cfg.Selector == "" {
+		return nil, errors.New("dkim selector is empty")
+	}
+
+	var algorithm string
+	switch key.(type) {
+	case *rsa.PrivateKey:
+		algorithm = "rsa-sha256"
+	case ed25519.PrivateKey:
+		algorithm = "ed25519-sha256"
+	default:
+		return nil, fmt.Errorf("unsupported dkim key type %T", key)
+	}
+
+	if len(cfg.Headers) == 0 {
+		cfg.Headers = DefaultHeaders
+	}
+	if !containsFold(cfg.Headers, "From") {
+		cfg.Headers = append([]string{"From"}, cfg.Headers...)
+	}
+
+	return &Signer{
+		cfg:       cfg,
+		key:       key,
+		algorithm: algorithm,
+		now:       time.Now,
+	}, nil
+}
+
+// LoadKey loads a PEM-encoded RSA (PKCS #1 or PKCS #8) or Ed25519 (PKCS #8)
+// private key from the file.
+func LoadKey(path string) (crypto.Signer, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading dkim key: %w", err)
+	}
+
+	block, _ := pem.Decode(b)
+	if block == nil {
+		return nil, errors.New("dkim key is not PEM-encoded")
+	}
+
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing dkim key: %w", err)
+	}
+
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("unsupported dkim key type %T", key)
+	}
+
+	return signer, nil
+}
+
+// Sign returns the message with the DKIM-Signature header field prepended.
+func (s *Signer) Sign(msg []byte) ([]byte, error) {
+	headers, body, err := splitMessage(msg)
+	if err != nil {
+		return nil, err
+	}
+
+	bodyHash := sha256.Sum256(relaxedBody(body))
+
+	tags := []string{
+		"v=1",
+		"a=" + s.algorithm,
+		"c=relaxed/relaxed",
+		"d=" + s.cfg.Domain,
+		"s=" + s.cfg.Selector,
+		"t=" + strconv.FormatInt(s.now().Unix(), 10),
+		"h=" + strings.ToLower(strings.Join(s.cfg.Headers, ":")),
+		"bh=" + base64.StdEncoding.EncodeToString(bodyHash[:]),
+		"b=",
+	}
+	sigHeader := headerName + ": " + strings.Join(tags, "; ")
+
+	digest := headerHash(headers, s.cfg.Headers, sigHeader)
+
+	opts := crypto.SignerOpts(crypto.SHA256)
+	if s.algorithm == "ed25519-sha256" {
+		// Ed25519 signs the hash itself (RFC 8463, section 3)
+		opts = crypto.Hash(0)
+	}
+
+	sig, err := s.key.Sign(rand.Reader, digest, opts)
+	if err != nil {
+		return nil, fmt.Errorf("error signing message: %w", err)
+	}
+
+	signed := sigHeader + fold(base64.StdEncoding.EncodeToString(sig)) + "\r\n"
+
+	return append([]byte(signed), toCRLF(msg)...), nil
+}
+
+// PublicKeyRecord returns the TXT record to publish at
+// `<selector>._domainkey.<domain>`.
+func (s *Signer) PublicKeyRecord() (string, error) {
+	switch pub := s.key.Public().(type) {
+	case *rsa.PublicKey:
+		der, err := x509.MarshalPKIXPublicKey(pub)
+		if err != nil {
+			return "", err
+		}
+		return "v=DKIM1; k=rsa; p=" + base64.StdEncoding.EncodeToString(der), nil
+	case ed25519.PublicKey:
+		return "v=DKIM1; k=ed25519; p=" + base64.StdEncoding.EncodeToString(pub), nil
+	default:
+		return "", fmt.Errorf("unsupported dkim key type %T", pub)
+	}
+}
+
+// headerHash hashes the signed header fields followed by the DKIM-Signature header
+// field with an empty signature.
+func headerHash(headers []header, signed []string, sigHeader string) []byte {
+	h := sha256.New()
+
+	// If a header field occurs multiple times, the occurrences are signed from the
+	// bottom up (RFC 6376, section 5.4.2)
+	used := make(map[int]bool)
+	for _, name := range signed {
+		for i := len(headers) - 1; i >= 0; i-- {
+			if !used[i] && strings.EqualFold(headers[i].name, name) {
+				used[i] = true
+				h.Write([]byte(relaxedHeader(headers[i].raw)))
+				break
+			}
+		}
+	}
+
+	h.Write([]byte(strings.TrimSuffix(relaxedHeader(sigHeader), "\r\n")))
+
+	return h.Sum(nil)
+}
+
+// fold folds the signature, so that the header field lines stay short.
+func fold(sig string) string {
+	const width = 72
+
+	var b strings.Builder
+	for len(sig) > width {
+		b.WriteString(sig[:width])
+		b.WriteString("\r\n\t")
+		sig = sig[width:]
+	}
+	b.WriteString(sig)
+
+	return b.String()
+}
+
+func containsFold(list []string, s string) bool {
+	for _, v := range list {
+		if strings.EqualFold(v, s) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,245 @@
+package dkim_test
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/vladyslavpavlenko/genesis-api-project/pkg/dkim"
+	"gopkg.in/gomail.v2"
+)
+
+func newMessage(t *testing.T) []byte {
+	t.Helper()
+
+	m := gomail.NewMessage()
+	m.SetHeader("From", "sender@example.com")
+	m.SetHeader("To", "recipient@example.com")
+	m.SetHeader("Subject", "Daily  rate\tdigest")
+	m.SetBody("text/plain", "1 USD = 41.2 UAH  \r\n\r\n\r\n")
+	m.AddAlternative("text/html", "<p>1 USD = 41.2 UAH</p>")
+
+	var buf bytes.Buffer
+	_, err := m.WriteTo(&buf)
+	require.NoError(t, err)
+
+	return buf.Bytes()
+}
+
+func keys(t *testing.T) map[string]crypto.Signer {
+	t.Helper()
+
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+
+	return map[string]crypto.Signer{"rsa": rsaKey, "ed25519": edKey}
+}
+
+func TestSign(t *testing.T) {
+	for name, key := range keys(t) {
+		t.Run(name, func(t *testing.T) {
+			s, err := dkim.NewSigner(dkim.Config{Domain: "example.com", Selector: "mail"}, key)
+			require.NoError(t, err)
+
+			signed, err := s.Sign(newMessage(t))
+			require.NoError(t, err)
+
+			assert.True(t, bytes.HasPrefix(signed, []byte("DKIM-Signature: v=1; a="+name+"-sha256;")))
+			require.NoError(t, dkim.Verify(signed, key.Public()))
+
+			// The relaxed canonicalization tolerates whitespace changes in transit
+			relaxed := bytes.Replace(signed, []byte("Subject: Daily"), []byte("subject:   Daily"), 1)
+			assert.NoError(t, dkim.Verify(relaxed, key.Public()))
+
+			tamperedBody := bytes.Replace(signed, []byte("41.2"), []byte("14.2"), 1)
+			assert.Error(t, dkim.Verify(tamperedBody, key.Public()))
+
+			tamperedHeader := bytes.Replace(signed, []byte("To: recipient@"), []byte("To: attacker@"), 1)
+			assert.Error(t, dkim.Verify(tamperedHeader, key.Public()))
+
+			other := keys(t)[name]
+			assert.Error(t, dkim.Verify(signed, other.Public()))
+		})
+	}
+}
+
+func TestSign_Headers(t *testing.T) {
+	key := keys(t)["ed25519"]
+	s, err := dkim.NewSigner(dkim.Config{Domain: "example.com", Selector: "mail", Headers: []string{"Subject"}}, key)
+	require.NoError(t, err)
+
+	signed, err := s.Sign(newMessage(t))
+	require.NoError(t, err)
+
+	// From is always signed
+	assert.Contains(t, string(signed), "h=from:subject;")
+
+	// Unsigned header fields may change
+	unsigned := bytes.Replace(signed, []byte("To: recipient@"), []byte("To: other@"), 1)
+	assert.NoError(t, dkim.Verify(unsigned, key.Public()))
+}
+
+func TestVerify_NoSignature(t *testing.T) {
+	err := dkim.Verify(newMessage(t), keys(t)["ed25519"].Public())
+	assert.ErrorIs(t, err, dkim.ErrNoSignature)
+}
+
+func TestLoadKey(t *testing.T) {
+	dir := t.TempDir()
+
+	for name, key := range keys(t) {
+		t.Run(name, func(t *testing.T) {
+			der, err := x509.MarshalPKCS8PrivateKey(key)
+			require.NoError(t, err)
+
+			path := filepath.Join(dir, name+".pem")
+			require.NoError(t, os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), 0o600))
+
+			loaded, err := dkim.LoadKey(path)
+			require.NoError(t, err)
+			assert.True(t, key.Public().(interface{ Equal(crypto.PublicKey) bool }).Equal(loaded.Public()))
+		})
+	}
+
+	t.Run("pkcs1", func(t *testing.T) {
+		key := keys(t)["rsa"].(*rsa.PrivateKey)
+		path := filepath.Join(dir, "pkcs1.pem")
+		block := &pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)}
+		require.NoError(t, os.WriteFile(path, pem.EncodeToMemory(block), 0o600))
+
+		loaded, err := dkim.LoadKey(path)
+		require.NoError(t, err)
+		assert.True(t, key.PublicKey.Equal(loaded.Public()))
+	})
+
+	t.Run("not pem", func(t *testing.T) {
+		path := filepath.Join(dir, "key.txt")
+		require.NoError(t, os.WriteFile(path, []byte("key"), 0o600))
+
+		_, err := dkim.LoadKey(path)
+		assert.Error(t, err)
+	})
+}
+
+func TestPublicKeyRecord(t *testing.T) {
+	s, err := dkim.NewSigner(dkim.Config{Domain: "example.com", Selector: "mail"}, keys(t)["ed25519"])
+	require.NoError(t, err)
+
+	record, err := s.PublicKeyRecord()
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(record, "v=DKIM1; k=ed25519; p="))
+}
+
+// The signatures and the keys of RFC 8463, Appendix A.
+const (
+	rfc8463Ed25519Seed = "nWGxne/9WmC6hEr0kuwsxERJxWl7MmkZcDusAxyuf2A="
+	rfc8463Ed25519Key  = "11qYAYKxCrfVS/7TyWQHOg7hcvPapiMlrwIaaPcHURo="
+	rfc8463RSAKey      = "MIGfMA0GCSqGSIb3DQEBAQUAA4GNADCBiQKBgQDkHlOQoBTzWRiGs5V6NpP3idY6Wk08a5qhdR6wy5bd" +
+		"OKb2jLQiY/J16JYi0Qvx/byYzCNb3W91y3FutACDfzwQ/BC/e/8uBsCR+yz1Lxj+PL6lHvqMKrM3rG4hstT5QjvHO9Pzox" +
+		"ZyVYLzBfO2EeC3Ip3G+2kryOTIKT+l/K4w3QIDAQAB"
+
+	rfc8463Ed25519Signature = `DKIM-Signature: v=1; a=ed25519-sha256; c=relaxed/relaxed;
+ d=football.example.com; i=@football.example.com;
+ q=dns/txt; s=brisbane; t=1528637909; h=from : to :
+ subject : date : message-id : from : subject : date;
+ bh=2jUSOH9NhtVGCQWNr9BrIAPreKQjO6Sn7XIkfJVOzv8=;
+ b=/gCrinpcQOoIfuHNQIbq4pgh9kyIK3AQUdt9OdqQehSwhEIug4D11Bus
+ Fa3bT3FY5OsU7ZbnKELq+eXdp1Q1Dw==
+`
+	rfc8463RSASignature = `DKIM-Signature: v=1; a=rsa-sha256; c=relaxed/relaxed;
+ d=football.example.com; i=@football.example.com;
+ q=dns/txt; s=test; t=1528637909; h=from : to : subject :
+ date : message-id : from : subject : date;
+ bh=2jUSOH9NhtVGCQWNr9BrIAPreKQjO6Sn7XIkfJVOzv8=;
+ b=F45dVWDfMbQDGHJFlXUNB2HKfbCeLRyhDXgFpEL8GwpsRe0IeIixNTe3
+ DhCVlUrSjV4BwcVcOF6+FF3Zo9Rpo1tFOeS9mPYQTnGdaSGsgeefOsk2Jz
+ dA+L10TeYt9BgDfQNZtKdN1WO//KgIqXP7OdEFE4LjFYNcUxZQ4FADY+8=
+`
+	rfc8463Message = `From: Joe SixPack <joe@football.example.com>
+To: Suzie Q <suzie@shopping.example.net>
+Subject: Is dinner ready?
+Date: Fri, 11 Jul 2003 21:00:37 -0700 (PDT)
+Message-ID: <20030712040037.46341.5F8J@football.example.com>
+
+Hi.
+
+We lost the game.  Are you hungry yet?
+
+Joe.`
+)
+
+func rfc8463Keys(t *testing.T) (ed25519.PrivateKey, *rsa.PublicKey) {
+	t.Helper()
+
+	seed, err := base64.StdEncoding.DecodeString(rfc8463Ed25519Seed)
+	require.NoError(t, err)
+	edKey := ed25519.NewKeyFromSeed(seed)
+	require.Equal(t, rfc8463Ed25519Key, base64.StdEncoding.EncodeToString(edKey.Public().(ed25519.PublicKey)))
+
+	der, err := base64.StdEncoding.DecodeString(rfc8463RSAKey)
+	require.NoError(t, err)
+	rsaKey, err := x509.ParsePKIXPublicKey(der)
+	require.NoError(t, err)
+
+	return edKey, rsaKey.(*rsa.PublicKey)
+}
+
+func TestVerify_RFC8463(t *testing.T) {
+	edKey, rsaKey := rfc8463Keys(t)
+
+	tests := []struct {
+		name string
+		msg  string
+		key  crypto.PublicKey
+	}{
+		{"ed25519", rfc8463Ed25519Signature + rfc8463RSASignature + rfc8463Message, edKey.Public()},
+		{"rsa", rfc8463RSASignature + rfc8463Message, rsaKey},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			require.NoError(t, dkim.Verify([]byte(tt.msg), tt.key))
+
+			tampered := strings.Replace(tt.msg, "dinner", "lunch", 1)
+			assert.Error(t, dkim.Verify([]byte(tampered), tt.key))
+		})
+	}
+}
+
+func TestSign_RFC8463(t *testing.T) {
+	edKey, _ := rfc8463Keys(t)
+
+	s, err := dkim.NewSigner(dkim.Config{Domain: "football.example.com", Selector: "brisbane"}, edKey)
+	require.NoError(t, err)
+
+	signed, err := s.Sign([]byte(rfc8463Message))
+	require.NoError(t, err)
+
+	// The body hash is the one of the RFC, and the signature verifies against its key
+	assert.Contains(t, string(signed), "bh=2jUSOH9NhtVGCQWNr9BrIAPreKQjO6Sn7XIkfJVOzv8=;")
+	assert.NoError(t, dkim.Verify(signed, edKey.Public()))
+}
+
+// TestRelaxed checks the relaxed canonicalization against the example of RFC 6376,
+// section 3.4.5.
+func TestRelaxed(t *testing.T) {
+	assert.Equal(t, "a:X\r\n", dkim.RelaxedHeader("A: X\r\n"))
+	assert.Equal(t, "b:Y Z\r\n", dkim.RelaxedHeader("B : Y\t\r\n\tZ  \r\n"))
+
+	body := []byte(" C \r\nD \t E\r\n\r\n\r\n")
+	assert.Equal(t, " C\r\nD E\r\n", string(dkim.RelaxedBody(body)))
+}
@@ -0,0 +1,6 @@
+package dkim
+
+var (
+	RelaxedHeader = relaxedHeader
+	RelaxedBody   = relaxedBody
+)
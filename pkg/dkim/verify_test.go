@@ -0,0 +1,105 @@
+package dkim
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// ErrNoSignature is returned when verifying a message without a DKIM signature.
+var ErrNoSignature = errors.New("message has no dkim signature")
+
+// signatureValue matches the value of the b= tag.
+var signatureValue = regexp.MustCompile(`([;\s:]b=)[^;]*`)
+
+// Verify verifies the first DKIM signature of the message against the public key,
+// so that the tests can check the signatures. It does not look the key up in DNS.
+func Verify(msg []byte, pub crypto.PublicKey) error {
+	headers, body, err := splitMessage(msg)
+	if err != nil {
+		return err
+	}
+
+	var sigHeader *header
+	for i := range headers {
+		if strings.EqualFold(headers[i].name, headerName) {
+			sigHeader = &headers[i]
+			break
+		}
+	}
+	if sigHeader == nil {
+		return ErrNoSignature
+	}
+
+	tags := parseTags(sigHeader.raw)
+
+	if tags["c"] != "relaxed/relaxed" {
+		return fmt.Errorf("unsupported canonicalization %q", tags["c"])
+	}
+
+	bodyHash := sha256.Sum256(relaxedBody(body))
+	if tags["bh"] != base64.StdEncoding.EncodeToString(bodyHash[:]) {
+		return errors.New("body hash mismatch")
+	}
+
+	sig, err := base64.StdEncoding.DecodeString(tags["b"])
+	if err != nil {
+		return fmt.Errorf("malformed signature: %w", err)
+	}
+
+	unsigned := signatureValue.ReplaceAllString(sigHeader.raw, "${1}")
+	digest := headerHash(headers, strings.Split(tags["h"], ":"), unsigned)
+
+	switch tags["a"] {
+	case "rsa-sha256":
+		key, ok := pub.(*rsa.PublicKey)
+		if !ok {
+			return errors.New("key does not match the algorithm")
+		}
+		if err = rsa.VerifyPKCS1v15(key, crypto.SHA256, digest, sig); err != nil {
+			return fmt.Errorf("signature mismatch: %w", err)
+		}
+	case "ed25519-sha256":
+		key, ok := pub.(ed25519.PublicKey)
+		if !ok {
+			return errors.New("key does not match the algorithm")
+		}
+		if !ed25519.Verify(key, digest, sig) {
+			return errors.New("signature mismatch")
+		}
+	default:
+		return fmt.Errorf("unsupported algorithm %q", tags["a"])
+	}
+
+	return nil
+}
+
+// parseTags parses the tag list of the DKIM-Signature header field.
+func parseTags(raw string) map[string]string {
+	_, value, _ := strings.Cut(raw, ":")
+
+	tags := make(map[string]string)
+	for _, tag := range strings.Split(value, ";") {
+		k, v, ok := strings.Cut(tag, "=")
+		if !ok {
+			continue
+		}
+		// Whitespace is allowed anywhere in the tag values we use
+		v = string(bytes.Map(func(r rune) rune {
+			if r == ' ' || r == '\t' || r == '\r' || r == '\n' {
+				return -1
+			}
+			return r
+		}, []byte(v)))
+		tags[strings.TrimSpace(k)] = v
+	}
+
+	return tags
+}
@@ -0,0 +1,309 @@
+// Package envelope encrypts small values, such as email addresses, with envelope
+// encryption and computes their blind indexes.
+//
+// Every value is encrypted with its own random data key using AES-256-GCM, and the
+// data key is in turn encrypted (wrapped) with the primary master key of a Keyring.
+// The master keys are identified by their IDs, which are stored along with the
+// values, so the keys can be rotated: a new primary key encrypts the new values,
+// while the old keys still decrypt the old ones until they are rewrapped.
+//
+// Encrypted values are not comparable, so equality lookups use a blind index, that
+// is a keyed HMAC-SHA256 of the value.
+package envelope
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// KeySize is the size of the master, data, and index keys in bytes.
+const KeySize = 32
+
+// prefix marks the encrypted values, so that they can be told apart from the values
+// stored before the encryption was enabled.
+const prefix = "enc:v1:"
+
+var (
+	ErrUnknownKey = errors.New("unknown master key")
+	ErrMalformed  = errors.New("malformed encrypted value")
+	ErrNoIndexKey = errors.New("blind index key is required along with the master keys")
+	ErrInvalidKey = errors.New("invalid key")
+	ErrDecrypt    = errors.New("failed to decrypt value")
+)
+
+var keyID = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+var encoding = base64.RawStdEncoding
+
+// Key is a master key along with its ID.
+type Key struct {
+	ID     string
+	Secret []byte
+}
+
+// Keyring encrypts and decrypts the values with its master keys. A nil Keyring, as
+// well as one without master keys, stores the values in plain text, which is meant
+// for development: Seal returns the value as is, and BlindIndex returns it unchanged
+// unless the index key is set.
+type Keyring struct {
+	primary string
+	keys    map[string]cipher.AEAD
+	index   []byte
+}
+
+// New creates a new Keyring of the master keys, the first of which is the primary
+// one, and the key of the blind index. The index key is required if there are master
+// keys, as the index would disclose the values otherwise.
+func New(keys []Key, indexKey []byte) (*Keyring, error) {
+	if len(keys) > 0 && len(indexKey) == 0 {
+		return nil, ErrNoIndexKey
+	}
+	if len(indexKey) > 0 && len(indexKey) != KeySize {
+		return nil, fmt.Errorf("%w: index key must be %d bytes long", ErrInvalidKey, KeySize)
+	}
+
+	k := &Keyring{keys: make(map[string]cipher.AEAD, len(keys)), index: indexKey}
+	for i, key := range keys {
+		if !keyID.MatchString(key.ID) {
+			return nil, fmt.Errorf("%w: id %q may only contain letters, digits, '-' and '_'", ErrInvalidKey, key.ID)
+		}
+		if _, ok := k.keys[key.ID]; ok {
+			return nil, fmt.Errorf("%w: duplicate id %q", ErrInvalidKey, key.ID)
+		}
+
+		aead, err := newAEAD(key.Secret)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s: %w", ErrInvalidKey, key.ID, err)
+		}
+		k.keys[key.ID] = aead
+
+		if i == 0 {
+			k.primary = key.ID
+		}
+	}
+
+	return k, nil
+}
+
+// ParseKeys parses a comma-separated list of `<id>:<base64-encoded key>` pairs, e.g.
+// `2024-06:q83v...,2024-01:ZmFr...`. The order of the keys is kept.
+func ParseKeys(s string) ([]Key, error) {
+	var keys []Key
+	for i, pair := range strings.Split(s, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+
+		id, secret, ok := strings.Cut(pair, ":")
+		if !ok {
+			// The pair is not quoted, as it may be the key itself
+			return nil, fmt.Errorf("%w: entry %d is not an <id>:<key> pair", ErrInvalidKey, i+1)
+		}
+
+		b, err := base64.StdEncoding.DecodeString(secret)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s: %w", ErrInvalidKey, id, err)
+		}
+		keys = append(keys, Key{ID: id, Secret: b})
+	}
+	return keys, nil
+}
+
+// Enabled reports whether the values are encrypted.
+func (k *Keyring) Enabled() bool {
+	return k != nil && k.primary != ""
+}
+
+// Indexed reports whether the blind indexes are keyed, i.e. the index key is set.
+func (k *Keyring) Indexed() bool {
+	return k != nil && len(k.index) > 0
+}
+
+// Seal encrypts the value with a new data key wrapped with the primary key.
+func (k *Keyring) Seal(value string) (string, error) {
+	if !k.Enabled() {
+		return value, nil
+	}
+
+	dataKey := make([]byte, KeySize)
+	if _, err := rand.Read(dataKey); err != nil {
+		return "", err
+	}
+
+	aead, err := newAEAD(dataKey)
+	if err != nil {
+		return "", err
+	}
+
+	ciphertext, err := seal(aead, []byte(value), nil)
+	if err != nil {
+		return "", err
+	}
+
+	wrapped, err := seal(k.keys[k.primary], dataKey, []byte(k.primary))
+	if err != nil {
+		return "", err
+	}
+
+	return prefix + k.primary + ":" + encoding.EncodeToString(wrapped) + ":" + encoding.EncodeToString(ciphertext), nil
+}
+
+// Open decrypts the value. Values that are not encrypted are returned as is.
+func (k *Keyring) Open(value string) (string, error) {
+	e, ok, err := parse(value)
+	if err != nil || !ok {
+		return value, err
+	}
+
+	dataKey, err := k.unwrap(e)
+	if err != nil {
+		return "", err
+	}
+
+	aead, err := newAEAD(dataKey)
+	if err != nil {
+		return "", err
+	}
+
+	plaintext, err := open(aead, e.ciphertext, nil)
+	if err != nil {
+		return "", err
+	}
+	return string(plaintext), nil
+}
+
+// Rewrap wraps the data key of the value with the primary key, leaving the value
+// encrypted with the same data key, and encrypts the values that are not encrypted.
+// It reports whether the value has changed. Without the master keys, the values are
+// left as they are.
+func (k *Keyring) Rewrap(value string) (string, bool, error) {
+	if !k.Enabled() {
+		return value, false, nil
+	}
+
+	e, ok, err := parse(value)
+	if err != nil {
+		return "", false, err
+	}
+	if !ok {
+		sealed, err := k.Seal(value)
+		return sealed, err == nil, err
+	}
+	if e.keyID == k.primary {
+		return value, false, nil
+	}
+
+	dataKey, err := k.unwrap(e)
+	if err != nil {
+		return "", false, err
+	}
+
+	wrapped, err := seal(k.keys[k.primary], dataKey, []byte(k.primary))
+	if err != nil {
+		return "", false, err
+	}
+
+	return prefix + k.primary + ":" + encoding.EncodeToString(wrapped) + ":" + encoding.EncodeToString(e.ciphertext),
+		true, nil
+}
+
+// BlindIndex returns the hex-encoded HMAC-SHA256 of the value, which is equal for
+// equal values. Without the index key, the value is returned unchanged.
+func (k *Keyring) BlindIndex(value string) string {
+	if !k.Indexed() {
+		return value
+	}
+
+	mac := hmac.New(sha256.New, k.index)
+	mac.Write([]byte(value))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// encrypted is a parsed encrypted value.
+type encrypted struct {
+	keyID      string
+	wrappedKey []byte
+	ciphertext []byte
+}
+
+// parse parses the encrypted value. It reports false if the value is not encrypted.
+func parse(value string) (encrypted, bool, error) {
+	rest, ok := strings.CutPrefix(value, prefix)
+	if !ok {
+		return encrypted{}, false, nil
+	}
+
+	parts := strings.Split(rest, ":")
+	if len(parts) != 3 {
+		return encrypted{}, false, ErrMalformed
+	}
+
+	wrappedKey, err := encoding.DecodeString(parts[1])
+	if err != nil {
+		return encrypted{}, false, ErrMalformed
+	}
+	ciphertext, err := encoding.DecodeString(parts[2])
+	if err != nil {
+		return encrypted{}, false, ErrMalformed
+	}
+
+	return encrypted{keyID: parts[0], wrappedKey: wrappedKey, ciphertext: ciphertext}, true, nil
+}
+
+// unwrap decrypts the data key of the value with the master key it was wrapped with.
+func (k *Keyring) unwrap(e encrypted) ([]byte, error) {
+	var master cipher.AEAD
+	if k != nil {
+		master = k.keys[e.keyID]
+	}
+	if master == nil {
+		return nil, fmt.Errorf("%w: %q", ErrUnknownKey, e.keyID)
+	}
+
+	return open(master, e.wrappedKey, []byte(e.keyID))
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	if len(key) != KeySize {
+		return nil, fmt.Errorf("key must be %d bytes long", KeySize)
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// seal encrypts the plaintext with a random nonce, which is prepended to the result.
+func seal(aead cipher.AEAD, plaintext, additionalData []byte) ([]byte, error) {
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return aead.Seal(nonce, nonce, plaintext, additionalData), nil
+}
+
+// open decrypts the result of seal.
+func open(aead cipher.AEAD, ciphertext, additionalData []byte) ([]byte, error) {
+	if len(ciphertext) < aead.NonceSize() {
+		return nil, ErrMalformed
+	}
+
+	nonce, ciphertext := ciphertext[:aead.NonceSize()], ciphertext[aead.NonceSize():]
+	plaintext, err := aead.Open(nil, nonce, ciphertext, additionalData)
+	if err != nil {
+		return nil, ErrDecrypt
+	}
+	return plaintext, nil
+}
@@ -0,0 +1,175 @@
+package envelope_test
+
+import (
+	"bytes"
+	"encoding/base64"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/vladyslavpavlenko/genesis-api-project/pkg/envelope"
+)
+
+func key(id string, b byte) envelope.Key {
+	return envelope.Key{ID: id, Secret: bytes.Repeat([]byte{b}, envelope.KeySize)}
+}
+
+var indexKey = bytes.Repeat([]byte{0xff}, envelope.KeySize)
+
+func TestKeyring_SealOpen(t *testing.T) {
+	k, err := envelope.New([]envelope.Key{key("k1", 1)}, indexKey)
+	require.NoError(t, err)
+	require.True(t, k.Enabled())
+
+	sealed, err := k.Seal("alice@example.com")
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(sealed, "enc:v1:k1:"), sealed)
+	assert.NotContains(t, sealed, "alice")
+
+	// Every value gets its own data key
+	again, err := k.Seal("alice@example.com")
+	require.NoError(t, err)
+	assert.NotEqual(t, sealed, again)
+
+	opened, err := k.Open(sealed)
+	require.NoError(t, err)
+	assert.Equal(t, "alice@example.com", opened)
+
+	// The values stored before the encryption are returned as is
+	opened, err = k.Open("bob@example.com")
+	require.NoError(t, err)
+	assert.Equal(t, "bob@example.com", opened)
+
+	other, err := envelope.New([]envelope.Key{key("k1", 2)}, indexKey)
+	require.NoError(t, err)
+	_, err = other.Open(sealed)
+	assert.ErrorIs(t, err, envelope.ErrDecrypt)
+
+	_, err = k.Open("enc:v1:k1:garbage")
+	assert.ErrorIs(t, err, envelope.ErrMalformed)
+}
+
+func TestKeyring_Rotation(t *testing.T) {
+	old, err := envelope.New([]envelope.Key{key("k1", 1)}, indexKey)
+	require.NoError(t, err)
+
+	sealed, err := old.Seal("alice@example.com")
+	require.NoError(t, err)
+
+	rotated, err := envelope.New([]envelope.Key{key("k2", 2), key("k1", 1)}, indexKey)
+	require.NoError(t, err)
+
+	opened, err := rotated.Open(sealed)
+	require.NoError(t, err)
+	assert.Equal(t, "alice@example.com", opened)
+
+	rewrapped, changed, err := rotated.Rewrap(sealed)
+	require.NoError(t, err)
+	assert.True(t, changed)
+	assert.True(t, strings.HasPrefix(rewrapped, "enc:v1:k2:"), rewrapped)
+
+	_, changed, err = rotated.Rewrap(rewrapped)
+	require.NoError(t, err)
+	assert.False(t, changed)
+
+	// The old key can be retired once everything is rewrapped
+	current, err := envelope.New([]envelope.Key{key("k2", 2)}, indexKey)
+	require.NoError(t, err)
+	opened, err = current.Open(rewrapped)
+	require.NoError(t, err)
+	assert.Equal(t, "alice@example.com", opened)
+
+	_, err = current.Open(sealed)
+	assert.ErrorIs(t, err, envelope.ErrUnknownKey)
+
+	// Plain-text values are encrypted
+	encrypted, changed, err := current.Rewrap("bob@example.com")
+	require.NoError(t, err)
+	assert.True(t, changed)
+	assert.True(t, strings.HasPrefix(encrypted, "enc:v1:k2:"), encrypted)
+}
+
+func TestKeyring_BlindIndex(t *testing.T) {
+	k, err := envelope.New([]envelope.Key{key("k1", 1)}, indexKey)
+	require.NoError(t, err)
+
+	index := k.BlindIndex("alice@example.com")
+	assert.Len(t, index, 64)
+	assert.Equal(t, index, k.BlindIndex("alice@example.com"))
+	assert.NotEqual(t, index, k.BlindIndex("bob@example.com"))
+
+	// The index does not depend on the master keys
+	rotated, err := envelope.New([]envelope.Key{key("k2", 2)}, indexKey)
+	require.NoError(t, err)
+	assert.Equal(t, index, rotated.BlindIndex("alice@example.com"))
+}
+
+func TestKeyring_Disabled(t *testing.T) {
+	for _, k := range []*envelope.Keyring{nil, mustNew(t, nil, nil)} {
+		assert.False(t, k.Enabled())
+
+		sealed, err := k.Seal("alice@example.com")
+		require.NoError(t, err)
+		assert.Equal(t, "alice@example.com", sealed)
+
+		opened, err := k.Open(sealed)
+		require.NoError(t, err)
+		assert.Equal(t, "alice@example.com", opened)
+
+		_, changed, err := k.Rewrap(sealed)
+		require.NoError(t, err)
+		assert.False(t, changed)
+
+		assert.Equal(t, "alice@example.com", k.BlindIndex("alice@example.com"))
+	}
+}
+
+func TestNew_InvalidKeys(t *testing.T) {
+	tests := []struct {
+		name     string
+		keys     []envelope.Key
+		indexKey []byte
+		err      error
+	}{
+		{"no index key", []envelope.Key{key("k1", 1)}, nil, envelope.ErrNoIndexKey},
+		{"short index key", nil, []byte("short"), envelope.ErrInvalidKey},
+		{"short key", []envelope.Key{{ID: "k1", Secret: []byte("short")}}, indexKey, envelope.ErrInvalidKey},
+		{"invalid id", []envelope.Key{key("k:1", 1)}, indexKey, envelope.ErrInvalidKey},
+		{"duplicate id", []envelope.Key{key("k1", 1), key("k1", 2)}, indexKey, envelope.ErrInvalidKey},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := envelope.New(tt.keys, tt.indexKey)
+			assert.ErrorIs(t, err, tt.err)
+		})
+	}
+}
+
+func TestParseKeys(t *testing.T) {
+	secret := bytes.Repeat([]byte{1}, envelope.KeySize)
+	encoded := base64.StdEncoding.EncodeToString(secret)
+
+	keys, err := envelope.ParseKeys("k2:" + encoded + ", k1:" + encoded)
+	require.NoError(t, err)
+	assert.Equal(t, []envelope.Key{{ID: "k2", Secret: secret}, {ID: "k1", Secret: secret}}, keys)
+
+	keys, err = envelope.ParseKeys("")
+	require.NoError(t, err)
+	assert.Empty(t, keys)
+
+	_, err = envelope.ParseKeys(encoded)
+	assert.ErrorIs(t, err, envelope.ErrInvalidKey)
+	assert.NotContains(t, err.Error(), encoded)
+
+	_, err = envelope.ParseKeys("k1:not base64")
+	assert.ErrorIs(t, err, envelope.ErrInvalidKey)
+}
+
+func mustNew(t *testing.T, keys []envelope.Key, indexKey []byte) *envelope.Keyring {
+	t.Helper()
+	k, err := envelope.New(keys, indexKey)
+	require.NoError(t, err)
+	return k
+}
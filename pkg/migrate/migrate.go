@@ -0,0 +1,376 @@
+// Package migrate applies versioned SQL migrations to a database. The migrations
+// are read from pairs of `<version>_<name>.up.sql` and `<version>_<name>.down.sql`
+// files, typically embedded into the binary, and the applied versions are recorded
+// in the schema_migrations table.
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io/fs"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// Table is the name of the table the applied versions are recorded in.
+const Table = "schema_migrations"
+
+var (
+	ErrNoMigrations   = errors.New("no migrations found")
+	ErrUnknownVersion = errors.New("applied migration is unknown")
+)
+
+var fileName = regexp.MustCompile(`^(\d+)_(\w+)\.(up|down)\.sql$`)
+
+// Migration is a single schema change along with its reversal.
+type Migration struct {
+	Version int64
+	Name    string
+	Up      string
+	Down    string
+}
+
+// String returns the file name of the migration without the direction.
+func (m Migration) String() string {
+	return fmt.Sprintf("%04d_%s", m.Version, m.Name)
+}
+
+// Status is a migration along with the time it was applied at.
+type Status struct {
+	Migration
+	Applied   bool
+	AppliedAt time.Time
+}
+
+// Locker serializes the migrations run by concurrent replicas. The lock is taken on
+// the connection the migrations are run on.
+type Locker interface {
+	Lock(ctx context.Context, conn *sql.Conn) error
+	Unlock(ctx context.Context, conn *sql.Conn) error
+}
+
+// AdvisoryLock is a Locker using a PostgreSQL session-level advisory lock with the
+// given key.
+type AdvisoryLock int64
+
+// Lock waits for the advisory lock to be acquired.
+func (l AdvisoryLock) Lock(ctx context.Context, conn *sql.Conn) error {
+	_, err := conn.ExecContext(ctx, "SELECT pg_advisory_lock($1)", int64(l))
+	return err
+}
+
+// Unlock releases the advisory lock.
+func (l AdvisoryLock) Unlock(ctx context.Context, conn *sql.Conn) error {
+	_, err := conn.ExecContext(ctx, "SELECT pg_advisory_unlock($1)", int64(l))
+	return err
+}
+
+// Migrator applies and reverts the migrations.
+type Migrator struct {
+	db         *sql.DB
+	migrations []Migration
+	locker     Locker
+}
+
+// New creates a new Migrator of the migrations in the root of fsys. If locker is
+// nil, the migrations are not protected from concurrent runs.
+func New(db *sql.DB, fsys fs.FS, locker Locker) (*Migrator, error) {
+	migrations, err := Load(fsys)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Migrator{db: db, migrations: migrations, locker: locker}, nil
+}
+
+// Load reads the migrations from the root of fsys, ordered by version. Every
+// migration must have both the up and the down file.
+func Load(fsys fs.FS) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return nil, fmt.Errorf("error reading migrations: %w", err)
+	}
+
+	byVersion := make(map[int64]*Migration)
+	for _, e := range entries {
+		match := fileName.FindStringSubmatch(e.Name())
+		if e.IsDir() || match == nil {
+			continue
+		}
+
+		version, err := strconv.ParseInt(match[1], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid migration version %s: %w", e.Name(), err)
+		}
+
+		b, err := fs.ReadFile(fsys, e.Name())
+		if err != nil {
+			return nil, fmt.Errorf("error reading migration %s: %w", e.Name(), err)
+		}
+
+		m, ok := byVersion[version]
+		if !ok {
+			m = &Migration{Version: version, Name: match[2]}
+			byVersion[version] = m
+		}
+		if m.Name != match[2] {
+			return nil, fmt.Errorf("migrations %s and %s share version %d", m, e.Name(), version)
+		}
+
+		if match[3] == "up" {
+			m.Up = string(b)
+		} else {
+			m.Down = string(b)
+		}
+	}
+
+	if len(byVersion) == 0 {
+		return nil, ErrNoMigrations
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.Up == "" || m.Down == "" {
+			return nil, fmt.Errorf("migration %s must have both up and down files", m)
+		}
+		migrations = append(migrations, *m)
+	}
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+
+	return migrations, nil
+}
+
+// Up applies all the pending migrations and returns them.
+func (m *Migrator) Up(ctx context.Context) ([]Migration, error) {
+	return m.UpAndRun(ctx, nil)
+}
+
+// UpAndRun applies all the pending migrations and then runs fn, if not nil, while
+// still holding the lock, e.g. to migrate the data that cannot be migrated in SQL. fn
+// runs even if there are no pending migrations. The applied migrations are returned
+// even if fn fails.
+func (m *Migrator) UpAndRun(ctx context.Context, fn func(ctx context.Context) error) ([]Migration, error) {
+	var applied []Migration
+	err := m.withLock(ctx, func(conn *sql.Conn) error {
+		pending, err := m.pending(ctx, conn)
+		if err != nil {
+			return err
+		}
+
+		for _, mig := range pending {
+			err = m.apply(ctx, conn, mig.Up, func(tx *sql.Tx) error {
+				_, err := tx.ExecContext(ctx, "INSERT INTO "+Table+" (version, name, applied_at) VALUES ($1, $2, $3)",
+					mig.Version, mig.Name, time.Now().UTC())
+				return err
+			})
+			if err != nil {
+				return fmt.Errorf("error applying migration %s: %w", mig, err)
+			}
+			applied = append(applied, mig)
+		}
+
+		if fn == nil {
+			return nil
+		}
+		return fn(ctx)
+	})
+
+	return applied, err
+}
+
+// Down reverts the given number of the last applied migrations and returns them.
+func (m *Migrator) Down(ctx context.Context, steps int) ([]Migration, error) {
+	var reverted []Migration
+	err := m.withLock(ctx, func(conn *sql.Conn) error {
+		versions, err := m.applied(ctx, conn)
+		if err != nil {
+			return err
+		}
+
+		for i := len(versions) - 1; i >= 0 && len(reverted) < steps; i-- {
+			mig, ok := m.find(versions[i].version)
+			if !ok {
+				return fmt.Errorf("%w: %d", ErrUnknownVersion, versions[i].version)
+			}
+
+			err = m.apply(ctx, conn, mig.Down, func(tx *sql.Tx) error {
+				_, err := tx.ExecContext(ctx, "DELETE FROM "+Table+" WHERE version = $1", mig.Version)
+				return err
+			})
+			if err != nil {
+				return fmt.Errorf("error reverting migration %s: %w", mig, err)
+			}
+			reverted = append(reverted, mig)
+		}
+
+		return nil
+	})
+
+	return reverted, err
+}
+
+// Status returns all the known migrations along with whether they are applied.
+func (m *Migrator) Status(ctx context.Context) ([]Status, error) {
+	conn, err := m.db.Conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	if err = m.createTable(ctx, conn); err != nil {
+		return nil, err
+	}
+
+	versions, err := m.applied(ctx, conn)
+	if err != nil {
+		return nil, err
+	}
+
+	appliedAt := make(map[int64]time.Time, len(versions))
+	for _, v := range versions {
+		appliedAt[v.version] = v.appliedAt
+	}
+
+	statuses := make([]Status, len(m.migrations))
+	for i, mig := range m.migrations {
+		at, ok := appliedAt[mig.Version]
+		statuses[i] = Status{Migration: mig, Applied: ok, AppliedAt: at}
+	}
+
+	return statuses, nil
+}
+
+// Pending returns the migrations that are not applied yet.
+func (m *Migrator) Pending(ctx context.Context) ([]Migration, error) {
+	statuses, err := m.Status(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var pending []Migration
+	for _, s := range statuses {
+		if !s.Applied {
+			pending = append(pending, s.Migration)
+		}
+	}
+
+	return pending, nil
+}
+
+// withLock runs fn on a single connection holding the lock.
+func (m *Migrator) withLock(ctx context.Context, fn func(conn *sql.Conn) error) error {
+	conn, err := m.db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if m.locker != nil {
+		if err = m.locker.Lock(ctx, conn); err != nil {
+			return fmt.Errorf("error acquiring migration lock: %w", err)
+		}
+		defer func() {
+			// The lock is released with the session anyway, so the error is ignored
+			_ = m.locker.Unlock(context.Background(), conn)
+		}()
+	}
+
+	if err = m.createTable(ctx, conn); err != nil {
+		return err
+	}
+
+	return fn(conn)
+}
+
+// apply runs the SQL and records the change in a single transaction.
+func (m *Migrator) apply(ctx context.Context, conn *sql.Conn, query string, record func(tx *sql.Tx) error) error {
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	if _, err = tx.ExecContext(ctx, query); err != nil {
+		return err
+	}
+
+	if err = record(tx); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (m *Migrator) createTable(ctx context.Context, conn *sql.Conn) error {
+	_, err := conn.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS `+Table+` (
+		version BIGINT PRIMARY KEY,
+		name TEXT NOT NULL,
+		applied_at TIMESTAMP NOT NULL
+	)`)
+	if err != nil {
+		return fmt.Errorf("error creating %s table: %w", Table, err)
+	}
+	return nil
+}
+
+type appliedVersion struct {
+	version   int64
+	appliedAt time.Time
+}
+
+// applied returns the applied versions in ascending order.
+func (m *Migrator) applied(ctx context.Context, conn *sql.Conn) ([]appliedVersion, error) {
+	rows, err := conn.QueryContext(ctx, "SELECT version, applied_at FROM "+Table+" ORDER BY version")
+	if err != nil {
+		return nil, fmt.Errorf("error reading %s table: %w", Table, err)
+	}
+	defer rows.Close()
+
+	var versions []appliedVersion
+	for rows.Next() {
+		var v appliedVersion
+		if err = rows.Scan(&v.version, &v.appliedAt); err != nil {
+			return nil, err
+		}
+		versions = append(versions, v)
+	}
+
+	return versions, rows.Err()
+}
+
+// pending returns the known migrations that are not applied yet.
+func (m *Migrator) pending(ctx context.Context, conn *sql.Conn) ([]Migration, error) {
+	versions, err := m.applied(ctx, conn)
+	if err != nil {
+		return nil, err
+	}
+
+	applied := make(map[int64]bool, len(versions))
+	for _, v := range versions {
+		applied[v.version] = true
+	}
+
+	var pending []Migration
+	for _, mig := range m.migrations {
+		if !applied[mig.Version] {
+			pending = append(pending, mig)
+		}
+	}
+
+	return pending, nil
+}
+
+func (m *Migrator) find(version int64) (Migration, bool) {
+	for _, mig := range m.migrations {
+		if mig.Version == version {
+			return mig, true
+		}
+	}
+	return Migration{}, false
+}
@@ -0,0 +1,63 @@
+package migrate_test
+
+import (
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/vladyslavpavlenko/genesis-api-project/pkg/migrate"
+)
+
+func TestLoad(t *testing.T) {
+	fsys := fstest.MapFS{
+		"0002_add_locale.up.sql":   {Data: []byte("ALTER TABLE users ADD COLUMN locale TEXT;")},
+		"0002_add_locale.down.sql": {Data: []byte("ALTER TABLE users DROP COLUMN locale;")},
+		"0001_initial.up.sql":      {Data: []byte("CREATE TABLE users (id BIGINT);")},
+		"0001_initial.down.sql":    {Data: []byte("DROP TABLE users;")},
+		"README.md":                {Data: []byte("ignored")},
+	}
+
+	migrations, err := migrate.Load(fsys)
+	require.NoError(t, err)
+	require.Len(t, migrations, 2)
+
+	assert.Equal(t, int64(1), migrations[0].Version)
+	assert.Equal(t, "initial", migrations[0].Name)
+	assert.Equal(t, "CREATE TABLE users (id BIGINT);", migrations[0].Up)
+	assert.Equal(t, "DROP TABLE users;", migrations[0].Down)
+	assert.Equal(t, "0002_add_locale", migrations[1].String())
+}
+
+func TestLoad_Invalid(t *testing.T) {
+	tests := []struct {
+		name string
+		fsys fstest.MapFS
+	}{
+		{
+			name: "empty",
+			fsys: fstest.MapFS{},
+		},
+		{
+			name: "missing down",
+			fsys: fstest.MapFS{
+				"0001_initial.up.sql": {Data: []byte("CREATE TABLE users (id BIGINT);")},
+			},
+		},
+		{
+			name: "shared version",
+			fsys: fstest.MapFS{
+				"0001_initial.up.sql":   {Data: []byte("CREATE TABLE users (id BIGINT);")},
+				"0001_users.down.sql":   {Data: []byte("DROP TABLE users;")},
+				"0001_initial.down.sql": {Data: []byte("DROP TABLE users;")},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := migrate.Load(tt.fsys)
+			assert.Error(t, err)
+		})
+	}
+}
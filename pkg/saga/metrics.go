@@ -0,0 +1,37 @@
+package saga
+
+import (
+	"fmt"
+
+	"github.com/VictoriaMetrics/metrics"
+)
+
+func outcomeCounter(saga, status string) *metrics.Counter {
+	return metrics.GetOrCreateCounter(fmt.Sprintf(`saga_outcomes_count{saga=%q,status=%q}`, saga, status))
+}
+
+func durationHistogram(saga string) *metrics.Histogram {
+	return metrics.GetOrCreateHistogram(fmt.Sprintf(`saga_duration_seconds{saga=%q}`, saga))
+}
+
+func stepDurationHistogram(saga, step, phase string) *metrics.Histogram {
+	return metrics.GetOrCreateHistogram(
+		fmt.Sprintf(`saga_step_duration_seconds{saga=%q,step=%q,phase=%q}`, saga, step, phase))
+}
+
+func stepErrorsCounter(saga, step, phase string) *metrics.Counter {
+	return metrics.GetOrCreateCounter(
+		fmt.Sprintf(`saga_step_errors_count{saga=%q,step=%q,phase=%q}`, saga, step, phase))
+}
+
+func compensationFailuresCounter(saga string) *metrics.Counter {
+	return metrics.GetOrCreateCounter(fmt.Sprintf(`saga_compensation_failures_count{saga=%q}`, saga))
+}
+
+func recoveriesCounter(saga string) *metrics.Counter {
+	return metrics.GetOrCreateCounter(fmt.Sprintf(`saga_recoveries_count{saga=%q}`, saga))
+}
+
+func interventionsCounter(saga, action string) *metrics.Counter {
+	return metrics.GetOrCreateCounter(fmt.Sprintf(`saga_interventions_count{saga=%q,action=%q}`, saga, action))
+}
@@ -0,0 +1,250 @@
+package saga
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/vladyslavpavlenko/genesis-api-project/pkg/logger"
+	"go.uber.org/zap"
+)
+
+const (
+	// DefaultLease is how long a saga is reserved for the Orchestrator running it. The
+	// lease is renewed with every step, which takes much less, so it only expires once
+	// the Orchestrator is gone, and the saga is taken over by the recovery.
+	DefaultLease = time.Minute
+
+	// recoveryBatchSize is the maximum number of sagas recovered at once.
+	recoveryBatchSize = 100
+)
+
+const (
+	actionRetry      = "retry"
+	actionCompensate = "compensate"
+	actionResolve    = "resolve"
+)
+
+// resumer is a Saga of any data type.
+type resumer interface {
+	resume(ctx context.Context, inst *Instance) error
+	forceCompensate(ctx context.Context, inst *Instance, reason string) error
+}
+
+// Orchestrator runs the sagas registered with it and recovers the interrupted ones.
+type Orchestrator struct {
+	store Store
+	// owner identifies the Orchestrator as the holder of the saga leases.
+	owner string
+	lease time.Duration
+	l     *logger.Logger
+
+	mu    sync.RWMutex
+	sagas map[string]resumer
+}
+
+// NewOrchestrator creates a new Orchestrator storing the sagas in the store.
+func NewOrchestrator(store Store, l *logger.Logger) *Orchestrator {
+	return &Orchestrator{
+		store: store,
+		owner: uuid.New().String(),
+		lease: DefaultLease,
+		l:     l,
+		sagas: make(map[string]resumer),
+	}
+}
+
+// Register registers the Definition with the Orchestrator, so that its sagas can be
+// run and recovered.
+func Register[T any](o *Orchestrator, def Definition[T]) (*Saga[T], error) {
+	if def.Name == "" || len(def.Steps) == 0 {
+		return nil, fmt.Errorf("saga %q must have a name and steps", def.Name)
+	}
+	for _, step := range def.Steps {
+		if step.Action == nil {
+			return nil, fmt.Errorf("step %q of saga %q has no action", step.Name, def.Name)
+		}
+	}
+
+	if def.Codec == nil {
+		def.Codec = JSONCodec[T]{}
+	}
+	if def.Backoff.Attempts == 0 {
+		def.Backoff = DefaultBackoff
+	}
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	if _, ok := o.sagas[def.Name]; ok {
+		return nil, fmt.Errorf("%w: %s", ErrDuplicateSaga, def.Name)
+	}
+
+	s := &Saga[T]{def: def, o: o}
+	o.sagas[def.Name] = s
+	return s, nil
+}
+
+// Recover recovers the interrupted sagas right away and then every interval until
+// the context is canceled.
+func (o *Orchestrator) Recover(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		recovered, err := o.RecoverSagas()
+		if err != nil {
+			o.l.Error("failed to recover sagas", zap.Error(err))
+		}
+		if recovered > 0 {
+			o.l.Info("recovered sagas", zap.Int("count", recovered))
+		}
+
+		select {
+		case <-ctx.Done():
+			o.l.Info("shutting down saga recovery...")
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// RecoverSagas resumes the sagas left in progress whose leases have expired, that is
+// the sagas of the Orchestrators that crashed or were stopped halfway, and the sagas
+// whose compensations have failed. Each saga is leased first, so that it is not
+// recovered by several Orchestrators at once. It returns the number of sagas
+// recovered.
+func (o *Orchestrator) RecoverSagas() (int, error) {
+	ctx := context.Background()
+
+	ids, err := o.store.ExpiredSagas(ctx, time.Now(), recoveryBatchSize)
+	if err != nil {
+		return 0, err
+	}
+
+	recovered := 0
+	for _, id := range ids {
+		now := time.Now()
+		inst, ok, err := o.store.LeaseSaga(ctx, id, o.owner, now, now.Add(o.lease))
+		if err != nil {
+			return recovered, fmt.Errorf("failed to lease saga %s: %w", id, err)
+		}
+		if !ok {
+			// The saga has been leased by another Orchestrator
+			continue
+		}
+
+		s, ok := o.saga(inst.Name)
+		if !ok {
+			o.l.Warn("unknown saga", zap.String("id", id), zap.String("name", inst.Name))
+			continue
+		}
+
+		recoveriesCounter(inst.Name).Inc()
+		if err = s.resume(ctx, inst); err != nil {
+			o.l.Info("recovered saga failed", zap.String("id", id), zap.String("name", inst.Name), zap.Error(err))
+		} else {
+			o.l.Info("recovered saga completed", zap.String("id", id), zap.String("name", inst.Name))
+		}
+		recovered++
+	}
+
+	return recovered, nil
+}
+
+// Retry resumes the saga in progress right away, rather than once it is recovered,
+// e.g. after the cause of its failing compensations has been fixed. It returns the
+// error of the saga, as Saga.Run does.
+func (o *Orchestrator) Retry(ctx context.Context, id string) error {
+	inst, s, err := o.acquire(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	interventionsCounter(inst.Name, actionRetry).Inc()
+	o.l.Info("retrying saga", zap.String("id", id), zap.String("name", inst.Name))
+
+	return s.resume(ctx, inst)
+}
+
+// Compensate compensates the saga in progress, even though none of its steps has
+// failed, e.g. if a step keeps being interrupted. The reason is stored as the error of
+// the saga. It returns the error of the saga, as Saga.Run does.
+func (o *Orchestrator) Compensate(ctx context.Context, id, reason string) error {
+	inst, s, err := o.acquire(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	interventionsCounter(inst.Name, actionCompensate).Inc()
+	o.l.Info("compensating saga", zap.String("id", id), zap.String("name", inst.Name),
+		zap.String("reason", reason))
+
+	return s.forceCompensate(ctx, inst, reason)
+}
+
+// Resolve marks the failed saga, or the saga in progress that is not being run, as
+// resolved with the resolution, e.g. once it has been fixed by hand. The saga is no
+// longer recovered.
+func (o *Orchestrator) Resolve(ctx context.Context, id, resolution string) error {
+	ok, err := o.store.ResolveSaga(ctx, id, resolution, time.Now())
+	if err != nil {
+		return fmt.Errorf("failed to resolve saga %s: %w", id, err)
+	}
+
+	inst, err := o.store.GetSaga(ctx, id)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return unavailable(inst)
+	}
+
+	interventionsCounter(inst.Name, actionResolve).Inc()
+	outcomeCounter(inst.Name, StatusResolved).Inc()
+	o.l.Info("resolved saga", zap.String("id", id), zap.String("name", inst.Name),
+		zap.String("resolution", resolution))
+
+	return nil
+}
+
+// acquire leases the saga in progress to the Orchestrator and returns it along with
+// its Saga.
+func (o *Orchestrator) acquire(ctx context.Context, id string) (*Instance, resumer, error) {
+	now := time.Now()
+	inst, ok, err := o.store.LeaseSaga(ctx, id, o.owner, now, now.Add(o.lease))
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to lease saga %s: %w", id, err)
+	}
+	if !ok {
+		if inst, err = o.store.GetSaga(ctx, id); err != nil {
+			return nil, nil, err
+		}
+		return nil, nil, unavailable(inst)
+	}
+
+	s, ok := o.saga(inst.Name)
+	if !ok {
+		return nil, nil, fmt.Errorf("unknown saga %s", inst.Name)
+	}
+	return inst, s, nil
+}
+
+// saga returns the Saga registered with the name.
+func (o *Orchestrator) saga(name string) (resumer, bool) {
+	o.mu.RLock()
+	defer o.mu.RUnlock()
+
+	s, ok := o.sagas[name]
+	return s, ok
+}
+
+// unavailable returns the reason why the saga could not be leased or resolved.
+func unavailable(inst *Instance) error {
+	if inst.Status == StatusInProgress {
+		return ErrSagaLeased
+	}
+	return fmt.Errorf("%w: %s", ErrInvalidStatus, inst.Status)
+}
@@ -0,0 +1,451 @@
+// Package saga runs sagas, that is sequences of steps, each of which is a local
+// transaction, along with the compensations that undo them.
+//
+// A saga is declared as a Definition of the steps acting on its data of any type,
+// registered with an Orchestrator, and run. The progress of the saga is saved to a
+// Store after every step, along with a log of every attempt of every step, so that
+// the sagas interrupted halfway, e.g. by a crash, can be recovered: the saga either
+// continues with its next step, or, if it has failed, with the compensations of the
+// steps done so far, newest first. The steps must therefore tolerate being run again,
+// as the saga may have been interrupted after a step was done, but before its
+// progress was saved.
+package saga
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+)
+
+const (
+	StatusInProgress = "in_progress"
+	StatusCompleted  = "completed"
+	StatusFailed     = "failed"
+	// StatusResolved is the status of a saga resolved manually, e.g. once it has been
+	// fixed by hand.
+	StatusResolved = "resolved"
+)
+
+const (
+	PhaseAction       = "action"
+	PhaseCompensation = "compensation"
+)
+
+// DefaultTimeout is the timeout of a single attempt of a step, unless the step sets
+// its own.
+const DefaultTimeout = 10 * time.Second
+
+// DefaultBackoff is the backoff of the compensations, unless the saga sets its own.
+var DefaultBackoff = Backoff{Attempts: 3, Initial: 100 * time.Millisecond, Max: 2 * time.Second}
+
+var (
+	// ErrCompensated matches the CompensatedError.
+	ErrCompensated = errors.New("saga compensated")
+	// ErrLeaseLost is returned if the saga has been taken over by another Orchestrator.
+	ErrLeaseLost = errors.New("saga lease lost")
+	// ErrDuplicateSaga is returned if a saga with the same name is registered already.
+	ErrDuplicateSaga = errors.New("saga already registered")
+	// ErrSagaNotFound is returned if there is no saga with the ID.
+	ErrSagaNotFound = errors.New("saga not found")
+	// ErrSagaLeased is returned if the saga is being run by an Orchestrator.
+	ErrSagaLeased = errors.New("saga is leased")
+	// ErrInvalidStatus is returned if the saga cannot be changed in its status.
+	ErrInvalidStatus = errors.New("invalid saga status")
+)
+
+// CompensatedError is returned once a failed saga is compensated. It wraps the error
+// of the failed step.
+type CompensatedError struct {
+	Err error
+}
+
+func (e *CompensatedError) Error() string {
+	return ErrCompensated.Error() + ": " + e.Err.Error()
+}
+
+func (e *CompensatedError) Unwrap() error {
+	return e.Err
+}
+
+// Is reports whether the target is ErrCompensated.
+func (e *CompensatedError) Is(target error) bool {
+	return target == ErrCompensated
+}
+
+// Instance is a saga as it is stored.
+type Instance struct {
+	ID   string `gorm:"primaryKey" json:"id"`
+	Name string `json:"name"`
+	// Key identifies what the saga is about, e.g. a subscriber, to look it up by.
+	Key string `json:"key,omitempty"`
+	// CurrentStep is the index of the next step to run or, if the saga is
+	// compensating, to compensate.
+	CurrentStep  int    `json:"current_step"`
+	Compensating bool   `json:"compensating"`
+	Status       string `json:"status"` // StatusInProgress, StatusCompleted, StatusFailed, StatusResolved
+	// Data is the data of the saga encoded by its Codec.
+	Data string `json:"data"`
+	// Error is the error of the failed step, if any.
+	Error string `json:"error,omitempty"`
+	// Resolution is the note left by whoever resolved the saga manually.
+	Resolution string `json:"resolution,omitempty"`
+	// LeaseOwner is the Orchestrator running the saga until LeaseExpiresAt.
+	LeaseOwner     string     `json:"lease_owner,omitempty"`
+	LeaseExpiresAt *time.Time `json:"lease_expires_at,omitempty"`
+	CreatedAt      time.Time  `json:"created_at"`
+	UpdatedAt      time.Time  `json:"updated_at"`
+}
+
+// TableName returns the table of the sagas.
+func (Instance) TableName() string {
+	return "sagas"
+}
+
+// StepLog is a record of a single attempt of a step or of its compensation.
+type StepLog struct {
+	ID        uint   `gorm:"primaryKey" json:"id"`
+	SagaID    string `gorm:"index" json:"saga_id"`
+	Step      string `json:"step"`
+	StepIndex int    `json:"step_index"`
+	Phase     string `json:"phase"` // PhaseAction, PhaseCompensation
+	Attempt   int    `json:"attempt"`
+	// Input and Output are the data of the saga before and after the step, encoded by
+	// its Codec. The output is empty if the step has failed.
+	Input     string        `json:"input"`
+	Output    string        `json:"output,omitempty"`
+	Error     string        `json:"error,omitempty"`
+	Duration  time.Duration `json:"duration"`
+	StartedAt time.Time     `json:"started_at"`
+}
+
+// TableName returns the table of the step logs.
+func (StepLog) TableName() string {
+	return "saga_steps"
+}
+
+// Store persists the sagas.
+type Store interface {
+	// SaveSaga creates the saga or updates it, provided it is still leased to its
+	// LeaseOwner. It returns ErrLeaseLost otherwise.
+	SaveSaga(ctx context.Context, s *Instance) error
+	// AddStepLog appends the record to the log of the saga.
+	AddStepLog(ctx context.Context, l *StepLog) error
+	// ExpiredSagas returns the IDs of at most limit sagas in progress whose leases
+	// have expired by now.
+	ExpiredSagas(ctx context.Context, now time.Time, limit int) ([]string, error)
+	// LeaseSaga leases the saga in progress to the owner until expiresAt, provided its
+	// lease has expired by now. It reports false if the saga cannot be leased.
+	LeaseSaga(ctx context.Context, id, owner string, now, expiresAt time.Time) (*Instance, bool, error)
+	// GetSaga returns the saga. It returns ErrSagaNotFound if there is none.
+	GetSaga(ctx context.Context, id string) (*Instance, error)
+	// ResolveSaga marks the failed saga, or the saga in progress whose lease has
+	// expired by now, as resolved with the resolution. It reports false if the saga
+	// cannot be resolved.
+	ResolveSaga(ctx context.Context, id, resolution string, now time.Time) (bool, error)
+}
+
+// Step is a step of a saga acting on its data of type T.
+type Step[T any] struct {
+	Name string
+	// Action does the step. The changes it makes to the data are saved along with the
+	// progress of the saga.
+	Action func(ctx context.Context, data *T) error
+	// Compensation undoes the step. It is nil if there is nothing to undo.
+	Compensation func(ctx context.Context, data *T) error
+	// Timeout bounds every attempt of the action and the compensation. DefaultTimeout
+	// is used if it is zero.
+	Timeout time.Duration
+}
+
+// Codec encodes the data of a saga to be stored.
+type Codec[T any] interface {
+	Encode(data T) (string, error)
+	Decode(s string) (T, error)
+}
+
+// JSONCodec encodes the data as JSON.
+type JSONCodec[T any] struct{}
+
+// Encode encodes the data as JSON.
+func (JSONCodec[T]) Encode(data T) (string, error) {
+	b, err := json.Marshal(data)
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
+
+// Decode decodes the data from JSON.
+func (JSONCodec[T]) Decode(s string) (T, error) {
+	var data T
+	err := json.Unmarshal([]byte(s), &data)
+	return data, err
+}
+
+// Backoff is how the failed compensations are retried. The delay doubles with every
+// attempt, from Initial up to Max.
+type Backoff struct {
+	Attempts int
+	Initial  time.Duration
+	Max      time.Duration
+}
+
+// delay returns the delay before the attempt, starting at 1.
+func (b Backoff) delay(attempt int) time.Duration {
+	d := b.Initial
+	for i := 2; i < attempt && d < b.Max; i++ {
+		d *= 2
+	}
+	return min(d, b.Max)
+}
+
+// Definition declares a saga.
+type Definition[T any] struct {
+	// Name identifies the saga, so it must not change once the sagas are stored.
+	Name  string
+	Steps []Step[T]
+	// Codec encodes the data of the saga. JSONCodec is used if it is nil.
+	Codec Codec[T]
+	// Key returns the Key of the saga. It is optional.
+	Key func(data T) string
+	// Backoff is how the compensations are retried. DefaultBackoff is used if it is
+	// zero. The sagas whose compensations still fail are left in progress to be
+	// recovered later.
+	Backoff Backoff
+}
+
+// Saga runs the sagas of a Definition.
+type Saga[T any] struct {
+	def Definition[T]
+	o   *Orchestrator
+}
+
+// Run runs a new saga with the data, which is updated by the steps. It returns nil
+// once every step is done, or a CompensatedError once the saga has failed and the
+// steps done so far have been compensated. Otherwise, e.g. if a
+// compensation keeps failing, the saga is left in progress to be recovered.
+func (s *Saga[T]) Run(ctx context.Context, data *T) error {
+	inst := &Instance{
+		ID:        uuid.New().String(),
+		Name:      s.def.Name,
+		Status:    StatusInProgress,
+		CreatedAt: time.Now(),
+	}
+	if err := s.save(ctx, inst, data); err != nil {
+		return err
+	}
+
+	return s.run(ctx, inst, data, nil, false)
+}
+
+// resume continues the stored saga. Its current step is run again, as it may have
+// been interrupted halfway, which the step can tell by Resumed.
+func (s *Saga[T]) resume(ctx context.Context, inst *Instance) error {
+	data, err := s.def.Codec.Decode(inst.Data)
+	if err != nil {
+		return fmt.Errorf("failed to decode saga data: %w", err)
+	}
+
+	var failure error
+	if inst.Error != "" {
+		failure = errors.New(inst.Error)
+	}
+
+	return s.run(ctx, inst, &data, failure, true)
+}
+
+// forceCompensate compensates the stored saga, even though none of its steps has
+// failed. Its current step is compensated as well, as it may have been done partly.
+func (s *Saga[T]) forceCompensate(ctx context.Context, inst *Instance, reason string) error {
+	data, err := s.def.Codec.Decode(inst.Data)
+	if err != nil {
+		return fmt.Errorf("failed to decode saga data: %w", err)
+	}
+
+	if !inst.Compensating {
+		inst.Compensating, inst.Error = true, reason
+		inst.CurrentStep = min(inst.CurrentStep, len(s.def.Steps)-1)
+	}
+
+	return s.run(ctx, inst, &data, errors.New(inst.Error), true)
+}
+
+// run runs the saga from its current step. The failure is the error of the failed
+// step, if the saga is compensating.
+func (s *Saga[T]) run(ctx context.Context, inst *Instance, data *T, failure error, resumed bool) error {
+	for {
+		// Only the first step of a resumed saga may have been run before
+		stepCtx := ctx
+		if resumed {
+			stepCtx, resumed = withResumed(ctx), false
+		}
+
+		if !inst.Compensating {
+			if inst.CurrentStep >= len(s.def.Steps) {
+				inst.Status = StatusCompleted
+				if err := s.save(ctx, inst, data); err != nil {
+					return err
+				}
+				s.finished(inst)
+				return nil
+			}
+
+			step := s.def.Steps[inst.CurrentStep]
+			if err := s.attempt(stepCtx, inst, PhaseAction, 1, step.Action, data); err != nil {
+				// The failed step has not been done, so the previous one is the first to undo
+				failure = err
+				inst.Compensating, inst.Error = true, err.Error()
+				inst.CurrentStep--
+			} else {
+				inst.CurrentStep++
+			}
+
+			if err := s.save(ctx, inst, data); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if inst.CurrentStep < 0 {
+			inst.Status = StatusFailed
+			if err := s.save(ctx, inst, data); err != nil {
+				return err
+			}
+			s.finished(inst)
+			return &CompensatedError{Err: failure}
+		}
+
+		step := s.def.Steps[inst.CurrentStep]
+		if step.Compensation != nil {
+			if err := s.compensate(stepCtx, inst, step, data); err != nil {
+				compensationFailuresCounter(s.def.Name).Inc()
+				return err
+			}
+		}
+
+		inst.CurrentStep--
+		if err := s.save(ctx, inst, data); err != nil {
+			return err
+		}
+	}
+}
+
+// compensate runs the compensation of the step until it succeeds or the attempts run
+// out.
+func (s *Saga[T]) compensate(ctx context.Context, inst *Instance, step Step[T], data *T) error {
+	var err error
+	for attempt := 1; attempt <= s.def.Backoff.Attempts; attempt++ {
+		if attempt > 1 {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(s.def.Backoff.delay(attempt)):
+			}
+		}
+
+		if err = s.attempt(ctx, inst, PhaseCompensation, attempt, step.Compensation, data); err == nil {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("failed to compensate step %s: %w", step.Name, err)
+}
+
+// attempt runs the action or the compensation of the current step once, and records
+// it to the log.
+func (s *Saga[T]) attempt(ctx context.Context, inst *Instance, phase string, attempt int,
+	fn func(context.Context, *T) error, data *T,
+) error {
+	step := s.def.Steps[inst.CurrentStep]
+
+	input, err := s.def.Codec.Encode(*data)
+	if err != nil {
+		return fmt.Errorf("failed to encode saga data: %w", err)
+	}
+
+	timeout := step.Timeout
+	if timeout == 0 {
+		timeout = DefaultTimeout
+	}
+	stepCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	started := time.Now()
+	err = fn(stepCtx, data)
+	stepDurationHistogram(s.def.Name, step.Name, phase).UpdateDuration(started)
+
+	record := &StepLog{
+		SagaID:    inst.ID,
+		Step:      step.Name,
+		StepIndex: inst.CurrentStep,
+		Phase:     phase,
+		Attempt:   attempt,
+		Input:     input,
+		Duration:  time.Since(started),
+		StartedAt: started,
+	}
+	if err != nil {
+		record.Error = err.Error()
+		stepErrorsCounter(s.def.Name, step.Name, phase).Inc()
+	} else if record.Output, err = s.def.Codec.Encode(*data); err != nil {
+		return fmt.Errorf("failed to encode saga data: %w", err)
+	}
+
+	// The step is done regardless, so a missing record is not worth failing it
+	if logErr := s.o.store.AddStepLog(ctx, record); logErr != nil {
+		s.o.l.Error("failed to record saga step",
+			zap.String("id", inst.ID),
+			zap.String("step", step.Name),
+			zap.Error(logErr),
+		)
+	}
+
+	return err
+}
+
+// finished records the outcome of the saga and its duration.
+func (s *Saga[T]) finished(inst *Instance) {
+	outcomeCounter(s.def.Name, inst.Status).Inc()
+	durationHistogram(s.def.Name).UpdateDuration(inst.CreatedAt)
+}
+
+// save saves the saga with the data, renewing its lease.
+func (s *Saga[T]) save(ctx context.Context, inst *Instance, data *T) error {
+	encoded, err := s.def.Codec.Encode(*data)
+	if err != nil {
+		return fmt.Errorf("failed to encode saga data: %w", err)
+	}
+	inst.Data = encoded
+
+	if s.def.Key != nil {
+		inst.Key = s.def.Key(*data)
+	}
+
+	expiresAt := time.Now().Add(s.o.lease)
+	inst.LeaseOwner, inst.LeaseExpiresAt = s.o.owner, &expiresAt
+	inst.UpdatedAt = time.Now()
+
+	if err = s.o.store.SaveSaga(ctx, inst); err != nil {
+		return fmt.Errorf("failed to save saga %s: %w", inst.ID, err)
+	}
+	return nil
+}
+
+type resumedKey struct{}
+
+// withResumed marks the context of a resumed saga.
+func withResumed(ctx context.Context) context.Context {
+	return context.WithValue(ctx, resumedKey{}, true)
+}
+
+// Resumed reports whether the step is run by a saga being recovered, in which case
+// the step may have been done before, at least partly.
+func Resumed(ctx context.Context) bool {
+	resumed, _ := ctx.Value(resumedKey{}).(bool)
+	return resumed
+}
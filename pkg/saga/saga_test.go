@@ -0,0 +1,401 @@
+package saga_test
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/vladyslavpavlenko/genesis-api-project/pkg/logger"
+	"github.com/vladyslavpavlenko/genesis-api-project/pkg/saga"
+)
+
+// memStore is an in-memory saga.Store.
+type memStore struct {
+	mu    sync.Mutex
+	sagas map[string]saga.Instance
+	logs  []saga.StepLog
+}
+
+func newMemStore() *memStore {
+	return &memStore{sagas: make(map[string]saga.Instance)}
+}
+
+func (m *memStore) SaveSaga(_ context.Context, s *saga.Instance) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if stored, ok := m.sagas[s.ID]; ok && stored.LeaseOwner != s.LeaseOwner {
+		return saga.ErrLeaseLost
+	}
+	m.sagas[s.ID] = *s
+	return nil
+}
+
+func (m *memStore) AddStepLog(_ context.Context, l *saga.StepLog) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.logs = append(m.logs, *l)
+	return nil
+}
+
+func (m *memStore) ExpiredSagas(_ context.Context, now time.Time, limit int) ([]string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var ids []string
+	for id, s := range m.sagas {
+		if m.expired(s, now) {
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)
+	return ids[:min(len(ids), limit)], nil
+}
+
+func (m *memStore) LeaseSaga(_ context.Context, id, owner string, now, expiresAt time.Time,
+) (*saga.Instance, bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	s, ok := m.sagas[id]
+	if !ok || !m.expired(s, now) {
+		return nil, false, nil
+	}
+	s.LeaseOwner, s.LeaseExpiresAt = owner, &expiresAt
+	m.sagas[id] = s
+	return &s, true, nil
+}
+
+func (m *memStore) GetSaga(_ context.Context, id string) (*saga.Instance, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	s, ok := m.sagas[id]
+	if !ok {
+		return nil, saga.ErrSagaNotFound
+	}
+	return &s, nil
+}
+
+func (m *memStore) ResolveSaga(_ context.Context, id, resolution string, now time.Time) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	s, ok := m.sagas[id]
+	if !ok || (s.Status != saga.StatusFailed && !m.expired(s, now)) {
+		return false, nil
+	}
+	s.Status, s.Resolution = saga.StatusResolved, resolution
+	m.sagas[id] = s
+	return true, nil
+}
+
+func (m *memStore) expired(s saga.Instance, now time.Time) bool {
+	return s.Status == saga.StatusInProgress && (s.LeaseExpiresAt == nil || s.LeaseExpiresAt.Before(now))
+}
+
+func (m *memStore) only(t *testing.T) saga.Instance {
+	t.Helper()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	require.Len(t, m.sagas, 1)
+	for _, s := range m.sagas {
+		return s
+	}
+	return saga.Instance{}
+}
+
+// expire expires the leases of the stored sagas, as if their Orchestrator was gone.
+func (m *memStore) expire() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for id, s := range m.sagas {
+		s.LeaseExpiresAt = nil
+		m.sagas[id] = s
+	}
+}
+
+type order struct {
+	Items    []string `json:"items"`
+	Reserved bool     `json:"reserved"`
+	Charged  bool     `json:"charged"`
+}
+
+var errOutOfStock = errors.New("out of stock")
+
+func TestSaga_Run(t *testing.T) {
+	store := newMemStore()
+	o := saga.NewOrchestrator(store, logger.New(false))
+
+	s, err := saga.Register(o, saga.Definition[order]{
+		Name: "order",
+		Steps: []saga.Step[order]{
+			{Name: "reserve", Action: func(_ context.Context, o *order) error {
+				o.Reserved = true
+				return nil
+			}},
+			{Name: "charge", Action: func(_ context.Context, o *order) error {
+				o.Charged = true
+				return nil
+			}},
+		},
+		Key: func(o order) string { return o.Items[0] },
+	})
+	require.NoError(t, err)
+
+	data := order{Items: []string{"book"}}
+	require.NoError(t, s.Run(context.Background(), &data))
+	assert.True(t, data.Reserved && data.Charged)
+
+	inst := store.only(t)
+	assert.Equal(t, "order", inst.Name)
+	assert.Equal(t, "book", inst.Key)
+	assert.Equal(t, saga.StatusCompleted, inst.Status)
+	assert.Equal(t, 2, inst.CurrentStep)
+	assert.JSONEq(t, `{"items":["book"],"reserved":true,"charged":true}`, inst.Data)
+
+	require.Len(t, store.logs, 2)
+	assert.Equal(t, "reserve", store.logs[0].Step)
+	assert.Equal(t, saga.PhaseAction, store.logs[0].Phase)
+	assert.JSONEq(t, `{"items":["book"],"reserved":false,"charged":false}`, store.logs[0].Input)
+	assert.JSONEq(t, `{"items":["book"],"reserved":true,"charged":false}`, store.logs[0].Output)
+	assert.Equal(t, "charge", store.logs[1].Step)
+	assert.Equal(t, 1, store.logs[1].StepIndex)
+
+	_, err = saga.Register(o, saga.Definition[order]{Name: "order", Steps: []saga.Step[order]{{Name: "noop",
+		Action: func(context.Context, *order) error { return nil }}}})
+	assert.ErrorIs(t, err, saga.ErrDuplicateSaga)
+}
+
+func TestSaga_Compensate(t *testing.T) {
+	store := newMemStore()
+	o := saga.NewOrchestrator(store, logger.New(false))
+
+	released := 0
+	s, err := saga.Register(o, saga.Definition[order]{
+		Name: "order",
+		Steps: []saga.Step[order]{
+			{
+				Name: "reserve",
+				Action: func(_ context.Context, o *order) error {
+					o.Reserved = true
+					return nil
+				},
+				Compensation: func(_ context.Context, o *order) error {
+					// Fails the first time
+					if released++; released == 1 {
+						return errors.New("unavailable")
+					}
+					o.Reserved = false
+					return nil
+				},
+			},
+			{
+				Name:         "charge",
+				Action:       func(context.Context, *order) error { return errOutOfStock },
+				Compensation: func(context.Context, *order) error { panic("the failed step is compensated") },
+			},
+		},
+		Backoff: saga.Backoff{Attempts: 2, Initial: time.Millisecond, Max: time.Millisecond},
+	})
+	require.NoError(t, err)
+
+	data := order{Items: []string{"book"}}
+	err = s.Run(context.Background(), &data)
+	require.ErrorIs(t, err, saga.ErrCompensated)
+	require.ErrorIs(t, err, errOutOfStock)
+
+	var compensated *saga.CompensatedError
+	require.ErrorAs(t, err, &compensated)
+	assert.Equal(t, errOutOfStock, compensated.Err)
+	assert.False(t, data.Reserved)
+
+	inst := store.only(t)
+	assert.Equal(t, saga.StatusFailed, inst.Status)
+	assert.True(t, inst.Compensating)
+	assert.Equal(t, errOutOfStock.Error(), inst.Error)
+
+	var steps []string
+	for _, l := range store.logs {
+		steps = append(steps, l.Step+"/"+l.Phase)
+	}
+	assert.Equal(t, []string{"reserve/action", "charge/action", "reserve/compensation", "reserve/compensation"},
+		steps)
+	assert.Equal(t, errOutOfStock.Error(), store.logs[1].Error)
+	assert.Empty(t, store.logs[1].Output)
+	assert.Equal(t, 2, store.logs[3].Attempt)
+}
+
+func TestSaga_Timeout(t *testing.T) {
+	store := newMemStore()
+	o := saga.NewOrchestrator(store, logger.New(false))
+
+	s, err := saga.Register(o, saga.Definition[order]{
+		Name: "order",
+		Steps: []saga.Step[order]{{
+			Name: "reserve",
+			Action: func(ctx context.Context, _ *order) error {
+				<-ctx.Done()
+				return ctx.Err()
+			},
+			Timeout: 10 * time.Millisecond,
+		}},
+	})
+	require.NoError(t, err)
+
+	err = s.Run(context.Background(), &order{})
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Equal(t, saga.StatusFailed, store.only(t).Status)
+	require.Len(t, store.logs, 1)
+	assert.GreaterOrEqual(t, store.logs[0].Duration, 10*time.Millisecond)
+}
+
+func TestSaga_LeaseLost(t *testing.T) {
+	store := newMemStore()
+	o := saga.NewOrchestrator(store, logger.New(false))
+
+	s, err := saga.Register(o, saga.Definition[order]{
+		Name: "order",
+		Steps: []saga.Step[order]{
+			{Name: "reserve", Action: func(context.Context, *order) error {
+				// Taken over while the step is running
+				store.mu.Lock()
+				defer store.mu.Unlock()
+				for id, s := range store.sagas {
+					s.LeaseOwner = "other"
+					store.sagas[id] = s
+				}
+				return nil
+			}},
+			{Name: "charge", Action: func(context.Context, *order) error { panic("the saga is run twice") }},
+		},
+	})
+	require.NoError(t, err)
+
+	assert.ErrorIs(t, s.Run(context.Background(), &order{}), saga.ErrLeaseLost)
+	assert.Equal(t, 0, store.only(t).CurrentStep)
+}
+
+func TestOrchestrator_RecoverSagas(t *testing.T) {
+	store := newMemStore()
+	o := saga.NewOrchestrator(store, logger.New(false))
+
+	var resumed []bool
+	_, err := saga.Register(o, saga.Definition[order]{
+		Name: "order",
+		Steps: []saga.Step[order]{
+			{Name: "reserve", Action: func(context.Context, *order) error { panic("the step is done already") }},
+			{Name: "charge", Action: func(ctx context.Context, o *order) error {
+				resumed = append(resumed, saga.Resumed(ctx))
+				o.Charged = true
+				return nil
+			}},
+			{Name: "ship", Action: func(ctx context.Context, _ *order) error {
+				resumed = append(resumed, saga.Resumed(ctx))
+				return nil
+			}},
+		},
+	})
+	require.NoError(t, err)
+
+	// Interrupted after the first step, and still leased by its Orchestrator
+	expiresAt := time.Now().Add(time.Hour)
+	require.NoError(t, store.SaveSaga(context.Background(), &saga.Instance{
+		ID:             "interrupted",
+		Name:           "order",
+		CurrentStep:    1,
+		Status:         saga.StatusInProgress,
+		Data:           `{"items":["book"],"reserved":true}`,
+		LeaseOwner:     "gone",
+		LeaseExpiresAt: &expiresAt,
+	}))
+
+	recovered, err := o.RecoverSagas()
+	require.NoError(t, err)
+	assert.Zero(t, recovered)
+
+	store.expire()
+	recovered, err = o.RecoverSagas()
+	require.NoError(t, err)
+	assert.Equal(t, 1, recovered)
+	// Only the step that was interrupted is told so
+	assert.Equal(t, []bool{true, false}, resumed)
+
+	inst := store.only(t)
+	assert.Equal(t, saga.StatusCompleted, inst.Status)
+	assert.JSONEq(t, `{"items":["book"],"reserved":true,"charged":true}`, inst.Data)
+
+	recovered, err = o.RecoverSagas()
+	require.NoError(t, err)
+	assert.Zero(t, recovered)
+}
+
+func TestOrchestrator_Interventions(t *testing.T) {
+	store := newMemStore()
+	o := saga.NewOrchestrator(store, logger.New(false))
+
+	var released int
+	release := func(context.Context, *order) error {
+		released++
+		return nil
+	}
+	_, err := saga.Register(o, saga.Definition[order]{
+		Name: "order",
+		Steps: []saga.Step[order]{
+			{
+				Name:         "reserve",
+				Action:       func(context.Context, *order) error { panic("the step is done already") },
+				Compensation: release,
+			},
+			{
+				Name:         "charge",
+				Action:       func(context.Context, *order) error { return nil },
+				Compensation: release,
+			},
+		},
+	})
+	require.NoError(t, err)
+
+	add := func(id string, leased bool) {
+		inst := &saga.Instance{ID: id, Name: "order", CurrentStep: 1, Status: saga.StatusInProgress, Data: `{}`}
+		if leased {
+			expiresAt := time.Now().Add(time.Hour)
+			inst.LeaseOwner, inst.LeaseExpiresAt = "other", &expiresAt
+		}
+		require.NoError(t, store.SaveSaga(context.Background(), inst))
+	}
+	ctx := context.Background()
+
+	assert.ErrorIs(t, o.Retry(ctx, "missing"), saga.ErrSagaNotFound)
+
+	add("leased", true)
+	assert.ErrorIs(t, o.Retry(ctx, "leased"), saga.ErrSagaLeased)
+	assert.ErrorIs(t, o.Compensate(ctx, "leased", "stuck"), saga.ErrSagaLeased)
+	assert.ErrorIs(t, o.Resolve(ctx, "leased", "fixed"), saga.ErrSagaLeased)
+
+	add("retried", false)
+	require.NoError(t, o.Retry(ctx, "retried"))
+	assert.Equal(t, saga.StatusCompleted, store.sagas["retried"].Status)
+	assert.ErrorIs(t, o.Retry(ctx, "retried"), saga.ErrInvalidStatus)
+
+	// The current step is compensated as well
+	add("compensated", false)
+	err = o.Compensate(ctx, "compensated", "stuck")
+	assert.ErrorIs(t, err, saga.ErrCompensated)
+	assert.EqualError(t, errors.Unwrap(err), "stuck")
+	assert.Equal(t, 2, released)
+	assert.Equal(t, saga.StatusFailed, store.sagas["compensated"].Status)
+
+	require.NoError(t, o.Resolve(ctx, "compensated", "refunded by hand"))
+	assert.Equal(t, saga.StatusResolved, store.sagas["compensated"].Status)
+	assert.Equal(t, "refunded by hand", store.sagas["compensated"].Resolution)
+	assert.ErrorIs(t, o.Resolve(ctx, "compensated", "again"), saga.ErrInvalidStatus)
+}